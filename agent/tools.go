@@ -1,21 +0,0 @@
-package agent
-
-import "fmt"
-
-func searchDocs(args map[string]interface{}) (interface{}, error) {
-	query, ok := args["query"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid query argument")
-	}
-	// TODO: Implement actual documentation search
-	return fmt.Sprintf("Search results for: %s", query), nil
-}
-
-func getFileContent(args map[string]interface{}) (interface{}, error) {
-	path, ok := args["path"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid path argument")
-	}
-	// TODO: Implement actual file reading
-	return fmt.Sprintf("Content of file: %s", path), nil
-}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// maxWordDiffCells bounds the LCS table of a word diff; longer answers are
+// compared line by line.
+const maxWordDiffCells = 4_000_000
+
+func init() {
+	registerCommand(command{
+		name:  "ab",
+		usage: "<model>",
+		help:  "Answer the last message with another model and compare the two replies",
+		run: func(ctx context.Context, a *Agent, name string) error {
+			if name == "" {
+				return fmt.Errorf("usage: /ab <model>")
+			}
+			return a.compareModels(ctx, name)
+		},
+	})
+}
+
+// compareModels implements /ab: the prompt that produced the first reply to
+// the last user message is sent to another model, and the two replies are
+// shown as a word diff with their statistics. The conversation is not
+// changed and tool calls in the other reply are not run.
+func (a *Agent) compareModels(ctx context.Context, name string) error {
+	i := a.lastUserMessage()
+	if i < 0 || i+1 >= len(a.history) || a.history[i+1].Role != "assistant" {
+		return fmt.Errorf("there is no reply to compare; send a message first")
+	}
+	name, err := a.installedModel(name)
+	if err != nil {
+		return err
+	}
+	original := a.history[i+1]
+	if original.Model == name {
+		return fmt.Errorf("the last reply already came from %s", name)
+	}
+
+	// Work on a copy so the model settings and history of the chat are kept.
+	other := *a
+	other.history = a.history[:i+1]
+	if err := other.useModel(ctx, name); err != nil {
+		return err
+	}
+	fmt.Printf(colorYellow+"AI (%s)"+colorReset+": ", name)
+	waiting := startSpinner(name)
+	reply, stats, err := other.inferOnce(ctx, func(part string) {
+		waiting.stop()
+		fmt.Print(part)
+	})
+	waiting.stop()
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	if a.usage != nil {
+		if _, err := a.usage.Record(usageProvider(), stats.PromptTokens+stats.TokenCount); err != nil {
+			slog.Warn(err.Error())
+		}
+	}
+
+	originalModel := original.Model
+	if originalModel == "" {
+		originalModel = "previous reply"
+	}
+	fmt.Printf("\n"+colorCyan+"Diff"+colorReset+" ("+colorRed+"[-%s-]"+colorReset+" "+colorGreen+"{+%s+}"+colorReset+"):\n", originalModel, name)
+	fmt.Println(wordDiff(original.Content, reply))
+	fmt.Println()
+	if turn, ok := a.turnFor(original); ok {
+		fmt.Printf("%-24s %d tokens in %.2fs, TTFT %.2fs, %.2f tokens/s\n", originalModel+":", turn.OutputTokens, turn.DurationSeconds, turn.TTFTSeconds, turn.TokensPerSecond)
+	} else {
+		fmt.Printf("%-24s %d tokens (timing not recorded)\n", originalModel+":", original.Tokens)
+	}
+	fmt.Printf("%-24s %d tokens in %.2fs, TTFT %.2fs, %.2f tokens/s\n", name+":", stats.TokenCount, stats.Elapsed().Seconds(), stats.TimeToFirstToken().Seconds(), stats.TokensPerSecond())
+	if calls := tools.ExtractCalls(reply, other.toolGrammar); len(calls) > 0 {
+		fmt.Printf("(%s asked for %d tool calls, which were not run)\n", name, len(calls))
+	}
+	return nil
+}
+
+// turnFor finds the recorded statistics of an assistant message: the last
+// inference by its model that started before the message was added.
+func (a *Agent) turnFor(msg Message) (turnReport, bool) {
+	for i := len(a.turns) - 1; i >= 0; i-- {
+		turn := a.turns[i]
+		if turn.Model == msg.Model && !turn.Time.After(msg.Time) {
+			return turn, true
+		}
+	}
+	return turnReport{}, false
+}
+
+// wordDiff marks the words removed from a with [-...-] and the words added
+// in b with {+...+}, in colour, like git diff --word-diff.
+func wordDiff(a, b string) string {
+	sep := " "
+	x, y := strings.Fields(a), strings.Fields(b)
+	if len(x)*len(y) > maxWordDiffCells {
+		sep = "\n"
+		x, y = strings.Split(a, "\n"), strings.Split(b, "\n")
+	}
+
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var parts []string
+	var removed, added []string
+	flush := func() {
+		if len(removed) > 0 {
+			parts = append(parts, colorRed+"[-"+strings.Join(removed, sep)+"-]"+colorReset)
+		}
+		if len(added) > 0 {
+			parts = append(parts, colorGreen+"{+"+strings.Join(added, sep)+"+}"+colorReset)
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			flush()
+			parts = append(parts, x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, x[i])
+			i++
+		default:
+			added = append(added, y[j])
+			j++
+		}
+	}
+	flush()
+	return strings.Join(parts, sep)
+}
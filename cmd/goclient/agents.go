@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+	"gopkg.in/yaml.v3"
+)
+
+// AgentType is an agent selected with -agent: a system prompt with optional
+// defaults for the model, the tools it may call and the temperature.
+type AgentType struct {
+	Name        string         `yaml:"name"` // defaults to the file name
+	Description string         `yaml:"description"`
+	System      string         `yaml:"system"`
+	Model       string         `yaml:"model"`       // used when -model is not given
+	Tools       []string       `yaml:"tools"`       // tools the agent may call; all if unset
+	Temperature *float64       `yaml:"temperature"` // Ollama's default if unset
+	Examples    []AgentExample `yaml:"examples"`    // example exchanges shown before the conversation
+	source      string
+}
+
+// AgentExample is one message of an agent's example exchanges: a user
+// message, an assistant reply, which may call a tool, or a tool result.
+type AgentExample struct {
+	Role    string `yaml:"role"` // user, assistant or tool
+	Tool    string `yaml:"tool"` // tool name for role tool
+	Content string `yaml:"content"`
+}
+
+// builtinAgentTypes are available without any agent files.
+var builtinAgentTypes = []AgentType{
+	{Name: "default", Description: "General assistant", System: "You are a helpful AI assistant."},
+	{Name: "code", Description: "Go programming", System: "You are an expert Go programmer. Provide clear and concise code examples."},
+	{Name: "explain", Description: "Explains technical concepts", System: "You are a technical expert. Explain concepts clearly and thoroughly."},
+}
+
+// agentTypes holds the built-in agent types and those loaded by
+// loadAgentTypes, by name.
+var agentTypes = map[string]AgentType{}
+
+func init() {
+	for _, t := range builtinAgentTypes {
+		t.source = "built-in"
+		agentTypes[t.Name] = t
+	}
+}
+
+// agentDirs returns the directories agent files are loaded from, in order:
+// ~/.config/goclient/agents, then .goclient/agents in the working directory,
+// whose definitions replace user ones of the same name.
+func agentDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "goclient", "agents"))
+	}
+	return append(dirs, filepath.Join(tools.StateDir, "agents"))
+}
+
+// loadAgentTypes adds the agent types defined in *.yaml files of the agent
+// directories to agentTypes.
+func loadAgentTypes() error {
+	for _, dir := range agentDirs() {
+		var files []string
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return err
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			t, err := readAgentType(file)
+			if err != nil {
+				return err
+			}
+			agentTypes[t.Name] = t
+		}
+	}
+	return nil
+}
+
+func readAgentType(file string) (AgentType, error) {
+	var t AgentType
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return t, fmt.Errorf("failed to read agent file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("failed to parse agent file %s: %v", file, err)
+	}
+	if t.Name == "" {
+		t.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if strings.TrimSpace(t.System) == "" {
+		return t, fmt.Errorf("agent %s in %s has no system prompt", t.Name, file)
+	}
+	if t.Temperature != nil && *t.Temperature < 0 {
+		return t, fmt.Errorf("agent %s in %s has a negative temperature", t.Name, file)
+	}
+	for i, example := range t.Examples {
+		switch example.Role {
+		case "user", "assistant":
+		case "tool":
+			if example.Tool == "" {
+				return t, fmt.Errorf("agent %s in %s: example %d is a tool result without a tool name", t.Name, file, i+1)
+			}
+		default:
+			return t, fmt.Errorf("agent %s in %s: example %d has role %q; want user, assistant or tool", t.Name, file, i+1, example.Role)
+		}
+	}
+	t.source = file
+	return t, nil
+}
+
+// lookupAgentType returns the agent type with the given name.
+func lookupAgentType(name string) (AgentType, error) {
+	t, ok := agentTypes[name]
+	if !ok {
+		return t, fmt.Errorf("unknown agent %q; 'goclient -agent list' shows the available agents", name)
+	}
+	return t, nil
+}
+
+// toolSet returns the tools an agent of this type may call, or nil for all
+// tools.
+func (t AgentType) toolSet() (map[string]bool, error) {
+	if t.Tools == nil {
+		return nil, nil
+	}
+	allowed := map[string]bool{}
+	for _, name := range t.Tools {
+		if _, ok := tools.LookupTool(name); !ok {
+			return nil, fmt.Errorf("agent %s: %w: %s", t.Name, tools.ErrToolNotFound, name)
+		}
+		allowed[name] = true
+	}
+	return allowed, nil
+}
+
+// exampleMessages returns the agent's example exchanges as messages.
+func (t AgentType) exampleMessages() []Message {
+	var messages []Message
+	for _, example := range t.Examples {
+		messages = append(messages, Message{Role: example.Role, Tool: example.Tool, Content: strings.TrimSpace(example.Content)})
+	}
+	return messages
+}
+
+// listAgentTypes prints the available agent types for -agent list.
+func listAgentTypes() {
+	var names []string
+	for name := range agentTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := agentTypes[name]
+		var details []string
+		if t.Model != "" {
+			details = append(details, "model "+t.Model)
+		}
+		if t.Tools != nil {
+			details = append(details, fmt.Sprintf("tools: %s", strings.Join(t.Tools, ", ")))
+		}
+		if t.Temperature != nil {
+			details = append(details, fmt.Sprintf("temperature %g", *t.Temperature))
+		}
+		if len(t.Examples) > 0 {
+			details = append(details, fmt.Sprintf("%d example messages", len(t.Examples)))
+		}
+		description := t.Description
+		if len(details) > 0 {
+			description = strings.TrimSpace(description + " (" + strings.Join(details, "; ") + ")")
+		}
+		fmt.Printf("%-12s %s\n", name, description)
+		fmt.Printf("%-12s "+colorGray+"%s"+colorReset+"\n", "", t.source)
+	}
+}
+
+// agentOptions configures a pkg/agent Agent, as used by serve and -stdio,
+// like the chat's agent of the named type: its system prompt with the
+// config's and extra instructions, its tools, the model's tool-call format,
+// the generation options, the model's context limit and compaction, and
+// taint tracking when the config turns it on. history is the conversation
+// to continue.
+func agentOptions(cfg *Config, agentName, model, extra string, history []Message) ([]agent.Option, error) {
+	agentType, err := lookupAgentType(agentName)
+	if err != nil {
+		return nil, err
+	}
+	system := agentType.System
+	if cfg.System != "" {
+		system += "\n\n" + cfg.System
+	}
+	if extra != "" {
+		system += "\n\n" + extra
+	}
+	if system, err = expandPrompt("the system prompt of agent "+agentType.Name, system); err != nil {
+		return nil, err
+	}
+	grammar := tools.GrammarText
+	if format := cfg.toolFormat(model); format != "" {
+		if grammar, err = tools.ParseToolGrammar(format); err != nil {
+			return nil, err
+		}
+	}
+	options := map[string]interface{}{"stop": cfg.stopSequences(model)}
+	for key, value := range cfg.Options {
+		options[key] = value
+	}
+	if n := cfg.numCtx(model); n > 0 {
+		options["num_ctx"] = n
+	}
+	if agentType.Temperature != nil {
+		options["temperature"] = *agentType.Temperature
+	}
+	var modelMax int
+	if cfg.numCtx(model) == 0 {
+		if modelMax, err = fetchContextLength(provider.NewClient(30*time.Second), model); err != nil {
+			slog.Warn(fmt.Sprintf("%v. Assuming a %d token context.", err, defaultNumCtx))
+		}
+	}
+	opts := []agent.Option{
+		agent.WithModel(model),
+		agent.WithSystemPrompt(system),
+		agent.WithGrammar(grammar),
+		agent.WithOptions(options),
+		agent.WithContextLimit(contextLimit(cfg.numCtx(model), modelMax)),
+		agent.WithCompaction(cfg.Compact.Threshold, cfg.Compact.KeepTurns),
+		agent.WithHistory(history),
+	}
+	if cfg.Security != nil && cfg.Security.Taint {
+		taint, err := newTaintTracker(cfg)
+		if err != nil {
+			return nil, err
+		}
+		taint.rebuild(history)
+		opts = append(opts, agent.WithHooks(taint.hooks()), agent.WithUntrustedTools(taint.tools()...))
+	}
+	if agentType.Tools != nil {
+		var allowed []tools.Tool
+		for _, name := range agentType.Tools {
+			tool, ok := tools.LookupTool(name)
+			if !ok {
+				return nil, fmt.Errorf("agent %s: %w: %s", agentType.Name, tools.ErrToolNotFound, name)
+			}
+			allowed = append(allowed, tool)
+		}
+		opts = append(opts, agent.WithTools(allowed...))
+	}
+	return opts, nil
+}
+
+// approvalHook returns a hook that asks ask to approve each call of a tool
+// that needsApproval, with the action to show, and refuses the call unless
+// it is approved.
+func approvalHook(ask func(ctx context.Context, call tools.Call, action string) bool) agent.Hooks {
+	return agent.Hooks{BeforeToolCall: func(ctx context.Context, call *tools.Call) error {
+		if !needsApproval(call.Name) {
+			return nil
+		}
+		args, _ := json.Marshal(call.Args)
+		if !ask(ctx, *call, fmt.Sprintf("Run %s(%s)?", call.Name, args)) {
+			return fmt.Errorf("%w: %s was not run", tools.ErrNotApproved, call.Name)
+		}
+		return nil
+	}}
+}
+
+// needsApproval reports whether a call of the named tool must be approved
+// before it runs: every tool but the read-only ones and those, such as
+// edit_file and command tools, that ask for approval themselves through the
+// agent's approver.
+func needsApproval(name string) bool {
+	tool, ok := tools.LookupTool(name)
+	return !ok || !(tools.ReadOnly(tool) || tools.AsksApproval(tool))
+}
+
+// isReadOnly reports whether the named tool is registered and only reads
+// the workspace.
+func isReadOnly(name string) bool {
+	tool, ok := tools.LookupTool(name)
+	return ok && tools.ReadOnly(tool)
+}
+
+// readOnlyTools returns the names of the registered read-only tools.
+func readOnlyTools() []string {
+	var names []string
+	for _, tool := range tools.Tools() {
+		if tools.ReadOnly(tool) {
+			names = append(names, tool.Name())
+		}
+	}
+	return names
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+const batchUsage = `Usage: goclient batch -prompt-template file -glob pattern [flags]
+
+Runs the same prompt against many files, several at a time, and writes the
+answer for each file under -out, at the file's path with -ext appended. The
+prompt template is a Go text/template that sees {{.path}}, {{.name}},
+{{.content}} and the usual prompt variables. The model may call the tools
+that only read the workspace. The exit status is 1 if any file failed.
+
+Example:
+  goclient batch -agent code -prompt-template review.tmpl -glob 'pkg/**/*.go' -concurrency 4
+
+Flags:`
+
+// maxBatchFileSize is the largest file included in a batch prompt.
+const maxBatchFileSize = 256 << 10
+
+// batchResult is the outcome for one file.
+type batchResult struct {
+	path    string
+	output  string // where the answer was written
+	tokens  int
+	elapsed time.Duration
+	err     error
+}
+
+// runBatchCommand implements `goclient batch` and returns the exit code.
+func runBatchCommand(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, batchUsage)
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "", "Name of the Ollama model to use. If empty, you will be prompted to select.")
+	agentType := fs.String("agent", "code", "Agent type whose system prompt and examples are used.")
+	templatePath := fs.String("prompt-template", "", "File with the prompt template run for each file.")
+	var globs []string
+	fs.Func("glob", "Files to process, relative to the working directory; ** matches any number of directories. May be repeated.", func(value string) error {
+		globs = append(globs, value)
+		return nil
+	})
+	concurrency := fs.Int("concurrency", 2, "Number of files processed at once.")
+	outDir := fs.String("out", "batch-output", "Directory the answers are written to.")
+	ext := fs.String("ext", ".md", "Extension appended to each file's path to name its answer.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+	fs.Var(varFlag{}, "var", "Set a prompt template variable, as key=value; may be repeated.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *templatePath == "" || len(globs) == 0 || *concurrency < 1 {
+		fs.Usage()
+		return 2
+	}
+	text, err := os.ReadFile(*templatePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read the prompt template: %v\n", err)
+		return 2
+	}
+	tmpl, err := template.New(filepath.Base(*templatePath)).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid template in %s: %v\n", *templatePath, err)
+		return 2
+	}
+	files, err := batchFiles(globs, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no files match %s\n", strings.Join(globs, ", "))
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if err := applyConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if _, ok := agentTypes[*agentType]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown agent type %q\n", *agentType)
+		return 2
+	}
+	if *model == "" {
+		input := newLineInput()
+		*model, err = selectOllamaModel(provider.NewClient(30*time.Second), input.line)
+		input.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting Ollama model: %v\n", err)
+			return 1
+		}
+	}
+	// Only the summary and the progress line are shown; files are processed
+	// at once, so nothing can ask for approval.
+	quiet = true
+	tools.OnProgress = progress.show
+	tools.Approve = func(action string) bool { return false }
+
+	b := &batch{
+		model:    *model,
+		agent:    *agentType,
+		config:   cfg,
+		template: tmpl,
+		outDir:   *outDir,
+		ext:      *ext,
+	}
+	usage, err := loadUsageLedger(cfg.Budgets)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("%v. Usage will not be tracked.", err))
+	}
+	b.usage = usage
+	ctx := handleSignals(context.Background())
+	start := time.Now()
+	results := b.run(ctx, files, *concurrency)
+	progress.clear()
+	return printBatchSummary(results, time.Since(start), ctx.Err() != nil)
+}
+
+// batch runs one prompt template over many files.
+type batch struct {
+	model    string
+	agent    string
+	config   *Config
+	template *template.Template
+	outDir   string
+	ext      string
+	usage    *UsageLedger
+}
+
+// run processes files with up to concurrency at once and returns the
+// results in the order of files.
+func (b *batch) run(ctx context.Context, files []string, concurrency int) []batchResult {
+	results := make([]batchResult, len(files))
+	next := make(chan int)
+	var mu sync.Mutex
+	done := 0
+	report := func(current string) {
+		tools.OnProgress(tools.Progress{Task: "batch " + b.model, Done: done, Total: len(files), Current: current})
+	}
+	report("")
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = b.process(ctx, files[i])
+				mu.Lock()
+				done++
+				report(files[i])
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		if ctx.Err() != nil {
+			results[i] = batchResult{path: files[i], err: ctx.Err()}
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// process answers the prompt for one file and writes the answer.
+func (b *batch) process(ctx context.Context, path string) (result batchResult) {
+	result.path = path
+	start := time.Now()
+	defer func() { result.elapsed = time.Since(start) }()
+	prompt, err := b.prompt(path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	a, err := b.newAgent(ctx)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	answer, err := a.runSubAgent(ctx, prompt, nil)
+	for _, msg := range a.history {
+		result.tokens += msg.Tokens
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.output = filepath.Join(b.outDir, path+b.ext)
+	if err := os.MkdirAll(filepath.Dir(result.output), 0755); err != nil {
+		result.err = fmt.Errorf("failed to create %s: %v", filepath.Dir(result.output), err)
+		return result
+	}
+	if err := os.WriteFile(result.output, []byte(answer+"\n"), 0644); err != nil {
+		result.err = fmt.Errorf("failed to write %s: %v", result.output, err)
+	}
+	return result
+}
+
+// prompt renders the template for a file.
+func (b *batch) prompt(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxBatchFileSize {
+		return "", fmt.Errorf("%s is larger than %d KB", path, maxBatchFileSize>>10)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	vars := map[string]string{}
+	for key, value := range templateVars() {
+		vars[key] = value
+	}
+	vars["path"] = filepath.ToSlash(path)
+	vars["name"] = filepath.Base(path)
+	vars["content"] = string(content)
+	var out strings.Builder
+	if err := b.template.Execute(&out, vars); err != nil {
+		return "", fmt.Errorf("%v (set variables with -var key=value)", err)
+	}
+	return out.String(), nil
+}
+
+// newAgent builds the agent for one file: the agent type's system prompt
+// and examples, with the read-only tools it may call.
+func (b *batch) newAgent(ctx context.Context) (*Agent, error) {
+	system, err := expandPrompt("the system prompt", getSystemPrompt(b.agent))
+	if err != nil {
+		return nil, err
+	}
+	a := NewAgent(withModel(b.model), withSystemPrompt(system), withMaxIterations(agent.DefaultMaxIterations))
+	a.config = b.config
+	a.usage = b.usage
+	a.httpClient.Timeout = 10 * time.Minute
+	t := agentTypes[b.agent]
+	a.examples = t.exampleMessages()
+	a.tools = map[string]bool{}
+	for _, name := range readOnlyTools() {
+		if len(t.Tools) == 0 || containsString(t.Tools, name) {
+			a.tools[name] = true
+		}
+	}
+	if err := a.useModel(ctx, b.model); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// batchFiles returns the regular files under the working directory that
+// match any of the globs, sorted. Version control, vendored and state
+// directories and the output directory are skipped.
+func batchFiles(globs []string, outDir string) ([]string, error) {
+	outDir = filepath.Clean(outDir)
+	var files []string
+	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != "." && (skippedBatchDirs[d.Name()] || path == outDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		slash := filepath.ToSlash(path)
+		for _, glob := range globs {
+			if matchPathGlob(strings.Split(strings.TrimPrefix(glob, "./"), "/"), strings.Split(slash, "/")) {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %v", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+var skippedBatchDirs = map[string]bool{".git": true, "vendor": true, "node_modules": true, ".goclient": true}
+
+// matchPathGlob matches a path against a glob, both split at slashes. A **
+// element matches any number of path elements, and the others match one
+// element as in filepath.Match.
+func matchPathGlob(glob, path []string) bool {
+	if len(glob) == 0 {
+		return len(path) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPathGlob(glob[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(glob[0], path[0]); !ok {
+		return false
+	}
+	return matchPathGlob(glob[1:], path[1:])
+}
+
+// printBatchSummary reports how the batch went and returns the exit code.
+func printBatchSummary(results []batchResult, elapsed time.Duration, interrupted bool) int {
+	var failed []batchResult
+	tokens := 0
+	for _, r := range results {
+		tokens += r.tokens
+		if r.err != nil {
+			failed = append(failed, r)
+		}
+	}
+	fmt.Printf("Processed %d files in %s: %d written, %d failed, %d output tokens\n",
+		len(results), elapsed.Round(time.Second), len(results)-len(failed), len(failed), tokens)
+	for _, r := range results {
+		if r.err == nil {
+			fmt.Printf("  %s -> %s (%.1fs)\n", r.path, r.output, r.elapsed.Seconds())
+		}
+	}
+	for _, r := range failed {
+		fmt.Printf(colorRed+"  %s: %v"+colorReset+"\n", r.path, r.err)
+	}
+	switch {
+	case interrupted:
+		return exitInterrupted
+	case len(failed) > 0:
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// useCassette starts recording the session's Ollama traffic to record, or
+// replaying it from replay.
+func useCassette(record, replay string) error {
+	var err error
+	switch {
+	case record != "" && replay != "":
+		return fmt.Errorf("-record and -replay cannot be used together")
+	case record != "":
+		provider.ActiveCassette, err = provider.RecordCassette(record)
+	case replay != "":
+		provider.ActiveCassette, err = provider.ReplayCassette(replay)
+	}
+	return err
+}
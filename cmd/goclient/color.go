@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+
+	"github.com/charmbracelet/x/term"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// ANSI colours used in the terminal output. They are all empty when colour
+// is disabled.
+var (
+	colorReset       = "\u001b[0m"
+	colorRed         = "\u001b[31m"
+	colorGreen       = "\u001b[32m"
+	colorGray        = "\u001b[90m"
+	colorBrightRed   = "\u001b[91m"
+	colorBrightGreen = "\u001b[92m"
+	colorYellow      = "\u001b[93m"
+	colorBlue        = "\u001b[94m"
+	colorCyan        = "\u001b[96m"
+)
+
+// disableColor turns off colours and other escape sequences, for NO_COLOR
+// and for output that is not a terminal.
+func disableColor() {
+	colorReset, colorRed, colorGreen, colorGray = "", "", "", ""
+	colorBrightRed, colorBrightGreen, colorYellow, colorBlue, colorCyan = "", "", "", "", ""
+	tools.Color = false
+	progress.disabled = true
+}
+
+// useColor reports whether output to f should be coloured: f is a terminal
+// and NO_COLOR is not set.
+func useColor(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(f)
+}
+
+// isTerminal reports whether f is a terminal. Other character devices,
+// such as /dev/null in CI jobs, are not.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
+
+// setupOutput separates the model's answers from everything else: when
+// stdout is not a terminal, or in one-shot mode, os.Stdout is pointed at
+// stderr so that banners, prompts, statistics and tool output go there, and
+// the returned writer, the original stdout, receives only the answers.
+// Colour is disabled when NO_COLOR is set or the remaining output is not a
+// terminal.
+func setupOutput(oneShot bool) *os.File {
+	answers := os.Stdout
+	if oneShot || !isTerminal(os.Stdout) {
+		os.Stdout = os.Stderr
+	}
+	if !useColor(os.Stdout) {
+		disableColor()
+	}
+	return answers
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// command is a REPL command typed as "/name arguments".
+type command struct {
+	name    string
+	usage   string // arguments shown by /help, e.g. "[name]"
+	help    string
+	aliases []string
+	run     func(ctx context.Context, a *Agent, arg string) error
+}
+
+// errQuit is returned by a command to end the chat.
+var errQuit = errors.New("quit")
+
+// commands maps command names and aliases, without the slash, to commands.
+var commands = map[string]*command{}
+
+// registerCommand adds a slash command, replacing any command with the same
+// name or alias. Features register their commands from init functions.
+func registerCommand(cmd command) {
+	commands[cmd.name] = &cmd
+	for _, alias := range cmd.aliases {
+		commands[alias] = &cmd
+	}
+}
+
+// isCommand reports whether a line of user input is a slash command.
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), "/") && !isDroppedFile(input)
+}
+
+// runCommand runs a slash command and reports its error. It returns errQuit
+// when the chat should end and errRetry when the last message should be
+// answered again.
+func (a *Agent) runCommand(ctx context.Context, input string) error {
+	name, arg, _ := strings.Cut(strings.TrimSpace(input), " ")
+	cmd, ok := commands[strings.TrimPrefix(name, "/")]
+	if !ok {
+		fmt.Printf("Unknown command %s. Type /help to list the commands.\n", name)
+		return nil
+	}
+	err := cmd.run(ctx, a, strings.TrimSpace(arg))
+	if err != nil && err != errQuit && err != errRetry {
+		fmt.Printf("Error: %v\n", err)
+		return nil
+	}
+	return err
+}
+
+func init() {
+	registerCommand(command{
+		name: "help",
+		help: "List the commands",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			printCommandHelp()
+			return nil
+		},
+	})
+	registerCommand(command{
+		name:    "quit",
+		help:    "End the chat",
+		aliases: []string{"exit"},
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			return errQuit
+		},
+	})
+	registerCommand(command{
+		name: "reset",
+		help: "Start a new conversation; pinned files are kept",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			a.history, a.memories, a.retrieved = nil, "", ""
+			tools.ClearCheckpoints()
+			if a.taint != nil {
+				a.taint.rebuild(nil)
+			}
+			fmt.Println("Conversation cleared.")
+			if a.sessionName != "" {
+				// Keep the saved session instead of overwriting it with the new conversation.
+				fmt.Printf("No longer saving to session %q; use /save to start a new one.\n", a.sessionName)
+				a.sessionName = ""
+			}
+			return nil
+		},
+	})
+	registerCommand(command{
+		name: "tools",
+		help: "List the tools available to the model",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			for _, tool := range tools.Tools() {
+				fmt.Printf("  %-16s %s\n", tool.Name(), tools.Synopsis(tool))
+			}
+			return nil
+		},
+	})
+	registerCommand(command{
+		name:  "system",
+		usage: "[instructions]",
+		help:  "Show the system prompt, or replace its instructions (tools and pinned files are kept)",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			if arg == "" {
+				fmt.Println(a.system())
+				return nil
+			}
+			a.systemPrompt = arg + strings.TrimPrefix(a.systemPrompt, a.instructions)
+			a.instructions = arg
+			fmt.Println("System instructions updated.")
+			return nil
+		},
+	})
+	registerCommand(command{
+		name: "status",
+		help: "Show the model, the models loaded in Ollama and token usage",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			a.printStatus(ctx)
+			return nil
+		},
+	})
+	registerCommand(command{
+		name:  "index",
+		usage: "[update|rebuild]",
+		help:  "Show the semantic search index, or update or rebuild it",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			return handleIndexCommand(ctx, arg)
+		},
+	})
+}
+
+// printCommandHelp lists the registered commands by name.
+func printCommandHelp() {
+	var names []string
+	for name, cmd := range commands {
+		if name == cmd.name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		usage := "/" + name
+		if cmd.usage != "" {
+			usage += " " + cmd.usage
+		}
+		help := cmd.help
+		if len(cmd.aliases) > 0 {
+			help += " (also /" + strings.Join(cmd.aliases, ", /") + ")"
+		}
+		fmt.Printf("  %-24s %s\n", usage, help)
+	}
+}
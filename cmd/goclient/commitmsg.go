@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+const commitMsgUsage = `Usage: goclient commit-msg [flags] [message-file [source [sha]]]
+
+Writes a conventional-commit message for the staged changes (git diff
+--cached). The message is shown for approval: accept it, edit it in git's
+editor or ask for another. Once accepted it is printed, or committed with
+-commit.
+
+Given a message file, as git passes to a prepare-commit-msg hook, the message
+is written to the top of the file without asking, and git's editor shows it
+as usual. Nothing is written when git already has a message (-m, -F, merges,
+squashes, amends and templates), and errors never stop the commit. To install
+the hook:
+
+  printf '#!/bin/sh\nexec goclient commit-msg "$@"\n' > .git/hooks/prepare-commit-msg
+  chmod +x .git/hooks/prepare-commit-msg
+
+Flags:`
+
+const commitMsgSystemPrompt = `You write git commit messages in the Conventional Commits format:
+a subject line "type(scope): summary" where type is one of feat, fix, docs, style, refactor,
+perf, test, build, ci or chore, the scope is optional, and the summary is imperative, lower
+case and at most 72 characters without a trailing period. If the change needs explaining,
+add a blank line and a body wrapped at 72 characters that says what changed and why.
+Add "BREAKING CHANGE: ..." in a footer only for incompatible changes.
+Reply with the commit message only, without quotes, code fences or commentary.`
+
+// defaultMaxDiff bounds the diff sent to the model, in bytes.
+const defaultMaxDiff = 32 << 10
+
+// runCommitMsgCommand implements `goclient commit-msg` and returns the exit
+// code.
+func runCommitMsgCommand(args []string) int {
+	fs := flag.NewFlagSet("commit-msg", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, commitMsgUsage)
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "", "Name of the Ollama model to use; defaults to the model in the config file.")
+	commit := fs.Bool("commit", false, "Commit the staged changes with the accepted message.")
+	yes := fs.Bool("yes", false, "Accept the first message without asking.")
+	maxDiff := fs.Int("max-diff", defaultMaxDiff, "Bytes of the diff sent to the model; the rest is summarized by git diff --stat.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	hookFile, source := fs.Arg(0), fs.Arg(1)
+	if hookFile != "" {
+		// As a hook, leave messages git already has alone and never fail:
+		// a missing message is better than a blocked commit.
+		if source != "" {
+			return 0
+		}
+		if err := commitMsgHook(*configPath, *profile, *model, *maxDiff, hookFile); err != nil {
+			fmt.Fprintf(os.Stderr, "goclient commit-msg: %v\n", err)
+		}
+		return 0
+	}
+
+	answers := setupOutput(true)
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if err := applyConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *model == "" {
+		*model = cfg.Model
+	}
+	input := bufio.NewScanner(os.Stdin)
+	ask := func(prompt string) (string, bool) {
+		fmt.Print(prompt)
+		if !input.Scan() {
+			return "", false
+		}
+		return input.Text(), true
+	}
+	if *model == "" {
+		if *model, err = selectOllamaModel(provider.NewClient(30*time.Second), ask); err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting Ollama model: %v\n", err)
+			return 1
+		}
+	}
+	ctx := handleSignals(context.Background())
+	a := commitMsgAgent(cfg, *model)
+	prompt, err := commitMsgPrompt(*maxDiff)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var message string
+	for message == "" {
+		waiting := startSpinner(*model)
+		message, err = a.commitMessage(ctx, prompt)
+		waiting.stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if *yes {
+			break
+		}
+		fmt.Printf("\n%s\n\n", message)
+		answer, ok := ask(colorYellow + "Use this message? [y]es, [e]dit, [r]egenerate, [n]o: " + colorReset)
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		case "e", "edit":
+			if message, err = editCommitMessage(message); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			if message == "" {
+				fmt.Println("The message is empty; not committing.")
+				return 1
+			}
+		case "r", "regenerate":
+			message = ""
+		default:
+			if ok {
+				fmt.Println("Cancelled.")
+			}
+			return 1
+		}
+	}
+	if !*commit {
+		fmt.Fprintln(answers, message)
+		return 0
+	}
+	cmd := exec.Command("git", "commit", "-F", "-")
+	cmd.Stdin = strings.NewReader(message + "\n")
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: git commit failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// commitMsgHook writes a message for the staged changes to the top of the
+// message file git passes to a prepare-commit-msg hook.
+func commitMsgHook(configPath, profile, model string, maxDiff int, path string) error {
+	cfg, err := loadConfig(configPath, profile)
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cfg); err != nil {
+		return err
+	}
+	if model == "" {
+		model = cfg.Model
+	}
+	if model == "" {
+		return fmt.Errorf("no model; set model in the config file or pass -model in the hook")
+	}
+	prompt, err := commitMsgPrompt(maxDiff)
+	if err != nil {
+		return err
+	}
+	message, err := commitMsgAgent(cfg, model).commitMessage(context.Background(), prompt)
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(message+"\n"+string(existing)), 0644)
+}
+
+// commitMsgAgent sets up an agent to write commit messages with model.
+func commitMsgAgent(cfg *Config, model string) *Agent {
+	a := NewAgent(withModel(model), withSystemPrompt(commitMsgSystemPrompt))
+	a.config = cfg
+	a.httpClient.Timeout = 5 * time.Minute
+	a.stopSequences = cfg.stopSequences(model)
+	a.numCtx = cfg.numCtx(model)
+	return a
+}
+
+// commitMsgPrompt describes the staged changes: their stat, the diff up to
+// maxDiff bytes, and recent subjects, so the message can follow the
+// repository's habits.
+func commitMsgPrompt(maxDiff int) (string, error) {
+	diff, err := gitOutput("diff", "--cached", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("nothing is staged; stage changes with git add first")
+	}
+	stat, err := gitOutput("diff", "--cached", "--no-color", "--stat")
+	if err != nil {
+		return "", err
+	}
+	if len(diff) > maxDiff {
+		diff = diff[:maxDiff] + "\n[diff truncated; the stat above lists every changed file]"
+	}
+	var b strings.Builder
+	b.WriteString("Write the commit message for these staged changes.\n\n")
+	b.WriteString("Changed files:\n" + stat + "\n")
+	// A new repository has no log; that is not an error here.
+	if subjects, err := gitOutput("log", "-10", "--format=%s"); err == nil && strings.TrimSpace(subjects) != "" {
+		b.WriteString("Recent commit subjects, for the usual scopes:\n" + subjects + "\n")
+	}
+	b.WriteString(attachment("Diff", diff))
+	return b.String(), nil
+}
+
+// gitOutput runs git with args and returns its output.
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+			return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", fmt.Errorf("git %s failed: %v", args[0], err)
+	}
+	return string(out), nil
+}
+
+// commitMessage asks the model for a message and tidies it up.
+func (a *Agent) commitMessage(ctx context.Context, prompt string) (string, error) {
+	text, err := a.generateOnce(ctx, a.systemPrompt, prompt)
+	if err != nil {
+		return "", err
+	}
+	message := cleanCommitMessage(text)
+	if message == "" {
+		return "", fmt.Errorf("%s did not write a message", a.modelName)
+	}
+	return message, nil
+}
+
+var commitMsgLabel = regexp.MustCompile(`(?i)^(commit message|subject)\s*:\s*`)
+
+// cleanCommitMessage removes what models wrap messages in: code fences,
+// quotes and a "Commit message:" label.
+func cleanCommitMessage(text string) string {
+	text = stripFence(text)
+	text = commitMsgLabel.ReplaceAllString(text, "")
+	if len(text) >= 2 && (text[0] == '"' || text[0] == '\'' || text[0] == '`') && text[len(text)-1] == text[0] {
+		text = text[1 : len(text)-1]
+	}
+	return strings.TrimSpace(text)
+}
+
+// editCommitMessage opens message in git's editor and returns it without
+// comment lines, as git would.
+func editCommitMessage(message string) (string, error) {
+	f, err := os.CreateTemp("", "COMMIT_EDITMSG-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, "%s\n\n# Edit the message; lines starting with '#' are ignored.\n", message)
+	f.Close()
+	editor, _ := gitOutput("var", "GIT_EDITOR")
+	if err := openEditor(strings.TrimSpace(editor), f.Name()); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
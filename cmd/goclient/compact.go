@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gherlein/goclient/pkg/agent"
+)
+
+// CompactConfig controls automatic conversation summarization.
+type CompactConfig struct {
+	Threshold float64 `yaml:"threshold"`  // fraction of the context limit that triggers compaction; 0 disables it
+	KeepTurns int     `yaml:"keep_turns"` // most recent user turns kept verbatim
+}
+
+func init() {
+	registerCommand(command{
+		name: "compact",
+		help: "Summarize older turns to free up context",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			if err := a.conversation(agent.Events{}).Compact(ctx); err != nil {
+				return fmt.Errorf("failed to compact conversation: %v", err)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// minCompareColumn is the narrowest column replies are shown side by side
+// in; with less room they are shown one after another.
+const minCompareColumn = 36
+
+func init() {
+	registerCommand(command{
+		name:  "compare",
+		usage: "<model,model...> [message]",
+		help:  "Answer a message, or the last one, with several models at once and show the replies side by side",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			list, message, _ := strings.Cut(arg, " ")
+			models := splitList(list)
+			if len(models) == 0 {
+				return fmt.Errorf("usage: /compare <model,model...> [message]")
+			}
+			return a.compareCommand(ctx, models, strings.TrimSpace(message))
+		},
+	})
+}
+
+// comparison is one model's side of a comparison: a copy of the chat's
+// agent set up for the model, with its own history, and its latest reply.
+type comparison struct {
+	agent *Agent
+	reply string
+	stats *provider.Stats
+	err   error
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newComparisons sets up a copy of the agent for each model, starting from
+// the agent's history. The copies are set up one at a time, since probing a
+// model's tool-call format may ask a question.
+func (a *Agent) newComparisons(ctx context.Context, models []string) ([]*comparison, error) {
+	var comparisons []*comparison
+	for _, model := range models {
+		name, err := a.installedModel(model)
+		if err != nil {
+			return nil, err
+		}
+		other := *a
+		other.history = append([]Message(nil), a.history...)
+		if err := other.useModel(ctx, name); err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, &comparison{agent: &other})
+	}
+	return comparisons, nil
+}
+
+// compareCommand implements /compare: message, or else the last user
+// message, is answered by each model from the conversation so far. The
+// conversation is not changed and tool calls in the replies are not run.
+func (a *Agent) compareCommand(ctx context.Context, models []string, message string) error {
+	history := a.history
+	if message == "" {
+		i := a.lastUserMessage()
+		if i < 0 {
+			return fmt.Errorf("there is no message to answer; send one first or give it after the models")
+		}
+		history, message = a.history[:i], a.history[i].Content
+	}
+	saved := a.history
+	a.history = history
+	comparisons, err := a.newComparisons(ctx, models)
+	a.history = saved
+	if err != nil {
+		return err
+	}
+	a.answerAll(ctx, comparisons, message)
+	printComparisons(a.out, comparisons)
+	return nil
+}
+
+// runCompare implements -compare: every message is answered by each of the
+// models, which keep their own conversations, until the input ends. In
+// one-shot mode only prompt is answered. It returns the exit code.
+func (a *Agent) runCompare(ctx context.Context, models []string, prompt string, oneShot bool) int {
+	comparisons, err := a.newComparisons(ctx, models)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+	if !oneShot {
+		fmt.Printf("Comparing %s (type 'exit' to quit; tool calls are not run)\n", strings.Join(models, ", "))
+	}
+	for ctx.Err() == nil {
+		if !oneShot {
+			var ok bool
+			if prompt, ok = a.readMessage(ctx); !ok {
+				break
+			}
+			if strings.ToLower(strings.TrimSpace(prompt)) == "exit" {
+				break
+			}
+			if isCommand(prompt) {
+				fmt.Println("Commands are not available while comparing models.")
+				continue
+			}
+		}
+		a.answerAll(ctx, comparisons, prompt)
+		printComparisons(a.out, comparisons)
+		if oneShot {
+			for _, c := range comparisons {
+				if c.err != nil {
+					return exitFailed
+				}
+			}
+			return exitOK
+		}
+	}
+	if ctx.Err() != nil {
+		return exitInterrupted
+	}
+	return exitOK
+}
+
+// answerAll sends message to every model at once and waits for all the
+// replies. A model's reply is added to its conversation, with the message,
+// only when it succeeds.
+func (a *Agent) answerAll(ctx context.Context, comparisons []*comparison, message string) {
+	var names []string
+	for _, c := range comparisons {
+		names = append(names, c.agent.modelName)
+	}
+	waiting := startSpinner(strings.Join(names, ", "))
+	var wg sync.WaitGroup
+	for _, c := range comparisons {
+		wg.Add(1)
+		go func(c *comparison) {
+			defer wg.Done()
+			other := c.agent
+			history := append(other.history, Message{Role: "user", Content: message, Time: time.Now()})
+			other.history = history
+			var reply string
+			reply, c.stats, c.err = other.inferOnce(ctx, nil)
+			c.reply = strings.TrimSpace(reply)
+			if c.err != nil {
+				other.history = history[:len(history)-1]
+				return
+			}
+			other.history = append(history, Message{Role: "assistant", Content: c.reply, Model: other.modelName, Tokens: c.stats.TokenCount, Time: time.Now()})
+		}(c)
+	}
+	wg.Wait()
+	waiting.stop()
+	if a.usage == nil {
+		return
+	}
+	for _, c := range comparisons {
+		if _, err := a.usage.Record(usageProvider(), c.stats.PromptTokens+c.stats.TokenCount); err != nil {
+			slog.Warn(err.Error())
+		}
+	}
+}
+
+// printComparisons shows the replies in columns when out is a terminal
+// wide enough, and otherwise one after another under the model's name.
+// Each reply is followed by its statistics.
+func printComparisons(out io.Writer, comparisons []*comparison) {
+	width := 0
+	if f, ok := out.(*os.File); ok && isTerminal(f) {
+		width, _, _ = term.GetSize(f.Fd())
+	}
+	const gap = " │ "
+	column := (width - lipgloss.Width(gap)*(len(comparisons)-1)) / len(comparisons)
+	if len(comparisons) < 2 || column < minCompareColumn {
+		for _, c := range comparisons {
+			fmt.Fprintf(out, "\n"+colorYellow+"── %s"+colorReset+"\n%s\n", c.agent.modelName, c.body())
+			fmt.Fprintln(out, colorGray+c.summary()+colorReset)
+		}
+		return
+	}
+	style := lipgloss.NewStyle().Width(column)
+	var rendered []string
+	height := 0
+	for _, c := range comparisons {
+		text := colorYellow + c.agent.modelName + colorReset + "\n" + strings.Repeat("─", column) + "\n" +
+			c.body() + "\n\n" + colorGray + c.summary() + colorReset
+		rendered = append(rendered, style.Render(text))
+		height = max(height, lipgloss.Height(rendered[len(rendered)-1]))
+	}
+	separator := strings.TrimSuffix(strings.Repeat(gap+"\n", height), "\n")
+	columns := []string{rendered[0]}
+	for _, column := range rendered[1:] {
+		columns = append(columns, separator, column)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, lipgloss.JoinHorizontal(lipgloss.Top, columns...))
+}
+
+// body is the reply, or the error that replaced it.
+func (c *comparison) body() string {
+	if c.err != nil {
+		return colorRed + "Error: " + c.err.Error() + colorReset
+	}
+	return c.reply
+}
+
+// summary gives the reply's statistics and notes the tool calls it asked
+// for, which are not run.
+func (c *comparison) summary() string {
+	if c.err != nil {
+		return ""
+	}
+	summary := fmt.Sprintf("%d tokens in %.2fs, TTFT %.2fs, %.2f tokens/s", c.stats.TokenCount, c.stats.Elapsed().Seconds(),
+		c.stats.TimeToFirstToken().Seconds(), c.stats.TokensPerSecond())
+	if calls := tools.ExtractCalls(c.reply, c.agent.toolGrammar); len(calls) > 0 {
+		summary += fmt.Sprintf("; asked for %d tool calls, not run", len(calls))
+	}
+	return summary
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+const completionUsage = `Usage: goclient completion bash|zsh|fish
+
+Prints a shell completion script. Add it to your shell's startup file:
+  bash:  source <(goclient completion bash)              in ~/.bashrc
+  zsh:   source <(goclient completion zsh)               in ~/.zshrc
+  fish:  goclient completion fish > ~/.config/fish/completions/goclient.fish`
+
+// subcommands are the first arguments main dispatches on.
+var subcommands = []string{"sessions", "docgen", "pipeline", "serve", "doctor", "models", "batch", "commit-msg", "review", "gen-tests", "config", "completion"}
+
+// completedFlags maps the flags whose values are completed from a list to
+// the argument of `goclient __complete` that prints it.
+var completedFlags = map[string]string{
+	"model":       "models",
+	"agent":       "agents",
+	"profile":     "profiles",
+	"session":     "sessions",
+	"tool-format": "tool-formats",
+}
+
+// runCompletionCommand implements `goclient completion` and returns the exit
+// code. It is called after the chat's flags are defined, so that the
+// scripts cover all of them.
+func runCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, completionUsage)
+		return 2
+	}
+	var flags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion(flags))
+	case "zsh":
+		fmt.Print(zshCompletion(flags))
+	case "fish":
+		fmt.Print(fishCompletion(flags))
+	default:
+		fmt.Fprintln(os.Stderr, completionUsage)
+		return 2
+	}
+	return 0
+}
+
+// runCompleteCommand implements the hidden `goclient __complete <list>`
+// used by the completion scripts: it prints the installed models, the agent
+// types, the profiles, the saved sessions or the tool-call formats, one per
+// line. Errors print nothing, so that completion stays quiet.
+func runCompleteCommand(args []string) int {
+	if len(args) != 1 {
+		return 2
+	}
+	cfg, err := loadConfig(defaultConfigPath(), "")
+	if err != nil {
+		return 1
+	}
+	configureHost(cfg)
+	var names []string
+	switch args[0] {
+	case "models":
+		names, _ = getAvailableOllamaModels(provider.NewClient(2 * time.Second))
+	case "agents":
+		if loadAgentTypes() == nil {
+			for name := range agentTypes {
+				names = append(names, name)
+			}
+			names = append(names, "list")
+		}
+	case "profiles":
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+	case "sessions":
+		sessions, _ := listSessions()
+		for _, s := range sessions {
+			names = append(names, s.Name)
+		}
+	case "tool-formats":
+		names = []string{"text", "json", "json-strict", "structured"}
+	default:
+		return 2
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return 0
+}
+
+// isBoolFlag reports whether a flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// flagSummary is the first sentence of a flag's usage, for the shells that
+// show descriptions.
+func flagSummary(f *flag.Flag) string {
+	summary, _, _ := strings.Cut(f.Usage, ". ")
+	return strings.TrimSuffix(summary, ".")
+}
+
+func bashCompletion(flags []*flag.Flag) string {
+	var names, cases []string
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+		if list, ok := completedFlags[f.Name]; ok {
+			cases = append(cases, fmt.Sprintf("    -%[1]s|--%[1]s) words=$(goclient __complete %[2]s 2>/dev/null) ;;", f.Name, list))
+		} else if !isBoolFlag(f) {
+			cases = append(cases, fmt.Sprintf("    -%[1]s|--%[1]s) return ;; # files", f.Name))
+		}
+	}
+	return `# bash completion for goclient
+_goclient() {
+  local cur prev words=""
+  COMPREPLY=()
+  if declare -F _get_comp_words_by_ref >/dev/null; then
+    _get_comp_words_by_ref -n : cur prev
+  else
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+  fi
+  case "$prev" in
+` + strings.Join(cases, "\n") + `
+    *)
+      if [[ $COMP_CWORD -eq 1 && "$cur" != -* ]]; then
+        words="` + strings.Join(subcommands, " ") + `"
+      else
+        case "${COMP_WORDS[1]}" in
+          completion) words="bash zsh fish" ;;
+          config) words="get set unset path edit -project -config" ;;
+          sessions) words="list show delete export merge" ;;
+          pipeline) words="list run" ;;
+          *) words="` + strings.Join(names, " ") + `" ;;
+        esac
+      fi ;;
+  esac
+  COMPREPLY=($(compgen -W "$words" -- "$cur"))
+  if declare -F __ltrim_colon_completions >/dev/null; then
+    __ltrim_colon_completions "$cur"
+  fi
+}
+complete -o default -F _goclient goclient
+`
+}
+
+func zshCompletion(flags []*flag.Flag) string {
+	escape := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]")
+	var specs []string
+	for _, f := range flags {
+		spec := "'-" + f.Name + "[" + escape.Replace(flagSummary(f)) + "]"
+		if list, ok := completedFlags[f.Name]; ok {
+			spec += ":" + f.Name + ":_goclient_complete " + list
+		} else if !isBoolFlag(f) {
+			spec += ":" + f.Name + ":_files"
+		}
+		specs = append(specs, "    "+spec+"'")
+	}
+	return `#compdef goclient
+# zsh completion for goclient
+_goclient_complete() {
+  local -a values
+  values=(${(f)"$(goclient __complete $1 2>/dev/null)"})
+  _describe -t values "$1" values
+}
+
+_goclient() {
+  if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+    local -a commands
+    commands=(` + strings.Join(subcommands, " ") + `)
+    _describe -t commands command commands
+    return
+  fi
+  case $words[2] in
+    completion) _values shell bash zsh fish; return ;;
+    config) _values command get set unset path edit; return ;;
+    sessions) _values command list show delete export merge; return ;;
+    pipeline) _values command list run; return ;;
+    docgen|doctor) _files; return ;;
+  esac
+  _arguments \
+` + strings.Join(specs, " \\\n") + `
+}
+
+compdef _goclient goclient
+`
+}
+
+func fishCompletion(flags []*flag.Flag) string {
+	escape := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	var b strings.Builder
+	b.WriteString("# fish completion for goclient\n")
+	fmt.Fprintf(&b, "complete -c goclient -n '__fish_use_subcommand' -f -a '%s'\n", strings.Join(subcommands, " "))
+	b.WriteString("complete -c goclient -n '__fish_seen_subcommand_from completion' -f -a 'bash zsh fish'\n")
+	b.WriteString("complete -c goclient -n '__fish_seen_subcommand_from config' -f -a 'get set unset path edit'\n")
+	b.WriteString("complete -c goclient -n '__fish_seen_subcommand_from sessions' -f -a 'list show delete export merge'\n")
+	b.WriteString("complete -c goclient -n '__fish_seen_subcommand_from pipeline' -f -a 'list run'\n")
+	for _, f := range flags {
+		fmt.Fprintf(&b, "complete -c goclient -n 'not __fish_seen_subcommand_from %s' -o %s -d '%s'",
+			strings.Join(subcommands, " "), f.Name, escape.Replace(flagSummary(f)))
+		if list, ok := completedFlags[f.Name]; ok {
+			fmt.Fprintf(&b, " -x -a '(goclient __complete %s 2>/dev/null)'", list)
+		} else if !isBoolFlag(f) {
+			b.WriteString(" -r -F")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// projectConfigFile is the config file in the workspace root. Its settings
+// override those of the global config file.
+const projectConfigFile = ".goclient.yaml"
+
+// Config holds settings loaded from ~/.config/goclient/config.yaml and the
+// project's .goclient.yaml.
+type Config struct {
+	Model       string                 `yaml:"model"` // used when -model is not given
+	Host        string                 `yaml:"host"`  // Ollama's base URL
+	Agent       string                 `yaml:"agent"` // used when -agent is not given
+	Color       *bool                  `yaml:"color"` // false turns colours off, like NO_COLOR
+	Options     map[string]interface{} `yaml:"options"`
+	Permissions *PermissionsConfig     `yaml:"permissions"`
+	System      string                 `yaml:"system"`     // added to the agent type's system prompt
+	APIKey      string                 `yaml:"api_key"`    // sent as a bearer token to host; $VARS are expanded
+	KeepAlive   string                 `yaml:"keep_alive"` // how long Ollama keeps the model loaded, e.g. 30m or -1
+	Warmup      bool                   `yaml:"warmup"`     // load the model at startup
+	Profiles    map[string]yaml.Node   `yaml:"profiles"`
+
+	Tools      []tools.CommandTool       `yaml:"tools"`
+	Macros     []tools.MacroTool         `yaml:"macros"`
+	Pipelines  map[string]PipelineConfig `yaml:"pipelines"`
+	Budgets    map[string]ProviderBudget `yaml:"budgets"`
+	Models     map[string]ModelConfig    `yaml:"models"`
+	SQL        *tools.SQLConfig          `yaml:"sql"`
+	Sandbox    *SandboxConfig            `yaml:"sandbox"`
+	Security   *SecurityConfig           `yaml:"security"`
+	Docs       *tools.DocsConfig         `yaml:"docs"`
+	Compact    CompactConfig             `yaml:"compact"`
+	Files      *tools.ListConfig         `yaml:"list_files"`
+	RepoMap    *tools.RepoMapConfig      `yaml:"repo_map"`
+	Memory     *tools.MemoryConfig       `yaml:"memory"`
+	Embeddings *tools.EmbedConfig        `yaml:"embeddings"`
+	Vision     *tools.VisionConfig       `yaml:"vision"`
+	Transcribe *tools.TranscribeConfig   `yaml:"transcription"`
+	Routing    *RoutingConfig            `yaml:"routing"`
+}
+
+// PermissionsConfig controls which tools the model may use and whether
+// their actions need approval.
+type PermissionsConfig struct {
+	AutoApprove   bool     `yaml:"auto_approve"`   // like -yes
+	DisabledTools []string `yaml:"disabled_tools"` // never offered to the model
+}
+
+// SandboxConfig selects where command tools run. Backend is "host" (the
+// default) or "docker".
+type SandboxConfig struct {
+	Backend              string `yaml:"backend"`
+	tools.DockerExecutor `yaml:",inline"`
+}
+
+// ModelConfig holds per-model settings. Keys in Config.Models may be a full
+// model name ("llama3:8b") or a name without its tag ("llama3").
+type ModelConfig struct {
+	Stop       []string `yaml:"stop"`
+	NumCtx     int      `yaml:"num_ctx"`     // context size requested from Ollama
+	ToolFormat string   `yaml:"tool_format"` // text, json, json-strict or structured; overrides the probe
+}
+
+// defaultStopSequences stop the model from writing the other side of the
+// dialogue in the freeform prompt format of package agent.
+var defaultStopSequences = []string{"\nUser:", "\nYou:", "\nTool result"}
+
+// modelConfig returns the settings for a model, matching the full name first
+// and then the name without its tag.
+func (c *Config) modelConfig(model string) (ModelConfig, bool) {
+	if mc, ok := c.Models[model]; ok {
+		return mc, true
+	}
+	if base, _, found := strings.Cut(model, ":"); found {
+		if mc, ok := c.Models[base]; ok {
+			return mc, true
+		}
+	}
+	return ModelConfig{}, false
+}
+
+// numCtx returns the configured context size for a model, or 0.
+func (c *Config) numCtx(model string) int {
+	mc, _ := c.modelConfig(model)
+	return mc.NumCtx
+}
+
+// stopSequences returns the configured stop sequences for a model, falling
+// back to defaultStopSequences.
+func (c *Config) stopSequences(model string) []string {
+	if mc, ok := c.modelConfig(model); ok && mc.Stop != nil {
+		return mc.Stop
+	}
+	return defaultStopSequences
+}
+
+// toolFormat returns the configured tool-call format for a model, or "".
+func (c *Config) toolFormat(model string) string {
+	mc, _ := c.modelConfig(model)
+	return mc.ToolFormat
+}
+
+// defaultConfigPath returns $GOCLIENT_CONFIG or
+// ~/.config/goclient/config.yaml.
+func defaultConfigPath() string {
+	if path := envDefault("CONFIG", ""); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "goclient", "config.yaml")
+}
+
+// dataDir returns ~/.local/share/goclient, where goclient keeps its state.
+func dataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "goclient")
+}
+
+// loadConfig reads the config file at path, then the project config file
+// in the current directory, then applies the named profile, if any, and the
+// GOCLIENT_* environment variables. Later
+// settings override earlier ones, except that tools and macros are added to
+// those already defined. A missing file is ignored.
+func loadConfig(path, profile string) (*Config, error) {
+	global := &Config{}
+	if err := readConfigFile(path, global); err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	for _, file := range []string{path, projectConfigFile} {
+		if err := mergeConfig(cfg, func(c *Config) error { return readConfigFile(file, c) }); err != nil {
+			return nil, err
+		}
+	}
+	if profile != "" {
+		node, ok := cfg.Profiles[profile]
+		if !ok {
+			var names []string
+			for name := range cfg.Profiles {
+				names = append(names, name)
+			}
+			if len(names) == 0 {
+				return nil, fmt.Errorf("unknown profile %q: the config defines no profiles", profile)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown profile %q (profiles: %s)", profile, strings.Join(names, ", "))
+		}
+		if err := mergeConfig(cfg, func(c *Config) error { return node.Decode(c) }); err != nil {
+			return nil, fmt.Errorf("failed to apply profile %s: %v", profile, err)
+		}
+	}
+	// A checked-out repository must not approve its own tool calls: only the
+	// global file, or a profile defined there, can turn on auto_approve.
+	if cfg.Permissions != nil && cfg.Permissions.AutoApprove && !global.autoApprove(profile) {
+		slog.Warn(fmt.Sprintf("ignoring permissions.auto_approve in %s; set it in %s or pass -yes", projectConfigFile, path))
+		cfg.Permissions.AutoApprove = false
+	}
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// mergeConfig decodes more settings onto cfg, adding to its tools and
+// macros rather than replacing them.
+func mergeConfig(cfg *Config, decode func(*Config) error) error {
+	tools, macros := cfg.Tools, cfg.Macros
+	cfg.Tools, cfg.Macros = nil, nil
+	if err := decode(cfg); err != nil {
+		return err
+	}
+	cfg.Tools = append(tools, cfg.Tools...)
+	cfg.Macros = append(macros, cfg.Macros...)
+	return nil
+}
+
+// autoApprove reports whether c, with the named profile applied, turns on
+// auto_approve.
+func (c *Config) autoApprove(profile string) bool {
+	if node, ok := c.Profiles[profile]; ok {
+		var p Config
+		if node.Decode(&p) == nil && p.Permissions != nil {
+			return p.Permissions.AutoApprove
+		}
+	}
+	return c.Permissions != nil && c.Permissions.AutoApprove
+}
+
+// flagPassed reports whether a command-line flag was given, so that only
+// explicit flags override the config file.
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// readConfigFile decodes the YAML file at path into cfg. Fields the file
+// does not set are left unchanged.
+func readConfigFile(path string, cfg *Config) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyConfig registers the tools declared in the config and applies its
+// settings to the tools and provider packages.
+func applyConfig(cfg *Config) error {
+	configureHost(cfg)
+	if err := configureKeepAlive(cfg.KeepAlive); err != nil {
+		return err
+	}
+	if cfg.Color != nil && !*cfg.Color {
+		disableColor()
+	}
+	if err := registerCommandTools(cfg); err != nil {
+		return fmt.Errorf("registering config tools: %v", err)
+	}
+	if err := configureSandbox(cfg); err != nil {
+		return fmt.Errorf("configuring sandbox: %v", err)
+	}
+	configureDocs(cfg)
+	configureListFiles(cfg)
+	configureRepoMap(cfg)
+	configureMemory(cfg)
+	configureEmbeddings(cfg)
+	configureVision(cfg)
+	configureTranscription(cfg)
+	if err := registerSQLTool(cfg); err != nil {
+		return fmt.Errorf("configuring sql_query tool: %v", err)
+	}
+	if err := registerMacroTools(cfg); err != nil {
+		return fmt.Errorf("registering macro tools: %v", err)
+	}
+	if err := loadAgentTypes(); err != nil {
+		return fmt.Errorf("loading agents: %v", err)
+	}
+	if cfg.Permissions != nil {
+		for _, name := range cfg.Permissions.DisabledTools {
+			tools.UnregisterTool(name)
+		}
+	}
+	return nil
+}
+
+// configureHost points requests at the configured Ollama server.
+func configureHost(cfg *Config) {
+	if cfg.Host != "" {
+		provider.OllamaHost = strings.TrimRight(cfg.Host, "/")
+	}
+	provider.OllamaAPIKey = os.ExpandEnv(cfg.APIKey)
+}
+
+// registerCommandTools registers the shell-command tools declared in the config.
+func registerCommandTools(cfg *Config) error {
+	for _, tool := range cfg.Tools {
+		def, err := tool.Definition()
+		if err != nil {
+			return err
+		}
+		tools.RegisterTool(def)
+	}
+	return nil
+}
+
+// registerMacroTools registers the macro tools declared in the config. Their
+// steps are looked up when they run, so they may use any registered tool.
+func registerMacroTools(cfg *Config) error {
+	for _, macro := range cfg.Macros {
+		def, err := macro.Definition()
+		if err != nil {
+			return err
+		}
+		tools.RegisterTool(def)
+	}
+	return nil
+}
+
+// registerSQLTool registers the sql_query tool when a database is configured.
+func registerSQLTool(cfg *Config) error {
+	if cfg.SQL == nil || cfg.SQL.DSN == "" {
+		return nil
+	}
+	def, err := tools.NewSQLTool(*cfg.SQL)
+	if err != nil {
+		return err
+	}
+	tools.RegisterTool(def)
+	return nil
+}
+
+// configureSandbox selects the execution backend for command tools.
+func configureSandbox(cfg *Config) error {
+	if cfg.Sandbox == nil {
+		return nil
+	}
+	switch cfg.Sandbox.Backend {
+	case "", "host":
+		tools.CommandExecutor = tools.HostExecutor{}
+	case "docker":
+		tools.CommandExecutor = cfg.Sandbox.DockerExecutor
+	default:
+		return fmt.Errorf("unknown sandbox backend: %q (use host or docker)", cfg.Sandbox.Backend)
+	}
+	return nil
+}
+
+// configureDocs points search_docs at the configured documentation directory.
+func configureDocs(cfg *Config) {
+	if cfg.Docs == nil {
+		return
+	}
+	docs := *cfg.Docs
+	if docs.Dir == "" {
+		docs.Dir = tools.DocsSettings.Dir
+	}
+	tools.DocsSettings = docs
+}
+
+// configureListFiles applies the list_files limits from the config file.
+// Limits left at zero keep their defaults.
+func configureListFiles(cfg *Config) {
+	if cfg.Files == nil {
+		return
+	}
+	if cfg.Files.MaxEntries > 0 {
+		tools.ListSettings.MaxEntries = cfg.Files.MaxEntries
+	}
+	if cfg.Files.MaxBytes > 0 {
+		tools.ListSettings.MaxBytes = cfg.Files.MaxBytes
+	}
+}
+
+// configureRepoMap applies the repo_map section; the map itself is built
+// when the code agent starts.
+func configureRepoMap(cfg *Config) {
+	if cfg.RepoMap == nil {
+		return
+	}
+	tools.RepoMapSettings.Disabled = cfg.RepoMap.Disabled
+	if cfg.RepoMap.MaxBytes > 0 {
+		tools.RepoMapSettings.MaxBytes = cfg.RepoMap.MaxBytes
+	}
+}
+
+// configureMemory stores long-term memories in the data directory unless the
+// config file names another file. max_injected: -1 disables injection.
+func configureMemory(cfg *Config) {
+	if dir := dataDir(); dir != "" {
+		tools.MemorySettings.Path = filepath.Join(dir, "MEMORY.md")
+	}
+	if cfg.Memory == nil {
+		return
+	}
+	if cfg.Memory.Path != "" {
+		tools.MemorySettings.Path = cfg.Memory.Path
+	}
+	if cfg.Memory.MaxInjected != 0 {
+		tools.MemorySettings.MaxInjected = cfg.Memory.MaxInjected
+	}
+}
+
+// configureVision enables view_image when the config file names a vision
+// model.
+func configureVision(cfg *Config) {
+	if cfg.Vision == nil || cfg.Vision.Model == "" {
+		return
+	}
+	vision := *cfg.Vision
+	if vision.Prompt == "" {
+		vision.Prompt = tools.VisionSettings.Prompt
+	}
+	tools.VisionSettings = vision
+	tools.RegisterViewImage()
+}
+
+// configureTranscription points -transcribe at the configured server and
+// enables transcribe_audio when the config file has a transcription
+// section.
+func configureTranscription(cfg *Config) {
+	if cfg.Transcribe == nil {
+		return
+	}
+	transcribe := *cfg.Transcribe
+	if transcribe.URL == "" {
+		transcribe.URL = tools.TranscribeSettings.URL
+	}
+	if transcribe.Timeout <= 0 {
+		transcribe.Timeout = tools.TranscribeSettings.Timeout
+	}
+	tools.TranscribeSettings = transcribe
+	tools.RegisterTranscribeAudio()
+}
+
+// configureEmbeddings enables semantic_search and automatic retrieval when
+// the config file has an embeddings section.
+func configureEmbeddings(cfg *Config) {
+	if cfg.Embeddings == nil {
+		return
+	}
+	embed := *cfg.Embeddings
+	if embed.Model == "" {
+		embed.Model = tools.EmbedSettings.Model
+	}
+	if embed.Dir == "" {
+		embed.Dir = tools.EmbedSettings.Dir
+	}
+	tools.EmbedSettings = embed
+	tools.RegisterSemanticSearch()
+}
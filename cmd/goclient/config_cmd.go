@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `Usage: goclient config <command> [-project] [-config path] [arguments]
+
+Commands:
+  get <key>                     Print a setting: from the project's .goclient.yaml
+                                if it sets it, otherwise from the global config
+  set <key> <value>             Change a setting in the config file
+  unset <key>                   Remove a setting from the config file
+  path                          Print the paths of the config files
+  edit                          Open the config file in $EDITOR
+
+Keys are the names used in the file, with dots for nested settings, e.g.
+model, host, agent, color, options.temperature, permissions.auto_approve or
+models.llama3.num_ctx. "temperature" and "auto_approve" are short for
+options.temperature and permissions.auto_approve. Values are YAML: 0.2,
+true, [edit_file, sql_query].
+
+-project changes the project's .goclient.yaml instead of the global file.`
+
+// configKeyAliases are shorthands accepted for common settings.
+var configKeyAliases = map[string]string{
+	"temperature":  "options.temperature",
+	"auto_approve": "permissions.auto_approve",
+}
+
+// runConfigCommand implements `goclient config ...` and returns the exit code.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	command := args[0]
+	fs := flag.NewFlagSet("config "+command, flag.ContinueOnError)
+	project := fs.Bool("project", false, "Use the project's .goclient.yaml instead of the global config file.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the global config file.")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	path := *configPath
+	if *project {
+		path = projectConfigFile
+	}
+	rest := fs.Args()
+	key := ""
+	if len(rest) > 0 {
+		key = rest[0]
+		if alias, ok := configKeyAliases[key]; ok {
+			key = alias
+		}
+	}
+
+	var err error
+	switch {
+	case command == "get" && len(rest) == 1:
+		err = configGet(*configPath, key)
+	case command == "set" && len(rest) == 2:
+		err = configSet(path, key, rest[1])
+	case command == "unset" && len(rest) == 1:
+		err = configUnset(path, key)
+	case command == "path" && len(rest) == 0:
+		for _, p := range []string{*configPath, projectConfigFile} {
+			status := "not found"
+			if _, statErr := os.Stat(p); statErr == nil {
+				status = "exists"
+			}
+			abs, _ := filepath.Abs(p)
+			fmt.Printf("%s (%s)\n", abs, status)
+		}
+	case command == "edit" && len(rest) == 0:
+		err = configEdit(path)
+	case command == "help" || command == "-h" || command == "--help":
+		fmt.Println(configUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid config command %q\n\n%s\n", strings.Join(args, " "), configUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// configGet prints the value of key, looking in the project file first.
+func configGet(globalPath, key string) error {
+	for _, path := range []string{projectConfigFile, globalPath} {
+		doc, err := readConfigNode(path)
+		if err != nil {
+			return err
+		}
+		node := lookupConfigNode(doc.Content[0], strings.Split(key, "."))
+		if node == nil {
+			continue
+		}
+		if node.Kind == yaml.ScalarNode {
+			fmt.Println(node.Value)
+			return nil
+		}
+		out, err := yaml.Marshal(node)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %v", key, err)
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+	return fmt.Errorf("%s is not set", key)
+}
+
+// configSet sets key to value, parsed as YAML, in the file at path. The
+// rest of the file, including its comments, is kept.
+func configSet(path, key, value string) error {
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil || len(parsed.Content) == 0 {
+		parsed = yaml.Node{Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: value}}}
+	}
+	if strings.HasPrefix(key, "options.") && parsed.Content[0].ShortTag() == "!!str" {
+		return fmt.Errorf("%s must be a number, a boolean or a list, not %q", key, value)
+	}
+	if path == projectConfigFile && key == "permissions.auto_approve" {
+		slog.Warn(fmt.Sprintf("auto_approve is ignored in %s; set it in the global config", projectConfigFile))
+	}
+	doc, err := readConfigNode(path)
+	if err != nil {
+		return err
+	}
+	parent := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child := lookupConfigNode(parent, []string{part})
+		if child == nil || child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			setConfigNode(parent, part, child)
+		}
+		parent = child
+	}
+	setConfigNode(parent, parts[len(parts)-1], parsed.Content[0])
+	return writeConfigNode(path, doc)
+}
+
+// configUnset removes key from the file at path.
+func configUnset(path, key string) error {
+	doc, err := readConfigNode(path)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(key, ".")
+	parent := lookupConfigNode(doc.Content[0], parts[:len(parts)-1])
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not set in %s", key, path)
+	}
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == parts[len(parts)-1] {
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return writeConfigNode(path, doc)
+		}
+	}
+	return fmt.Errorf("%s is not set in %s", key, path)
+}
+
+// configEdit opens the file at path in $VISUAL or $EDITOR and checks it
+// afterwards.
+func configEdit(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	if err := openEditor(editor, path); err != nil {
+		return err
+	}
+	if err := readConfigFile(path, &Config{}); err != nil {
+		return fmt.Errorf("%v; run 'goclient config edit' again to fix it", err)
+	}
+	return nil
+}
+
+// openEditor edits the file at path with editor, a command line that may
+// include arguments, or vi if it is empty, and waits for it to exit.
+func openEditor(editor, path string) error {
+	if strings.TrimSpace(editor) == "" {
+		editor = "vi"
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %v", editor, err)
+	}
+	return nil
+}
+
+// readConfigNode reads the file at path as a YAML document whose content is
+// a mapping; a missing or empty file yields an empty mapping.
+func readConfigNode(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s is not a mapping of settings", path)
+	}
+	return doc, nil
+}
+
+// writeConfigNode checks that doc is a valid config and writes it to path.
+func writeConfigNode(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode config: %v", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.KnownFields(true)
+	if err := dec.Decode(&Config{}); err != nil {
+		return fmt.Errorf("invalid setting: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// lookupConfigNode follows keys through nested mappings.
+func lookupConfigNode(node *yaml.Node, keys []string) *yaml.Node {
+	for _, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var found *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				found = node.Content[i+1]
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		node = found
+	}
+	return node
+}
+
+// setConfigNode sets key in a mapping, replacing an existing value.
+func setConfigNode(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts the environment variables that override config
+// settings: GOCLIENT_MODEL sets model, GOCLIENT_PERMISSIONS_AUTO_APPROVE
+// sets permissions.auto_approve and GOCLIENT_OPTIONS_TOP_P sets
+// options.top_p. Values are YAML, like those of `goclient config set`.
+const envPrefix = "GOCLIENT_"
+
+// envAliases are shorter names for common settings.
+var envAliases = map[string]string{
+	"AUTO_APPROVE":   "PERMISSIONS_AUTO_APPROVE",
+	"DISABLED_TOOLS": "PERMISSIONS_DISABLED_TOOLS",
+	"TEMPERATURE":    "OPTIONS_TEMPERATURE",
+}
+
+// envOnly are variables that are not settings in the config file.
+var envOnly = map[string]bool{
+	"CONFIG":  true, // the config file, -config
+	"PROFILE": true, // the profile, -profile
+}
+
+// envDefault returns the value of GOCLIENT_name, or def when it is unset,
+// for flags whose default can come from the environment.
+func envDefault(name, def string) string {
+	if value, ok := os.LookupEnv(envPrefix + name); ok {
+		return value
+	}
+	return def
+}
+
+// applyEnv applies the GOCLIENT_* environment variables to cfg. They take
+// precedence over the config files and the profile, but not over flags.
+func applyEnv(cfg *Config) error {
+	var names []string
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, envPrefix) {
+			names = append(names, strings.TrimPrefix(name, envPrefix))
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if envOnly[name] {
+			continue
+		}
+		setting := name
+		if alias, ok := envAliases[name]; ok {
+			setting = alias
+		}
+		key, t, ok := configKey(reflect.TypeOf(Config{}), strings.ToLower(setting))
+		if !ok {
+			slog.Warn(fmt.Sprintf("ignoring %s%s, which is not a setting", envPrefix, name))
+			continue
+		}
+		value := os.Getenv(envPrefix + name)
+		var parsed yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &parsed); err != nil || len(parsed.Content) == 0 {
+			parsed = yaml.Node{Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: value}}}
+		}
+		root := parsed.Content[0]
+		if t.Kind() == reflect.Slice && root.Kind == yaml.ScalarNode {
+			// A list may also be given as comma-separated values.
+			root = &yaml.Node{Kind: yaml.SequenceNode}
+			for _, item := range strings.Split(value, ",") {
+				root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: strings.TrimSpace(item)})
+			}
+		}
+		parts := strings.Split(key, ".")
+		for i := len(parts) - 1; i >= 0; i-- {
+			root = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: parts[i]}, root}}
+		}
+		if err := mergeConfig(cfg, func(c *Config) error { return root.Decode(c) }); err != nil {
+			return fmt.Errorf("invalid %s%s=%q for %s: %v", envPrefix, name, value, key, err)
+		}
+	}
+	return nil
+}
+
+// configKey finds the dotted config key for an environment variable name
+// in lower case, such as "permissions_auto_approve", by matching it against
+// the yaml tags of t, and returns the type of the setting. The rest of a
+// name that reaches a map is the map key.
+func configKey(t reflect.Type, name string) (string, reflect.Type, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if opts == "inline" {
+			if key, ft, ok := configKey(field.Type, name); ok {
+				return key, ft, true
+			}
+			continue
+		}
+		if tag == "" || tag == "-" {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if name == tag {
+			return tag, ft, true
+		}
+		rest, found := strings.CutPrefix(name, tag+"_")
+		if !found {
+			continue
+		}
+		switch ft.Kind() {
+		case reflect.Map:
+			return tag + "." + rest, ft.Elem(), true
+		case reflect.Struct:
+			if key, et, ok := configKey(ft, rest); ok {
+				return tag + "." + key, et, true
+			}
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// defaultNumCtx is the context size Ollama uses when num_ctx isn't set.
+const defaultNumCtx = 4096
+
+// estimateTokens approximates the token count of text (about four
+// characters per token for English text and code).
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// fetchContextLength asks Ollama's /api/show for the model's maximum context length.
+func fetchContextLength(client *http.Client, model string) (int, error) {
+	body, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Post(provider.OllamaHost+"/api/show", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query model info: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Ollama /api/show request failed with status %d", resp.StatusCode)
+	}
+
+	var show struct {
+		ModelInfo map[string]interface{} `json:"model_info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return 0, fmt.Errorf("failed to decode model info: %v", err)
+	}
+	for key, value := range show.ModelInfo {
+		if strings.HasSuffix(key, ".context_length") {
+			if n, ok := value.(float64); ok && n > 0 {
+				return int(n), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("model info for %s has no context length", model)
+}
+
+// contextLimit returns the number of tokens the prompt may use: the
+// configured num_ctx, or Ollama's default capped by the model's maximum.
+func contextLimit(numCtx, modelMax int) int {
+	if numCtx > 0 {
+		return numCtx
+	}
+	if modelMax > 0 && modelMax < defaultNumCtx {
+		return modelMax
+	}
+	return defaultNumCtx
+}
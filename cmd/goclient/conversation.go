@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// conversationOptions configures a pkg/agent Agent to answer a's
+// conversation as the chat does: with its model, system prompt, tools,
+// examples, context limit and generation options. Calls of tools outside
+// a.tools are refused; with taint tracking, calls copying untrusted content
+// only run if the user allows them; the hooks may then change or refuse
+// each call, and calls of tools that needsApproval run only once approved.
+func (a *Agent) conversationOptions() []agent.Option {
+	available := a.availableTools()
+	interruptible := make([]tools.Tool, 0, len(available))
+	for _, tool := range available {
+		interruptible = append(interruptible, interruptibleTool{tool})
+	}
+	hooks := []agent.Hooks{a.requestHook()}
+	if a.taint != nil {
+		hooks = append(hooks, a.taint.hooks())
+	}
+	hooks = append(hooks, a.hooks...)
+	// Approval comes last, so it is asked about the call the hooks let through.
+	hooks = append(hooks, approvalHook(confirmToolCall))
+
+	opts := []agent.Option{
+		agent.WithModel(a.modelName),
+		agent.WithProvider(&provider.Ollama{Client: a.httpClient, RawLine: a.dump.Line}),
+		agent.WithSystemPrompt(a.system()),
+		agent.WithoutToolPrompt(), // a.systemPrompt has the tool descriptions for the model
+		agent.WithGrammar(a.toolGrammar),
+		agent.WithTools(interruptible...),
+		agent.WithMaxIterations(a.maxIterations),
+		agent.WithOptions(a.requestOptions()),
+		agent.WithExamples(a.examples),
+		agent.WithTurnContext(func(ctx context.Context, message string) string { return a.turnContext() }),
+		agent.WithContextLimit(a.promptContextLimit()),
+		agent.WithCompaction(a.compactConfig.Threshold, a.compactConfig.KeepTurns),
+		agent.WithHistory(a.history),
+		agent.WithHooks(hooks...),
+	}
+	if a.taint != nil {
+		opts = append(opts, agent.WithUntrustedTools(a.taint.tools()...))
+	}
+	return opts
+}
+
+// conversation returns a pkg/agent Agent that continues a's conversation.
+// events show the reply as the caller wants; the chat's own bookkeeping is
+// added to them: a.history follows the agent's, and the transcript, tool
+// results, usage and per-inference stats are recorded.
+func (a *Agent) conversation(events agent.Events) *agent.Agent {
+	var c *agent.Agent
+	message := events.Message
+	events.Message = func(msg Message) {
+		a.history = c.History()
+		a.transcript.message(msg)
+		if message != nil {
+			message(msg)
+		}
+	}
+	toolCallStart := events.ToolCallStart
+	events.ToolCallStart = func(call tools.Call) {
+		a.transcript.toolCalls([]tools.Call{call})
+		if !quiet {
+			fmt.Printf(colorBrightGreen+"tool"+colorReset+": %s\n", call.Name)
+		}
+		if toolCallStart != nil {
+			toolCallStart(call)
+		}
+	}
+	toolResult := events.ToolResult
+	events.ToolResult = func(call tools.Call, result string, err error) {
+		if err != nil {
+			fmt.Printf(colorBrightRed+"Tool error: %v"+colorReset+"\n", err)
+		}
+		if toolResult != nil {
+			toolResult(call, result, err)
+		}
+	}
+	toolOutput := events.ToolOutput
+	events.ToolOutput = func(call tools.Call, result interface{}) {
+		if !quiet {
+			fmt.Println(tools.RenderToolResult(call.Name, result))
+		}
+		a.toolCalls = append(a.toolCalls, call.Name)
+		if toolOutput != nil {
+			toolOutput(call, result)
+		}
+	}
+	stats := events.Stats
+	events.Stats = func(s *provider.Stats) {
+		if a.usage != nil {
+			warning, err := a.usage.Record(usageProvider(), s.PromptTokens+s.TokenCount)
+			if err != nil {
+				slog.Warn(err.Error())
+			} else if warning != "" {
+				slog.Warn(warning)
+			}
+		}
+		a.recordTurn(s)
+		if a.latency != nil {
+			a.latency.observe(s)
+		}
+		if stats != nil {
+			stats(s)
+		}
+	}
+	if events.Notice == nil {
+		events.Notice = func(text string) { fmt.Println(colorGray + "(" + text + ")" + colorReset) }
+	}
+	c = agent.NewAgent(append(a.conversationOptions(), agent.WithEventSink(events))...)
+	return c
+}
+
+// inferOnce streams the model's next reply to a's conversation to onToken
+// and returns it with its stats, without adding it to the conversation or
+// running the tools it calls.
+func (a *Agent) inferOnce(ctx context.Context, onToken func(string)) (string, *provider.Stats, error) {
+	stats := &provider.Stats{}
+	events := agent.Events{Token: onToken, Stats: func(s *provider.Stats) { stats = s }}
+	reply, err := agent.NewAgent(append(a.conversationOptions(), agent.WithEventSink(events))...).Infer(ctx)
+	return reply, stats, err
+}
+
+// requestHook brings each request up to date with the chat: the usage
+// budget is checked and the options follow /retry and the latency budget.
+func (a *Agent) requestHook() agent.Hooks {
+	return agent.Hooks{BeforeInference: func(ctx context.Context, request *provider.Request) error {
+		if a.usage != nil {
+			if err := a.usage.CheckBudget(usageProvider()); err != nil {
+				return err
+			}
+		}
+		request.Options = a.requestOptions()
+		a.dump.Marker("POST /api/generate model=%s", a.modelName)
+		return nil
+	}}
+}
+
+// promptContextLimit is the context limit the conversation is trimmed to:
+// the model's, or less when the prompt would not fit the latency budget.
+// Three quarters of the limit go to the prompt, the rest to the reply.
+func (a *Agent) promptContextLimit() int {
+	if a.latency != nil && a.contextLimit > 0 {
+		return min(a.contextLimit, a.latency.promptTokens()*4/3)
+	}
+	return a.contextLimit
+}
+
+// confirmToolCall asks the user, or the approver of ctx, to approve a call.
+func confirmToolCall(ctx context.Context, call tools.Call, action string) bool {
+	return tools.Confirm(ctx, action)
+}
+
+// interruptibleTool runs a tool so that Ctrl-C stops the tool instead of
+// exiting, and the model is told it was stopped.
+type interruptibleTool struct {
+	tools.Tool
+}
+
+func (t interruptibleTool) Call(ctx context.Context, input json.RawMessage) (interface{}, error) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	toolRunning.Store(true)
+	defer toolRunning.Store(false)
+	result, err := t.Tool.Call(ctx, input)
+	progress.clear()
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("stopped by the user: %w", err)
+	}
+	return result, err
+}
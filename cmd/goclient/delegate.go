@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// defaultDelegateIterations bounds the replies of a sub-agent that does not
+// set max_iterations.
+const defaultDelegateIterations = 8
+
+// maxDelegateIterations caps max_iterations requested by the model.
+const maxDelegateIterations = 25
+
+// delegateSystemPrompt frames the sub-agent's work; the task's own
+// instructions, if any, come first.
+const delegateSystemPrompt = `You are a sub-agent working on one task for another assistant, who sees only your final reply.
+Use the tools to investigate, then reply with a concise, self-contained answer: the facts found, with file paths and names, and nothing else.
+If you cannot finish, say what you found and what is missing.`
+
+// registerDelegateTool adds delegate_task, which runs a sub-agent on the
+// chat agent's model.
+func registerDelegateTool(a *Agent) {
+	tools.RegisterTool(tools.NewTool("delegate_task",
+		`Hand a self-contained task to a sub-agent with its own, empty conversation and return its final answer. `+
+			`Use it for exploration that would otherwise fill this conversation, e.g. finding where something is implemented. `+
+			`The sub-agent can only read and search the workspace unless tools lists others. `+
+			`Arguments: {"task": "what to find out or do, with all the context needed", "instructions": "optional system prompt", `+
+			`"tools": ["read_file", "list_files"], "max_iterations": 8}; only task is required.`,
+		a.delegate,
+		tools.WithSummary("Delegate a self-contained task to a sub-agent and get its answer."),
+		tools.WithExamples(`{"task": "Find where HTTP timeouts are configured and list the files and values."}`)))
+}
+
+// delegateInput is the input of delegate_task.
+type delegateInput struct {
+	Task          string      `json:"task" description:"what to find out or do, with all the context needed"`
+	Instructions  string      `json:"instructions,omitempty" description:"system prompt for the sub-agent"`
+	Tools         interface{} `json:"tools,omitempty" description:"names of the tools the sub-agent may use"`
+	MaxIterations int         `json:"max_iterations,omitempty" description:"the most replies that may call tools"`
+}
+
+// delegate implements delegate_task.
+func (a *Agent) delegate(ctx context.Context, input delegateInput) (string, error) {
+	task := input.Task
+	if strings.TrimSpace(task) == "" {
+		return "", fmt.Errorf("%w: task is required", tools.ErrInvalidToolArgs)
+	}
+	iterations := defaultDelegateIterations
+	if input.MaxIterations > 0 {
+		iterations = min(input.MaxIterations, maxDelegateIterations)
+	}
+	available, err := delegateTools(input.Tools)
+	if err != nil {
+		return "", err
+	}
+
+	system := delegateSystemPrompt
+	if strings.TrimSpace(input.Instructions) != "" {
+		system = input.Instructions + "\n\n" + system
+	}
+	sub := NewAgent(withModel(a.modelName), withSystemPrompt(system), withMaxIterations(iterations))
+	sub.httpClient = a.httpClient
+	sub.stopSequences = a.stopSequences
+	sub.numCtx = a.numCtx
+	sub.contextLimit = a.contextLimit
+	sub.toolGrammar = a.toolGrammar
+	sub.dump = a.dump
+	sub.taint = a.taint
+	sub.usage = a.usage
+	sub.hooks = a.hooks
+	sub.systemPrompt += "\n\n" + tools.ToolPromptWith(available, a.toolGrammar, false)
+	sub.tools = map[string]bool{}
+	for _, tool := range available {
+		sub.tools[tool.Name()] = true
+	}
+	return sub.runSubAgent(ctx, task, nil)
+}
+
+// delegateTools returns the tools a sub-agent may use: the named ones, or
+// the tools that only read the workspace. Sub-agents cannot delegate.
+func delegateTools(requested interface{}) ([]tools.Tool, error) {
+	var names []string
+	switch v := requested.(type) {
+	case nil:
+		names = readOnlyTools()
+	case []interface{}:
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("tools must be a list of tool names")
+			}
+			names = append(names, name)
+		}
+	case string:
+		names = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	default:
+		return nil, fmt.Errorf("tools must be a list of tool names")
+	}
+	sort.Strings(names)
+
+	var available []tools.Tool
+	for _, name := range names {
+		if name == "delegate_task" {
+			return nil, fmt.Errorf("a sub-agent cannot delegate_task")
+		}
+		tool, ok := tools.LookupTool(name)
+		if !ok {
+			continue // e.g. semantic_search without embeddings configured
+		}
+		available = append(available, tool)
+	}
+	if len(available) == 0 && requested != nil {
+		return nil, fmt.Errorf("none of the requested tools exist")
+	}
+	return available, nil
+}
+
+// runSubAgent runs the tool loop on task, a fresh conversation, until the
+// model replies without calling a tool, and returns that reply. Replies are
+// passed to stream, if set, as they arrive.
+func (a *Agent) runSubAgent(ctx context.Context, task string, stream func(string)) (string, error) {
+	a.history = nil
+	return a.continueSubAgent(ctx, task, stream)
+}
+
+// continueSubAgent is runSubAgent for a follow-up message: the conversation
+// so far is kept.
+func (a *Agent) continueSubAgent(ctx context.Context, task string, stream func(string)) (string, error) {
+	a.history = append(a.history, Message{Role: "user", Content: task, Time: time.Now()})
+	start := time.Now()
+	step := 1
+	c := a.conversation(agent.Events{
+		Token: func(part string) {
+			if stream != nil {
+				stream(part)
+			}
+		},
+		TurnComplete: func(reply string) {
+			if stream != nil {
+				stream("\n")
+			}
+		},
+		Stats: func(stats *provider.Stats) {
+			if len(stats.ToolCalls) > 0 && !quiet {
+				fmt.Printf(colorGray+"(sub-agent step %d: %s)"+colorReset+"\n", step, strings.Join(stats.ToolCalls, ", "))
+			}
+			step++
+		},
+	})
+	reply, err := c.Continue(ctx)
+	switch {
+	case errors.Is(err, agent.ErrToolLoop):
+		return "", fmt.Errorf("sub-agent %v. Its last reply was: %s", err, strings.TrimSpace(reply))
+	case err != nil:
+		return "", fmt.Errorf("sub-agent failed at step %d: %v", step, err)
+	}
+	if !quiet {
+		fmt.Printf(colorGray+"(sub-agent finished in %d steps, %.1fs)"+colorReset+"\n", step-1, time.Since(start).Seconds())
+	}
+	return strings.TrimSpace(reply), nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeSpace is not implemented on this platform.
+func freeSpace(dir string) (uint64, error) {
+	return 0, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+const docgenUsage = `Usage: goclient docgen [flags]
+
+Generates or updates the package doc comments and README.md of the Go module
+in the current directory. Each change is shown as a diff and only written
+after confirmation.
+
+Flags:`
+
+const docgenSystemPrompt = `You are a technical writer documenting a Go project. Be accurate: only describe
+what the outline and existing documentation show. Prefer short, concrete sentences.
+Reply with the requested document only, without commentary.`
+
+// runDocgenCommand implements `goclient docgen` and returns the exit code.
+func runDocgenCommand(args []string) int {
+	fs := flag.NewFlagSet("docgen", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, docgenUsage)
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "", "Name of the Ollama model to use. If empty, you will be prompted to select.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+	readme := fs.Bool("readme", true, "Generate or update README.md.")
+	packages := fs.Bool("packages", true, "Generate package doc comments (doc.go) for packages without one.")
+	yes := fs.Bool("yes", false, "Write every change without asking.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if err := configureSandbox(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring sandbox: %v\n", err)
+		return 1
+	}
+	input := newLineInput()
+	defer input.Close()
+	if *model == "" {
+		*model, err = selectOllamaModel(provider.NewClient(30*time.Second), input.line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting Ollama model: %v\n", err)
+			return 1
+		}
+	}
+
+	tools.OnProgress = progress.show
+	tools.Approve = func(action string) bool {
+		if *yes {
+			return true
+		}
+		answer, ok := input.line(colorYellow + action + colorReset + " [y/N]: ")
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return ok && (answer == "y" || answer == "yes")
+	}
+
+	d := &docgen{agent: NewAgent(withModel(*model), withSystemPrompt(docgenSystemPrompt))}
+	d.agent.httpClient.Timeout = 5 * time.Minute
+	d.agent.stopSequences = cfg.stopSequences(*model)
+	d.agent.numCtx = cfg.numCtx(*model)
+	if err := d.run(context.Background(), *packages, *readme); err != nil {
+		progress.clear()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type docgen struct {
+	agent    *Agent
+	module   string
+	outlines []tools.PackageOutline
+}
+
+func (d *docgen) run(ctx context.Context, packages, readme bool) error {
+	d.module = moduleName("go.mod")
+	if d.module == "" {
+		return fmt.Errorf("no go.mod in the current directory; run docgen from the module root")
+	}
+	outlines, err := tools.OutlinePackages(".")
+	if err != nil {
+		return err
+	}
+	d.outlines = outlines
+	fmt.Printf("Module %s: %d packages\n", d.module, len(outlines))
+
+	if packages {
+		for i, pkg := range d.outlines {
+			if pkg.Doc != "" {
+				continue
+			}
+			tools.OnProgress(tools.Progress{Task: "drafting package docs", Done: i, Total: len(d.outlines), Current: pkg.Dir})
+			if err := d.packageDoc(ctx, pkg); err != nil {
+				return err
+			}
+		}
+	}
+	if readme {
+		tools.OnProgress(tools.Progress{Task: "drafting README.md"})
+		if err := d.readme(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageDoc drafts a doc.go holding the package comment of pkg.
+func (d *docgen) packageDoc(ctx context.Context, pkg tools.PackageOutline) error {
+	start := "Package " + pkg.Name
+	if pkg.Name == "main" {
+		start = "the command name" // doc comments of commands describe the program
+	}
+	prompt := fmt.Sprintf("Write the Go package doc comment for this package of module %s.\n\n%s\n\n"+
+		"Start with %q and explain what the package is for in 2-5 sentences. "+
+		"Reply with the comment text only, without // markers.", d.module, pkg, start)
+	text, err := d.agent.generateOnce(ctx, d.agent.systemPrompt, prompt)
+	if err != nil {
+		return err
+	}
+	content := docComment(stripFence(text)) + "package " + pkg.Name + "\n"
+	return d.propose(ctx, filepath.Join(pkg.Dir, "doc.go"), content)
+}
+
+// readme drafts README.md from the outline and the existing README, and
+// asks the model to fix Go snippets that do not compile.
+func (d *docgen) readme(ctx context.Context) error {
+	existing, err := os.ReadFile("README.md")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read README.md: %v", err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Module: %s\n\nPackages:\n", d.module)
+	for _, pkg := range d.outlines {
+		b.WriteString(pkg.String() + "\n\n")
+	}
+	if len(existing) > 0 {
+		b.WriteString("Current README.md:\n" + string(existing) + "\n\n")
+		b.WriteString("Update the README so it matches the packages above. Keep sections that are still accurate, ")
+		b.WriteString("fix ones that are not and document missing features. Reply with the complete README in markdown.")
+	} else {
+		b.WriteString("Write a README.md for this project: what it is, how to install and build it, how to use it, ")
+		b.WriteString("and a short overview of the packages. Reply with the complete README in markdown.")
+	}
+	prompt := b.String()
+
+	text, err := d.agent.generateOnce(ctx, d.agent.systemPrompt, prompt)
+	if err != nil {
+		return err
+	}
+	text = stripFence(text)
+	if problems := verifySnippets(text); len(problems) > 0 {
+		tools.OnProgress(tools.Progress{Task: fmt.Sprintf("fixing %d Go snippets", len(problems))})
+		retry := prompt + "\n\nYour previous README:\n" + text + "\n\nThese Go snippets in it do not compile:\n- " +
+			strings.Join(problems, "\n- ") + "\nReply with the corrected complete README."
+		text, err = d.agent.generateOnce(ctx, d.agent.systemPrompt, retry)
+		if err != nil {
+			return err
+		}
+		text = stripFence(text)
+		if problems := verifySnippets(text); len(problems) > 0 {
+			progress.clear()
+			slog.Warn("README.md still has Go snippets that do not compile:\n- " + strings.Join(problems, "\n- "))
+		}
+	}
+	return d.propose(ctx, "README.md", strings.TrimSpace(text)+"\n")
+}
+
+// propose shows the change to path as a diff and writes it once approved.
+func (d *docgen) propose(ctx context.Context, path, content string) error {
+	progress.clear()
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if string(old) == content {
+		fmt.Printf("%s is up to date\n", path)
+		return nil
+	}
+	fmt.Println(tools.DiffRenderer.Render(tools.FileEdit{Path: path, Old: string(old), New: content}))
+	edit := tools.Edit{NewStr: content}
+	if len(old) > 0 {
+		edit.OldStr = string(old)
+	}
+	result, err := tools.ApplyEdits(ctx, path, []tools.Edit{edit})
+	if errors.Is(err, tools.ErrNotApproved) {
+		fmt.Printf("Skipped %s\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if result.Proposed {
+		fmt.Printf("Proposed %s to the editor\n", path)
+	} else {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	return nil
+}
+
+// moduleName returns the module path declared in a go.mod file.
+func moduleName(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(name), `"`)
+		}
+	}
+	return ""
+}
+
+// docComment turns plain text into a // comment block.
+func docComment(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		line = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(line), "//"), " ")
+		if line == "" {
+			b.WriteString("//\n")
+		} else {
+			b.WriteString("// " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// stripFence removes a code fence the model wrapped its whole reply in.
+func stripFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") {
+		return text
+	}
+	_, body, ok := strings.Cut(text, "\n")
+	if !ok {
+		return text
+	}
+	return strings.TrimSpace(strings.TrimSuffix(body, "```"))
+}
+
+var goSnippet = regexp.MustCompile("(?s)```go\\s*\n(.*?)```")
+
+// verifySnippets checks the ```go blocks of a markdown document. Complete
+// programs are built inside the module; fragments only need to parse as
+// declarations or as statements.
+func verifySnippets(markdown string) []string {
+	var problems []string
+	for i, match := range goSnippet.FindAllStringSubmatch(markdown, -1) {
+		if err := checkSnippet(match[1]); err != nil {
+			problems = append(problems, fmt.Sprintf("snippet %d: %v", i+1, err))
+		}
+	}
+	return problems
+}
+
+func checkSnippet(code string) error {
+	fset := token.NewFileSet()
+	if file, err := parser.ParseFile(fset, "snippet.go", code, 0); err == nil {
+		if file.Name.Name == "main" {
+			return buildSnippet(code)
+		}
+		return nil
+	} else if strings.HasPrefix(strings.TrimSpace(code), "package ") {
+		return err
+	}
+	if _, err := parser.ParseFile(fset, "snippet.go", "package p\n"+code, 0); err == nil {
+		return nil
+	}
+	_, err := parser.ParseFile(fset, "snippet.go", "package p\nfunc _() {\n"+code+"\n}", 0)
+	if err != nil {
+		return fmt.Errorf("does not parse: %v", err)
+	}
+	return nil
+}
+
+// buildSnippet compiles a complete program in a temporary directory inside
+// the module, so imports of the module's own packages resolve.
+func buildSnippet(code string) error {
+	dir, err := os.MkdirTemp(".", ".docgen-")
+	if err != nil {
+		return fmt.Errorf("failed to create build directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0o644); err != nil {
+		return fmt.Errorf("failed to write snippet: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull, "./"+filepath.Base(dir))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("does not build: %s", strings.TrimSpace(strings.ReplaceAll(string(output), dir+"/", "")))
+	}
+	return nil
+}
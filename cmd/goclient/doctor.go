@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// minOllamaVersion is the oldest Ollama that reports model_info (and so
+// the context length) from /api/show.
+const minOllamaVersion = "0.3.0"
+
+// Free space below these limits in a state directory is reported.
+const (
+	lowDiskSpace      = 1 << 30   // indexes and sessions may not fit
+	criticalDiskSpace = 100 << 20 // writes are likely to fail
+)
+
+// checkStatus is the outcome of one doctor check.
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+// check is one doctor finding, with a suggested fix unless it is OK.
+type check struct {
+	name   string
+	status checkStatus
+	detail string
+	fix    string
+}
+
+func (c check) String() string {
+	label := map[checkStatus]string{
+		checkOK:   colorBrightGreen + " ok " + colorReset,
+		checkWarn: colorYellow + "warn" + colorReset,
+		checkFail: colorBrightRed + "fail" + colorReset,
+	}[c.status]
+	line := fmt.Sprintf("[%s] %s: %s", label, c.name, c.detail)
+	if c.fix != "" && c.status != checkOK {
+		line += "\n       fix: " + c.fix
+	}
+	return line
+}
+
+// runDoctorCommand implements `goclient doctor` and returns the exit code:
+// 1 if any check failed.
+func runDoctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	model := fs.String("model", "", "Also check that this model is installed and fits in memory.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Check with this profile from the config file applied.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !useColor(os.Stdout) {
+		disableColor()
+	}
+
+	if cfg, err := loadConfig(*configPath, *profile); err == nil {
+		configureHost(cfg) // errors are reported by checkConfig
+	}
+	client := provider.NewClient(5 * time.Second)
+	var checks []check
+	checks = append(checks, checkOllama(client)...)
+	checks = append(checks, checkModels(client, *model)...)
+	checks = append(checks, checkConfig(*configPath, *profile)...)
+	checks = append(checks, checkStateDirs()...)
+	checks = append(checks, checkTerminal())
+
+	failed := 0
+	for _, c := range checks {
+		fmt.Println(c)
+		if c.status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d checks failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+// ollamaVersion returns the version reported by /api/version.
+func ollamaVersion(client *http.Client) (string, error) {
+	resp, err := client.Get(provider.OllamaHost + "/api/version")
+	if err != nil {
+		return "", fmt.Errorf("%w at %s: %w", provider.ErrOllamaUnreachable, provider.OllamaHost, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Ollama /api/version request failed with status %d", resp.StatusCode)
+	}
+	var body struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode Ollama version: %v", err)
+	}
+	return body.Version, nil
+}
+
+func checkOllama(client *http.Client) []check {
+	version, err := ollamaVersion(client)
+	if err != nil {
+		return []check{{name: "ollama", status: checkFail, detail: err.Error(),
+			fix: "start Ollama with 'ollama serve' (or the desktop app), or set host in the config to where it runs"}}
+	}
+	c := check{name: "ollama", detail: "version " + version}
+	if olderVersion(version, minOllamaVersion) {
+		c.status = checkWarn
+		c.detail += fmt.Sprintf(", older than %s: context lengths are not reported and long conversations may be cut off", minOllamaVersion)
+		c.fix = "upgrade Ollama from https://ollama.com/download"
+	}
+	return []check{c}
+}
+
+// olderVersion compares dotted version numbers; unparsable parts count as 0.
+func olderVersion(version, than string) bool {
+	parse := func(v string) []int {
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		var parts []int
+		for _, part := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(part)
+			parts = append(parts, n)
+		}
+		return parts
+	}
+	a, b := parse(version), parse(than)
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// checkModels reports installed models that are larger than the available
+// memory, which makes Ollama swap or fall back to the CPU and appear to hang.
+func checkModels(client *http.Client, model string) []check {
+	resp, err := client.Get(provider.OllamaHost + "/api/tags")
+	if err != nil {
+		return nil // already reported by checkOllama
+	}
+	defer resp.Body.Close()
+	var tags struct {
+		Models []provider.ModelInfo `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return []check{{name: "models", status: checkWarn, detail: fmt.Sprintf("failed to decode Ollama tags response: %v", err)}}
+	}
+	if len(tags.Models) == 0 {
+		return []check{{name: "models", status: checkFail, detail: "no models installed", fix: "pull one, e.g. 'ollama pull llama3'"}}
+	}
+
+	memory, memErr := availableMemory()
+	var checks []check
+	found := model == ""
+	for _, m := range tags.Models {
+		if model != "" && m.Name != model && m.Name != model+":latest" {
+			continue
+		}
+		found = true
+		c := check{name: "model " + m.Name, detail: fmt.Sprintf("%.1f GB", float64(m.Size)/(1<<30))}
+		switch {
+		case memErr != nil:
+			c.detail += "; available memory unknown: " + memErr.Error()
+		case uint64(m.Size) > memory:
+			c.status = checkWarn
+			c.detail += fmt.Sprintf(", more than the %.1f GB of available memory: replies will be very slow", float64(memory)/(1<<30))
+			c.fix = "use a smaller model or quantization (e.g. a q4 tag), or close other programs"
+		}
+		checks = append(checks, c)
+	}
+	if !found {
+		checks = append(checks, check{name: "model " + model, status: checkFail, detail: "not installed", fix: "ollama pull " + model})
+	}
+	return checks
+}
+
+// availableMemory returns the memory available for a model, in bytes.
+func availableMemory() (uint64, error) {
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/meminfo")
+		if err != nil {
+			return 0, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "MemAvailable:" {
+				kb, err := strconv.ParseUint(fields[1], 10, 64)
+				return kb * 1024, err
+			}
+		}
+		return 0, fmt.Errorf("no MemAvailable in /proc/meminfo")
+	case "darwin":
+		// Unified memory is shared with the GPU; the total is the useful bound.
+		out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+	default:
+		return 0, fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+}
+
+// checkConfig loads the config file and validates the tools and settings
+// it declares, as the chat would at startup.
+func checkConfig(path, profile string) []check {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return []check{{name: "config", detail: path + " does not exist; using defaults"}}
+	}
+	cfg, err := loadConfig(path, profile)
+	if err != nil {
+		return []check{{name: "config", status: checkFail, detail: err.Error(), fix: "correct the YAML in " + path}}
+	}
+	var problems []string
+	for _, tool := range cfg.Tools {
+		if _, err := tool.Definition(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, macro := range cfg.Macros {
+		if _, err := macro.Definition(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for name, mc := range cfg.Models {
+		if mc.ToolFormat == "" {
+			continue
+		}
+		if _, err := tools.ParseToolGrammar(mc.ToolFormat); err != nil {
+			problems = append(problems, fmt.Sprintf("model %s: %v", name, err))
+		}
+	}
+	if err := configureSandbox(cfg); err != nil {
+		problems = append(problems, err.Error())
+	} else if cfg.Sandbox != nil && cfg.Sandbox.Backend == "docker" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			problems = append(problems, "the docker sandbox is configured but docker is not installed")
+		}
+	}
+	if len(problems) > 0 {
+		return []check{{name: "config", status: checkFail, detail: path + ": " + strings.Join(problems, "; "), fix: "correct these settings in " + path}}
+	}
+	return []check{{name: "config", detail: fmt.Sprintf("%s (%d tools, %d macros)", path, len(cfg.Tools), len(cfg.Macros))}}
+}
+
+// checkStateDirs checks that the directories goclient writes to are
+// writable and have space left.
+func checkStateDirs() []check {
+	dirs := []string{dataDir(), tools.StateDir}
+	if cache, err := os.UserCacheDir(); err == nil {
+		dirs = append(dirs, filepath.Join(cache, "goclient"))
+	}
+	var checks []check
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		c := check{name: "disk " + dir}
+		free, err := freeSpace(dir)
+		switch {
+		case err != nil:
+			c.status, c.detail = checkWarn, "free space unknown: "+err.Error()
+		case free < criticalDiskSpace:
+			c.status, c.detail = checkFail, fmt.Sprintf("only %d MB free", free>>20)
+			c.fix = "free up disk space; sessions, statistics and indexes are written here"
+		case free < lowDiskSpace:
+			c.status, c.detail = checkWarn, fmt.Sprintf("only %d MB free", free>>20)
+			c.fix = "free up disk space before building search indexes"
+		default:
+			c.detail = fmt.Sprintf("%.1f GB free", float64(free)/(1<<30))
+		}
+		if err := checkWritable(dir); err != nil {
+			c.status, c.detail = checkFail, err.Error()
+			c.fix = "fix the permissions of " + dir
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// existingParent returns dir, or its nearest parent that exists.
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// checkWritable creates and removes a file in dir, or in the nearest
+// existing parent when dir has not been created yet.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(existingParent(dir), ".goclient-doctor-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %v", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkTerminal reports output that will not display well.
+func checkTerminal() check {
+	c := check{name: "terminal"}
+	switch {
+	case !isTerminal(os.Stdout):
+		c.detail = "output is not a terminal: colours are off and only answers go to stdout"
+	case os.Getenv("NO_COLOR") != "":
+		c.detail = "NO_COLOR is set: colours are off"
+	case os.Getenv("TERM") == "dumb":
+		c.status, c.detail = checkWarn, "TERM=dumb: colours and the progress line may not display"
+		c.fix = "use a terminal that supports ANSI escape codes"
+	default:
+		c.detail = "TERM=" + os.Getenv("TERM")
+	}
+	return c
+}
+
+// startupWarning checks the Ollama version when the chat starts and returns
+// a warning, or "" when nothing is wrong.
+func startupWarning(client *http.Client) string {
+	version, err := ollamaVersion(client)
+	if err != nil {
+		return err.Error() + ". Run 'goclient doctor' to diagnose."
+	}
+	if olderVersion(version, minOllamaVersion) {
+		return fmt.Sprintf("Ollama %s is older than %s; run 'goclient doctor' for details.", version, minOllamaVersion)
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamDumpFlushInterval throttles how often buffered dump lines are flushed
+// to disk, so dumping doesn't slow down token streaming.
+const streamDumpFlushInterval = 500 * time.Millisecond
+
+// streamDump writes every raw NDJSON line received from the backend to a
+// file, prefixed with a timestamp.
+type streamDump struct {
+	mu        sync.Mutex
+	file      *os.File
+	writer    *bufio.Writer
+	lastFlush time.Time
+}
+
+// newStreamDump opens path for appending.
+func newStreamDump(path string) (*streamDump, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream dump file: %v", err)
+	}
+	return &streamDump{file: f, writer: bufio.NewWriter(f), lastFlush: time.Now()}, nil
+}
+
+// Marker records a non-stream event, such as the start of a request.
+func (d *streamDump) Marker(format string, args ...interface{}) {
+	d.write("# " + fmt.Sprintf(format, args...))
+}
+
+// Line records one raw line from the stream.
+func (d *streamDump) Line(line []byte) {
+	d.write(string(line))
+}
+
+func (d *streamDump) write(text string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.writer, "%s %s\n", time.Now().Format(time.RFC3339Nano), strings.TrimRight(text, "\r\n"))
+	if time.Since(d.lastFlush) >= streamDumpFlushInterval {
+		d.writer.Flush()
+		d.lastFlush = time.Now()
+	}
+}
+
+// Close flushes any buffered lines and closes the file.
+func (d *streamDump) Close() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.writer.Flush(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
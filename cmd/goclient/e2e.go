@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/provider/providertest"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// E2EScenario is a scripted conversation run against a real model, or
+// against scripted replies when Replies is set or a recorded session when
+// Cassette is set. The scenario runs in a fresh temporary directory; paths
+// are relative to it.
+type E2EScenario struct {
+	Name       string              `yaml:"name"`
+	Model      string              `yaml:"model"`
+	Agent      string              `yaml:"agent"`
+	Timeout    time.Duration       `yaml:"timeout"`
+	Tools      []tools.CommandTool `yaml:"tools"`
+	Files      map[string]string   `yaml:"files"` // files created before the run
+	Inputs     []string            `yaml:"inputs"`
+	Replies    []string            `yaml:"replies"`     // the model's replies, in order, served by a fake Ollama
+	ToolFormat string              `yaml:"tool_format"` // tool-call format of the replies; text by default
+	Cassette   string              `yaml:"cassette"`    // a -record cassette to replay, relative to the scenario
+	Approve    bool                `yaml:"approve"`     // answer yes to every approval; by default all are denied
+	Expect     E2EExpectations     `yaml:"expect"`
+}
+
+// E2EExpectations are checked after the scenario's inputs are exhausted.
+type E2EExpectations struct {
+	Tools []string          `yaml:"tools"` // tools that must have been executed
+	Files map[string]string `yaml:"files"` // path -> substring the file must contain
+}
+
+// defaultE2ETimeout bounds a scenario when it does not set a timeout.
+const defaultE2ETimeout = 5 * time.Minute
+
+// runE2EScenario runs the scenario at path and returns the process exit code.
+// modelOverride, when set, replaces the scenario's model unless the scenario
+// scripts the replies.
+func runE2EScenario(path, modelOverride string, cfg *Config) (exitCode int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error reading scenario: %v\n", err)
+		return 2
+	}
+	var scenario E2EScenario
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		fmt.Printf("Error parsing scenario %s: %v\n", path, err)
+		return 2
+	}
+	if len(scenario.Replies) > 0 {
+		// The replies are the model; a real one is not needed.
+		if scenario.Model == "" {
+			scenario.Model = "scripted"
+		}
+		server := providertest.NewServer(scenario.Model, scenario.Replies...)
+		defer server.Close()
+		provider.OllamaHost = server.URL
+		defer func() {
+			if n := server.Remaining(); n > 0 && exitCode == 0 {
+				fmt.Printf("FAIL: %d scripted replies were not used\n", n)
+				exitCode = 1
+			}
+		}()
+	} else if scenario.Cassette != "" {
+		// The recording is the model; so is its name.
+		cassette, err := provider.ReplayCassette(filepath.Join(filepath.Dir(path), scenario.Cassette))
+		if err != nil {
+			fmt.Printf("Error in scenario %s: %v\n", path, err)
+			return 2
+		}
+		provider.ActiveCassette = cassette
+		defer func() {
+			if n := cassette.Remaining(); n > 0 && exitCode == 0 {
+				fmt.Printf("FAIL: %d recorded requests were not made\n", n)
+				exitCode = 1
+			}
+		}()
+	} else if modelOverride != "" {
+		scenario.Model = modelOverride
+	}
+	grammar := tools.GrammarText
+	if scenario.ToolFormat != "" {
+		if grammar, err = tools.ParseToolGrammar(scenario.ToolFormat); err != nil {
+			fmt.Printf("Error in scenario %s: %v\n", path, err)
+			return 2
+		}
+	}
+	if scenario.Model == "" {
+		fmt.Println("Error: scenario does not set a model; pass -model")
+		return 2
+	}
+	if scenario.Timeout <= 0 {
+		scenario.Timeout = defaultE2ETimeout
+	}
+
+	tools.Approve = func(action string) bool { return scenario.Approve }
+
+	for _, tool := range scenario.Tools {
+		def, err := tool.Definition()
+		if err != nil {
+			fmt.Printf("Error registering scenario tool: %v\n", err)
+			return 2
+		}
+		tools.RegisterTool(def)
+	}
+
+	workDir, err := os.MkdirTemp("", "goclient-e2e-")
+	if err != nil {
+		fmt.Printf("Error creating scenario directory: %v\n", err)
+		return 2
+	}
+	defer os.RemoveAll(workDir)
+	for name, content := range scenario.Files {
+		target := filepath.Join(workDir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			fmt.Printf("Error creating %s: %v\n", name, err)
+			return 2
+		}
+		if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+			fmt.Printf("Error creating %s: %v\n", name, err)
+			return 2
+		}
+	}
+	if err := os.Chdir(workDir); err != nil {
+		fmt.Printf("Error entering scenario directory: %v\n", err)
+		return 2
+	}
+
+	inputs := scenario.Inputs
+	getUserMessage := func() (string, bool) {
+		if len(inputs) == 0 {
+			return "", false
+		}
+		input := inputs[0]
+		inputs = inputs[1:]
+		fmt.Printf(colorBlue+"You (scripted)"+colorReset+": %s\n", input)
+		return input, true
+	}
+
+	fmt.Printf("Running scenario %q with model %s in %s\n", scenario.Name, scenario.Model, workDir)
+	a := NewAgent(withModel(scenario.Model), withUserInput(getUserMessage), withSystemPrompt(getSystemPrompt(scenario.Agent)+"\n\n"+tools.ToolPromptFor(grammar, false)))
+	a.stopSequences = cfg.stopSequences(scenario.Model)
+	a.toolGrammar = grammar
+
+	ctx, cancel := context.WithTimeout(context.Background(), scenario.Timeout)
+	defer cancel()
+	if err := a.Run(ctx); err != nil {
+		fmt.Printf("FAIL: agent run failed: %v\n", err)
+		return 1
+	}
+
+	failures := checkE2EExpectations(scenario.Expect, a.toolCalls)
+	if len(failures) > 0 {
+		for _, failure := range failures {
+			fmt.Printf("FAIL: %s\n", failure)
+		}
+		return 1
+	}
+	fmt.Printf("PASS: %s\n", scenario.Name)
+	return 0
+}
+
+// checkE2EExpectations returns a description of every unmet expectation.
+func checkE2EExpectations(expect E2EExpectations, toolCalls []string) []string {
+	var failures []string
+	executed := map[string]bool{}
+	for _, name := range toolCalls {
+		executed[name] = true
+	}
+	for _, name := range expect.Tools {
+		if !executed[name] {
+			failures = append(failures, fmt.Sprintf("expected tool %s to be executed (executed: %v)", name, toolCalls))
+		}
+	}
+	for name, want := range expect.Files {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("expected file %s: %v", name, err))
+			continue
+		}
+		if !strings.Contains(string(content), want) {
+			failures = append(failures, fmt.Sprintf("file %s does not contain %q", name, want))
+		}
+	}
+	return failures
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+const genTestsUsage = `Usage: goclient gen-tests [flags] package-dir
+
+Writes table-driven tests for the Go package in package-dir. The code agent
+reads the package and writes _test.go files next to it; each write is shown
+as a diff and only made once approved. go test then runs on the package, and
+while it fails the output goes back to the agent to fix the tests, for at most
+-max-rounds rounds. Only _test.go files in package-dir can be written. The
+exit status is 0 once the tests pass and 1 if they still fail.
+
+Example:
+  goclient gen-tests -model qwen2.5-coder:14b ./pkg/tools
+
+Flags:`
+
+const genTestsInstructions = `You write tests for Go packages. Read the package's source with read_file
+before writing anything; use go_outline and go_doc for the APIs it uses. Write table-driven
+tests: a slice of cases with a name, the inputs and the expected result, run with t.Run.
+Test behavior through the package's API, cover edge cases and errors, and use only the
+standard library. Put the tests in _test.go files in the package's directory, in the same
+package, next to the file they test (tests for parse.go go in parse_test.go). Create a file
+with edit_file and an empty old_str; to change a test file, replace part of it. Never change
+a file that is not a _test.go file. When you are done, reply with a short summary and no
+tool call.`
+
+// defaultGenTestsRounds bounds how many times go test runs.
+const defaultGenTestsRounds = 5
+
+// maxTestOutput bounds the go test output sent back to the model.
+const maxTestOutput = 8 << 10
+
+// runGenTestsCommand implements `goclient gen-tests` and returns the exit
+// code.
+func runGenTestsCommand(args []string) int {
+	fs := flag.NewFlagSet("gen-tests", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, genTestsUsage)
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "", "Name of the Ollama model to use. If empty, you will be prompted to select.")
+	rounds := fs.Int("max-rounds", defaultGenTestsRounds, "Times go test runs before giving up on tests that fail.")
+	timeout := fs.Duration("timeout", 2*time.Minute, "Timeout of each go test run.")
+	yes := fs.Bool("yes", false, "Write every test file without asking.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 || *rounds < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	dir := filepath.Clean(fs.Arg(0))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", fs.Arg(0))
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return exitFailed
+	}
+	if err := applyConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailed
+	}
+	input := newLineInput()
+	defer input.Close()
+	if *model == "" {
+		*model, err = selectOllamaModel(provider.NewClient(30*time.Second), input.line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting Ollama model: %v\n", err)
+			return exitFailed
+		}
+	}
+	tools.OnProgress = progress.show
+	tools.Approve = func(action string) bool {
+		if *yes {
+			return true
+		}
+		answer, ok := input.line(colorYellow + action + colorReset + " [y/N]: ")
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return ok && (answer == "y" || answer == "yes")
+	}
+
+	ctx := handleSignals(context.Background())
+	g := &genTests{dir: dir, rounds: *rounds, timeout: *timeout}
+	if err := g.setup(ctx, cfg, *model); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailed
+	}
+	passed, err := g.run(ctx)
+	progress.clear()
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailed
+	case !passed:
+		return exitFailed
+	}
+	return exitOK
+}
+
+// genTests drives the agent writing tests for one package.
+type genTests struct {
+	dir     string
+	rounds  int
+	timeout time.Duration
+	agent   *Agent
+	written map[string]bool // test files written, by workspace-relative path
+	writes  int             // edit_file calls that succeeded
+	denied  int             // writes the user refused in this round
+}
+
+// setup builds the agent: the code agent's examples with the read-only
+// tools and edit_file, whose calls go through approve.
+func (g *genTests) setup(ctx context.Context, cfg *Config, model string) error {
+	if output, err := exec.CommandContext(ctx, "go", "build", g.pattern()).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s does not build, so its tests cannot pass:\n%s", g.dir, strings.TrimSpace(string(output)))
+	}
+	a := NewAgent(withModel(model), withSystemPrompt(getSystemPrompt("code")+"\n\n"+genTestsInstructions))
+	a.config = cfg
+	a.httpClient.Timeout = 10 * time.Minute
+	a.examples = agentTypes["code"].exampleMessages()
+	a.tools = map[string]bool{"edit_file": true}
+	for _, name := range readOnlyTools() {
+		a.tools[name] = true
+	}
+	a.hooks = append(a.hooks, agent.Hooks{
+		BeforeToolCall: g.approve,
+		AfterToolCall: func(ctx context.Context, call tools.Call, result string, err error) {
+			path, _ := call.Args["path"].(string)
+			switch {
+			case call.Name != "edit_file":
+			case err == nil:
+				g.written[tools.DisplayPath(path)] = true
+				g.writes++
+			case errors.Is(err, tools.ErrNotApproved):
+				g.denied++
+			}
+		},
+	})
+	if err := a.useModel(ctx, model); err != nil {
+		return err
+	}
+	g.agent = a
+	g.written = map[string]bool{}
+	return nil
+}
+
+// pattern is the go package pattern of the directory.
+func (g *genTests) pattern() string {
+	if filepath.IsAbs(g.dir) {
+		return g.dir
+	}
+	return "./" + filepath.ToSlash(g.dir)
+}
+
+// approve limits edit_file to the package's _test.go files and shows each
+// write as a diff, which edit_file then asks to approve.
+func (g *genTests) approve(ctx context.Context, call *tools.Call) error {
+	if call.Name != "edit_file" {
+		return nil
+	}
+	path, _ := call.Args["path"].(string)
+	path = tools.DisplayPath(path)
+	if !strings.HasSuffix(path, "_test.go") || filepath.Dir(path) != tools.DisplayPath(g.dir) {
+		return fmt.Errorf("gen-tests only writes _test.go files in %s, not %s", tools.DisplayPath(g.dir), path)
+	}
+	oldStr, _ := call.Args["old_str"].(string)
+	newStr, _ := call.Args["new_str"].(string)
+	edit := tools.FileEdit{Path: path, Old: oldStr, New: newStr}
+	if current, err := os.ReadFile(path); err == nil && oldStr != "" && strings.Count(string(current), oldStr) == 1 {
+		edit.Old, edit.New = string(current), strings.Replace(string(current), oldStr, newStr, 1)
+	}
+	progress.clear()
+	fmt.Println(tools.DiffRenderer.Render(edit))
+	return nil
+}
+
+// run asks for tests and runs go test after each round, feeding failures
+// back, until the tests pass or the rounds are used up.
+func (g *genTests) run(ctx context.Context) (bool, error) {
+	prompt := g.firstPrompt()
+	stream := func(part string) { fmt.Print(part) }
+	for round := 1; round <= g.rounds; round++ {
+		g.denied = 0
+		before := g.writes
+		if _, err := g.agent.continueSubAgent(ctx, prompt, stream); err != nil {
+			return false, err
+		}
+		if g.writes == before && g.denied > 0 {
+			fmt.Println("No change to the tests was approved; stopping.")
+			return false, nil
+		}
+		if len(g.written) == 0 {
+			prompt = fmt.Sprintf("You have not written any test file. Write the tests into _test.go files in %s with edit_file.", g.dir)
+			continue
+		}
+		tools.OnProgress(tools.Progress{Task: fmt.Sprintf("go test %s (round %d of %d)", g.pattern(), round, g.rounds)})
+		output, err := g.test(ctx)
+		progress.clear()
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err == nil {
+			fmt.Printf(colorGreen+"Tests pass after round %d. Wrote %s."+colorReset+"\n", round, strings.Join(g.files(), ", "))
+			return true, nil
+		}
+		fmt.Printf(colorGray+"%s"+colorReset+"\n", output)
+		if round == g.rounds {
+			break
+		}
+		prompt = "go test failed:\n\n" + attachment("go test output", output) +
+			"\nFix the tests so they compile and pass. If a case fails because the package has a bug, " +
+			"do not change the package: remove the case and say what the bug is in your summary."
+	}
+	fmt.Printf(colorRed+"The tests still fail after %d rounds; the files written are %s."+colorReset+"\n", g.rounds, strings.Join(g.files(), ", "))
+	return false, nil
+}
+
+// firstPrompt asks for tests, listing the package's files so the agent
+// knows what to read and which tests exist.
+func (g *genTests) firstPrompt() string {
+	var sources, existing []string
+	entries, _ := os.ReadDir(g.dir)
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case e.IsDir() || !strings.HasSuffix(name, ".go"):
+		case strings.HasSuffix(name, "_test.go"):
+			existing = append(existing, filepath.Join(g.dir, name))
+		default:
+			sources = append(sources, filepath.Join(g.dir, name))
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Write table-driven tests for the Go package in %s.\n\nIts source files: %s\n", g.dir, strings.Join(sources, ", "))
+	if len(existing) > 0 {
+		fmt.Fprintf(&b, "Its existing tests, which you may extend but must keep passing: %s\n", strings.Join(existing, ", "))
+	}
+	fmt.Fprintf(&b, "\nThe tests are run with: go test %s\n", g.pattern())
+	return b.String()
+}
+
+// test runs go test on the package and returns its output, truncated.
+func (g *genTests) test(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "go", "test", "-count=1", g.pattern()).CombinedOutput()
+	text := strings.TrimSpace(string(output))
+	if ctx.Err() == context.DeadlineExceeded {
+		text += fmt.Sprintf("\n[go test timed out after %s; a test may hang]", g.timeout)
+	}
+	if len(text) > maxTestOutput {
+		text = text[:maxTestOutput] + "\n[output truncated]"
+	}
+	return text, err
+}
+
+// files lists the test files written, sorted.
+func (g *genTests) files() []string {
+	var files []string
+	for path := range g.written {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
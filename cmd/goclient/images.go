@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// maxImageSize is the largest image attached; vision models scale images
+// down, so anything larger is almost certainly a mistake.
+const maxImageSize = 20 << 20
+
+// imageExtensions are the image types vision models accept.
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true}
+
+// imageFlag collects repeated -image flags.
+type imageFlag []string
+
+func (f *imageFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *imageFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func init() {
+	registerCommand(command{
+		name:  "image",
+		usage: "[file...|clear]",
+		help:  "Attach images to your next message for a vision model, or list or clear the attached ones",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			switch paths := splitPaths(arg); {
+			case len(paths) == 0:
+				a.printImages()
+			case arg == "clear":
+				fmt.Printf("Removed %d attached images\n", len(a.images))
+				a.images = nil
+			default:
+				for _, path := range paths {
+					if err := a.attachImage(path); err != nil {
+						fmt.Printf("Error: %v\n", err)
+						continue
+					}
+					fmt.Printf("Attached %s to your next message\n", filepath.Base(path))
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// printImages lists the images attached to the next message.
+func (a *Agent) printImages() {
+	if len(a.images) == 0 {
+		fmt.Println("No images attached. Use /image <file>, or drag a file into the terminal, to attach one to your next message.")
+		return
+	}
+	fmt.Println("Attached to your next message:")
+	for _, path := range a.images {
+		fmt.Printf("  %s\n", path)
+	}
+}
+
+// attachImage checks that path is an image a model can be sent and attaches
+// it to the next message.
+func (a *Agent) attachImage(path string) error {
+	path, err := checkImage(path)
+	if err != nil {
+		return err
+	}
+	if !containsString(a.images, path) {
+		a.images = append(a.images, path)
+	}
+	return nil
+}
+
+// checkImage returns the absolute path of an image file, or why it cannot
+// be attached.
+func checkImage(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot attach %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("cannot attach %s: it is a directory", path)
+	}
+	if info.Size() > maxImageSize {
+		return "", fmt.Errorf("cannot attach %s: %s is larger than the %s limit", path, formatModelSize(info.Size()), formatModelSize(maxImageSize))
+	}
+	if !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot attach %s: %v", path, err)
+		}
+		defer f.Close()
+		head := make([]byte, 512)
+		n, _ := f.Read(head)
+		if !strings.HasPrefix(http.DetectContentType(head[:n]), "image/") {
+			return "", fmt.Errorf("cannot attach %s: it is not an image", path)
+		}
+	}
+	return path, nil
+}
+
+// takeImages returns the images for a message: those attached with /image
+// or -image, and image files named in the message itself, as a terminal
+// writes a file dragged into it. The attached images are used up.
+func (a *Agent) takeImages(ctx context.Context, message string) []string {
+	images := a.images
+	a.images = nil
+	for _, path := range droppedImages(message) {
+		if !containsString(images, path) {
+			images = append(images, path)
+		}
+	}
+	if len(images) > 0 && !quiet {
+		var names []string
+		for _, path := range images {
+			names = append(names, filepath.Base(path))
+		}
+		fmt.Printf(colorGray+"(sending %s)"+colorReset+"\n", strings.Join(names, ", "))
+	}
+	if len(images) > 0 {
+		a.warnIfNoVision(ctx)
+	}
+	return images
+}
+
+// droppedImages returns the image files named in message, in the forms
+// terminals paste dragged files: absolute paths, plain or quoted, with
+// spaces escaped with backslashes, or file:// URLs. A relative file name is
+// just a mention.
+func droppedImages(message string) []string {
+	var images []string
+	for _, word := range splitPaths(message) {
+		if strings.HasPrefix(word, "file://") {
+			if u, err := url.Parse(word); err == nil {
+				word = u.Path
+			}
+		}
+		if strings.HasPrefix(word, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				word = filepath.Join(home, word[2:])
+			}
+		}
+		if !filepath.IsAbs(word) || !imageExtensions[strings.ToLower(filepath.Ext(word))] {
+			continue
+		}
+		if path, err := checkImage(word); err == nil && !containsString(images, path) {
+			images = append(images, path)
+		}
+	}
+	return images
+}
+
+// splitPaths splits text into words as a shell would for quotes and
+// backslash-escaped spaces, which is how file paths are pasted.
+func splitPaths(text string) []string {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == '\\' && i+1 < len(runes) && runes[i+1] == ' ':
+			word.WriteRune(' ')
+			inWord = true
+			i++
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// isDroppedFile reports whether input starts with the path of an existing
+// file, as when a file is dragged into the terminal, so that it is sent as
+// a message rather than taken for a command.
+func isDroppedFile(input string) bool {
+	words := splitPaths(strings.TrimSpace(input))
+	if len(words) == 0 || strings.Count(words[0], "/") < 2 {
+		return false
+	}
+	info, err := os.Stat(words[0])
+	return err == nil && !info.IsDir()
+}
+
+// requestImages reads the images of the messages in history, base64
+// encoded for Ollama, in order. An image that can no longer be read is
+// left out with a warning.
+func requestImages(history []Message) []string {
+	var images []string
+	for _, msg := range history {
+		for _, path := range msg.Images {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				slog.Warn(fmt.Sprintf("leaving out image %s: %v", path, err))
+				continue
+			}
+			images = append(images, base64.StdEncoding.EncodeToString(data))
+		}
+	}
+	return images
+}
+
+// warnIfNoVision warns when Ollama reports the model's capabilities and
+// vision is not among them, since the images would be ignored or refused.
+func (a *Agent) warnIfNoVision(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	details, err := (&provider.Ollama{Client: a.httpClient}).Show(ctx, a.modelName)
+	if err != nil || len(details.Capabilities) == 0 || containsString(details.Capabilities, "vision") {
+		return
+	}
+	fmt.Printf(colorYellow+"%s does not support images; switch to a vision model such as llava or llama3.2-vision with /model."+colorReset+"\n", a.modelName)
+}
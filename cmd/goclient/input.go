@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// historyFileName is the file in the home directory that keeps the chat
+// input history.
+const historyFileName = ".goclient_history"
+
+// multiLineDelimiter starts and ends a message of several lines typed or
+// piped line by line.
+const multiLineDelimiter = `"""`
+
+// lineBreak stands for a line break in the line editor, where a pasted
+// block or Alt-Enter would otherwise submit the line.
+const lineBreak = "↵"
+
+// Bracketed paste: the terminal wraps pasted text in these sequences once
+// enabled, so its line breaks can be told apart from Enter.
+const (
+	bracketedPasteOn    = "\x1b[?2004h"
+	bracketedPasteOff   = "\x1b[?2004l"
+	bracketedPasteStart = "\x1b[200~"
+	bracketedPasteEnd   = "\x1b[201~"
+)
+
+// lineInput reads chat input. On a terminal it is a line editor with
+// Emacs key bindings, Ctrl-R history search and history persisted across
+// runs; otherwise it reads plain lines from stdin.
+type lineInput struct {
+	rl      *readline.Instance
+	scanner *bufio.Scanner
+}
+
+func newLineInput() *lineInput {
+	if isTerminal(os.Stdin) {
+		rl, err := readline.NewEx(&readline.Config{
+			HistoryFile:            historyPath(),
+			DisableAutoSaveHistory: true, // only chat messages are saved, not answers to questions
+			HistorySearchFold:      true,
+			Stdin:                  readline.NewCancelableStdin(&pasteReader{in: os.Stdin}),
+			Stdout:                 os.Stdout,
+			Stderr:                 os.Stderr,
+		})
+		if err == nil {
+			fmt.Print(bracketedPasteOn)
+			return &lineInput{rl: rl}
+		}
+		slog.Warn("line editing unavailable", "err", err)
+	}
+	return newPlainInput()
+}
+
+// newPlainInput reads lines from stdin without a line editor.
+func newPlainInput() *lineInput {
+	return &lineInput{scanner: bufio.NewScanner(os.Stdin)}
+}
+
+// historyPath returns ~/.goclient_history, or "" to keep no history.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+// message reads a chat message after showing prompt. A message starting
+// with """ continues until a line ending with """; pasted blocks and
+// Alt-Enter add line breaks without submitting the message.
+func (in *lineInput) message(prompt string) (string, bool) {
+	line, ok := in.editedLine(prompt)
+	if !ok || !strings.HasPrefix(strings.TrimSpace(line), multiLineDelimiter) {
+		return line, ok
+	}
+	text := strings.TrimPrefix(strings.TrimSpace(line), multiLineDelimiter)
+	for {
+		if body, done := strings.CutSuffix(strings.TrimRight(text, " \t"), multiLineDelimiter); done {
+			return strings.Trim(body, "\n"), true
+		}
+		next, ok := in.line(continuationPrompt(prompt))
+		if !ok {
+			return strings.Trim(text, "\n"), true
+		}
+		text += "\n" + next
+	}
+}
+
+// continuationPrompt is shown for the lines after the first of a message.
+func continuationPrompt(prompt string) string {
+	if prompt == "" {
+		return ""
+	}
+	return "... "
+}
+
+// editedLine reads a line and adds it to the history. Ctrl-C discards the
+// line being typed; it returns false at the end of input (Ctrl-D).
+func (in *lineInput) editedLine(prompt string) (string, bool) {
+	if in.rl == nil {
+		return in.line(prompt)
+	}
+	in.rl.SetPrompt(prompt)
+	defer in.rl.SetPrompt("")
+	for {
+		line, err := in.rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("\nError reading input: %v\n", err)
+			}
+			return "", false
+		}
+		if line != "" {
+			if err := in.rl.SaveHistory(line); err != nil {
+				slog.Warn("could not save input history", "err", err)
+			}
+		}
+		return strings.ReplaceAll(line, lineBreak, "\n"), true
+	}
+}
+
+// line shows prompt and reads a line that is not kept in the history, e.g.
+// the answer to a question.
+func (in *lineInput) line(prompt string) (string, bool) {
+	if in.rl != nil {
+		in.rl.SetPrompt(prompt)
+		defer in.rl.SetPrompt("")
+		line, err := in.rl.Readline()
+		return strings.ReplaceAll(line, lineBreak, "\n"), err == nil
+	}
+	fmt.Print(prompt)
+	if !in.scanner.Scan() {
+		if err := in.scanner.Err(); err != nil {
+			fmt.Printf("\nError reading input: %v\n", err)
+		}
+		return "", false
+	}
+	return in.scanner.Text(), true
+}
+
+// Close restores the terminal.
+func (in *lineInput) Close() {
+	if in.rl != nil {
+		fmt.Print(bracketedPasteOff)
+		in.rl.Close()
+	}
+}
+
+// pasteReader passes terminal input to the line editor, replacing the line
+// breaks in bracketed pastes and Alt-Enter (Esc followed by Enter) with
+// lineBreak.
+type pasteReader struct {
+	in      io.Reader
+	pasting bool
+	pending []byte // the start of an escape sequence cut off by a read
+	out     []byte
+}
+
+func (r *pasteReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		buf := make([]byte, 256)
+		n, err := r.in.Read(buf)
+		r.translate(append(r.pending, buf[:n]...))
+		if err != nil {
+			r.out = append(r.out, r.pending...)
+			r.pending = nil
+			if len(r.out) == 0 {
+				return 0, err
+			}
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *pasteReader) translate(data []byte) {
+	r.pending = nil
+	for i := 0; i < len(data); i++ {
+		rest := string(data[i:])
+		switch {
+		case strings.HasPrefix(rest, bracketedPasteStart):
+			r.pasting = true
+			i += len(bracketedPasteStart) - 1
+		case strings.HasPrefix(rest, bracketedPasteEnd):
+			r.pasting = false
+			i += len(bracketedPasteEnd) - 1
+		case strings.HasPrefix(rest, "\x1b\r"), strings.HasPrefix(rest, "\x1b\n"):
+			r.out = append(r.out, lineBreak...)
+			i++
+		case data[i] == 0x1b && (strings.HasPrefix(bracketedPasteStart, rest) || strings.HasPrefix(bracketedPasteEnd, rest)):
+			r.pending = append([]byte{}, data[i:]...) // wait for the rest of the sequence
+			return
+		case r.pasting && (data[i] == '\r' || data[i] == '\n'):
+			r.out = append(r.out, lineBreak...)
+			if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+				i++
+			}
+		default:
+			r.out = append(r.out, data[i])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// parseKeepAlive checks a keep_alive setting and returns it in the form
+// Ollama accepts: a duration, with a bare number taken as seconds, so that
+// "-1" keeps the model loaded and "0" unloads it after every reply.
+func parseKeepAlive(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return fmt.Sprintf("%ds", n), nil
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return "", fmt.Errorf("invalid keep-alive %q: use a duration such as 30m, -1 to keep the model loaded, or 0 to unload it after each reply", value)
+	}
+	return value, nil
+}
+
+// configureKeepAlive sends the keep_alive setting with every request.
+func configureKeepAlive(value string) error {
+	keepAlive, err := parseKeepAlive(value)
+	if err != nil {
+		return err
+	}
+	provider.KeepAlive = keepAlive
+	return nil
+}
+
+// warmUp loads model in the background, so that the model is in memory by
+// the time the first message is sent rather than adding its load time to
+// the first reply. Nothing is sent while a cassette is recorded or
+// replayed, so that the two see the same requests.
+func warmUp(ctx context.Context, model string) {
+	if provider.ActiveCassette != nil {
+		return
+	}
+	go func() {
+		start := time.Now()
+		ollama := &provider.Ollama{Client: provider.NewClient(10 * time.Minute)}
+		if err := ollama.Warm(ctx, model); err != nil {
+			// The first message reports the problem with a hint.
+			slog.Debug("warm-up failed", "model", model, "err", err)
+			return
+		}
+		slog.Debug("warmed up", "model", model, "elapsed", time.Since(start))
+	}()
+}
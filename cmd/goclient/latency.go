@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// latencyHint is added to the system prompt when a latency budget is set.
+const latencyHint = `Replies must be fast. Keep answers short. To find code, prefer semantic_search, search_docs
+and go_outline over reading whole files, and read only the files you need.`
+
+// Until a reply has been measured, assume modest hardware.
+const (
+	initialGenerateRate = 10.0  // output tokens per second
+	initialPromptRate   = 200.0 // prompt tokens evaluated per second
+)
+
+// minNumPredict and minPromptTokens keep replies and prompts usable however
+// slow the model turns out to be.
+const (
+	minNumPredict   = 64
+	minPromptTokens = 1024
+)
+
+// generateShare is the part of the budget spent generating; the rest is
+// left for evaluating the prompt.
+const generateShare = 0.6
+
+// latencyBudget adapts requests so a reply takes about target: replies are
+// capped with num_predict and the prompt is trimmed harder, both sized from
+// the speeds measured on earlier replies.
+type latencyBudget struct {
+	target       time.Duration
+	generateRate float64
+	promptRate   float64
+}
+
+func newLatencyBudget(target time.Duration) *latencyBudget {
+	return &latencyBudget{target: target, generateRate: initialGenerateRate, promptRate: initialPromptRate}
+}
+
+// numPredict is the reply length that fits the generation share of the budget.
+func (l *latencyBudget) numPredict() int {
+	return max(minNumPredict, int(l.generateRate*l.target.Seconds()*generateShare))
+}
+
+// promptTokens is the prompt size Ollama can evaluate in the rest of the
+// budget. Cached prompt prefixes are not evaluated again, so this errs on
+// the side of short prompts.
+func (l *latencyBudget) promptTokens() int {
+	return max(minPromptTokens, int(l.promptRate*l.target.Seconds()*(1-generateShare)))
+}
+
+// observe updates the measured speeds from a finished reply, weighting the
+// latest measurement most, and reports replies that overran the budget.
+func (l *latencyBudget) observe(stats *provider.Stats) {
+	if stats.EvalDuration > 0 && stats.TokenCount > 0 {
+		l.generateRate = smoothRate(l.generateRate, float64(stats.TokenCount)/stats.EvalDuration.Seconds())
+	}
+	if stats.PromptEval > 0 && stats.PromptTokens > 0 {
+		l.promptRate = smoothRate(l.promptRate, float64(stats.PromptTokens)/stats.PromptEval.Seconds())
+	}
+	if elapsed := stats.Elapsed(); elapsed > l.target {
+		fmt.Printf(colorGray+"(latency budget %s: reply took %.1fs; next replies are limited to %d tokens)"+colorReset+"\n",
+			l.target, elapsed.Seconds(), l.numPredict())
+	}
+}
+
+func smoothRate(old, measured float64) float64 {
+	return 0.3*old + 0.7*measured
+}
+
+// String describes the budget for /status.
+func (l *latencyBudget) String() string {
+	return fmt.Sprintf("Latency budget: %s (replies up to %d tokens at %.1f tokens/s, prompts up to %d tokens)",
+		l.target, l.numPredict(), l.generateRate, l.promptTokens())
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// quiet is set by -quiet: statistics, tool headers and tool results are not
+// shown. Warnings and errors still are.
+var quiet bool
+
+// secretKey matches the names of log attributes whose values are replaced
+// in the debug log.
+var secretKey = regexp.MustCompile(`(?i)(authorization|api_?key|token|secret|password)$`)
+
+func init() {
+	slog.SetDefault(slog.New(&consoleHandler{level: slog.LevelWarn}))
+}
+
+// configureDebugLog keeps printing warnings to the console and also writes
+// every record, including the full Ollama requests and responses, to a JSON
+// log file at path, for -debug. The returned function closes the file.
+func configureDebugLog(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create debug log directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open debug log: %v", err)
+	}
+	debugLog := slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redactAttr})
+	slog.SetDefault(slog.New(teeHandler{slog.Default().Handler(), debugLog}))
+	slog.Debug("debug log started", "args", os.Args[1:])
+	return func() { file.Close() }, nil
+}
+
+// debugHooks logs every tool call with its arguments and result, for
+// -debug.
+func debugHooks() agent.Hooks {
+	return agent.Hooks{
+		BeforeToolCall: func(ctx context.Context, call *tools.Call) error {
+			slog.Debug("running tool", "tool", call.Name, "args", call.Args)
+			return nil
+		},
+		AfterToolCall: func(ctx context.Context, call tools.Call, result string, err error) {
+			if err != nil {
+				slog.Debug("tool failed", "tool", call.Name, "err", err)
+				return
+			}
+			slog.Debug("tool result", "tool", call.Name, "result", result)
+		},
+	}
+}
+
+// redactAttr hides the values of attributes with secret-looking names.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if secretKey.MatchString(attr.Key) && attr.Value.Kind() != slog.KindGroup {
+		return slog.String(attr.Key, "[redacted]")
+	}
+	return attr
+}
+
+// consoleHandler prints records the way goclient always printed warnings:
+// "Warning: message: err key=value", in yellow, to os.Stdout as it is when
+// the record is logged, so that one-shot mode and -tui capture it with the
+// rest of the chatter.
+type consoleHandler struct {
+	level slog.Level
+	attrs []slog.Attr
+	mu    sync.Mutex
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString(colorBrightRed + "Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString(colorYellow + "Warning: ")
+	}
+	b.WriteString(r.Message)
+	write := func(attr slog.Attr) bool {
+		if attr.Key == "err" {
+			fmt.Fprintf(&b, ": %v", attr.Value)
+		} else {
+			fmt.Fprintf(&b, " %s=%v", attr.Key, attr.Value)
+		}
+		return true
+	}
+	for _, attr := range h.attrs {
+		write(attr)
+	}
+	r.Attrs(write)
+	if r.Level >= slog.LevelWarn {
+		b.WriteString(colorReset)
+	}
+	b.WriteString("\n")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(os.Stdout, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &consoleHandler{level: h.level, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+// teeHandler passes each record to every handler that accepts its level.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,907 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+	"github.com/gherlein/goclient/pkg/tracing"
+)
+
+// --- Agent Logic (Simplified for Ollama) ---
+type Agent struct {
+	modelName      string
+	getUserMessage func() (string, bool)
+	systemPrompt   string
+	instructions   string // the agent type's part of systemPrompt, replaced by /system
+	httpClient     *http.Client
+	usage          *UsageLedger
+	stopSequences  []string
+	toolCalls      []string // names of tools executed successfully, in order
+	history        []Message
+	sessionName    string   // active session, saved after every turn
+	sessionTags    []string // tags added to sessions saved in this run
+	dump           *streamDump
+	toolGrammar    tools.ToolGrammar
+	numCtx         int // num_ctx sent to Ollama, 0 to use its default
+	contextLimit   int // prompt token budget used to trim history
+	compactConfig  CompactConfig
+	turns          []turnReport   // per-inference stats for the session summary
+	memories       string         // long-term memories relevant to the current user message
+	retrieved      string         // workspace excerpts relevant to the current user message
+	pinned         []*pinnedFile  // files added with /add, sent with every prompt
+	latency        *latencyBudget // set by -latency-budget
+	config         *Config
+	probe          bool                               // probe the tool-call format of models without cached capabilities
+	toolFormat     string                             // tool-call format forced with -tool-format
+	toolPrompt     string                             // the tool descriptions in systemPrompt, replaced when the model changes
+	readLine       func(prompt string) (string, bool) // reads the answer to a question
+	temperature    *float64                           // set by /retry for the rest of the turn
+	defaultTemp    *float64                           // the agent type's temperature
+	maxIterations  int
+	planMode       bool                        // set by -plan: plan each request before carrying it out
+	plan           *plan                       // the approved plan being carried out
+	taint          *taintTracker               // set by -taint
+	tools          map[string]bool             // tools the agent may call; nil for all
+	examples       []Message                   // the agent type's example exchanges, sent before the history
+	out            io.Writer                   // where replies are written; stdout even when other output goes to stderr
+	onTurn         func(stats *provider.Stats) // called after each inference, e.g. to update the -tui status bar
+	renderMarkdown bool                        // render replies as markdown; toggled with /render
+	transcript     *transcriptLog              // -log-transcript, or nil
+	hooks          agent.HookChain             // middleware around inference and tool calls
+	turnCtx        context.Context             // carries the current turn's span
+	turnSpan       *tracing.Span               // the current turn's span, or nil
+	router         *router                     // picks the model for each message; nil without routes
+	images         []string                    // attached with /image or -image, sent with the next message
+}
+
+// agentOption configures an Agent in NewAgent, like the options of
+// package agent.
+type agentOption func(*Agent)
+
+// withModel sets the model that answers.
+func withModel(name string) agentOption {
+	return func(a *Agent) { a.modelName = name }
+}
+
+// withUserInput sets how Run reads the user's messages.
+func withUserInput(read func() (string, bool)) agentOption {
+	return func(a *Agent) { a.getUserMessage = read }
+}
+
+// withSystemPrompt sets the agent type's instructions, which /system
+// replaces.
+func withSystemPrompt(prompt string) agentOption {
+	return func(a *Agent) { a.systemPrompt, a.instructions = prompt, prompt }
+}
+
+// withMaxIterations limits the consecutive replies that call tools; 0
+// means no limit.
+func withMaxIterations(n int) agentOption {
+	return func(a *Agent) { a.maxIterations = n }
+}
+
+func NewAgent(opts ...agentOption) *Agent {
+	a := &Agent{
+		httpClient:  provider.NewClient(60 * time.Second),
+		toolGrammar: tools.GrammarText,
+		out:         os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *Agent) Run(ctx context.Context) error {
+	fmt.Printf("Chat with Ollama model %s (type /help for commands, 'exit' to quit)\n", a.modelName)
+	defer a.printSessionStats()
+	defer tools.ClearCheckpoints()
+
+	defer func() { a.endTurn(nil) }()
+	for {
+		userInput, ok := a.readMessage(ctx) // This now handles its own prompting
+		if !ok {
+			break // End of input or scanner error
+		}
+
+		if strings.ToLower(strings.TrimSpace(userInput)) == "exit" {
+			fmt.Println("Exiting chat.")
+			break
+		}
+
+		a.temperature = nil
+		turnCtx := ctx
+		if isCommand(userInput) {
+			err := a.runCommand(ctx, userInput)
+			if err == errQuit {
+				fmt.Println("Exiting chat.")
+				break
+			}
+			if err != errRetry {
+				continue
+			}
+			// /retry removed the last reply; answer the same message again.
+			turnCtx = a.startTurn(ctx)
+		} else {
+			// Add user input to history
+			a.addMessage(Message{Role: "user", Content: userInput, Images: a.takeImages(ctx, userInput), Time: time.Now()})
+			a.routeTurn(ctx, userInput)
+			tools.Checkpoint() // file edits from here on are undone by /undo and /retry
+			a.memories = tools.MemoryPrompt(userInput)
+			retrieved, err := tools.Retrieve(ctx, userInput)
+			progress.clear()
+			if err != nil {
+				slog.Warn("could not retrieve workspace context", "err", err)
+			}
+			a.retrieved = retrieved
+			turnCtx = a.startTurn(ctx)
+
+			if a.usage != nil {
+				if err := a.usage.CheckBudget(usageProvider()); err != nil {
+					fmt.Printf(colorBrightRed+"%v"+colorReset+"\n", err)
+					a.endTurn(err)
+					a.history = a.history[:len(a.history)-1]
+					tools.DropCheckpoint()
+					continue
+				}
+			}
+			if a.planMode && !a.startPlan(ctx) {
+				continue
+			}
+		}
+
+		err := a.answer(turnCtx)
+		a.endTurn(err)
+		a.persistSession()
+		if err != nil && ctx.Err() != nil {
+			// Stopped by a signal: keep what the conversation has so far.
+			return ctx.Err()
+		}
+		if err != nil {
+			a.abandonPlan()
+		}
+		switch {
+		case errors.Is(err, agent.ErrToolLoop):
+			fmt.Printf(colorYellow+"Tool loop %v. Reply to continue, or rephrase the request."+colorReset+"\n", err)
+		case err != nil:
+			fmt.Printf("\nError during inference: %v\n", err)
+			if hint := errorHint(err, a.modelName); hint != "" {
+				fmt.Println(hint)
+			}
+		}
+	}
+	return nil
+}
+
+// answer has the model answer the latest message, running the tools it
+// calls, and then carries out the remaining steps of an approved plan.
+func (a *Agent) answer(ctx context.Context) error {
+	for {
+		if err := a.reply(ctx); err != nil {
+			return err
+		}
+		if a.plan == nil || !a.advancePlan() {
+			return nil
+		}
+	}
+}
+
+// reply runs the tool loop on the conversation, streaming each reply to
+// a.out, with a spinner until its first token, followed by its stats.
+func (a *Agent) reply(ctx context.Context) error {
+	var markdown *markdownStream
+	var waiting *spinner
+	c := a.conversation(agent.Events{
+		Token: func(part string) {
+			waiting.stop()
+			if markdown != nil {
+				markdown.Write(part)
+			} else {
+				fmt.Fprint(a.out, part)
+			}
+		},
+		TurnComplete: func(reply string) {
+			if markdown != nil {
+				markdown.Flush()
+			} else {
+				fmt.Fprintln(a.out) // Newline after AI's full response
+			}
+		},
+		Stats: func(stats *provider.Stats) {
+			reportLoad(a.modelName, stats)
+			if !quiet {
+				fmt.Printf(colorGray+"Stats: %s"+colorReset+"\n", stats)
+			}
+			a.persistSession()
+		},
+	})
+	c.Use(agent.Hooks{
+		BeforeInference: func(ctx context.Context, request *provider.Request) error {
+			// Pinned files are read again, since the tools may have changed them.
+			a.refreshPinned()
+			request.System = a.system()
+			markdown = nil
+			if a.renderMarkdown {
+				markdown = newMarkdownStream(a.out)
+			}
+			if a.out == io.Writer(os.Stdout) {
+				fmt.Print(colorYellow + "AI" + colorReset + ": ")
+				if markdown != nil {
+					fmt.Println()
+				}
+			}
+			waiting = startSpinner(a.modelName)
+			return nil
+		},
+		AfterInference: func(ctx context.Context, request provider.Request, reply string, stats *provider.Stats, err error) {
+			waiting.stop()
+			if err != nil && markdown != nil {
+				markdown.Flush()
+			}
+		},
+	})
+	_, err := c.Continue(ctx)
+	return err
+}
+
+// readMessage reads the user's next message. It returns false when ctx is
+// done, even while the read is still waiting for input.
+func (a *Agent) readMessage(ctx context.Context) (string, bool) {
+	if ctx.Err() != nil {
+		return "", false
+	}
+	type message struct {
+		text string
+		ok   bool
+	}
+	read := make(chan message, 1)
+	go func() {
+		text, ok := a.getUserMessage()
+		read <- message{text, ok}
+	}()
+	select {
+	case msg := <-read:
+		return msg.text, msg.ok
+	case <-ctx.Done():
+		return "", false
+	}
+}
+
+// handleIndexCommand implements /index (status) and /index update|rebuild
+// for the semantic search index.
+func handleIndexCommand(ctx context.Context, arg string) error {
+	switch arg {
+	case "":
+	case "update", "rebuild":
+		err := tools.ReindexWorkspace(ctx, arg == "rebuild")
+		progress.clear()
+		if err != nil {
+			return fmt.Errorf("failed to update index: %v", err)
+		}
+	default:
+		return fmt.Errorf("usage: /index [update|rebuild]")
+	}
+	status, err := tools.CurrentIndexStatus()
+	if err != nil {
+		return fmt.Errorf("semantic search index unavailable: %v", err)
+	}
+	state := "idle"
+	switch {
+	case status.Indexing:
+		state = fmt.Sprintf("indexing (%d files pending)", status.Pending)
+	case status.Watching:
+		state = "watching for changes"
+	}
+	fmt.Printf("Index: %s (%s)\n", status.Root, status.Store)
+	fmt.Printf("  %d files, %d chunks; %s\n", status.Files, status.Chunks, state)
+	if !status.Updated.IsZero() {
+		fmt.Printf("  last update %s: %d chunks embedded, %d reused\n", status.Updated.Format("15:04:05"), status.Embedded, status.Reused)
+	}
+	if status.LastError != "" {
+		fmt.Printf("  last error: %s\n", status.LastError)
+	}
+	return nil
+}
+
+// printStatus shows the current model, the models Ollama has loaded and
+// provider usage.
+func (a *Agent) printStatus(ctx context.Context) {
+	fmt.Printf("Model: %s\n", a.modelName)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	loaded, err := (&provider.Ollama{Client: a.httpClient}).Loaded(ctx)
+	if err != nil {
+		fmt.Printf("Loaded models: unknown (%v)\n", err)
+	} else {
+		a.printLoaded(loaded)
+	}
+	if a.usage != nil {
+		fmt.Println(a.usage.Status(usageProvider()))
+	}
+	if a.latency != nil {
+		fmt.Println(a.latency)
+	}
+}
+
+// errorHint suggests what to do about an inference error, or returns "".
+func errorHint(err error, model string) string {
+	switch {
+	case errors.Is(err, provider.ErrOllamaUnreachable):
+		return "Is Ollama running? Start it with 'ollama serve', or point goclient at it with GOCLIENT_HOST or host in the config."
+	case errors.Is(err, provider.ErrModelNotFound):
+		return fmt.Sprintf("Pull the model with 'ollama pull %s', or pick an installed one with /model.", model)
+	case errors.Is(err, provider.ErrContextOverflow):
+		return "Shorten the conversation with /compact or /reset, or raise num_ctx."
+	case errors.Is(err, provider.ErrOutOfMemory):
+		return "Lower the model's num_ctx in the config file, unload other models, or pick a smaller one with /model."
+	}
+	return ""
+}
+
+// turnContext is the per-turn context added before the latest user message.
+func (a *Agent) turnContext() string {
+	var parts []string
+	for _, part := range []string{a.memories, a.retrieved} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// requestOptions returns the Ollama generation options for the agent's model.
+func (a *Agent) requestOptions() map[string]interface{} {
+	options := map[string]interface{}{}
+	if a.config != nil {
+		for key, value := range a.config.Options {
+			options[key] = value
+		}
+	}
+	if len(a.stopSequences) > 0 {
+		options["stop"] = a.stopSequences
+	}
+	if a.numCtx > 0 {
+		options["num_ctx"] = a.numCtx
+	}
+	if a.latency != nil {
+		options["num_predict"] = a.latency.numPredict()
+	}
+	if a.temperature != nil {
+		options["temperature"] = *a.temperature
+	} else if a.defaultTemp != nil {
+		options["temperature"] = *a.defaultTemp
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// --- Main Application Setup ---
+
+// getSystemPrompt returns the system prompt of an agent type, or of the
+// default agent for unknown types.
+func getSystemPrompt(agentType string) string {
+	if t, ok := agentTypes[agentType]; ok {
+		return t.System
+	}
+	return agentTypes["default"].System
+}
+
+// getAvailableOllamaModels returns the names of the installed models.
+func getAvailableOllamaModels(client *http.Client) ([]string, error) {
+	models, err := listOllamaModels(client)
+	if err != nil {
+		return nil, err
+	}
+	var modelNames []string
+	for _, model := range models {
+		modelNames = append(modelNames, model.Name)
+	}
+	return modelNames, nil
+}
+
+// listOllamaModels fetches /api/tags from Ollama
+func listOllamaModels(client *http.Client) ([]provider.ModelInfo, error) {
+	ollama := &provider.Ollama{Client: client}
+	return ollama.Models(context.Background())
+}
+
+// selectOllamaModel prompts user to select from available models, offering
+// the model used last as the default.
+func selectOllamaModel(client *http.Client, readLine func(prompt string) (string, bool)) (string, error) {
+	models, err := listOllamaModels(client)
+	if err != nil {
+		return "", fmt.Errorf("could not fetch available Ollama models: %w", err)
+	}
+	return pickModel(models, "", lastModel(), readLine)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sessions" {
+		os.Exit(runSessionsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "docgen" {
+		os.Exit(runDocgenCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "pipeline" {
+		os.Exit(runPipelineCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		os.Exit(runServeCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctorCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "models" {
+		os.Exit(runModelsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		os.Exit(runBatchCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "commit-msg" {
+		os.Exit(runCommitMsgCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		os.Exit(runReviewCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "gen-tests" {
+		os.Exit(runGenTestsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "__complete" {
+		os.Exit(runCompleteCommand(os.Args[2:]))
+	}
+
+	// Command-line flags for Ollama model and agent type
+	defaultModel := "llama3:latest" // A common default, user might need to change
+	modelNameFlag := flag.String("model", "", fmt.Sprintf("Name of the Ollama model to use (e.g., llama3:latest, codellama:latest). If empty, you will be prompted to select."))
+	agentTypeFlag := flag.String("agent", "code", "Type of agent behavior: default, code, explain or one defined in an agents directory; \"list\" lists them.") // Changed default to "code"
+	promptFileFlag := flag.String("promptfile", "", "Path to a file containing the initial prompt.")                                                            // New flag
+	configFlag := flag.String("config", defaultConfigPath(), "Path to the config file.")
+	profileFlag := flag.String("profile", envDefault("PROFILE", ""), "Apply a named profile from the config file: its host, model, system prompt, options and permissions override the other settings.")
+	e2eFlag := flag.String("e2e", "", "Run an end-to-end scenario file against a real model, or its scripted replies, and exit.")
+	recordFlag := flag.String("record", "", "Record every request to Ollama and its response to this cassette file, to replay the session later with -replay.")
+	replayFlag := flag.String("replay", "", "Answer requests to Ollama from this cassette file, recorded with -record, instead of contacting the server.")
+	dumpStreamFlag := flag.String("dump-stream", "", "Append every raw NDJSON line received from Ollama, with a timestamp, to this file.")
+	toolFormatFlag := flag.String("tool-format", "", "Tool-call format to ask for: text (tool: name({...}) lines), json (JSON objects) json-strict (only ```json fenced blocks) or structured (every reply a JSON object, enforced by Ollama). Overrides the probe and the config.")
+	compareFlag := flag.String("compare", "", "Answer every message with each of these comma-separated models at once, each keeping its own conversation, and show the replies side by side. Tool calls are not run.")
+	keepAliveFlag := flag.String("keep-alive", "", "How long Ollama keeps the model in memory after each reply, e.g. 30m; -1 keeps it loaded and 0 unloads it at once. Defaults to the config's keep_alive, then Ollama's five minutes.")
+	warmupFlag := flag.Bool("warmup", false, "Load the model in the background at startup, so the first reply does not wait for it.")
+	latencyFlag := flag.Duration("latency-budget", 0, "Target time per reply, e.g. 5s. Replies are shortened, prompts trimmed and the model nudged toward cheap searches to stay within it.")
+	maxIterationsFlag := flag.Int("max-iterations", agent.DefaultMaxIterations, "Maximum consecutive replies that call tools before control returns to you; 0 for no limit.")
+	planFlag := flag.Bool("plan", false, "Plan each request as numbered steps, shown for approval or editing before they are carried out one at a time.")
+	taintFlag := flag.Bool("taint", false, "Treat output of fetch_url and web_search (or security.untrusted_tools) as untrusted, and ask before running tools whose arguments copy from it.")
+	probeFlag := flag.Bool("probe", false, "On first use of a model, probe which tool-call format it follows best and cache the result.")
+	lspEditsFlag := flag.String("lsp-edits", "", "Do not write file edits; emit them as LSP workspace/applyEdit JSON lines to this file (\"-\" for stderr) for an editor to apply.")
+	statsFlag := flag.String("stats", "", "Also write per-inference and session statistics in this format (json) to -stats-file on exit.")
+	statsFileFlag := flag.String("stats-file", filepath.Join(tools.StateDir, "stats.json"), "File written by -stats.")
+	tagFlag := flag.String("tag", "", "Comma-separated tags added to sessions saved in this run, e.g. billing-refactor.")
+	flag.Var(varFlag{}, "var", "Set a prompt template variable, as key=value; may be repeated. Prompt files and system prompts can use it as {{.key}}.")
+	var imageFlags imageFlag
+	flag.Var(&imageFlags, "image", "Send this image with the first message (or the -p prompt), for vision models such as llava; may be repeated.")
+	sessionFlag := flag.String("session", "", "Name of a session to resume, or to create if it does not exist. The session is saved after every turn.")
+	promptFlag := flag.String("p", "", "Answer this prompt, followed by anything piped to stdin, print the answer and exit. Tools run up to -max-iterations replies; the exit status is 0 on success, 1 on errors, 2 for bad input and 3 when the tool loop was stopped.")
+	transcribeFlag := flag.String("transcribe", "", "Transcribe this audio file (WAV, MP3, ...) with the transcription server and add the transcript to the conversation; with -p it is added to the prompt.")
+	fileFlag := flag.String("file", "", "Like -p, with the prompt read from this file; with -p, the file is added to the prompt as context.")
+	tuiFlag := flag.Bool("tui", false, "Use a full-screen interface with a scrollable conversation, a status bar and an input box.")
+	plainFlag := flag.Bool("plain", false, "Show replies as plain text instead of rendering their markdown.")
+	transcriptFlag := flag.String("log-transcript", "", "Append the conversation (messages, replies, tool calls and results, with times) to this file as it happens: markdown, or JSON lines if it ends in .jsonl.")
+	debugFlag := flag.Bool("debug", false, "Log every Ollama request and response in full, tool calls and warnings as JSON to -debug-log, with credentials redacted.")
+	debugLogFlag := flag.String("debug-log", filepath.Join(tools.StateDir, "debug.log"), "File written by -debug.")
+	quietFlag := flag.Bool("quiet", false, "Do not show statistics, tool calls or tool results; warnings, errors and replies are still shown.")
+	yesFlag := flag.Bool("yes", false, "Approve every file edit and command without asking.")
+	stdioFlag := flag.Bool("stdio", false, "Speak newline-delimited JSON-RPC on stdin and stdout instead of chatting, for editor plugins that run goclient as a subprocess.")
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		os.Exit(runCompletionCommand(os.Args[2:]))
+	}
+	flag.Parse()
+
+	exitCode := exitOK
+	defer func() {
+		if exitCode != exitOK {
+			os.Exit(exitCode)
+		}
+	}()
+	oneShot := *promptFlag != "" || *fileFlag != ""
+	answers := setupOutput(oneShot || *stdioFlag)
+	quiet = *quietFlag
+	if *debugFlag {
+		closeLog, err := configureDebugLog(*debugLogFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitFailed
+			return
+		}
+		defer closeLog()
+	}
+
+	cfg, err := loadConfig(*configFlag, *profileFlag)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if err := applyConfig(cfg); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if *keepAliveFlag != "" {
+		if err := configureKeepAlive(*keepAliveFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitUsage
+			return
+		}
+	}
+	if err := useCassette(*recordFlag, *replayFlag); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if err := tracing.ConfigureFromEnv(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	defer tracing.Shutdown()
+	if !flagPassed("agent") && cfg.Agent != "" {
+		*agentTypeFlag = cfg.Agent
+	}
+	if *agentTypeFlag == "list" {
+		listAgentTypes()
+		return
+	}
+	agentType, err := lookupAgentType(*agentTypeFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if cfg.System != "" {
+		agentType.System += "\n\n" + cfg.System
+	}
+	if agentType.System, err = expandPrompt("the system prompt of agent "+agentType.Name, agentType.System); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if *e2eFlag != "" {
+		exitCode = runE2EScenario(*e2eFlag, *modelNameFlag, cfg)
+		return
+	}
+	ctx := handleSignals(context.Background())
+	if *stdioFlag {
+		model := *modelNameFlag
+		if model == "" {
+			model = agentType.Model
+		}
+		if model == "" {
+			model = cfg.Model
+		}
+		autoApprove := *yesFlag || (cfg.Permissions != nil && cfg.Permissions.AutoApprove)
+		if *taintFlag {
+			if cfg.Security == nil {
+				cfg.Security = &SecurityConfig{}
+			}
+			cfg.Security.Taint = true
+		}
+		if (*warmupFlag || cfg.Warmup) && model != "" {
+			warmUp(ctx, model)
+		}
+		exitCode = runStdio(ctx, cfg, model, *agentTypeFlag, *maxIterationsFlag, autoApprove, answers)
+		return
+	}
+	usage, err := loadUsageLedger(cfg.Budgets)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("%v. Usage will not be tracked.", err))
+	}
+
+	var initialPromptFromFile string
+	if *promptFileFlag != "" {
+		content, err := os.ReadFile(*promptFileFlag)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("could not read prompt file '%s': %v. Proceeding with interactive input.", *promptFileFlag, err))
+		} else if initialPromptFromFile, err = expandPrompt(*promptFileFlag, string(content)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitFailed
+			return
+		} else {
+			initialPromptFromFile = strings.TrimSpace(initialPromptFromFile)
+		}
+	}
+
+	httpClient := provider.NewClient(30 * time.Second) // Client for model selection
+	if warning := startupWarning(provider.NewClient(2 * time.Second)); warning != "" {
+		slog.Warn(warning)
+	}
+	selectedModelName := *modelNameFlag
+
+	var resumed *Session
+	if *sessionFlag != "" && sessionExists(*sessionFlag) {
+		resumed, err = loadSession(*sessionFlag)
+		if err != nil {
+			fmt.Printf("Error loading session: %v\n", err)
+			exitCode = exitFailed
+			return
+		}
+		if selectedModelName == "" {
+			selectedModelName = resumed.Model
+		}
+	}
+	if selectedModelName == "" {
+		selectedModelName = agentType.Model
+	}
+	if selectedModelName == "" {
+		selectedModelName = cfg.Model
+	}
+	if compared := splitList(*compareFlag); selectedModelName == "" && len(compared) > 0 {
+		selectedModelName = compared[0]
+	}
+	var oneShotInput string
+	if oneShot {
+		if selectedModelName == "" {
+			fmt.Println("Error: one-shot mode needs a model; pass -model or use an agent that sets one")
+			exitCode = exitUsage
+			return
+		}
+		if oneShotInput, err = oneShotPrompt(*promptFlag, *fileFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitUsage
+			return
+		}
+	}
+	var transcript string
+	if *transcribeFlag != "" {
+		if transcript, err = transcribeFlagFile(ctx, *transcribeFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitFailed
+			return
+		}
+		if oneShot {
+			oneShotInput += "\n\n" + attachment("Transcript of "+*transcribeFlag, transcript)
+		}
+	}
+
+	// -tui reads input in its own input box; the line editor would compete
+	// with it for the terminal.
+	var ui *tui
+	input := newPlainInput()
+	if *tuiFlag && !oneShot {
+		if !isTerminal(os.Stdin) || !isTerminal(answers) {
+			fmt.Println("Error: -tui needs a terminal")
+			exitCode = exitUsage
+			return
+		}
+		ui = newTUI()
+	} else {
+		input = newLineInput()
+	}
+	defer input.Close()
+	if selectedModelName == "" {
+		var err error
+		selectedModelName, err = selectOllamaModel(httpClient, input.line)
+		if err != nil {
+			fmt.Printf("Error selecting Ollama model: %v\n", err)
+			if hint := errorHint(err, ""); hint != "" {
+				fmt.Println(hint)
+			}
+			// Attempt to use a default if selection fails, or exit
+			fmt.Printf("Attempting to use default model: %s\n", defaultModel)
+			selectedModelName = defaultModel
+			// Check if default model exists (optional, or let the first request fail)
+		}
+	}
+	fmt.Printf("Using Ollama model: %s\n", selectedModelName)
+	saveLastModel(selectedModelName)
+
+	// Set up user input
+	interactive := isTerminal(os.Stdin) // no "You:" prompts for piped input
+	isFilePromptUsed := false
+	readMessage, ask := input.message, input.line
+	if ui != nil {
+		readMessage, ask = ui.message, ui.message
+	}
+
+	tools.OnProgress = progress.show
+	tools.Approve = func(action string) bool {
+		answer, ok := ask(colorYellow + action + colorReset + " [y/N]: ")
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return ok && (answer == "y" || answer == "yes")
+	}
+	if *yesFlag || (cfg.Permissions != nil && cfg.Permissions.AutoApprove) {
+		tools.Approve = func(action string) bool { return true }
+	}
+
+	getUserMessage := func() (string, bool) {
+		var promptText string
+		if initialPromptFromFile != "" && !isFilePromptUsed {
+			fmt.Printf(colorBlue+"You (from %s)"+colorReset+": %s\n", *promptFileFlag, initialPromptFromFile)
+			isFilePromptUsed = true // Mark as used so it's not used again
+			return initialPromptFromFile, true
+		}
+
+		// Standard prompt for stdin after initial file prompt (if any) or if no file prompt
+		prompt := ""
+		if interactive {
+			prompt = colorBlue + "You" + colorReset + ": "
+		}
+		promptText, ok := readMessage(prompt)
+		return promptText, ok
+	}
+
+	// Create and run the agent
+	chatAgent := NewAgent(withModel(selectedModelName), withUserInput(getUserMessage), withSystemPrompt(agentType.System), withMaxIterations(*maxIterationsFlag))
+	chatAgent.out = answers
+	chatAgent.renderMarkdown = !*plainFlag && colorReset != "" && isTerminal(answers) // colour is on
+	chatAgent.usage = usage
+	chatAgent.compactConfig = cfg.Compact
+	chatAgent.config = cfg
+	chatAgent.probe = *probeFlag
+	chatAgent.toolFormat = *toolFormatFlag
+	chatAgent.readLine = ask
+	if approve := tools.Approve; tracing.Enabled() {
+		tools.Approve = func(action string) bool {
+			return traceApproval(chatAgent.turnCtx, action, func() bool { return approve(action) })
+		}
+	}
+	chatAgent.planMode = *planFlag
+	if *debugFlag {
+		chatAgent.hooks = append(chatAgent.hooks, debugHooks())
+	}
+	chatAgent.defaultTemp = agentType.Temperature
+	chatAgent.examples = agentType.exampleMessages()
+	for _, path := range imageFlags {
+		if err := chatAgent.attachImage(path); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitUsage
+			return
+		}
+	}
+	if *transcriptFlag != "" {
+		if chatAgent.transcript, err = openTranscript(*transcriptFlag, selectedModelName); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitUsage
+			return
+		}
+		defer chatAgent.transcript.Close()
+	}
+	if *taintFlag || (cfg.Security != nil && cfg.Security.Taint) {
+		if chatAgent.taint, err = newTaintTracker(cfg); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitUsage
+			return
+		}
+	}
+	if *latencyFlag > 0 {
+		chatAgent.latency = newLatencyBudget(*latencyFlag)
+		chatAgent.systemPrompt += "\n\n" + latencyHint
+	}
+	registerDelegateTool(chatAgent)
+	if chatAgent.tools, err = agentType.toolSet(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if err := chatAgent.useModel(context.Background(), selectedModelName); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = exitFailed
+		return
+	}
+	if *statsFlag != "" && *statsFlag != "json" {
+		fmt.Printf("Error: unsupported -stats format %q (want json)\n", *statsFlag)
+		exitCode = exitFailed
+		return
+	}
+	if *statsFlag == "json" && strings.HasPrefix(filepath.ToSlash(filepath.Clean(*statsFileFlag)), tools.StateDir+"/") {
+		if _, err := tools.EnsureStateDir(); err != nil {
+			slog.Warn(err.Error())
+		}
+	}
+	if *lspEditsFlag != "" {
+		if *lspEditsFlag == "-" {
+			tools.EditProposals = os.Stderr
+		} else {
+			f, err := os.OpenFile(*lspEditsFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				fmt.Printf("Error: failed to open LSP edit output: %v\n", err)
+				exitCode = exitFailed
+				return
+			}
+			defer f.Close()
+			tools.EditProposals = f
+		}
+	}
+	if *dumpStreamFlag != "" {
+		dump, err := newStreamDump(*dumpStreamFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitFailed
+			return
+		}
+		defer dump.Close()
+		chatAgent.dump = dump
+	}
+	for _, tag := range strings.Split(*tagFlag, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			chatAgent.sessionTags = mergeTags(chatAgent.sessionTags, []string{tag})
+		}
+	}
+	if resumed != nil {
+		if err := chatAgent.resumeSession(resumed.Name); err != nil {
+			fmt.Printf("Error resuming session: %v\n", err)
+			exitCode = exitFailed
+			return
+		}
+		if chatAgent.modelName != selectedModelName {
+			// An explicit -model overrides the session's model.
+			if err := chatAgent.useModel(context.Background(), selectedModelName); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				exitCode = exitFailed
+				return
+			}
+		}
+	} else if *sessionFlag != "" {
+		if _, err := sessionPath(*sessionFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = exitFailed
+			return
+		}
+		chatAgent.sessionName = *sessionFlag
+	}
+	if cfg.Routing != nil && len(cfg.Routing.Routes) > 0 {
+		chatAgent.router = &router{RoutingConfig: *cfg.Routing, base: chatAgent.modelName}
+	}
+	if *agentTypeFlag == "code" && !tools.RepoMapSettings.Disabled {
+		// Built after resuming, which may change the working directory.
+		if repoMap, err := tools.RepoMap("."); err != nil {
+			slog.Warn(err.Error())
+		} else if repoMap != "" {
+			chatAgent.systemPrompt += "\n\nRepository map (files in the working directory, with the exported declarations of Go files):\n" + repoMap
+		}
+	}
+	if cfg.Embeddings != nil {
+		if err := tools.WatchWorkspace(context.Background()); err != nil {
+			slog.Warn("semantic search index", "err", err)
+		}
+	}
+	if transcript != "" && !oneShot {
+		chatAgent.addTranscript(*transcribeFlag, transcript)
+	}
+	if (*warmupFlag || cfg.Warmup) && !oneShot {
+		warmUp(ctx, chatAgent.modelName)
+	}
+	if *compareFlag != "" {
+		exitCode = chatAgent.runCompare(ctx, splitList(*compareFlag), oneShotInput, oneShot)
+	} else if oneShot {
+		exitCode = chatAgent.runOneShot(ctx, oneShotInput)
+	} else if ui != nil {
+		if err := ui.run(ctx, chatAgent); err != nil && ctx.Err() == nil {
+			fmt.Printf("Agent run failed: %s\n", err.Error())
+		}
+	} else if err := chatAgent.Run(ctx); err != nil && ctx.Err() == nil {
+		fmt.Printf("Agent run failed: %s\n", err.Error())
+	}
+	if ctx.Err() != nil && exitCode == exitOK {
+		exitCode = exitInterrupted
+	}
+	if *statsFlag == "json" {
+		if err := chatAgent.writeStats(*statsFileFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
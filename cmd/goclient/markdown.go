@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/x/term"
+)
+
+// defaultRenderWidth is the word-wrap width when the terminal size is
+// unknown.
+const defaultRenderWidth = 100
+
+func init() {
+	registerCommand(command{
+		name:  "render",
+		usage: "[on|off]",
+		help:  "Show or switch markdown rendering of replies",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			switch arg {
+			case "":
+				a.renderMarkdown = !a.renderMarkdown
+			case "on":
+				a.renderMarkdown = true
+			case "off":
+				a.renderMarkdown = false
+			default:
+				return fmt.Errorf("usage: /render [on|off]")
+			}
+			if a.renderMarkdown {
+				fmt.Println("Replies are rendered as markdown.")
+			} else {
+				fmt.Println("Replies are shown as plain text.")
+			}
+			return nil
+		},
+	})
+}
+
+// markdownStream renders a streamed reply as markdown, one block at a time:
+// text is held back until a blank line ends a paragraph or a code fence
+// closes, so that each block is rendered whole.
+type markdownStream struct {
+	out      io.Writer
+	renderer *glamour.TermRenderer
+	block    strings.Builder // complete lines of the current block
+	line     strings.Builder // the incomplete last line
+	fence    string          // the open code fence, if any
+}
+
+// newMarkdownStream returns a stream writing to out, or nil when the
+// renderer cannot be created.
+func newMarkdownStream(out io.Writer) *markdownStream {
+	// The style is not detected: asking the terminal for its background
+	// colour would race with the line editor for stdin.
+	style := os.Getenv("GLAMOUR_STYLE")
+	if style == "" {
+		style = "dark"
+	}
+	renderer, err := glamour.NewTermRenderer(glamour.WithStandardStyle(style), glamour.WithWordWrap(renderWidth()))
+	if err != nil {
+		slog.Warn("markdown rendering unavailable", "err", err)
+		return nil
+	}
+	return &markdownStream{out: out, renderer: renderer}
+}
+
+// renderWidth returns the width to wrap rendered text at.
+func renderWidth() int {
+	if width, _, err := term.GetSize(os.Stdout.Fd()); err == nil && width > 0 {
+		return min(width, 120) - 4 // glamour's margins
+	}
+	return defaultRenderWidth
+}
+
+// Write adds part of the reply.
+func (s *markdownStream) Write(part string) {
+	for {
+		i := strings.IndexByte(part, '\n')
+		if i < 0 {
+			s.line.WriteString(part)
+			return
+		}
+		s.line.WriteString(part[:i])
+		s.endLine(s.line.String())
+		s.line.Reset()
+		part = part[i+1:]
+	}
+}
+
+func (s *markdownStream) endLine(line string) {
+	s.block.WriteString(line + "\n")
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case s.fence != "":
+		if strings.HasPrefix(trimmed, s.fence) && strings.Trim(trimmed, s.fence[:1]) == "" {
+			s.fence = ""
+			s.flushBlock()
+		}
+	case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+		s.fence = trimmed[:3]
+		for strings.HasPrefix(trimmed[len(s.fence):], s.fence[:1]) {
+			s.fence += s.fence[:1]
+		}
+	case trimmed == "":
+		s.flushBlock()
+	}
+}
+
+// Flush renders what is left of the reply.
+func (s *markdownStream) Flush() {
+	if s.line.Len() > 0 {
+		s.block.WriteString(s.line.String())
+		s.line.Reset()
+	}
+	s.flushBlock()
+}
+
+func (s *markdownStream) flushBlock() {
+	text := s.block.String()
+	s.block.Reset()
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	rendered, err := s.renderer.Render(text)
+	if err != nil {
+		fmt.Fprint(s.out, text)
+		return
+	}
+	fmt.Fprintln(s.out, strings.Trim(rendered, "\n"))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// pickModel lists models and reads a selection: a number picks from the
+// list shown, other text narrows the list to the models it fuzzily
+// matches, and an empty answer picks the default, which is the first match
+// of a narrowed list or else preferred. current is marked in the list.
+func pickModel(models []provider.ModelInfo, current, preferred string, readLine func(prompt string) (string, bool)) (string, error) {
+	if len(models) == 0 {
+		return "", fmt.Errorf("no Ollama models found. Ensure Ollama is running and models are pulled (e.g., 'ollama pull llama3')")
+	}
+	if !containsModel(models, preferred) {
+		preferred = ""
+	}
+	shown, filtered := models, false
+	fmt.Println("\nAvailable Ollama models:")
+	for {
+		printModels(shown, current)
+		defaultName := preferred
+		if filtered {
+			defaultName = shown[0].Name
+		}
+		prompt := "Select a model by number, or type part of a name to filter: "
+		if defaultName != "" {
+			prompt = fmt.Sprintf("Select a model by number, or type part of a name to filter (Enter picks %s): ", defaultName)
+		}
+		input, ok := readLine(prompt)
+		if !ok {
+			return "", fmt.Errorf("no model selected")
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			if defaultName != "" {
+				return defaultName, nil
+			}
+			shown, filtered = models, false
+			continue
+		}
+		if selection, err := strconv.Atoi(input); err == nil {
+			if selection > 0 && selection <= len(shown) {
+				return shown[selection-1].Name, nil
+			}
+			fmt.Println("Invalid selection. Please try again.")
+			continue
+		}
+		matches := filterModels(models, input)
+		switch len(matches) {
+		case 0:
+			fmt.Printf("No model matches %q.\n", input)
+			shown, filtered = models, false
+		case 1:
+			fmt.Printf("Selected %s.\n", matches[0].Name)
+			return matches[0].Name, nil
+		default:
+			fmt.Printf("Models matching %q:\n", input)
+			shown, filtered = matches, true
+		}
+	}
+}
+
+// printModels shows a numbered table of models with their size, family,
+// parameter count and the date they were pulled.
+func printModels(models []provider.ModelInfo, current string) {
+	width := 0
+	for _, m := range models {
+		width = max(width, len(m.Name))
+	}
+	for i, m := range models {
+		modified := m.ModifiedAt
+		if t, err := time.Parse(time.RFC3339Nano, m.ModifiedAt); err == nil {
+			modified = t.Format("2006-01-02")
+		}
+		marker := ""
+		if m.Name == current {
+			marker = " (current)"
+		}
+		fmt.Printf("%3d. %-*s  %8s  %-12s %s%s\n", i+1, width, m.Name, formatModelSize(m.Size),
+			strings.TrimSpace(m.Details.Family+" "+m.Details.ParameterSize), modified, marker)
+	}
+}
+
+// formatModelSize formats a size in bytes as MB or GB.
+func formatModelSize(size int64) string {
+	if size >= 1<<30 {
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	}
+	return fmt.Sprintf("%.0f MB", float64(size)/(1<<20))
+}
+
+// filterModels returns the models whose name or family fuzzily matches
+// query, best match first.
+func filterModels(models []provider.ModelInfo, query string) []provider.ModelInfo {
+	type match struct {
+		model provider.ModelInfo
+		score int
+	}
+	var matches []match
+	for _, m := range models {
+		score, ok := fuzzyScore(query, m.Name)
+		if familyScore, familyOK := fuzzyScore(query, m.Details.Family); familyOK && (!ok || familyScore > score) {
+			score, ok = familyScore, true
+		}
+		if ok {
+			matches = append(matches, match{m, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	var result []provider.ModelInfo
+	for _, m := range matches {
+		result = append(result, m.model)
+	}
+	return result
+}
+
+// fuzzyScore reports whether the characters of query appear in text in
+// order, ignoring case and spaces, and scores the match: runs of adjacent
+// characters and matches at the start of a word score higher, gaps lower.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(strings.ReplaceAll(query, " ", "")))
+	t := []rune(strings.ToLower(text))
+	score, next, prev := 0, 0, -2
+	for _, c := range q {
+		j := next
+		for j < len(t) && t[j] != c {
+			j++
+		}
+		if j == len(t) {
+			return 0, false
+		}
+		score++
+		if j == prev+1 {
+			score += 5
+		}
+		if j == 0 || !unicode.IsLetter(t[j-1]) && !unicode.IsDigit(t[j-1]) {
+			score += 3
+		}
+		score -= min(j-next, 3)
+		prev, next = j, j+1
+	}
+	return score, true
+}
+
+func containsModel(models []provider.ModelInfo, name string) bool {
+	for _, m := range models {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lastModelPath returns ~/.local/share/goclient/last_model, which holds the
+// name of the model used last.
+func lastModelPath() string {
+	return filepath.Join(dataDir(), "last_model")
+}
+
+// lastModel returns the model used last, or "" if none was recorded.
+func lastModel() string {
+	data, err := os.ReadFile(lastModelPath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// saveLastModel records the model in use, to be offered as the default
+// the next time a model is picked.
+func saveLastModel(name string) {
+	path := lastModelPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		slog.Warn("could not remember the model", "err", err)
+		return
+	}
+	if err := os.WriteFile(path, []byte(name+"\n"), 0o644); err != nil {
+		slog.Warn("could not remember the model", "err", err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+const modelsUsage = `Usage: goclient models <command> [arguments]
+
+Commands:
+  list                          List the installed models
+  ps                            List the models loaded in memory, with their
+                                size, share on the GPU and when they unload
+  pull <name>...                Download models from the Ollama registry
+  rm <name>...                  Delete installed models
+  show [-modelfile] <name>      Describe a model: family, parameters, context
+                                length, capabilities and settings (also: info)`
+
+// runModelsCommand implements `goclient models ...` and returns the exit code.
+func runModelsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, modelsUsage)
+		return 2
+	}
+	cfg, err := loadConfig(defaultConfigPath(), envDefault("PROFILE", ""))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	configureHost(cfg)
+	if !useColor(os.Stdout) {
+		disableColor()
+	}
+
+	ollama := &provider.Ollama{}
+	ctx := context.Background()
+	switch args[0] {
+	case "list", "ls":
+		var models []provider.ModelInfo
+		if models, err = ollama.Models(ctx); err == nil {
+			if len(models) == 0 {
+				fmt.Println("No models installed.")
+			}
+			printModels(models, "")
+		}
+	case "ps":
+		var loaded []provider.LoadedModel
+		if loaded, err = ollama.Loaded(ctx); err == nil {
+			printLoadedModels(loaded)
+		}
+	case "pull":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: goclient models pull <name>...")
+			return 2
+		}
+		for _, name := range args[1:] {
+			if err = pullModel(ctx, ollama, name); err != nil {
+				break
+			}
+		}
+	case "rm", "delete":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: goclient models rm <name>...")
+			return 2
+		}
+		for _, name := range args[1:] {
+			if err = ollama.Delete(ctx, name); err != nil {
+				break
+			}
+			fmt.Printf("Deleted model %s\n", name)
+		}
+	case "show", "info":
+		err = showModelCommand(ctx, ollama, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(modelsUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown models command %q\n\n%s\n", args[0], modelsUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		hint := errorHint(err, "")
+		if errors.Is(err, provider.ErrModelNotFound) {
+			hint = "See the installed models with 'goclient models list'."
+		}
+		if hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
+		return 1
+	}
+	return 0
+}
+
+// printLoadedModels shows a table of the models in memory, like `ollama ps`.
+func printLoadedModels(models []provider.LoadedModel) {
+	if len(models) == 0 {
+		fmt.Println("No models loaded.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tPROCESSOR\tCONTEXT\tUNLOADS")
+	for _, m := range models {
+		numCtx := "-"
+		if m.ContextLength > 0 {
+			numCtx = fmt.Sprint(m.ContextLength)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, formatModelSize(m.Size), processorShare(m), numCtx, unloadTime(m.ExpiresAt))
+	}
+	w.Flush()
+}
+
+// printLoaded shows the models Ollama has in memory for /status, and why
+// the current model may be slow: not loaded yet, or partly on the CPU.
+func (a *Agent) printLoaded(loaded []provider.LoadedModel) {
+	fmt.Println("Loaded in Ollama:")
+	printLoadedModels(loaded)
+	for _, m := range loaded {
+		if m.Name != a.modelName && m.Name != a.modelName+":latest" {
+			continue
+		}
+		if m.Size > 0 && m.SizeVRAM < m.Size {
+			fmt.Printf("%s is %d%% on the CPU, which makes replies several times slower; a smaller model or a lower num_ctx may fit on the GPU.\n",
+				a.modelName, 100-int(m.SizeVRAM*100/m.Size))
+		}
+		return
+	}
+	fmt.Printf("%s is not loaded; the next reply waits while Ollama loads it.\n", a.modelName)
+}
+
+// processorShare describes how much of a loaded model is on the GPU. A model
+// partly on the CPU generates several times slower.
+func processorShare(m provider.LoadedModel) string {
+	switch {
+	case m.Size <= 0 || m.SizeVRAM >= m.Size:
+		return "100% GPU"
+	case m.SizeVRAM == 0:
+		return "100% CPU"
+	}
+	gpu := int(m.SizeVRAM * 100 / m.Size)
+	return fmt.Sprintf("%d%%/%d%% CPU/GPU", 100-gpu, gpu)
+}
+
+// unloadTime describes when Ollama unloads a model, at its keep-alive expiry.
+func unloadTime(expires time.Time) string {
+	switch until := time.Until(expires); {
+	case expires.IsZero() || until > 100*365*24*time.Hour:
+		return "never"
+	case until <= 0:
+		return "now"
+	case until < time.Hour:
+		return "in " + until.Round(time.Second).String()
+	case until < 48*time.Hour:
+		return fmt.Sprintf("in %dh%02dm", int(until.Hours()), int(until.Minutes())%60)
+	default:
+		return fmt.Sprintf("in %d days", int(until.Hours()/24))
+	}
+}
+
+// pullModel downloads a model, showing the progress of the layer being
+// downloaded as a bar on one line, or just each step when stdout is not a
+// terminal.
+func pullModel(ctx context.Context, ollama *provider.Ollama, name string) error {
+	terminal := isTerminal(os.Stdout)
+	var lastStatus string
+	var lastDraw time.Time
+	err := ollama.Pull(ctx, name, func(p provider.PullProgress) {
+		if p.Total > 0 && p.Status == lastStatus && p.Completed < p.Total && time.Since(lastDraw) < progressInterval {
+			return
+		}
+		lastDraw = time.Now()
+		if !terminal {
+			// One line per step, not per update.
+			if p.Status != lastStatus {
+				fmt.Println(p.Status)
+			}
+			lastStatus = p.Status
+			return
+		}
+		if p.Status != lastStatus && lastStatus != "" {
+			fmt.Println()
+		}
+		lastStatus = p.Status
+		fmt.Print("\r\u001b[2K" + pullLine(p))
+	})
+	if terminal && lastStatus != "" {
+		fmt.Println()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", name, err)
+	}
+	return nil
+}
+
+// pullBarWidth is the number of cells in the pull progress bar.
+const pullBarWidth = 30
+
+// pullLine renders a pull progress message, with a bar for a download.
+func pullLine(p provider.PullProgress) string {
+	if p.Total <= 0 {
+		return p.Status
+	}
+	done := min(p.Completed, p.Total)
+	filled := int(done * pullBarWidth / p.Total)
+	return fmt.Sprintf("%s [%s%s] %3d%% %s/%s", p.Status, strings.Repeat("=", filled),
+		strings.Repeat(" ", pullBarWidth-filled), done*100/p.Total,
+		formatModelSize(done), formatModelSize(p.Total))
+}
+
+func showModelCommand(ctx context.Context, ollama *provider.Ollama, args []string) error {
+	fs := flag.NewFlagSet("models show", flag.ContinueOnError)
+	modelfile := fs.Bool("modelfile", false, "Print the model's Modelfile instead.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: goclient models show [-modelfile] <name>")
+	}
+	name := fs.Arg(0)
+	details, err := ollama.Show(ctx, name)
+	if err != nil {
+		return err
+	}
+	if *modelfile {
+		fmt.Print(details.Modelfile)
+		return nil
+	}
+
+	fmt.Printf("Model: %s\n", name)
+	printDetail := func(label, value string) {
+		if value != "" {
+			fmt.Printf("  %-15s %s\n", label+":", value)
+		}
+	}
+	printDetail("Family", details.Details.Family)
+	printDetail("Parameters", details.Details.ParameterSize)
+	printDetail("Quantization", details.Details.QuantizationLevel)
+	printDetail("Format", details.Details.Format)
+	var infoKeys []string
+	for key := range details.ModelInfo {
+		infoKeys = append(infoKeys, key)
+	}
+	sort.Strings(infoKeys)
+	for _, field := range []struct{ suffix, label string }{
+		{".context_length", "Context length"},
+		{".embedding_length", "Embedding size"},
+	} {
+		for _, key := range infoKeys {
+			if n, ok := details.ModelInfo[key].(float64); ok && strings.HasSuffix(key, field.suffix) {
+				printDetail(field.label, fmt.Sprintf("%.0f", n))
+			}
+		}
+	}
+	printDetail("Capabilities", strings.Join(details.Capabilities, ", "))
+	if details.Parameters != "" {
+		fmt.Println("  Settings:")
+		for _, line := range strings.Split(strings.TrimSpace(details.Parameters), "\n") {
+			fmt.Printf("    %s\n", strings.Join(strings.Fields(line), " "))
+		}
+	}
+	if details.License != "" {
+		license, _, _ := strings.Cut(strings.TrimSpace(details.License), "\n")
+		printDetail("License", license)
+	}
+	return nil
+}
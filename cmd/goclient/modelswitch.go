@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "model",
+		usage: "[name]",
+		help:  "Switch to another model, keeping the conversation; without a name, pick from the installed models",
+		run: func(ctx context.Context, a *Agent, name string) error {
+			return a.switchModel(ctx, name)
+		},
+	})
+}
+
+// switchModel implements /model. Without a name it lists the installed
+// models and asks for one.
+func (a *Agent) switchModel(ctx context.Context, name string) error {
+	if name == "" {
+		models, err := listOllamaModels(a.httpClient)
+		if err != nil {
+			return fmt.Errorf("could not fetch available Ollama models: %v", err)
+		}
+		if a.readLine == nil {
+			fmt.Printf("Model: %s\n", a.modelName)
+			return nil
+		}
+		name, err = pickModel(models, a.modelName, a.modelName, a.readLine)
+		if err != nil || name == a.modelName {
+			return err
+		}
+	} else {
+		var err error
+		if name, err = a.installedModel(name); err != nil {
+			return err
+		}
+	}
+
+	previous := a.modelName
+	if err := a.useModel(ctx, name); err != nil {
+		return err
+	}
+	saveLastModel(a.modelName)
+	fmt.Printf("Switched from %s to %s; the conversation (%d messages) is kept.\n", previous, a.modelName, len(a.history))
+	if a.router != nil && !a.router.off {
+		a.router.off = true
+		fmt.Println("Routing is off until /route on.")
+	}
+	return nil
+}
+
+// installedModel checks that a model is installed, adding the :latest tag
+// when name has none. If the models cannot be listed, name is returned as is.
+func (a *Agent) installedModel(name string) (string, error) {
+	models, err := getAvailableOllamaModels(a.httpClient)
+	switch {
+	case err != nil:
+		return name, nil
+	case !strings.Contains(name, ":") && containsString(models, name+":latest"):
+		return name + ":latest", nil
+	case !containsString(models, name):
+		return "", fmt.Errorf("model %s is not installed (pull it with 'ollama pull %s'); /model lists the installed models", name, name)
+	}
+	return name, nil
+}
+
+// useModel configures the agent for a model: its stop sequences, context
+// size and tool-call format. The conversation is kept, and the tool
+// descriptions in the system prompt are replaced if the format changes.
+func (a *Agent) useModel(ctx context.Context, name string) error {
+	cfg := a.config
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	format := a.toolFormat
+	if format == "" {
+		format = cfg.toolFormat(name)
+	}
+	var forced tools.ToolGrammar
+	if format != "" {
+		var err error
+		if forced, err = tools.ParseToolGrammar(format); err != nil {
+			return err
+		}
+	}
+
+	a.modelName = name
+	a.stopSequences = cfg.stopSequences(name)
+	a.numCtx = cfg.numCtx(name)
+	modelMax, err := fetchContextLength(a.httpClient, name)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("%v. Assuming a %d token context.", err, defaultNumCtx))
+	}
+	a.contextLimit = contextLimit(a.numCtx, modelMax)
+
+	caps := a.modelCapabilities(ctx, a.probe)
+	if forced != "" {
+		caps.Grammar = forced
+	}
+	if a.latency != nil {
+		caps.FewShot = false // the worked example costs prompt tokens on every request
+	}
+	a.toolGrammar = caps.Grammar
+	var toolPrompt string
+	if defs := a.availableTools(); len(defs) > 0 {
+		toolPrompt = tools.ToolPromptWith(defs, caps.Grammar, caps.FewShot)
+	}
+	if a.toolPrompt == "" {
+		if toolPrompt != "" {
+			a.systemPrompt += "\n\n" + toolPrompt
+		}
+	} else {
+		a.systemPrompt = strings.Replace(a.systemPrompt, a.toolPrompt, toolPrompt, 1)
+	}
+	a.toolPrompt = toolPrompt
+	return nil
+}
+
+// availableTools returns the tools the agent may call: all registered tools,
+// or those in a.tools when it is set.
+func (a *Agent) availableTools() []tools.Tool {
+	if a.tools == nil {
+		return tools.Tools()
+	}
+	var allowed []tools.Tool
+	for _, tool := range tools.Tools() {
+		if a.tools[tool.Name()] {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
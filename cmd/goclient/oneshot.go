@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// Exit codes of one-shot mode (-p, -file).
+const (
+	exitOK        = 0
+	exitFailed    = 1 // the model could not be reached or returned an error
+	exitUsage     = 2 // bad flags or input
+	exitToolLimit = 3 // the tool loop was stopped before the model answered
+
+	exitInterrupted = 130 // stopped by SIGINT or SIGTERM, as shells report it
+)
+
+// oneShotPrompt returns the prompt for -p and -file. The -p text comes
+// first; a -file given alone is the prompt, and is added as context after
+// the -p text otherwise; content piped to stdin is added as context last.
+// The prompt text is expanded as a template.
+func oneShotPrompt(text, file string) (string, error) {
+	var parts []string
+	if text != "" {
+		prompt, err := expandPrompt("-p", text)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, prompt)
+	}
+	if file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt file: %v", err)
+		}
+		if text == "" {
+			prompt, err := expandPrompt(file, string(content))
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, strings.TrimSpace(prompt))
+		} else {
+			parts = append(parts, attachment(file, string(content)))
+		}
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %v", err)
+		}
+		if strings.TrimSpace(string(input)) != "" {
+			parts = append(parts, attachment("stdin", string(input)))
+		}
+	}
+	if len(parts) == 0 || strings.TrimSpace(parts[0]) == "" {
+		return "", fmt.Errorf("the prompt is empty")
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// attachment formats content given along with the prompt.
+func attachment(name, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s:\n%s\n%s\n%s", name, fence, strings.TrimRight(content, "\n"), fence)
+}
+
+// runOneShot answers prompt without a chat: tool calls are run until the
+// model replies without one or the loop guard stops it, and the final reply
+// is written to a.out. Everything else goes to stderr. It returns the exit
+// code.
+func (a *Agent) runOneShot(ctx context.Context, prompt string) (code int) {
+	a.routeTurn(ctx, prompt)
+	ctx = a.startTurn(ctx)
+	defer func() {
+		var err error
+		if code != exitOK {
+			err = fmt.Errorf("exit status %d", code)
+		}
+		a.endTurn(err)
+	}()
+	a.addMessage(Message{Role: "user", Content: prompt, Images: a.takeImages(ctx, prompt), Time: time.Now()})
+	a.memories = tools.MemoryPrompt(prompt)
+	retrieved, err := tools.Retrieve(ctx, prompt)
+	progress.clear()
+	if err != nil {
+		slog.Warn("could not retrieve workspace context", "err", err)
+	}
+	a.retrieved = retrieved
+
+	var waiting *spinner
+	step := 0
+	c := a.conversation(agent.Events{
+		Token: func(part string) { waiting.stop() },
+		Stats: func(stats *provider.Stats) {
+			step++
+			a.saveOneShotSession()
+			if len(stats.ToolCalls) > 0 && !quiet {
+				fmt.Fprintf(os.Stderr, colorGray+"(step %d: %s)"+colorReset+"\n", step, strings.Join(stats.ToolCalls, ", "))
+			}
+		},
+	})
+	c.Use(agent.Hooks{
+		BeforeInference: func(ctx context.Context, request *provider.Request) error {
+			waiting = startSpinner(a.modelName)
+			return nil
+		},
+		AfterInference: func(ctx context.Context, request provider.Request, reply string, stats *provider.Stats, err error) {
+			waiting.stop()
+			progress.clear()
+		},
+	})
+	reply, err := c.Continue(ctx)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		a.saveOneShotSession()
+		return exitInterrupted
+	case errors.Is(err, agent.ErrToolLoop):
+		fmt.Fprintf(os.Stderr, "Error: %v. The last reply was:\n%s\n", err, strings.TrimSpace(reply))
+		return exitToolLimit
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if hint := errorHint(err, a.modelName); hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
+		return exitFailed
+	}
+	fmt.Fprintln(a.out, strings.TrimSpace(reply))
+	return exitOK
+}
+
+func (a *Agent) saveOneShotSession() {
+	if a.sessionName == "" {
+		return
+	}
+	if err := a.saveSession(a.sessionName); err != nil {
+		slog.Warn("could not save session", "err", err)
+	}
+}
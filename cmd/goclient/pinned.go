@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// pinnedFile is a file added with /add. Its current content is sent with
+// every prompt until it is dropped.
+type pinnedFile struct {
+	path    string // workspace-relative
+	content string // as last sent to the model
+	err     string // why the file could not be read, if it couldn't
+}
+
+func init() {
+	registerCommand(command{
+		name:  "add",
+		usage: "<file>...",
+		help:  "Pin files into every prompt",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			paths := strings.Fields(arg)
+			if len(paths) == 0 {
+				return fmt.Errorf("usage: /add <file>...")
+			}
+			for _, path := range paths {
+				if err := a.pinFile(path); err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+			}
+			return nil
+		},
+	})
+	registerCommand(command{
+		name:  "drop",
+		usage: "[file]...",
+		help:  "Unpin files, or all files",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			paths := strings.Fields(arg)
+			if len(paths) == 0 {
+				fmt.Printf("Dropped %d pinned files\n", len(a.pinned))
+				a.pinned = nil
+				return nil
+			}
+			for _, path := range paths {
+				if err := a.unpinFile(path); err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+			}
+			return nil
+		},
+	})
+	registerCommand(command{
+		name: "files",
+		help: "List the pinned files",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			a.printPinned()
+			return nil
+		},
+	})
+}
+
+// printPinned lists the pinned files with their size in tokens.
+func (a *Agent) printPinned() {
+	if len(a.pinned) == 0 {
+		fmt.Println("No pinned files. Use /add <file> to include a file in every prompt.")
+		return
+	}
+	a.refreshPinned()
+	total := 0
+	for _, pin := range a.pinned {
+		if pin.err != "" {
+			fmt.Printf("  %s (%s)\n", pin.path, pin.err)
+			continue
+		}
+		tokens := estimateTokens(pin.content)
+		total += tokens
+		fmt.Printf("  %s (~%d tokens)\n", pin.path, tokens)
+	}
+	fmt.Printf("%d pinned files, ~%d tokens per prompt\n", len(a.pinned), total)
+}
+
+func (a *Agent) pinFile(path string) error {
+	path, err := tools.WorkspacePath(path)
+	if err != nil {
+		return err
+	}
+	for _, pin := range a.pinned {
+		if pin.path == path {
+			return fmt.Errorf("%s is already pinned", path)
+		}
+	}
+	content, err := readPinned(path)
+	if err != nil {
+		return err
+	}
+	a.pinned = append(a.pinned, &pinnedFile{path: path, content: content})
+	fmt.Printf("Added %s (~%d tokens)\n", path, estimateTokens(content))
+	return nil
+}
+
+func (a *Agent) unpinFile(path string) error {
+	if resolved, err := tools.WorkspacePath(path); err == nil {
+		path = resolved
+	}
+	for i, pin := range a.pinned {
+		if pin.path == path {
+			a.pinned = append(a.pinned[:i], a.pinned[i+1:]...)
+			fmt.Printf("Dropped %s\n", path)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not pinned", path)
+}
+
+// readPinned reads a file through read_file, so pinned files see the same
+// workspace checks, size limit and proposed edits as the model.
+func readPinned(path string) (string, error) {
+	result, err := tools.ExecuteTool(context.Background(), "read_file", map[string]interface{}{"path": path})
+	if err != nil {
+		return "", err
+	}
+	content, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected read_file result for %s", path)
+	}
+	return content, nil
+}
+
+// refreshPinned re-reads the pinned files and reports those that changed
+// on disk since they were last sent.
+func (a *Agent) refreshPinned() {
+	for _, pin := range a.pinned {
+		content, err := readPinned(pin.path)
+		switch {
+		case err != nil:
+			if pin.err == "" {
+				slog.Warn("pinned file " + err.Error())
+			}
+			pin.err, pin.content = err.Error(), ""
+		case content != pin.content:
+			fmt.Printf(colorGray+"(refreshed %s: changed on disk)"+colorReset+"\n", pin.path)
+			pin.err, pin.content = "", content
+		default:
+			pin.err = ""
+		}
+	}
+}
+
+// pinnedContext lists the pinned files with their current content.
+func (a *Agent) pinnedContext() string {
+	if len(a.pinned) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Files the user pinned to the conversation, with their current content. ")
+	b.WriteString("Use this content rather than reading these files again.\n")
+	for _, pin := range a.pinned {
+		if pin.err != "" {
+			fmt.Fprintf(&b, "\n--- %s (unavailable: %s) ---\n", pin.path, pin.err)
+			continue
+		}
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", pin.path, strings.TrimRight(pin.content, "\n"))
+	}
+	return b.String()
+}
+
+// system returns the system prompt followed by the pinned files. Pinned
+// files only change when they are edited, so Ollama can keep reusing the
+// cached prompt prefix between turns.
+func (a *Agent) system() string {
+	pinned := a.pinnedContext()
+	if pinned == "" {
+		return a.systemPrompt
+	}
+	return a.systemPrompt + "\n\n" + pinned
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// PipelineConfig is a named sequence of agents declared under pipelines in
+// the config. Each stage works on the task and the previous stage's output.
+type PipelineConfig struct {
+	Description string          `yaml:"description"`
+	Stages      []PipelineStage `yaml:"stages"`
+}
+
+// PipelineStage is one agent in a pipeline.
+type PipelineStage struct {
+	Name          string   `yaml:"name"`
+	Agent         string   `yaml:"agent"`  // agent type whose system prompt is used unless System is set
+	Model         string   `yaml:"model"`  // defaults to the -model flag
+	System        string   `yaml:"system"` // system prompt
+	Tools         []string `yaml:"tools"`  // tools the stage may call; none if empty
+	MaxIterations int      `yaml:"max_iterations"`
+}
+
+const pipelineUsage = `usage: goclient pipeline list
+       goclient pipeline run <name> -p "task" [-model name] [-yes] [-var key=value]`
+
+// runPipelineCommand implements `goclient pipeline` and returns the exit code.
+func runPipelineCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, pipelineUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("pipeline "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+
+	var err error
+	switch args[0] {
+	case "list":
+		if err = fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		err = listPipelines(*configPath, *profile)
+	case "run":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			fmt.Fprintln(os.Stderr, pipelineUsage)
+			return 2
+		}
+		task := fs.String("p", "", `The task, or "-" to read it from stdin.`)
+		model := fs.String("model", "", "Model for stages that do not name one.")
+		yes := fs.Bool("yes", false, "Approve every file edit and command without asking.")
+		fs.Var(varFlag{}, "var", "Set a prompt template variable, as key=value; may be repeated.")
+		if err = fs.Parse(args[2:]); err != nil {
+			return 2
+		}
+		err = runPipeline(context.Background(), *configPath, *profile, args[1], *task, *model, *yes)
+	default:
+		fmt.Fprintln(os.Stderr, pipelineUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func listPipelines(configPath, profile string) error {
+	cfg, err := loadConfig(configPath, profile)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Pipelines) == 0 {
+		fmt.Printf("No pipelines are defined in %s\n", configPath)
+		return nil
+	}
+	var names []string
+	for name := range cfg.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := cfg.Pipelines[name]
+		var stages []string
+		for _, stage := range p.Stages {
+			stages = append(stages, stage.Name)
+		}
+		fmt.Printf("%-16s %s\n", name, strings.Join(stages, " -> "))
+		if p.Description != "" {
+			fmt.Printf("%-16s %s\n", "", p.Description)
+		}
+	}
+	return nil
+}
+
+// runPipeline runs the stages of a pipeline in order, streaming each
+// stage's reply; the last stage's reply is the pipeline's result.
+func runPipeline(ctx context.Context, configPath, profile, name, task, model string, yes bool) error {
+	cfg, err := loadConfig(configPath, profile)
+	if err != nil {
+		return err
+	}
+	p, ok := cfg.Pipelines[name]
+	if !ok {
+		return fmt.Errorf("no pipeline named %q in %s; 'goclient pipeline list' shows the defined pipelines", name, configPath)
+	}
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("pipeline %s has no stages", name)
+	}
+	if task == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read the task from stdin: %v", err)
+		}
+		task = string(data)
+	}
+	if strings.TrimSpace(task) == "" {
+		return fmt.Errorf("no task given; use -p \"task\"")
+	}
+	if task, err = expandPrompt("the task", task); err != nil {
+		return err
+	}
+	if err := applyConfig(cfg); err != nil {
+		return err
+	}
+
+	answers := setupOutput(false)
+	scanner := bufio.NewScanner(os.Stdin)
+	tools.OnProgress = progress.show
+	tools.Approve = func(action string) bool {
+		if yes {
+			return true
+		}
+		fmt.Printf(colorYellow+"%s"+colorReset+" [y/N]: ", action)
+		if !scanner.Scan() {
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		return answer == "y" || answer == "yes"
+	}
+
+	usage, err := loadUsageLedger(cfg.Budgets)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("%v. Usage will not be tracked.", err))
+	}
+	input := task
+	for i, stage := range p.Stages {
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage %d", i+1)
+		}
+		stageModel := stage.Model
+		if stageModel == "" {
+			stageModel = model
+		}
+		if stageModel == "" {
+			return fmt.Errorf("stage %s has no model; set model in the config or pass -model", stage.Name)
+		}
+		a, err := newStageAgent(ctx, cfg, stage, stageModel)
+		if err != nil {
+			return fmt.Errorf("stage %s: %v", stage.Name, err)
+		}
+		a.usage = usage
+
+		fmt.Printf(colorCyan+"== %s (%s) =="+colorReset+"\n", stage.Name, stageModel)
+		output, err := a.runSubAgent(ctx, input, func(part string) { fmt.Fprint(answers, part) })
+		if err != nil {
+			return fmt.Errorf("stage %s: %v", stage.Name, err)
+		}
+		input = fmt.Sprintf("Task:\n%s\n\nOutput of the previous stage (%s):\n%s", strings.TrimSpace(task), stage.Name, output)
+	}
+	return nil
+}
+
+// newStageAgent builds the agent for a pipeline stage.
+func newStageAgent(ctx context.Context, cfg *Config, stage PipelineStage, model string) (*Agent, error) {
+	system := stage.System
+	if system == "" {
+		system = getSystemPrompt(stage.Agent)
+	}
+	system, err := expandPrompt("the system prompt of stage "+stage.Name, system)
+	if err != nil {
+		return nil, err
+	}
+	a := NewAgent(withModel(model), withSystemPrompt(system))
+	a.config = cfg
+	if t, ok := agentTypes[stage.Agent]; ok {
+		a.examples = t.exampleMessages()
+	}
+	a.tools = map[string]bool{}
+	for _, name := range stage.Tools {
+		if _, ok := tools.LookupTool(name); !ok {
+			return nil, fmt.Errorf("%w: %s", tools.ErrToolNotFound, name)
+		}
+		a.tools[name] = true
+	}
+	a.maxIterations = stage.MaxIterations
+	if a.maxIterations <= 0 {
+		a.maxIterations = agent.DefaultMaxIterations
+	}
+	if err := a.useModel(ctx, model); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// planSystemPrompt asks for a plan instead of an answer.
+const planSystemPrompt = `Before doing anything, plan how to carry out the user's latest request.
+Reply with a numbered list of steps, one line each, and nothing else: no tool calls, no code and no commentary.
+Each step should be a small change or check that can be done on its own, naming the files it touches.
+Use as few steps as the request needs.`
+
+// planStep matches a list item such as "1. Add the flag", "2) Test it" or
+// "- Update the README".
+var planStep = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*])\s+(.+)$`)
+
+// plan is an approved list of steps being carried out, one at a time.
+type plan struct {
+	steps   []string
+	current int // index of the step in progress
+}
+
+// parsePlan returns the steps of a list, ignoring other lines.
+func parsePlan(text string) []string {
+	var steps []string
+	for _, line := range strings.Split(text, "\n") {
+		if m := planStep.FindStringSubmatch(line); m != nil {
+			steps = append(steps, strings.TrimSpace(m[1]))
+		}
+	}
+	return steps
+}
+
+// startPlan asks the model for a plan for the latest user message and has
+// the user approve, edit or reject it. It returns false when the user
+// rejected the plan and the message was withdrawn.
+func (a *Agent) startPlan(ctx context.Context) bool {
+	steps, err := a.draftPlan(ctx)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("%v; answering without a plan.", err))
+		return true
+	}
+	for {
+		fmt.Println(colorCyan + "Plan:" + colorReset)
+		for i, step := range steps {
+			fmt.Printf("  %d. %s\n", i+1, step)
+		}
+		answer, ok := a.readLine("Execute this plan? [y]es, [e]dit, [n]o: ")
+		if !ok {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			a.plan = &plan{steps: steps}
+			a.addMessage(Message{Role: "note", Content: a.plan.describe(), Time: time.Now()})
+			a.plan.announce()
+			return true
+		case "e", "edit":
+			if edited := a.readPlan(); len(edited) > 0 {
+				steps = edited
+			}
+		case "n", "no":
+			a.history = a.history[:len(a.history)-1]
+			tools.DropCheckpoint()
+			fmt.Println("Plan rejected; the message was withdrawn.")
+			return false
+		}
+	}
+}
+
+// draftPlan asks the model for the steps without offering it tools.
+func (a *Agent) draftPlan(ctx context.Context) ([]string, error) {
+	var available []string
+	for _, tool := range tools.Tools() {
+		available = append(available, "- "+tool.Name()+": "+tools.Synopsis(tool))
+	}
+	system := a.instructions + "\n\n" + planSystemPrompt + "\n\nThe steps will later be carried out with these tools:\n" + strings.Join(available, "\n")
+
+	var prompt strings.Builder
+	if turn := a.turnContext(); turn != "" {
+		prompt.WriteString(turn + "\n\n")
+	}
+	for _, msg := range a.history {
+		prompt.WriteString(msg.PromptText())
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("Plan:\n")
+
+	fmt.Println(colorGray + "(planning...)" + colorReset)
+	reply, err := a.generateOnce(ctx, system, prompt.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not draft a plan: %v", err)
+	}
+	steps := parsePlan(reply)
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("the model did not reply with a numbered plan")
+	}
+	return steps, nil
+}
+
+// readPlan reads a replacement plan from the user, one step per line.
+func (a *Agent) readPlan() []string {
+	fmt.Println("Enter the steps, one per line; an empty line ends the plan:")
+	var steps []string
+	for {
+		line, ok := a.readLine("")
+		if !ok || strings.TrimSpace(line) == "" {
+			return steps
+		}
+		if m := planStep.FindStringSubmatch(line); m != nil {
+			line = m[1]
+		}
+		steps = append(steps, strings.TrimSpace(line))
+	}
+}
+
+// describe tells the model the approved plan and the step to carry out.
+func (p *plan) describe() string {
+	var b strings.Builder
+	b.WriteString("The user approved this plan:\n")
+	for i, step := range p.steps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+	fmt.Fprintf(&b, "\nCarry out step %d only: %s\nUse tools as needed, then reply briefly with what you did for this step.",
+		p.current+1, p.steps[p.current])
+	return b.String()
+}
+
+// announce shows which step is in progress.
+func (p *plan) announce() {
+	fmt.Printf(colorCyan+"[plan %d/%d] %s"+colorReset+"\n", p.current+1, len(p.steps), p.steps[p.current])
+}
+
+// advancePlan is called when the model finished a reply without tool calls
+// while a plan is active. It moves on to the next step and returns true, or
+// returns false once the last step is done.
+func (a *Agent) advancePlan() bool {
+	p := a.plan
+	fmt.Printf(colorCyan+"[plan %d/%d] done"+colorReset+"\n", p.current+1, len(p.steps))
+	p.current++
+	if p.current == len(p.steps) {
+		fmt.Println(colorCyan + "Plan complete." + colorReset)
+		a.plan = nil
+		return false
+	}
+	a.addMessage(Message{
+		Role:    "note",
+		Content: fmt.Sprintf("Step %d is done. Carry out step %d only: %s", p.current, p.current+1, p.steps[p.current]),
+		Time:    time.Now(),
+	})
+	p.announce()
+	return true
+}
+
+// abandonPlan stops executing the plan, e.g. after an error, leaving the
+// remaining steps to the user.
+func (a *Agent) abandonPlan() {
+	if a.plan == nil {
+		return
+	}
+	p := a.plan
+	fmt.Printf(colorYellow+"Plan stopped at step %d of %d; the remaining steps were not carried out:"+colorReset+"\n", p.current+1, len(p.steps))
+	for i := p.current; i < len(p.steps); i++ {
+		fmt.Printf("  %d. %s\n", i+1, p.steps[i])
+	}
+	a.plan = nil
+}
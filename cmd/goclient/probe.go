@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// ModelCapabilities records how well a model follows each tool-call grammar,
+// as measured by a hidden probe turn.
+type ModelCapabilities struct {
+	Grammar  tools.ToolGrammar `json:"grammar"`
+	FewShot  bool              `json:"few_shot"`
+	Score    float64           `json:"score"`
+	ProbedAt time.Time         `json:"probed_at"`
+}
+
+// probeGrammars are tried in order of preference.
+var probeGrammars = []tools.ToolGrammar{tools.GrammarText, tools.GrammarJSON}
+
+const probePrompt = "User: Use the read_file tool to read the file README.md.\n\nAI:"
+
+func capabilityCachePath() string {
+	return filepath.Join(dataDir(), "capabilities.json")
+}
+
+func loadCapabilityCache() map[string]ModelCapabilities {
+	cache := map[string]ModelCapabilities{}
+	data, err := os.ReadFile(capabilityCachePath())
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		slog.Warn("ignoring unreadable capability cache", "err", err)
+		return map[string]ModelCapabilities{}
+	}
+	return cache
+}
+
+func saveCapabilityCache(cache map[string]ModelCapabilities) error {
+	path := capabilityCachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode capability cache: %v", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// modelCapabilities returns the cached capabilities for the agent's model.
+// When none are cached and probe is true, it runs the probe and caches the
+// result; otherwise it returns the text grammar without examples.
+func (a *Agent) modelCapabilities(ctx context.Context, probe bool) ModelCapabilities {
+	cache := loadCapabilityCache()
+	if caps, ok := cache[a.modelName]; ok {
+		return caps
+	}
+	if !probe {
+		return ModelCapabilities{Grammar: tools.GrammarText}
+	}
+
+	fmt.Printf("Probing tool-call format for %s...\n", a.modelName)
+	caps := a.probeToolGrammar(ctx)
+	fmt.Printf("Using %s tool-call format (score %.2f, examples: %v)\n", caps.Grammar, caps.Score, caps.FewShot)
+	cache[a.modelName] = caps
+	if err := saveCapabilityCache(cache); err != nil {
+		slog.Warn("could not save capability cache", "err", err)
+	}
+	return caps
+}
+
+// probeToolGrammar asks the model to make a sample tool call in each grammar,
+// first without and then with a worked example, and keeps the best scoring
+// combination. A perfect score without examples ends the probe early.
+func (a *Agent) probeToolGrammar(ctx context.Context) ModelCapabilities {
+	best := ModelCapabilities{Grammar: tools.GrammarText, Score: -1}
+	for _, fewShot := range []bool{false, true} {
+		for _, grammar := range probeGrammars {
+			response, err := a.generateOnce(ctx, tools.ToolPromptFor(grammar, fewShot), probePrompt)
+			if err != nil {
+				slog.Warn("probe request failed", "err", err)
+				continue
+			}
+			score := scoreProbeResponse(response, grammar)
+			if score > best.Score {
+				best = ModelCapabilities{Grammar: grammar, FewShot: fewShot, Score: score}
+			}
+			if score == 1 {
+				best.ProbedAt = time.Now()
+				return best
+			}
+		}
+	}
+	if best.Score < 0 {
+		best.Score = 0
+	}
+	best.ProbedAt = time.Now()
+	return best
+}
+
+// scoreProbeResponse rates a probe reply: 1 for the exact expected call,
+// 0.5 for a parseable call with the wrong tool or arguments, 0 otherwise.
+func scoreProbeResponse(response string, grammar tools.ToolGrammar) float64 {
+	calls := tools.ExtractCalls(response, grammar)
+	if len(calls) == 0 {
+		return 0
+	}
+	if calls[0].Name == "read_file" && calls[0].Args["path"] == "README.md" {
+		return 1
+	}
+	return 0.5
+}
+
+// generateOnce runs a single completion outside the conversation.
+func (a *Agent) generateOnce(ctx context.Context, system, prompt string) (string, error) {
+	request := provider.Request{Model: a.modelName, Prompt: prompt, System: system, Options: a.requestOptions()}
+	return provider.Complete(ctx, &provider.Ollama{Client: a.httpClient}, request)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// progressLine shows tool progress on a single status line that is
+// overwritten by each update and cleared before the result is printed.
+type progressLine struct {
+	mu       sync.Mutex
+	shown    bool
+	last     time.Time
+	disabled bool // set when the output is not a terminal
+}
+
+var progress progressLine
+
+// progressInterval limits how often the status line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+func (p *progressLine) show(update tools.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.disabled || time.Since(p.last) < progressInterval {
+		return
+	}
+	p.last = time.Now()
+	p.shown = true
+	fmt.Printf("\r\u001b[2K"+colorGray+"%s"+colorReset, update)
+}
+
+func (p *progressLine) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shown {
+		fmt.Print("\r\u001b[2K")
+		p.shown = false
+	}
+}
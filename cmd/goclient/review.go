@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+const reviewUsage = `Usage: goclient review [flags] [-staged | -range main..HEAD | file.patch]
+
+Reviews a diff with the code agent: the uncommitted changes by default, the
+staged changes, a range of commits, or a patch file ("-" reads stdin). The
+diff is split into chunks of hunks, each chunk is reviewed on its own, and
+the findings are printed grouped by file with their severity.
+
+Flags:`
+
+const reviewInstructions = `You are reviewing a change. Look for bugs, security problems, race conditions,
+missing error handling, unclear code and missing tests, in the changed lines (marked +) only;
+the other lines are context. Each line starts with its line number in the new file.
+Report each real problem once, with the line it is on and a severity: high (a bug or
+vulnerability), medium (likely to cause trouble), low (worth improving) or info.
+Do not report style nits a formatter would fix, and do not praise. Reply with
+{"findings": []} if there is nothing to report.`
+
+// severities ranks the severities of findings, most severe first.
+var severities = []string{"high", "medium", "low", "info"}
+
+// maxReviewChunk bounds the diff text reviewed in one request.
+const maxReviewChunk = 8 << 10
+
+// Finding is a problem the review found.
+type Finding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// diffFile is a file's part of a unified diff.
+type diffFile struct {
+	path  string
+	hunks []diffHunk
+}
+
+// diffHunk is one @@ hunk, with its lines numbered in the new file.
+type diffHunk struct {
+	header string
+	lines  []string // "+", "-" or " " followed by the text
+	start  int      // the new-file line number of the first line
+}
+
+// runReviewCommand implements `goclient review` and returns the exit code.
+func runReviewCommand(args []string) int {
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, reviewUsage)
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "", "Name of the Ollama model to use; defaults to the model in the config file.")
+	staged := fs.Bool("staged", false, "Review the staged changes.")
+	commits := fs.String("range", "", "Review a range of commits, e.g. main..HEAD.")
+	format := fs.String("format", "text", "Output format: text, json, or github (GitHub Actions annotations).")
+	failOn := fs.String("fail-on", "", "Exit with status 1 if there are findings of this severity or worse: high, medium, low or info.")
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" && *format != "github" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text, json or github)\n", *format)
+		return 2
+	}
+	if *failOn != "" && !containsString(severities, *failOn) {
+		fmt.Fprintf(os.Stderr, "Error: unknown severity %q (use high, medium, low or info)\n", *failOn)
+		return 2
+	}
+	sources := 0
+	for _, set := range []bool{*staged, *commits != "", fs.NArg() > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	answers := setupOutput(true)
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if err := applyConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *model == "" {
+		*model = cfg.Model
+	}
+	if *model == "" {
+		fmt.Fprintln(os.Stderr, "Error: no model; pass -model or set model in the config")
+		return 2
+	}
+	diff, err := reviewDiff(*staged, *commits, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	files := parseDiff(diff)
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to review: the diff has no changed lines.")
+		return 0
+	}
+
+	ctx := handleSignals(context.Background())
+	tools.OnProgress = progress.show
+	a := NewAgent(withModel(*model), withSystemPrompt(getSystemPrompt("code")+"\n\n"+reviewInstructions))
+	a.config = cfg
+	a.httpClient.Timeout = 10 * time.Minute
+	a.stopSequences = cfg.stopSequences(*model)
+	a.numCtx = cfg.numCtx(*model)
+	findings, err := a.reviewFiles(ctx, files)
+	progress.clear()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if ctx.Err() != nil {
+			return exitInterrupted
+		}
+		return exitFailed
+	}
+	printFindings(answers, findings, *format, len(files))
+	if *failOn != "" {
+		limit := severityRank(*failOn)
+		for _, f := range findings {
+			if severityRank(f.Severity) <= limit {
+				return exitFailed
+			}
+		}
+	}
+	return exitOK
+}
+
+// reviewDiff returns the diff to review: of the staged changes, of a range
+// of commits, from a patch file, or else of the uncommitted changes.
+func reviewDiff(staged bool, commits, patch string) (string, error) {
+	switch {
+	case staged:
+		return gitOutput("diff", "--cached", "--no-color", "--no-ext-diff")
+	case commits != "":
+		return gitOutput("diff", "--no-color", "--no-ext-diff", commits)
+	case patch == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the patch from stdin: %v", err)
+		}
+		return string(data), nil
+	case patch != "":
+		data, err := os.ReadFile(patch)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the patch: %v", err)
+		}
+		return string(data), nil
+	}
+	return gitOutput("diff", "HEAD", "--no-color", "--no-ext-diff")
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseDiff splits a unified diff into files and hunks. A hunk ends after
+// the lines its header counts, so changed lines that look like headers are
+// read as lines. Deleted files and binary changes have no hunks of new lines
+// and are left out.
+func parseDiff(diff string) []diffFile {
+	var files []diffFile
+	var file *diffFile // nil for deleted files
+	var hunk *diffHunk
+	old, added := 0, 0 // lines of the hunk still to come
+	for _, line := range strings.Split(diff, "\n") {
+		if hunk != nil && (old > 0 || added > 0) {
+			if line == "" {
+				line = " "
+			}
+			switch line[0] {
+			case '-':
+				old--
+			case '+':
+				added--
+			case ' ':
+				old--
+				added--
+			default:
+				continue // "\ No newline at end of file"
+			}
+			hunk.lines = append(hunk.lines, line)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file, hunk = nil, nil
+			path := strings.TrimPrefix(line, "+++ ")
+			if i := strings.IndexByte(path, '\t'); i >= 0 {
+				path = path[:i]
+			}
+			if path == "/dev/null" {
+				continue
+			}
+			files = append(files, diffFile{path: strings.TrimPrefix(path, "b/")})
+			file = &files[len(files)-1]
+		case strings.HasPrefix(line, "@@") && file != nil:
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			start, _ := strconv.Atoi(m[2])
+			old, added = 1, 1
+			if m[1] != "" {
+				old, _ = strconv.Atoi(m[1])
+			}
+			if m[3] != "" {
+				added, _ = strconv.Atoi(m[3])
+			}
+			file.hunks = append(file.hunks, diffHunk{header: line, start: start})
+			hunk = &file.hunks[len(file.hunks)-1]
+		case strings.HasPrefix(line, "diff "):
+			file, hunk = nil, nil
+		}
+	}
+	var changed []diffFile
+	for _, f := range files {
+		if len(f.hunks) > 0 {
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+// numbered renders the hunk with the new-file line number of each line
+// that is in the new file.
+func (h diffHunk) numbered() string {
+	var b strings.Builder
+	b.WriteString(h.header + "\n")
+	line := h.start
+	for _, text := range h.lines {
+		if text[0] == '-' {
+			fmt.Fprintf(&b, "%6s %s\n", "", text)
+			continue
+		}
+		fmt.Fprintf(&b, "%6d %s\n", line, text)
+		line++
+	}
+	return b.String()
+}
+
+// reviewChunks groups a file's hunks into chunks of at most maxReviewChunk
+// bytes; a larger hunk is a chunk of its own.
+func reviewChunks(f diffFile) []string {
+	var chunks []string
+	var chunk strings.Builder
+	for _, h := range f.hunks {
+		text := h.numbered()
+		if chunk.Len() > 0 && chunk.Len()+len(text) > maxReviewChunk {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+		chunk.WriteString(text)
+	}
+	if chunk.Len() > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+// reviewFormat is the JSON schema of a chunk's review.
+var reviewFormat = json.RawMessage(`{"type":"object","properties":{"findings":{"type":"array","items":{"type":"object","properties":{` +
+	`"line":{"type":"integer"},"severity":{"type":"string","enum":["high","medium","low","info"]},"message":{"type":"string"}},` +
+	`"required":["line","severity","message"]}}},"required":["findings"]}`)
+
+// reviewFiles reviews every chunk of every file, one at a time, and returns
+// the findings sorted by file, line and severity.
+func (a *Agent) reviewFiles(ctx context.Context, files []diffFile) ([]Finding, error) {
+	type job struct {
+		path, chunk string
+	}
+	var jobs []job
+	for _, f := range files {
+		for _, chunk := range reviewChunks(f) {
+			jobs = append(jobs, job{f.path, chunk})
+		}
+	}
+	var findings []Finding
+	for i, j := range jobs {
+		tools.OnProgress(tools.Progress{Task: "reviewing with " + a.modelName, Done: i, Total: len(jobs), Current: j.path})
+		found, err := a.reviewChunk(ctx, j.path, j.chunk)
+		if err != nil {
+			return nil, fmt.Errorf("reviewing %s: %w", j.path, err)
+		}
+		findings = append(findings, found...)
+	}
+	sort.SliceStable(findings, func(i, k int) bool {
+		if findings[i].File != findings[k].File {
+			return findings[i].File < findings[k].File
+		}
+		if findings[i].Line != findings[k].Line {
+			return findings[i].Line < findings[k].Line
+		}
+		return severityRank(findings[i].Severity) < severityRank(findings[k].Severity)
+	})
+	return findings, nil
+}
+
+// reviewChunk asks the model to review one chunk of a file's diff.
+func (a *Agent) reviewChunk(ctx context.Context, path, chunk string) ([]Finding, error) {
+	request := provider.Request{
+		Model:   a.modelName,
+		System:  a.systemPrompt,
+		Prompt:  fmt.Sprintf("Review this change to %s.\n\n%s", path, chunk),
+		Options: a.requestOptions(),
+		Format:  reviewFormat,
+	}
+	reply, err := provider.Complete(ctx, &provider.Ollama{Client: a.httpClient}, request)
+	if err != nil {
+		return nil, err
+	}
+	var review struct {
+		Findings []Finding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(stripFence(reply)), &review); err != nil {
+		return nil, fmt.Errorf("%s did not reply with findings: %v", a.modelName, err)
+	}
+	var findings []Finding
+	for _, f := range review.Findings {
+		if strings.TrimSpace(f.Message) == "" {
+			continue
+		}
+		f.File = path
+		f.Severity = strings.ToLower(f.Severity)
+		if !containsString(severities, f.Severity) {
+			f.Severity = "info"
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// severityRank orders severities, 0 being the most severe.
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(severities)
+}
+
+// printFindings writes the findings in the format: text grouped by file,
+// a JSON array, or GitHub Actions workflow commands that annotate the
+// pull request.
+func printFindings(out io.Writer, findings []Finding, format string, reviewed int) {
+	switch format {
+	case "json":
+		if findings == nil {
+			findings = []Finding{}
+		}
+		data, _ := json.MarshalIndent(findings, "", "  ")
+		fmt.Fprintln(out, string(data))
+		return
+	case "github":
+		levels := map[string]string{"high": "error", "medium": "warning", "low": "notice", "info": "notice"}
+		for _, f := range findings {
+			message := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(f.Message)
+			fmt.Fprintf(out, "::%s file=%s,line=%d,title=%s::%s\n", levels[f.Severity], f.File, max(f.Line, 1), f.Severity, message)
+		}
+		return
+	}
+	colors := map[string]string{"high": colorBrightRed, "medium": colorYellow, "low": colorCyan, "info": colorGray}
+	file := ""
+	for _, f := range findings {
+		if f.File != file {
+			file = f.File
+			fmt.Fprintf(out, "\n%s\n", file)
+		}
+		fmt.Fprintf(out, "  %s%-6s"+colorReset+" L%-5d %s\n", colors[f.Severity], f.Severity, f.Line, f.Message)
+	}
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	var parts []string
+	for _, s := range severities {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	summary := "no findings"
+	if len(parts) > 0 {
+		summary = strings.Join(parts, ", ")
+	}
+	fmt.Fprintf(out, "\nReviewed %d files: %s\n", reviewed, summary)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// RoutingConfig picks the model for each message by the kind of request it
+// is. Routes maps kinds to models; the built-in kinds are code (writing,
+// fixing or exploring code, usually with tools), summary (condensing text)
+// and chat (anything else). A kind without a route is answered by the
+// chat's own model.
+type RoutingConfig struct {
+	Routes map[string]string `yaml:"routes"`
+	// Classifier is a small model that sorts messages into the kinds of
+	// Routes. Without one, keyword heuristics sort them into the built-in
+	// kinds.
+	Classifier string `yaml:"classifier"`
+}
+
+// router remembers the routing state of a chat.
+type router struct {
+	RoutingConfig
+	base string // the model for messages without a route
+	off  bool   // set by /route off and /model
+	last string // the kind of the last message routed
+}
+
+// classifierTimeout bounds the classifier model's answer; the heuristics
+// are used after it.
+const classifierTimeout = 20 * time.Second
+
+func init() {
+	registerCommand(command{
+		name:  "route",
+		usage: "[on|off]",
+		help:  "Show how messages are routed to models, or turn routing on or off",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			if a.router == nil {
+				return fmt.Errorf("no routes are configured; add a routing section to the config")
+			}
+			switch arg {
+			case "on":
+				a.router.off = false
+				fmt.Println("Routing is on.")
+			case "off":
+				a.router.off = true
+				fmt.Printf("Routing is off; %s answers every message.\n", a.modelName)
+			case "":
+				a.router.print()
+			default:
+				return fmt.Errorf("usage: /route [on|off]")
+			}
+			return nil
+		},
+	})
+}
+
+func (r *router) print() {
+	state := "on"
+	if r.off {
+		state = "off"
+	}
+	classifier := "keyword heuristics"
+	if r.Classifier != "" {
+		classifier = r.Classifier
+	}
+	fmt.Printf("Routing is %s; messages are classified by %s.\n", state, classifier)
+	var kinds []string
+	for kind := range r.Routes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("  %-10s %s\n", kind+":", r.Routes[kind])
+	}
+	fmt.Printf("  %-10s %s\n", "other:", r.base)
+	if r.last != "" {
+		fmt.Printf("The last message was a %s request.\n", r.last)
+	}
+}
+
+// routeTurn switches to the model for the kind of message before it is
+// answered. The model then answers the whole turn, tool calls included.
+func (a *Agent) routeTurn(ctx context.Context, message string) {
+	r := a.router
+	if r == nil || r.off {
+		return
+	}
+	r.last = r.classify(ctx, message)
+	model := r.Routes[r.last]
+	if model == "" {
+		model = r.base
+	}
+	if model == a.modelName {
+		return
+	}
+	if err := a.useModel(ctx, model); err != nil {
+		slog.Warn(fmt.Sprintf("could not route to %s: %v", model, err))
+		return
+	}
+	if !quiet {
+		fmt.Printf(colorGray+"(%s request: answering with %s)"+colorReset+"\n", r.last, model)
+	}
+}
+
+// classify returns the kind of request message is, asking the classifier
+// model if there is one.
+func (r *router) classify(ctx context.Context, message string) string {
+	if r.Classifier == "" {
+		return classifyRequest(message)
+	}
+	kinds := []string{"code", "summary", "chat"}
+	for kind := range r.Routes {
+		if !containsString(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(message) > 2000 {
+		message = message[:2000]
+	}
+	ctx, cancel := context.WithTimeout(ctx, classifierTimeout)
+	defer cancel()
+	answer, err := provider.Complete(ctx, &provider.Ollama{}, provider.Request{
+		Model: r.Classifier,
+		System: "Classify the user's request as one of these kinds: " + strings.Join(kinds, ", ") +
+			". code means writing, fixing, reviewing or exploring code or files; summary means summarizing or condensing text; chat means anything else. Answer with the kind only.",
+		Prompt:  message,
+		Options: map[string]interface{}{"temperature": 0, "num_predict": 8},
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("routing classifier %s failed: %v", r.Classifier, err))
+		return classifyRequest(message)
+	}
+	answer = strings.ToLower(strings.Trim(strings.TrimSpace(answer), ".\"'`*"))
+	for _, kind := range kinds {
+		if strings.HasPrefix(answer, kind) {
+			return kind
+		}
+	}
+	slog.Debug("routing classifier gave no kind", "answer", answer)
+	return classifyRequest(message)
+}
+
+var (
+	summaryWords = regexp.MustCompile(`(?i)\b(summari[sz]e|summary|tl;?dr|sum up|condense|recap|key points)\b`)
+	codeWords    = regexp.MustCompile("(?i)```|\\b(code|func(tion)?|method|class|struct|interface|bug|error|panic|stack ?trace|compile|build|test|refactor|implement|fix|debug|repo(sitory)?|file|diff|commit|lint|endpoint|api|script|regex|sql|query|package|import|deploy)s?\\b|\\b[\\w./-]+\\.(go|py|js|ts|rs|java|c|h|cpp|rb|sh|yaml|yml|json|toml|md|sql)\\b")
+)
+
+// classifyRequest sorts a message into the built-in kinds by its words:
+// a request to summarize is a summary even when it names a file, and one
+// that mentions code, files or errors is code.
+func classifyRequest(message string) string {
+	switch {
+	case summaryWords.MatchString(message):
+		return "summary"
+	case codeWords.MatchString(message):
+		return "code"
+	default:
+		return "chat"
+	}
+}
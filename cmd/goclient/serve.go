@@ -0,0 +1,921 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+	"github.com/gherlein/goclient/pkg/tracing"
+)
+
+const serveUsage = `usage: goclient serve [-port 8080] [-addr 127.0.0.1] [-model name] [-agent code] [-yes] [-token secret]
+
+Endpoints:
+  POST   /sessions                      Create a session: {"model": "...", "agent": "...", "system": "..."}
+  GET    /sessions                      List sessions
+  GET    /sessions/{id}                 A session and its conversation
+  DELETE /sessions/{id}                 Delete a session, stopping its messages
+  POST   /sessions/{id}/messages        Queue a message: {"content": "..."}; with
+                                        Accept: text/event-stream, stream its events
+  GET    /sessions/{id}/messages        The session's messages and their status
+  GET    /sessions/{id}/messages/{mid}  A message: queued, running, done or failed
+  GET    /sessions/{id}/events          Stream the session's events (SSE)
+  GET    /sessions/{id}/ws              WebSocket: the session's events as JSON frames;
+                                        send {"type": "message", "content": "..."} or
+                                        {"type": "approval", "approval": "id", "approve": true}
+  GET    /approvals                     Tool calls waiting for approval
+  POST   /approvals/{id}                Answer one: {"approve": true}
+  POST   /v1/chat/completions           OpenAI-compatible chat completions, streamed or not
+  GET    /v1/models                     OpenAI-compatible model list
+  GET    /metrics                       Prometheus metrics`
+
+// serveFinishedRetention is how long finished messages stay queryable.
+const serveFinishedRetention = 24 * time.Hour
+
+// runServeCommand implements `goclient serve` and returns the exit code.
+func runServeCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, serveUsage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", defaultConfigPath(), "Path to the config file.")
+	profile := fs.String("profile", envDefault("PROFILE", ""), "Apply this profile from the config file.")
+	addr := fs.String("addr", "127.0.0.1", "Address to listen on. The agent can edit files and run commands, so expose it beyond this machine only with -token.")
+	port := fs.Int("port", 8080, "Port to listen on.")
+	model := fs.String("model", "", "Model for sessions that do not name one; defaults to the config's model.")
+	agentName := fs.String("agent", "code", "Agent type for sessions that do not name one.")
+	maxIterations := fs.Int("max-iterations", agent.DefaultMaxIterations, "Maximum consecutive replies that call tools per message; 0 for no limit.")
+	yes := fs.Bool("yes", false, "Approve every file edit and command without asking.")
+	token := fs.String("token", envDefault("SERVE_TOKEN", ""), "Require this bearer token on every request.")
+	approvalTimeout := fs.Duration("approval-timeout", 10*time.Minute, "Deny a tool call that has not been approved or denied within this time.")
+	fs.Var(varFlag{}, "var", "Set a prompt template variable, as key=value; may be repeated.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if err := applyConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := tracing.ConfigureFromEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer tracing.Shutdown()
+	if *model == "" {
+		*model = cfg.Model
+	}
+	if *model == "" {
+		fmt.Fprintln(os.Stderr, "Error: no model; pass -model or set model in the config")
+		return 2
+	}
+	if _, err := lookupAgentType(*agentName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	s := &apiServer{
+		cfg:             cfg,
+		model:           *model,
+		agentName:       *agentName,
+		maxIterations:   *maxIterations,
+		autoApprove:     *yes || (cfg.Permissions != nil && cfg.Permissions.AutoApprove),
+		token:           *token,
+		approvalTimeout: *approvalTimeout,
+		statePath:       filepath.Join(tools.StateDir, "serve.json"),
+		sessions:        map[string]*serveSession{},
+		messages:        map[string]*serveMessage{},
+		approvals:       map[string]*serveApproval{},
+		wake:            make(chan struct{}, 1),
+		metrics:         newServeMetrics(),
+	}
+	if err := s.restore(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	ctx := handleSignals(context.Background())
+	if cfg.Warmup {
+		warmUp(ctx, *model)
+	}
+	worker := make(chan struct{})
+	go func() {
+		defer close(worker)
+		s.work(ctx)
+	}()
+
+	listen := net.JoinHostPort(*addr, strconv.Itoa(*port))
+	server := &http.Server{Addr: listen, Handler: s}
+	failed := make(chan error, 1)
+	go func() { failed <- server.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "Serving the %s agent with model %s on http://%s\n", *agentName, *model, listen)
+	select {
+	case err := <-failed:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	case <-ctx.Done():
+	}
+
+	// The message being answered fails with the shutdown as its error and
+	// queued ones stay saved for the next start. Then the event streams are
+	// closed, so the server is not kept waiting for them.
+	fmt.Fprintln(os.Stderr, "Shutting down")
+	<-worker
+	s.mu.Lock()
+	s.closeStreamsLocked()
+	s.mu.Unlock()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// apiServer runs agent sessions for HTTP clients. Messages from all
+// sessions are queued and answered one at a time, in the order they
+// arrived, since they share the model and the workspace. The sessions and
+// the queue are saved to statePath, so a restart resumes queued messages.
+type apiServer struct {
+	cfg             *Config
+	model           string
+	agentName       string
+	maxIterations   int
+	autoApprove     bool
+	token           string
+	approvalTimeout time.Duration
+	statePath       string
+
+	mu        sync.Mutex
+	sessions  map[string]*serveSession
+	messages  map[string]*serveMessage
+	queue     []string // IDs of queued messages, oldest first
+	running   *serveMessage
+	approvals map[string]*serveApproval
+	wake      chan struct{} // signalled when a message is queued
+	metrics   *serveMetrics
+}
+
+// serveSession is a conversation with its own agent.
+type serveSession struct {
+	ID      string          `json:"id"`
+	Model   string          `json:"model"`
+	Agent   string          `json:"agent"`
+	System  string          `json:"system,omitempty"` // added to the agent type's system prompt
+	Created time.Time       `json:"created"`
+	History []agent.Message `json:"history"`
+
+	transient   bool // not saved; it lives as long as one request
+	agent       *agent.Agent
+	subscribers map[chan serveEvent]bool
+}
+
+// serveMessage is a user message and, once answered, the reply.
+type serveMessage struct {
+	ID       string     `json:"id"`
+	Session  string     `json:"session"`
+	Content  string     `json:"content"`
+	Status   string     `json:"status"` // queued, running, done or failed
+	Reply    string     `json:"reply,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	ctx    context.Context // set while running
+	cancel context.CancelFunc
+}
+
+// serveApproval is a tool call, or another action of a tool, waiting for a
+// client to approve or deny it.
+type serveApproval struct {
+	ID      string                 `json:"id"`
+	Session string                 `json:"session"`
+	Message string                 `json:"message"`
+	Action  string                 `json:"action"`
+	Tool    string                 `json:"tool,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Created time.Time              `json:"created"`
+
+	answer chan bool
+}
+
+// serveEvent is streamed to the clients following a session.
+type serveEvent struct {
+	Type     string                 `json:"type"` // queued, token, tool_call, tool_result, reply, stats, approval, done or error
+	Message  string                 `json:"message"`
+	Text     string                 `json:"text,omitempty"`
+	Tool     string                 `json:"tool,omitempty"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+	Result   string                 `json:"result,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Approval string                 `json:"approval,omitempty"`
+	Stats    *serveStats            `json:"stats,omitempty"`
+}
+
+// serveStats are the token counts and timings of one inference.
+type serveStats struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	Tokens           int     `json:"tokens"`
+	TimeToFirstToken float64 `json:"time_to_first_token"` // seconds
+	Seconds          float64 `json:"seconds"`
+	TokensPerSecond  float64 `json:"tokens_per_second"`
+}
+
+// serveState is the saved form of the server's sessions and messages.
+type serveState struct {
+	Sessions []*serveSession `json:"sessions"`
+	Messages []*serveMessage `json:"messages"`
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: w}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	found := true
+	if s.authorized(r) {
+		found = s.route(recorder, r, parts)
+	} else {
+		writeAPIError(recorder, http.StatusUnauthorized, "missing or wrong bearer token")
+	}
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK // as net/http sends for an empty response
+	}
+	s.metrics.add("goclient_http_requests_total", 1, "route", metricsRoute(r.Method, parts, found), "code", strconv.Itoa(recorder.status))
+}
+
+// route passes a request to its endpoint's handler, and reports whether
+// there is one.
+func (s *apiServer) route(w http.ResponseWriter, r *http.Request, parts []string) bool {
+	route := r.Method + " " + parts[0]
+	switch {
+	case route == "GET metrics" && len(parts) == 1:
+		s.serveMetricsHandler(w)
+	case route == "GET sessions" && len(parts) == 1:
+		s.listSessions(w)
+	case route == "POST sessions" && len(parts) == 1:
+		s.createSession(w, r)
+	case route == "GET sessions" && len(parts) == 2:
+		s.getSession(w, parts[1])
+	case route == "DELETE sessions" && len(parts) == 2:
+		s.deleteSession(w, parts[1])
+	case route == "POST sessions" && len(parts) == 3 && parts[2] == "messages":
+		s.postMessage(w, r, parts[1])
+	case route == "GET sessions" && len(parts) == 3 && parts[2] == "messages":
+		s.listMessages(w, parts[1])
+	case route == "GET sessions" && len(parts) == 4 && parts[2] == "messages":
+		s.getMessage(w, parts[1], parts[3])
+	case route == "GET sessions" && len(parts) == 3 && parts[2] == "events":
+		s.streamEvents(w, r, parts[1], "")
+	case route == "GET sessions" && len(parts) == 3 && parts[2] == "ws":
+		s.webSocket(w, r, parts[1])
+	case route == "POST v1" && len(parts) == 3 && parts[1] == "chat" && parts[2] == "completions":
+		s.chatCompletions(w, r)
+	case route == "GET v1" && len(parts) == 2 && parts[1] == "models":
+		s.openAIModels(w, r)
+	case route == "GET approvals" && len(parts) == 1:
+		s.listApprovals(w)
+	case route == "POST approvals" && len(parts) == 2:
+		s.answerApproval(w, r, parts[1])
+	default:
+		writeAPIError(w, http.StatusNotFound, "no such endpoint: %s %s", r.Method, r.URL.Path)
+		return false
+	}
+	return true
+}
+
+// authorized reports whether the request carries the -token. Browsers
+// cannot set headers on WebSocket connections, so those may pass it as the
+// token query parameter instead.
+func (s *apiServer) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && r.URL.Query().Has("token") {
+		given = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1
+}
+
+func (s *apiServer) createSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model  string `json:"model"`
+		Agent  string `json:"agent"`
+		System string `json:"system"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	session := &serveSession{ID: newServeID(), Model: body.Model, Agent: body.Agent, System: body.System, Created: time.Now()}
+	if session.Model == "" {
+		session.Model = s.model
+	}
+	if session.Agent == "" {
+		session.Agent = s.agentName
+	}
+	if err := s.startAgent(session); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.mu.Lock()
+	s.sessions[session.ID] = session
+	s.save()
+	s.mu.Unlock()
+	writeAPIJSON(w, http.StatusCreated, session)
+}
+
+// startAgent creates the session's agent, continuing its history.
+func (s *apiServer) startAgent(session *serveSession) error {
+	opts, err := agentOptions(s.cfg, session.Agent, session.Model, session.System, session.History)
+	if err != nil {
+		return err
+	}
+	session.agent = agent.NewAgent(append(opts,
+		agent.WithMaxIterations(s.maxIterations),
+		agent.WithApprover(s.approver(session.ID)),
+		agent.WithHooks(s.approveToolCall(session.ID), s.metrics.hooks()),
+		agent.WithEventSink(s.events(session.ID)),
+	)...)
+	return nil
+}
+
+func (s *apiServer) listSessions(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type summary struct {
+		ID       string    `json:"id"`
+		Model    string    `json:"model"`
+		Agent    string    `json:"agent"`
+		Created  time.Time `json:"created"`
+		Messages int       `json:"messages"`
+	}
+	list := []summary{}
+	for _, session := range s.sessions {
+		if session.transient {
+			continue
+		}
+		list = append(list, summary{session.ID, session.Model, session.Agent, session.Created, len(session.History)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	writeAPIJSON(w, http.StatusOK, list)
+}
+
+func (s *apiServer) getSession(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "no session %s", id)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, session)
+}
+
+func (s *apiServer) deleteSession(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		writeAPIError(w, http.StatusNotFound, "no session %s", id)
+		return
+	}
+	s.deleteSessionLocked(id)
+	s.save()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteSessionLocked removes a session, stopping its messages and
+// disconnecting its clients; the caller holds s.mu.
+func (s *apiServer) deleteSessionLocked(id string) {
+	session := s.sessions[id]
+	delete(s.sessions, id)
+	for _, msg := range s.messages {
+		if msg.Session != id {
+			continue
+		}
+		if msg.cancel != nil {
+			msg.cancel()
+		}
+		delete(s.messages, msg.ID)
+	}
+	for ch := range session.subscribers {
+		close(ch)
+	}
+	session.subscribers = nil
+}
+
+func (s *apiServer) postMessage(w http.ResponseWriter, r *http.Request, sessionID string) {
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		writeAPIError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	s.mu.Lock()
+	if _, ok := s.sessions[sessionID]; !ok {
+		s.mu.Unlock()
+		writeAPIError(w, http.StatusNotFound, "no session %s", sessionID)
+		return
+	}
+	stream := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	var events chan serveEvent
+	if stream {
+		// Subscribe before queueing, so no event is missed.
+		events = s.subscribeLocked(sessionID)
+	}
+	msg := *s.queueMessageLocked(sessionID, body.Content)
+	s.mu.Unlock()
+
+	if stream {
+		s.writeEvents(w, r, sessionID, msg.ID, events)
+		return
+	}
+	writeAPIJSON(w, http.StatusAccepted, msg)
+}
+
+// queueMessageLocked queues content for the session's agent and tells the
+// session's clients; the caller holds s.mu.
+func (s *apiServer) queueMessageLocked(sessionID, content string) *serveMessage {
+	msg := &serveMessage{ID: newServeID(), Session: sessionID, Content: content, Status: "queued", Created: time.Now()}
+	s.messages[msg.ID] = msg
+	s.publishLocked(sessionID, serveEvent{Type: "queued", Message: msg.ID, Text: content})
+	s.enqueueLocked(msg.ID)
+	s.save()
+	return msg
+}
+
+func (s *apiServer) listMessages(w http.ResponseWriter, sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[sessionID]; !ok {
+		writeAPIError(w, http.StatusNotFound, "no session %s", sessionID)
+		return
+	}
+	list := []*serveMessage{}
+	for _, msg := range s.messages {
+		if msg.Session == sessionID {
+			list = append(list, msg)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	writeAPIJSON(w, http.StatusOK, list)
+}
+
+func (s *apiServer) getMessage(w http.ResponseWriter, sessionID, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, ok := s.messages[id]
+	if !ok || msg.Session != sessionID {
+		writeAPIError(w, http.StatusNotFound, "no message %s in session %s", id, sessionID)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, msg)
+}
+
+func (s *apiServer) listApprovals(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []*serveApproval{}
+	for _, approval := range s.approvals {
+		list = append(list, approval)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	writeAPIJSON(w, http.StatusOK, list)
+}
+
+func (s *apiServer) answerApproval(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Approve *bool `json:"approve"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if body.Approve == nil {
+		writeAPIError(w, http.StatusBadRequest, "approve (true or false) is required")
+		return
+	}
+	if err := s.decide(id, *body.Approve); err != nil {
+		writeAPIError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decide answers a pending approval.
+func (s *apiServer) decide(id string, approve bool) error {
+	s.mu.Lock()
+	approval, ok := s.approvals[id]
+	delete(s.approvals, id)
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no pending approval %s", id)
+	}
+	approval.answer <- approve
+	return nil
+}
+
+// approveToolCall asks the clients of a session to approve each call of a
+// tool that does more than read the workspace.
+func (s *apiServer) approveToolCall(sessionID string) agent.Hooks {
+	return approvalHook(func(ctx context.Context, call tools.Call, action string) bool {
+		approval := &serveApproval{Tool: call.Name, Args: call.Args, Action: action}
+		return traceApproval(ctx, action, func() bool { return s.ask(ctx, sessionID, approval) })
+	})
+}
+
+// approver asks the clients of a session to confirm the actions tools ask
+// about themselves: file edits, commands and SQL statements that modify
+// data.
+func (s *apiServer) approver(sessionID string) func(action string) bool {
+	return func(action string) bool {
+		s.mu.Lock()
+		ctx := s.running.ctx
+		s.mu.Unlock()
+		return s.ask(ctx, sessionID, &serveApproval{Action: action})
+	}
+}
+
+// ask publishes approval to the session's clients and waits for one to
+// answer it. It is denied if none does within approvalTimeout or the
+// message is cancelled.
+func (s *apiServer) ask(ctx context.Context, sessionID string, approval *serveApproval) bool {
+	if s.autoApprove {
+		return true
+	}
+	s.mu.Lock()
+	approval.ID, approval.Session, approval.Created = newServeID(), sessionID, time.Now()
+	approval.Message = s.running.ID
+	approval.answer = make(chan bool, 1)
+	s.approvals[approval.ID] = approval
+	s.publishLocked(sessionID, serveEvent{Type: "approval", Message: approval.Message, Approval: approval.ID, Text: approval.Action, Tool: approval.Tool, Args: approval.Args})
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.approvals, approval.ID)
+		s.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(s.approvalTimeout)
+	defer timer.Stop()
+	select {
+	case approved := <-approval.answer:
+		return approved
+	case <-timer.C:
+		slog.Warn(fmt.Sprintf("denied %q: not approved within %v", approval.Action, s.approvalTimeout))
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// events forwards what a session's agent does to the session's clients.
+func (s *apiServer) events(sessionID string) agent.EventSink {
+	publish := func(event serveEvent) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.running != nil {
+			event.Message = s.running.ID
+		}
+		s.publishLocked(sessionID, event)
+	}
+	return agent.Events{
+		Token: func(text string) { publish(serveEvent{Type: "token", Text: text}) },
+		ToolCallStart: func(call tools.Call) {
+			publish(serveEvent{Type: "tool_call", Tool: call.Name, Args: call.Args})
+		},
+		ToolResult: func(call tools.Call, result string, err error) {
+			event := serveEvent{Type: "tool_result", Tool: call.Name, Result: result}
+			if err != nil {
+				event.Error = err.Error()
+			}
+			publish(event)
+		},
+		TurnComplete: func(reply string) { publish(serveEvent{Type: "reply", Text: reply}) },
+		Stats: func(stats *provider.Stats) {
+			publish(serveEvent{Type: "stats", Stats: &serveStats{
+				PromptTokens:     stats.PromptTokens,
+				Tokens:           stats.TokenCount,
+				TimeToFirstToken: stats.TimeToFirstToken().Seconds(),
+				Seconds:          stats.Elapsed().Seconds(),
+				TokensPerSecond:  stats.TokensPerSecond(),
+			}})
+		},
+	}
+}
+
+func (s *apiServer) streamEvents(w http.ResponseWriter, r *http.Request, sessionID, messageID string) {
+	s.mu.Lock()
+	if _, ok := s.sessions[sessionID]; !ok {
+		s.mu.Unlock()
+		writeAPIError(w, http.StatusNotFound, "no session %s", sessionID)
+		return
+	}
+	events := s.subscribeLocked(sessionID)
+	s.mu.Unlock()
+	s.writeEvents(w, r, sessionID, messageID, events)
+}
+
+// writeEvents streams events as server-sent events until the client goes
+// away or, when messageID is set, that message is answered.
+func (s *apiServer) writeEvents(w http.ResponseWriter, r *http.Request, sessionID, messageID string, events chan serveEvent) {
+	defer s.unsubscribe(sessionID, events)
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if messageID != "" && event.Message != messageID {
+				continue
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flush()
+			if messageID != "" && (event.Type == "done" || event.Type == "error") {
+				return
+			}
+		}
+	}
+}
+
+// subscribeLocked returns a channel receiving the session's events; the
+// caller holds s.mu.
+func (s *apiServer) subscribeLocked(sessionID string) chan serveEvent {
+	session := s.sessions[sessionID]
+	if session.subscribers == nil {
+		session.subscribers = map[chan serveEvent]bool{}
+	}
+	events := make(chan serveEvent, 256)
+	session.subscribers[events] = true
+	return events
+}
+
+// closeStreamsLocked ends the event streams of every session; the caller
+// holds s.mu.
+func (s *apiServer) closeStreamsLocked() {
+	for _, session := range s.sessions {
+		for events := range session.subscribers {
+			close(events)
+		}
+		session.subscribers = nil
+	}
+}
+
+func (s *apiServer) unsubscribe(sessionID string, events chan serveEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[sessionID]; ok && session.subscribers[events] {
+		delete(session.subscribers, events)
+		close(events)
+	}
+}
+
+// publishLocked sends event to the session's subscribers; the caller holds
+// s.mu. A subscriber too slow to keep up is dropped rather than stall the
+// agent; it can fetch the message once it is answered.
+func (s *apiServer) publishLocked(sessionID string, event serveEvent) {
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return
+	}
+	for events := range session.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(session.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// enqueueLocked queues a message and wakes the worker; the caller holds
+// s.mu.
+func (s *apiServer) enqueueLocked(id string) {
+	s.queue = append(s.queue, id)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work answers queued messages one at a time until ctx is done.
+func (s *apiServer) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		var msg *serveMessage
+		for len(s.queue) > 0 && msg == nil {
+			msg = s.messages[s.queue[0]] // nil if its session was deleted
+			s.queue = s.queue[1:]
+		}
+		s.mu.Unlock()
+		if msg == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+		s.answer(ctx, msg)
+	}
+}
+
+// answer sends a message to its session's agent and records the outcome.
+func (s *apiServer) answer(shutdown context.Context, msg *serveMessage) {
+	ctx, cancel := context.WithCancel(shutdown)
+	defer cancel()
+	s.mu.Lock()
+	session, ok := s.sessions[msg.Session]
+	if !ok {
+		s.mu.Unlock()
+		return // deleted since it was dequeued
+	}
+	msg.Status = "running"
+	msg.ctx, msg.cancel = ctx, cancel
+	s.running = msg
+	s.save()
+	s.mu.Unlock()
+
+	started := time.Now()
+	reply, err := session.agent.Send(ctx, msg.Content)
+	if err != nil && shutdown.Err() != nil {
+		err = fmt.Errorf("interrupted by a server shutdown")
+	}
+	s.metrics.observe("goclient_message_duration_seconds", time.Since(started).Seconds())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := time.Now()
+	msg.Finished = &finished
+	msg.ctx, msg.cancel = nil, nil
+	s.running = nil
+	session.History = session.agent.History()
+	if err != nil {
+		msg.Status = "failed"
+		s.metrics.add("goclient_messages_total", 1, "status", "failed")
+		msg.Error = err.Error()
+		msg.Reply = reply
+		s.publishLocked(session.ID, serveEvent{Type: "error", Message: msg.ID, Error: msg.Error})
+	} else {
+		msg.Status = "done"
+		s.metrics.add("goclient_messages_total", 1, "status", "done")
+		msg.Reply = reply
+		s.publishLocked(session.ID, serveEvent{Type: "done", Message: msg.ID, Text: reply})
+	}
+	s.save()
+}
+
+// restore loads the saved sessions and queue. A message that was running
+// when the server stopped is marked failed; queued ones are answered again
+// in their original order.
+func (s *apiServer) restore() error {
+	data, err := os.ReadFile(s.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read server state: %v", err)
+	}
+	var state serveState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse server state %s: %v", s.statePath, err)
+	}
+	for _, session := range state.Sessions {
+		if err := s.startAgent(session); err != nil {
+			return fmt.Errorf("restoring session %s: %v", session.ID, err)
+		}
+		s.sessions[session.ID] = session
+	}
+	sort.Slice(state.Messages, func(i, j int) bool { return state.Messages[i].Created.Before(state.Messages[j].Created) })
+	resumed := 0
+	for _, msg := range state.Messages {
+		if _, ok := s.sessions[msg.Session]; !ok {
+			continue
+		}
+		switch msg.Status {
+		case "running":
+			finished := time.Now()
+			msg.Status, msg.Error, msg.Finished = "failed", "interrupted by a server restart", &finished
+		case "queued":
+			s.queue = append(s.queue, msg.ID)
+			resumed++
+		}
+		s.messages[msg.ID] = msg
+	}
+	if resumed > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming %d queued messages\n", resumed)
+		s.wake <- struct{}{}
+	}
+	return nil
+}
+
+// save writes the sessions and messages to statePath, dropping messages
+// finished more than serveFinishedRetention ago; the caller holds s.mu.
+func (s *apiServer) save() {
+	state := serveState{Sessions: []*serveSession{}, Messages: []*serveMessage{}}
+	for _, session := range s.sessions {
+		if !session.transient {
+			state.Sessions = append(state.Sessions, session)
+		}
+	}
+	for id, msg := range s.messages {
+		if session, ok := s.sessions[msg.Session]; ok && session.transient {
+			continue
+		}
+		if msg.Finished != nil && time.Since(*msg.Finished) > serveFinishedRetention {
+			delete(s.messages, id)
+			continue
+		}
+		state.Messages = append(state.Messages, msg)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.statePath), 0o755)
+	}
+	if err == nil {
+		// Write to a temporary file first so an interrupted save can't
+		// corrupt the previous version.
+		tmp := s.statePath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, s.statePath)
+		}
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("could not save the server state: %v", err))
+	}
+}
+
+// newServeID returns a random identifier for a session, message or
+// approval.
+func newServeID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// decodeBody decodes a JSON request body into v; an empty body leaves v
+// unchanged.
+func decodeBody(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeAPIJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
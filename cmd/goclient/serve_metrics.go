@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// Buckets of the latency histograms, in seconds.
+var (
+	fastBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	slowBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+)
+
+// serveMetrics counts what the server does, for GET /metrics in the
+// Prometheus text format.
+type serveMetrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+	order    []string
+}
+
+// metricFamily is a counter or a histogram and its series by label set.
+type metricFamily struct {
+	name    string
+	help    string
+	buckets []float64 // nil for a counter
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value  float64  // a counter's value, or a histogram's sum
+	counts []uint64 // a histogram's observations per bucket
+	count  uint64
+}
+
+func newServeMetrics() *serveMetrics {
+	m := &serveMetrics{families: map[string]*metricFamily{}}
+	m.define("goclient_http_requests_total", "HTTP requests by route and status code.", nil)
+	m.define("goclient_messages_total", "Messages answered, by outcome: done or failed.", nil)
+	m.define("goclient_message_duration_seconds", "Time from starting to answer a message until the final reply.", slowBuckets)
+	m.define("goclient_inferences_total", "Requests to the model.", nil)
+	m.define("goclient_inference_errors_total", "Requests to the model that failed.", nil)
+	m.define("goclient_prompt_tokens_total", "Tokens sent to the model.", nil)
+	m.define("goclient_completion_tokens_total", "Tokens generated by the model.", nil)
+	m.define("goclient_time_to_first_token_seconds", "Time from a request to the model until its first token.", fastBuckets)
+	m.define("goclient_inference_duration_seconds", "Time the model took for a reply.", slowBuckets)
+	m.define("goclient_tool_calls_total", "Tool calls by tool.", nil)
+	m.define("goclient_tool_call_failures_total", "Tool calls that failed or were denied, by tool.", nil)
+	m.define("goclient_tool_call_duration_seconds", "Time tools took to run, excluding approval.", fastBuckets)
+	return m
+}
+
+func (m *serveMetrics) define(name, help string, buckets []float64) {
+	m.families[name] = &metricFamily{name: name, help: help, buckets: buckets, series: map[string]*metricSeries{}}
+	m.order = append(m.order, name)
+}
+
+// series returns the series of a metric with the labels, given as name and
+// value pairs; the caller holds m.mu.
+func (m *serveMetrics) series(name string, labels []string) *metricSeries {
+	f := m.families[name]
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	key := strings.Join(pairs, ",")
+	series, ok := f.series[key]
+	if !ok {
+		series = &metricSeries{counts: make([]uint64, len(f.buckets))}
+		f.series[key] = series
+	}
+	return series
+}
+
+// add adds v to a counter.
+func (m *serveMetrics) add(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name, labels).value += v
+}
+
+// observe records v in a histogram.
+func (m *serveMetrics) observe(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := m.series(name, labels)
+	for i, bound := range m.families[name].buckets {
+		if v <= bound {
+			series.counts[i]++
+		}
+	}
+	series.value += v
+	series.count++
+}
+
+// hooks record the agent's inferences and tool calls. They must come after
+// the approval hook, so the time waiting for approval is not counted as the
+// tool's.
+func (m *serveMetrics) hooks() agent.Hooks {
+	var started time.Time // tool calls run one at a time
+	return agent.Hooks{
+		AfterInference: func(ctx context.Context, request provider.Request, reply string, stats *provider.Stats, err error) {
+			m.add("goclient_inferences_total", 1, "model", request.Model)
+			if err != nil {
+				m.add("goclient_inference_errors_total", 1, "model", request.Model)
+				return
+			}
+			m.add("goclient_prompt_tokens_total", float64(stats.PromptTokens), "model", request.Model)
+			m.add("goclient_completion_tokens_total", float64(stats.TokenCount), "model", request.Model)
+			if ttft := stats.TimeToFirstToken(); ttft > 0 {
+				m.observe("goclient_time_to_first_token_seconds", ttft.Seconds(), "model", request.Model)
+			}
+			m.observe("goclient_inference_duration_seconds", stats.Elapsed().Seconds(), "model", request.Model)
+		},
+		BeforeToolCall: func(ctx context.Context, call *tools.Call) error {
+			started = time.Now()
+			return nil
+		},
+		AfterToolCall: func(ctx context.Context, call tools.Call, result string, err error) {
+			m.add("goclient_tool_calls_total", 1, "tool", call.Name)
+			if err != nil {
+				m.add("goclient_tool_call_failures_total", 1, "tool", call.Name)
+			}
+			if !started.IsZero() { // zero if the call was denied
+				m.observe("goclient_tool_call_duration_seconds", time.Since(started).Seconds(), "tool", call.Name)
+				started = time.Time{}
+			}
+		},
+	}
+}
+
+// write writes the metrics in the Prometheus text format, followed by
+// gauges of the server's current state.
+func (m *serveMetrics) write(w io.Writer, gauges map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.order {
+		f := m.families[name]
+		kind := "counter"
+		if f.buckets != nil {
+			kind = "histogram"
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := f.series[key]
+			if f.buckets == nil {
+				fmt.Fprintf(w, "%s%s %s\n", name, braces(key), formatFloat(series.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(join(key, `le="`+formatFloat(bound)+`"`)), series.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(join(key, `le="+Inf"`)), series.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(key), formatFloat(series.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, braces(key), series.count)
+		}
+	}
+	names := make([]string, 0, len(gauges))
+	for name := range gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s gauge\n%s %s\n", name, name, formatFloat(gauges[name]))
+	}
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func join(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// serveMetricsHandler answers GET /metrics.
+func (s *apiServer) serveMetricsHandler(w http.ResponseWriter) {
+	s.mu.Lock()
+	gauges := map[string]float64{
+		"goclient_sessions":          float64(len(s.sessions)),
+		"goclient_queued_messages":   float64(len(s.queue)),
+		"goclient_pending_approvals": float64(len(s.approvals)),
+		"goclient_running_messages":  0,
+	}
+	if s.running != nil {
+		gauges["goclient_running_messages"] = 1
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w, gauges)
+}
+
+// metricsRoute is the route label of a request: its path with the IDs
+// replaced, so the label has a bounded number of values.
+func metricsRoute(method string, parts []string, found bool) string {
+	if !found {
+		return "other"
+	}
+	route := make([]string, len(parts))
+	copy(route, parts)
+	if (parts[0] == "sessions" || parts[0] == "approvals") && len(parts) > 1 {
+		route[1] = "{id}"
+	}
+	if len(parts) > 3 {
+		route[3] = "{mid}"
+	}
+	return method + " /" + strings.Join(route, "/")
+}
+
+// statusRecorder remembers the status code of a response. It passes on
+// flushes, for event streams, and hijacking, for WebSockets.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response cannot be hijacked")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// openAIModel is the model name that stands for the server's default
+// model in the OpenAI-compatible API.
+const openAIModel = "goclient"
+
+// openAIRequest is the part of a chat completion request the facade uses.
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+// openAIMessage is a chat message. Content is a string, or a list of parts
+// of which the text parts are used.
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message's text content.
+func (m openAIMessage) text() (string, error) {
+	var text string
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return "", nil
+	}
+	if err := json.Unmarshal(m.Content, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", fmt.Errorf("%s message content must be a string or a list of parts", m.Role)
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// chatCompletions answers POST /v1/chat/completions with the agent: the
+// last message is sent to an agent that has the earlier ones as its
+// history, and the tools it calls run as in any session, approvals
+// included. The request waits in the queue like any other message.
+func (s *apiServer) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request openAIRequest
+	if err := decodeBody(r, &request); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	session, content, err := s.openAISession(request)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := s.startAgent(session); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.sessions[session.ID] = session
+	events := s.subscribeLocked(session.ID)
+	msg := s.queueMessageLocked(session.ID, content)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.deleteSessionLocked(session.ID)
+		s.mu.Unlock()
+	}()
+
+	completion := openAICompletion{
+		ID:      "chatcmpl-" + msg.ID,
+		Created: time.Now().Unix(),
+		Model:   session.Model,
+	}
+	if request.Model == "" || request.Model == openAIModel {
+		completion.Model = openAIModel
+	}
+	if request.Stream {
+		s.streamCompletion(r.Context(), w, completion, events)
+		return
+	}
+
+	var usage openAIUsage
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				writeOpenAIError(w, http.StatusInternalServerError, "the request was dropped")
+				return
+			}
+			switch event.Type {
+			case "stats":
+				usage.add(event.Stats)
+			case "error":
+				writeOpenAIError(w, http.StatusInternalServerError, "%s", event.Error)
+				return
+			case "done":
+				completion.Object = "chat.completion"
+				completion.Choices = []openAIChoice{{Message: &openAIReply{Role: "assistant", Content: event.Text}, FinishReason: "stop"}}
+				completion.Usage = &usage
+				writeAPIJSON(w, http.StatusOK, completion)
+				return
+			}
+		}
+	}
+}
+
+// openAISession returns a transient session holding the conversation of a
+// request, and the message to send to it.
+func (s *apiServer) openAISession(request openAIRequest) (*serveSession, string, error) {
+	session := &serveSession{ID: newServeID(), Model: request.Model, Agent: s.agentName, Created: time.Now(), transient: true}
+	if session.Model == "" || session.Model == openAIModel {
+		session.Model = s.model
+	}
+	if len(request.Messages) == 0 {
+		return nil, "", fmt.Errorf("messages is required")
+	}
+	last := request.Messages[len(request.Messages)-1]
+	if last.Role != "user" {
+		return nil, "", fmt.Errorf("the last message must be from the user, not %q", last.Role)
+	}
+	var system []string
+	for _, message := range request.Messages[:len(request.Messages)-1] {
+		text, err := message.text()
+		if err != nil {
+			return nil, "", err
+		}
+		switch message.Role {
+		case "system", "developer":
+			system = append(system, text)
+		case "user", "assistant":
+			session.History = append(session.History, agent.Message{Role: message.Role, Content: text})
+		case "tool":
+			session.History = append(session.History, agent.Message{Role: "tool", Content: text})
+		default:
+			return nil, "", fmt.Errorf("unknown message role %q", message.Role)
+		}
+	}
+	session.System = strings.Join(system, "\n\n")
+	content, err := last.text()
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, "", fmt.Errorf("the last message is empty")
+	}
+	return session, content, nil
+}
+
+// streamCompletion writes the agent's replies as chat.completion.chunk
+// server-sent events. Every reply is streamed, including those that call
+// tools, separated by a blank line; tool results are not.
+func (s *apiServer) streamCompletion(ctx context.Context, w http.ResponseWriter, completion openAICompletion, events chan serveEvent) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	completion.Object = "chat.completion.chunk"
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta openAIReply, finish string) {
+		c := completion
+		c.Choices = []openAIChoice{{Delta: &delta}}
+		if finish != "" {
+			c.Choices[0].FinishReason = finish
+		}
+		send(c)
+	}
+
+	chunk(openAIReply{Role: "assistant"}, "")
+	separate := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case "token":
+				if event.Text == "" {
+					continue
+				}
+				if separate {
+					chunk(openAIReply{Content: "\n\n"}, "")
+					separate = false
+				}
+				chunk(openAIReply{Content: event.Text}, "")
+			case "reply":
+				separate = true
+			case "error":
+				send(map[string]interface{}{"error": map[string]string{"message": event.Error, "type": "server_error"}})
+				fmt.Fprint(w, "data: [DONE]\n\n")
+				return
+			case "done":
+				chunk(openAIReply{}, "stop")
+				fmt.Fprint(w, "data: [DONE]\n\n")
+				return
+			}
+		}
+	}
+}
+
+// openAIModels answers GET /v1/models: "goclient", for the default model,
+// and the models installed in Ollama.
+func (s *apiServer) openAIModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	list := []model{{ID: openAIModel, Object: "model", OwnedBy: "goclient"}}
+	installed, err := (&provider.Ollama{}).Models(r.Context())
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	for _, m := range installed {
+		list = append(list, model{ID: m.Name, Object: "model", OwnedBy: "ollama"})
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": list})
+}
+
+type openAICompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *openAIReply `json:"message,omitempty"`
+	Delta        *openAIReply `json:"delta,omitempty"`
+	FinishReason interface{}  `json:"finish_reason"` // "stop", or null while streaming
+}
+
+type openAIReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// openAIUsage counts the tokens of every inference the answer took.
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *openAIUsage) add(stats *serveStats) {
+	if stats == nil {
+		return
+	}
+	u.PromptTokens += stats.PromptTokens
+	u.CompletionTokens += stats.Tokens
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+}
+
+// writeOpenAIError writes an error in the form OpenAI clients expect.
+func writeOpenAIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	kind := "invalid_request_error"
+	if status >= 500 {
+		kind = "server_error"
+	}
+	writeAPIJSON(w, status, map[string]interface{}{"error": map[string]string{
+		"message": fmt.Sprintf(format, args...),
+		"type":    kind,
+	}})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsFrame is a frame a WebSocket client sends: a message for the agent, or
+// the answer to an approval.
+type wsFrame struct {
+	Type     string `json:"type"` // message or approval
+	Content  string `json:"content"`
+	Approval string `json:"approval"`
+	Approve  bool   `json:"approve"`
+}
+
+// webSocket connects a client to a session over a WebSocket. The client
+// receives the session's events as JSON frames, the same events the SSE
+// stream carries, and sends messages and approval decisions as wsFrames.
+func (s *apiServer) webSocket(w http.ResponseWriter, r *http.Request, sessionID string) {
+	s.mu.Lock()
+	_, ok := s.sessions[sessionID]
+	s.mu.Unlock()
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "no session %s", sessionID)
+		return
+	}
+	server := websocket.Server{
+		Handshake: sameOrigin,
+		Handler:   func(ws *websocket.Conn) { s.serveWebSocket(ws, sessionID) },
+	}
+	server.ServeHTTP(w, r)
+}
+
+// sameOrigin refuses WebSocket connections opened by pages of other sites,
+// which browsers would otherwise allow. Clients that are not browsers send
+// no Origin and are accepted.
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("cross-origin WebSocket from %s refused", origin)
+	}
+	return nil
+}
+
+func (s *apiServer) serveWebSocket(ws *websocket.Conn, sessionID string) {
+	defer ws.Close()
+	s.mu.Lock()
+	if _, ok := s.sessions[sessionID]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	events := s.subscribeLocked(sessionID)
+	s.mu.Unlock()
+	defer s.unsubscribe(sessionID, events)
+
+	go func() {
+		// The events end when the session is deleted or the client falls
+		// behind; closing the connection ends the read loop below.
+		defer ws.Close()
+		for event := range events {
+			if websocket.JSON.Send(ws, event) != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var data string
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+		var frame wsFrame
+		if err := json.Unmarshal([]byte(data), &frame); err != nil {
+			websocket.JSON.Send(ws, serveEvent{Type: "error", Error: fmt.Sprintf("invalid frame: %v", err)})
+			continue
+		}
+		if err := s.handleFrame(sessionID, frame); err != nil {
+			websocket.JSON.Send(ws, serveEvent{Type: "error", Error: err.Error()})
+		}
+	}
+}
+
+// handleFrame acts on a frame from a WebSocket client. A queued message is
+// acknowledged by the queued event sent to all the session's clients.
+func (s *apiServer) handleFrame(sessionID string, frame wsFrame) error {
+	switch frame.Type {
+	case "message":
+		if strings.TrimSpace(frame.Content) == "" {
+			return fmt.Errorf("content is required")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.sessions[sessionID]; !ok {
+			return fmt.Errorf("no session %s", sessionID)
+		}
+		s.queueMessageLocked(sessionID, frame.Content)
+		return nil
+	case "approval":
+		return s.decide(frame.Approval, frame.Approve)
+	default:
+		return fmt.Errorf("unknown frame type %q; want message or approval", frame.Type)
+	}
+}
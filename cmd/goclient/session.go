@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// Message is one entry in the conversation.
+type Message = agent.Message
+
+// Session is a saved conversation that can be resumed later.
+type Session struct {
+	Name     string    `json:"name"`
+	Model    string    `json:"model"`
+	WorkDir  string    `json:"work_dir"`
+	Project  string    `json:"project,omitempty"` // repository name of WorkDir
+	Remote   string    `json:"remote,omitempty"`  // git remote URL of WorkDir
+	Tags     []string  `json:"tags,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Messages []Message `json:"messages"`
+}
+
+var validSessionName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// sessionDir returns ~/.local/share/goclient/sessions.
+func sessionDir() string {
+	return filepath.Join(dataDir(), "sessions")
+}
+
+func sessionPath(name string) (string, error) {
+	if !validSessionName.MatchString(name) || strings.Trim(name, ".") == "" {
+		return "", fmt.Errorf("invalid session name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(sessionDir(), name+".json"), nil
+}
+
+// loadSession reads a saved session by name.
+func loadSession(name string) (*Session, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session %q not found", name)
+		}
+		return nil, fmt.Errorf("failed to read session %q: %v", name, err)
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session %q: %v", name, err)
+	}
+	return &session, nil
+}
+
+// listSessions returns all saved sessions, most recently updated first.
+func listSessions() ([]*Session, error) {
+	entries, err := os.ReadDir(sessionDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %v", err)
+	}
+	var sessions []*Session
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		session, err := loadSession(name)
+		if err != nil {
+			slog.Warn(err.Error())
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// deleteSession removes a saved session.
+func deleteSession(name string) error {
+	path, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("session %q not found", name)
+		}
+		return fmt.Errorf("failed to delete session %q: %v", name, err)
+	}
+	return nil
+}
+
+// Models returns the distinct models used in the session, in order of first use.
+func (s *Session) Models() []string {
+	var models []string
+	seen := map[string]bool{}
+	add := func(model string) {
+		if model != "" && !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	for _, msg := range s.Messages {
+		add(msg.Model)
+	}
+	add(s.Model)
+	return models
+}
+
+// Tokens returns the total output tokens recorded in the session.
+func (s *Session) Tokens() int {
+	total := 0
+	for _, msg := range s.Messages {
+		total += msg.Tokens
+	}
+	return total
+}
+
+// sessionExists reports whether a session with the given name has been saved.
+func sessionExists(name string) bool {
+	path, err := sessionPath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// saveSession writes the session to disk, replacing any previous version.
+func saveSession(session *Session) error {
+	path, err := sessionPath(session.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create session directory: %v", err)
+	}
+	session.Updated = time.Now()
+	if session.Created.IsZero() {
+		session.Created = session.Updated
+	}
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %v", err)
+	}
+	// Write to a temporary file first so an interrupted save can't corrupt
+	// the previous version.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write session: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write session: %v", err)
+	}
+	return nil
+}
+
+// persistSession saves the conversation under its session name, if it has
+// one.
+func (a *Agent) persistSession() {
+	if a.sessionName == "" {
+		return
+	}
+	if err := a.saveSession(a.sessionName); err != nil {
+		slog.Warn("could not save session", "err", err)
+	}
+}
+
+// saveSession persists the current conversation under name, which becomes
+// the agent's active session.
+func (a *Agent) saveSession(name string) error {
+	wd, _ := os.Getwd()
+	session := &Session{
+		Name:     name,
+		Model:    a.modelName,
+		WorkDir:  wd,
+		Tags:     a.sessionTags,
+		Messages: a.history,
+	}
+	if existing, err := loadSession(name); err == nil {
+		session.Created = existing.Created
+		session.Tags = mergeTags(existing.Tags, a.sessionTags)
+		if existing.WorkDir == wd {
+			session.Project, session.Remote = existing.Project, existing.Remote
+		}
+	}
+	if session.Project == "" {
+		session.Project, session.Remote = detectProject(wd)
+	}
+	if err := saveSession(session); err != nil {
+		return err
+	}
+	a.sessionName = name
+	return nil
+}
+
+// resumeSession replaces the current conversation with a saved session and
+// switches to its model and working directory.
+func (a *Agent) resumeSession(name string) error {
+	session, err := loadSession(name)
+	if err != nil {
+		return err
+	}
+	a.history = session.Messages
+	a.sessionName = session.Name
+	tools.ClearCheckpoints()
+	if a.taint != nil {
+		a.taint.rebuild(a.history)
+	}
+	if session.Model != "" && session.Model != a.modelName {
+		if err := a.useModel(context.Background(), session.Model); err != nil {
+			slog.Warn("could not switch to the session's model "+session.Model, "err", err)
+		}
+	}
+	if session.WorkDir != "" {
+		if err := os.Chdir(session.WorkDir); err != nil {
+			slog.Warn("could not change to session directory "+session.WorkDir, "err", err)
+		}
+	}
+	fmt.Printf("Resumed session %q (%d messages, model %s)\n", session.Name, len(session.Messages), a.modelName)
+	return nil
+}
+
+func init() {
+	registerCommand(command{
+		name:  "save",
+		usage: "[name]",
+		help:  "Save the conversation as a session, saved again after every turn",
+		run: func(ctx context.Context, a *Agent, name string) error {
+			if name == "" {
+				name = a.sessionName
+			}
+			if name == "" {
+				name = defaultSessionName()
+			}
+			if err := a.saveSession(name); err != nil {
+				return fmt.Errorf("failed to save session: %v", err)
+			}
+			fmt.Printf("Saved session %q\n", name)
+			return nil
+		},
+	})
+	registerCommand(command{
+		name:  "resume",
+		usage: "<name>",
+		help:  "Replace the conversation with a saved session",
+		run: func(ctx context.Context, a *Agent, name string) error {
+			if name == "" {
+				return fmt.Errorf("usage: /resume <name>")
+			}
+			return a.resumeSession(name)
+		},
+	})
+}
+
+// defaultSessionName is used by /save when no session is active.
+func defaultSessionName() string {
+	return "session-" + time.Now().Format("20060102-150405")
+}
+
+// detectProject names the git repository containing dir after its origin
+// remote, or after the repository directory when it has no remote.
+func detectProject(dir string) (project, remote string) {
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if remote = git("config", "--get", "remote.origin.url"); remote != "" {
+		return projectFromRemote(remote), remote
+	}
+	if top := git("rev-parse", "--show-toplevel"); top != "" {
+		return filepath.Base(top), ""
+	}
+	return "", ""
+}
+
+// projectFromRemote returns the repository name of a remote URL such as
+// git@github.com:owner/repo.git or https://github.com/owner/repo.
+func projectFromRemote(remote string) string {
+	remote = strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git")
+	if i := strings.LastIndexAny(remote, "/:"); i >= 0 {
+		remote = remote[i+1:]
+	}
+	return remote
+}
+
+// mergeTags appends the tags in add that are not already in tags.
+func mergeTags(tags, add []string) []string {
+	merged := append([]string{}, tags...)
+	for _, tag := range add {
+		if !containsString(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesProject reports whether the session belongs to the named project,
+// matching the repository name or the remote URL.
+func (s *Session) matchesProject(name string) bool {
+	return strings.EqualFold(s.Project, name) || (s.Remote != "" && strings.Contains(s.Remote, name))
+}
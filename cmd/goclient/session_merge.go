@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// branchEdit is an edit_file call made in one branch of a merged session.
+type branchEdit struct {
+	oldStr string
+	newStr string
+}
+
+// mergeSessionsCommand implements `goclient sessions merge A B`.
+func mergeSessionsCommand(args []string) error {
+	if len(args) < 2 || strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[1], "-") {
+		return fmt.Errorf("usage: goclient sessions merge <a> <b> [-mode concat|interleave] [-o name]")
+	}
+	fs := flag.NewFlagSet("sessions merge", flag.ContinueOnError)
+	mode := fs.String("mode", "concat", "concat: all of a's branch, then b's; interleave: both branches ordered by time.")
+	output := fs.String("o", "", "Name of the merged session (default <a>-<b>).")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+	if *mode != "concat" && *mode != "interleave" {
+		return fmt.Errorf("unknown merge mode %q (use concat or interleave)", *mode)
+	}
+
+	a, err := loadSession(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadSession(args[1])
+	if err != nil {
+		return err
+	}
+	name := *output
+	if name == "" {
+		name = a.Name + "-" + b.Name
+	}
+	if sessionExists(name) {
+		return fmt.Errorf("session %q already exists; choose another name with -o", name)
+	}
+
+	merged, conflicts := mergeSessions(a, b, *mode)
+	merged.Name = name
+	if err := saveSession(merged); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %q and %q into %q (%d messages)\n", a.Name, b.Name, name, len(merged.Messages))
+	if a.WorkDir != b.WorkDir {
+		slog.Warn("the sessions ran in different directories; the merged session uses " + a.WorkDir)
+	}
+	for _, path := range conflicts {
+		fmt.Printf("Conflict: both branches edited %s\n", path)
+	}
+	if len(conflicts) > 0 {
+		fmt.Printf("The conflicting edits are listed with conflict markers at the end of the session; resume it with -session %s to reconcile them.\n", name)
+	}
+	return nil
+}
+
+// mergeSessions combines two sessions that share a common start. The shared
+// messages are kept once and the two branches follow, each introduced by a
+// note. Files edited in both branches are returned, and described with
+// conflict markers in a final note.
+func mergeSessions(a, b *Session, mode string) (*Session, []string) {
+	common := 0
+	for common < len(a.Messages) && common < len(b.Messages) && sameMessage(a.Messages[common], b.Messages[common]) {
+		common++
+	}
+	branchA, branchB := a.Messages[common:], b.Messages[common:]
+
+	merged := &Session{
+		Model:   a.Model,
+		WorkDir: a.WorkDir,
+		Project: a.Project,
+		Remote:  a.Remote,
+		Tags:    mergeTags(a.Tags, b.Tags),
+	}
+	merged.Messages = append(merged.Messages, a.Messages[:common]...)
+	note := func(text string) Message {
+		return Message{Role: "note", Content: text}
+	}
+	switch mode {
+	case "interleave":
+		merged.Messages = append(merged.Messages, note(fmt.Sprintf(
+			"The conversation branched here. The messages below interleave branch %q and branch %q by time.", a.Name, b.Name)))
+		tagged := make([]Message, 0, len(branchA)+len(branchB))
+		for _, msg := range branchA {
+			msg.Content = "(branch " + a.Name + ")\n" + msg.Content
+			tagged = append(tagged, msg)
+		}
+		for _, msg := range branchB {
+			msg.Content = "(branch " + b.Name + ")\n" + msg.Content
+			tagged = append(tagged, msg)
+		}
+		sort.SliceStable(tagged, func(i, j int) bool { return tagged[i].Time.Before(tagged[j].Time) })
+		merged.Messages = append(merged.Messages, tagged...)
+	default:
+		merged.Messages = append(merged.Messages, note(fmt.Sprintf("The conversation branched here. Branch %q follows.", a.Name)))
+		merged.Messages = append(merged.Messages, branchA...)
+		merged.Messages = append(merged.Messages, note(fmt.Sprintf(
+			"End of branch %q. Branch %q, which started from the same point, follows.", a.Name, b.Name)))
+		merged.Messages = append(merged.Messages, branchB...)
+	}
+
+	editsA, editsB := branchEdits(branchA), branchEdits(branchB)
+	var conflicts []string
+	for path := range editsA {
+		if _, ok := editsB[path]; ok {
+			conflicts = append(conflicts, path)
+		}
+	}
+	sort.Strings(conflicts)
+	if len(conflicts) > 0 {
+		var text strings.Builder
+		text.WriteString("Both branches edited the same files. Only one version can be on disk; ")
+		text.WriteString("compare the edits below and reconcile them before making further changes.\n")
+		for _, path := range conflicts {
+			fmt.Fprintf(&text, "\n%s:\n<<<<<<< %s\n", path, a.Name)
+			writeBranchEdits(&text, editsA[path])
+			text.WriteString("=======\n")
+			writeBranchEdits(&text, editsB[path])
+			fmt.Fprintf(&text, ">>>>>>> %s\n", b.Name)
+		}
+		merged.Messages = append(merged.Messages, note(strings.TrimRight(text.String(), "\n")))
+	}
+	for i := range merged.Messages {
+		if merged.Messages[i].Time.IsZero() && i > 0 {
+			merged.Messages[i].Time = merged.Messages[i-1].Time
+		}
+	}
+	return merged, conflicts
+}
+
+func sameMessage(x, y Message) bool {
+	return x.Role == y.Role && x.Tool == y.Tool && x.Content == y.Content
+}
+
+// branchEdits collects the edit_file calls made by the assistant in a
+// branch, by workspace-relative path. The grammar a session used is not
+// recorded, so each reply is parsed with the text grammar and then JSON.
+func branchEdits(messages []Message) map[string][]branchEdit {
+	edits := map[string][]branchEdit{}
+	for _, msg := range messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		calls := tools.ExtractCalls(msg.Content, tools.GrammarText)
+		if len(calls) == 0 {
+			calls = tools.ExtractCalls(msg.Content, tools.GrammarJSON)
+		}
+		for _, call := range calls {
+			path, _ := call.Args["path"].(string)
+			if call.Name != "edit_file" || path == "" {
+				continue
+			}
+			oldStr, _ := call.Args["old_str"].(string)
+			newStr, _ := call.Args["new_str"].(string)
+			path = strings.TrimPrefix(path, "./")
+			edits[path] = append(edits[path], branchEdit{oldStr: oldStr, newStr: newStr})
+		}
+	}
+	return edits
+}
+
+func writeBranchEdits(b *strings.Builder, edits []branchEdit) {
+	for _, edit := range edits {
+		if edit.oldStr == "" {
+			b.WriteString("(created the file with)\n")
+		} else {
+			fmt.Fprintf(b, "(replaced)\n%s\n(with)\n", strings.TrimRight(edit.oldStr, "\n"))
+		}
+		fmt.Fprintf(b, "%s\n", strings.TrimRight(edit.newStr, "\n"))
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const sessionsUsage = `Usage: goclient sessions <command> [arguments]
+
+Commands:
+  list [-project name] [-tag tag]
+                                List saved sessions, optionally only those of a
+                                project (git repository) or with a tag
+  show <name>                   Print a session transcript
+  delete <name>...              Delete sessions
+  export <name> [-format md|json] [-o file]
+                                Export a session transcript (default markdown to stdout)
+  merge <a> <b> [-mode concat|interleave] [-o name]
+                                Combine two branches of a conversation into a new
+                                session, marking files both branches edited`
+
+// runSessionsCommand implements `goclient sessions ...` and returns the exit code.
+func runSessionsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, sessionsUsage)
+		return 2
+	}
+
+	// "goclient sessions -project x" is shorthand for "sessions list -project x".
+	if strings.HasPrefix(args[0], "-") && args[0] != "-h" {
+		args = append([]string{"list"}, args...)
+	}
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = listSessionsCommand(args[1:])
+	case "show":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: goclient sessions show <name>")
+			return 2
+		}
+		err = showSessionCommand(args[1])
+	case "delete":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: goclient sessions delete <name>...")
+			return 2
+		}
+		for _, name := range args[1:] {
+			if err = deleteSession(name); err != nil {
+				break
+			}
+			fmt.Printf("Deleted session %q\n", name)
+		}
+	case "export":
+		err = exportSessionCommand(args[1:])
+	case "merge":
+		err = mergeSessionsCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(sessionsUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown sessions command %q\n\n%s\n", args[0], sessionsUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func listSessionsCommand(args []string) error {
+	fs := flag.NewFlagSet("sessions list", flag.ContinueOnError)
+	project := fs.String("project", "", "Only list sessions of this project (repository name or part of its remote URL).")
+	tag := fs.String("tag", "", "Only list sessions with this tag.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	all, err := listSessions()
+	if err != nil {
+		return err
+	}
+	var sessions []*Session
+	for _, s := range all {
+		if (*project == "" || s.matchesProject(*project)) && (*tag == "" || containsString(s.Tags, *tag)) {
+			sessions = append(sessions, s)
+		}
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No saved sessions.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tUPDATED\tCREATED\tMESSAGES\tTOKENS\tPROJECT\tTAGS\tMODELS")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", s.Name, s.Updated.Format("2006-01-02 15:04"),
+			s.Created.Format("2006-01-02 15:04"), len(s.Messages), s.Tokens(), s.Project,
+			strings.Join(s.Tags, ","), strings.Join(s.Models(), ", "))
+	}
+	return w.Flush()
+}
+
+func showSessionCommand(name string) error {
+	session, err := loadSession(name)
+	if err != nil {
+		return err
+	}
+	fmt.Print(sessionMarkdown(session))
+	return nil
+}
+
+func exportSessionCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: goclient sessions export <name> [-format md|json] [-o file]")
+	}
+	name := args[0]
+	fs := flag.NewFlagSet("sessions export", flag.ContinueOnError)
+	format := fs.String("format", "md", "Export format: md or json.")
+	output := fs.String("o", "", "Write to this file instead of stdout.")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	session, err := loadSession(name)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch *format {
+	case "md", "markdown":
+		data = []byte(sessionMarkdown(session))
+	case "json":
+		data, err = json.MarshalIndent(session, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode session: %v", err)
+		}
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unknown export format %q (use md or json)", *format)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", *output, err)
+	}
+	fmt.Printf("Exported session %q to %s\n", name, *output)
+	return nil
+}
+
+// sessionMarkdown renders a session as a markdown transcript.
+func sessionMarkdown(s *Session) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", s.Name)
+	fmt.Fprintf(&b, "- Models: %s\n", strings.Join(s.Models(), ", "))
+	fmt.Fprintf(&b, "- Working directory: %s\n", s.WorkDir)
+	if s.Project != "" {
+		fmt.Fprintf(&b, "- Project: %s\n", s.Project)
+	}
+	if len(s.Tags) > 0 {
+		fmt.Fprintf(&b, "- Tags: %s\n", strings.Join(s.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "- Created: %s\n", s.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Updated: %s\n", s.Updated.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Messages: %d, output tokens: %d\n", len(s.Messages), s.Tokens())
+	for _, msg := range s.Messages {
+		b.WriteString(messageMarkdown(msg))
+	}
+	return b.String()
+}
+
+// messageMarkdown renders one message of a transcript.
+func messageMarkdown(msg Message) string {
+	switch msg.Role {
+	case "user":
+		return fmt.Sprintf("\n## User (%s)\n\n%s\n", msg.Time.Format("15:04:05"), msg.Content)
+	case "tool":
+		return fmt.Sprintf("\n### Tool result: %s\n\n```json\n%s\n```\n", msg.Tool, msg.Content)
+	case "summary":
+		return fmt.Sprintf("\n## Summary of earlier conversation\n\n%s\n", msg.Content)
+	case "note":
+		return fmt.Sprintf("\n> **Note:** %s\n", strings.ReplaceAll(msg.Content, "\n", "\n> "))
+	default:
+		return fmt.Sprintf("\n## Assistant (%s)\n\n%s\n", msg.Time.Format("15:04:05"), msg.Content)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// toolRunning is set while the chat runs a tool. Ctrl-C then stops only the
+// tool (see interruptibleTool), and the chat goes on.
+var toolRunning atomic.Bool
+
+// handleSignals returns a context that is cancelled on SIGTERM, or on
+// SIGINT outside tool calls, so the request in flight is stopped and the
+// program exits through its normal cleanup: the transcript and logs are
+// closed, the session is saved and the summary printed. A second signal
+// exits at once.
+func handleSignals(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt && toolRunning.Load() {
+				continue
+			}
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "\nExiting without cleaning up.")
+				os.Exit(exitInterrupted)
+			}
+			fmt.Fprintf(os.Stderr, "\n%s: stopping; send it again to exit immediately.\n", sig)
+			cancel()
+		}
+	}()
+	return ctx
+}
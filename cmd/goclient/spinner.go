@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// spinnerDelay is how long a request may go unanswered before the spinner
+// appears, so that it does not flicker for a model that is already loaded.
+const spinnerDelay = 300 * time.Millisecond
+
+// slowLoad is the model load time from which it is pointed out after the
+// reply.
+const slowLoad = time.Second
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinner shows that a request is waiting for its first token: Ollama can
+// take tens of seconds to load a model before it answers. In a terminal it
+// is drawn after the text already on the line, e.g. the "AI:" banner, and
+// erased when stopped; in the TUI it is shown in the status bar.
+type spinner struct {
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// startSpinner shows a spinner with the elapsed time until stop is called.
+func startSpinner(model string) *spinner {
+	s := &spinner{done: make(chan struct{}), stopped: make(chan struct{})}
+	if progress.disabled {
+		close(s.stopped)
+		return s
+	}
+	inline := isTerminal(os.Stdout)
+	go func() {
+		defer close(s.stopped)
+		start := time.Now()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(spinnerDelay):
+		}
+		if inline {
+			fmt.Print("\u001b7") // save the cursor position
+			defer fmt.Print("\u001b8\u001b[K")
+		} else {
+			defer tools.OnProgress(tools.Progress{})
+		}
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			text := fmt.Sprintf("waiting for %s (%ds)", model, int(time.Since(start).Seconds()))
+			if time.Since(start) > 3*time.Second {
+				text = fmt.Sprintf("waiting for %s: loading the model or reading the prompt (%ds)", model, int(time.Since(start).Seconds()))
+			}
+			if inline {
+				fmt.Printf("\u001b8\u001b[K"+colorGray+"%s %s"+colorReset, spinnerFrames[frame%len(spinnerFrames)], text)
+			} else {
+				tools.OnProgress(tools.Progress{Task: text})
+			}
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// stop erases the spinner. It may be called more than once.
+func (s *spinner) stop() {
+	s.once.Do(func() { close(s.done) })
+	<-s.stopped
+}
+
+// reportLoad points out a slow model load once the reply is complete.
+func reportLoad(model string, stats *provider.Stats) {
+	if stats.LoadDuration >= slowLoad && !quiet {
+		fmt.Printf(colorGray+"(loading %s took %.1fs; Ollama keeps it in memory for a while, so the next reply starts sooner)"+colorReset+"\n", model, stats.LoadDuration.Seconds())
+	}
+}
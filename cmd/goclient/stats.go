@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// turnReport is the JSON form of one inference written by -stats json.
+type turnReport struct {
+	Model           string    `json:"model"`
+	Time            time.Time `json:"time"`
+	PromptTokens    int       `json:"prompt_tokens"`
+	OutputTokens    int       `json:"output_tokens"`
+	TTFTSeconds     float64   `json:"ttft_seconds"`
+	LoadSeconds     float64   `json:"load_seconds"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	TokensPerSecond float64   `json:"tokens_per_second"`
+	ToolCalls       []string  `json:"tool_calls"`
+}
+
+// statsReport is the file written by -stats json.
+type statsReport struct {
+	Model        string       `json:"model"`
+	Turns        []turnReport `json:"turns"`
+	PromptTokens int          `json:"prompt_tokens"`
+	OutputTokens int          `json:"output_tokens"`
+	ToolCalls    int          `json:"tool_calls"`
+}
+
+// recordTurn keeps the stats of a finished inference for the session summary.
+func (a *Agent) recordTurn(stats *provider.Stats) {
+	a.turns = append(a.turns, turnReport{
+		Model:           a.modelName,
+		Time:            stats.StartTime,
+		PromptTokens:    stats.PromptTokens,
+		OutputTokens:    stats.TokenCount,
+		TTFTSeconds:     stats.TimeToFirstToken().Seconds(),
+		LoadSeconds:     stats.LoadDuration.Seconds(),
+		DurationSeconds: stats.Elapsed().Seconds(),
+		TokensPerSecond: stats.TokensPerSecond(),
+		ToolCalls:       append([]string{}, stats.ToolCalls...),
+	})
+	if a.onTurn != nil {
+		a.onTurn(stats)
+	}
+}
+
+// statsReport totals the recorded turns.
+func (a *Agent) statsReport() statsReport {
+	report := statsReport{Model: a.modelName, Turns: a.turns}
+	if report.Turns == nil {
+		report.Turns = []turnReport{}
+	}
+	for _, turn := range a.turns {
+		report.PromptTokens += turn.PromptTokens
+		report.OutputTokens += turn.OutputTokens
+		report.ToolCalls += len(turn.ToolCalls)
+	}
+	return report
+}
+
+// printSessionStats prints a summary of every inference in this run.
+func (a *Agent) printSessionStats() {
+	if len(a.turns) == 0 || quiet {
+		return
+	}
+	report := a.statsReport()
+	var ttft, duration, tps float64
+	for _, turn := range report.Turns {
+		ttft += turn.TTFTSeconds
+		duration += turn.DurationSeconds
+		tps += turn.TokensPerSecond
+	}
+	n := float64(len(report.Turns))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session: %d inferences, %d tool calls\n", len(report.Turns), report.ToolCalls)
+	fmt.Fprintf(&b, "Tokens: %d prompt, %d output\n", report.PromptTokens, report.OutputTokens)
+	fmt.Fprintf(&b, "Time: %.2fs total, avg TTFT %.2fs, avg TPS %.2f", duration, ttft/n, tps/n)
+	fmt.Printf(colorGray+"%s"+colorReset+"\n", b.String())
+}
+
+// writeStats writes the session statistics as JSON to path.
+func (a *Agent) writeStats(path string) error {
+	data, err := json.MarshalIndent(a.statsReport(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write stats: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write stats: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// JSON-RPC error codes used by -stdio.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000 // the request failed, e.g. Ollama returned an error
+	rpcNotInitialized = -32002
+)
+
+// rpcMessage is a JSON-RPC 2.0 request, notification or response.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// stdioServer speaks newline-delimited JSON-RPC on stdin and stdout for an
+// editor that runs goclient as a subprocess. It holds one conversation.
+type stdioServer struct {
+	cfg           *Config
+	model         string
+	agentName     string
+	maxIterations int
+	autoApprove   bool
+
+	out   io.Writer
+	outMu sync.Mutex
+
+	mu        sync.Mutex
+	agent     *agent.Agent
+	ctx       context.Context // of the message being answered
+	cancel    context.CancelFunc
+	sending   sync.WaitGroup // the message being answered
+	nextID    int
+	approvals map[string]chan bool // pending toolApprovalRequests by ID
+}
+
+// runStdio serves JSON-RPC on stdin, writing to out, until stdin closes,
+// the client calls shutdown or ctx is done, and returns the exit code.
+func runStdio(ctx context.Context, cfg *Config, model, agentName string, maxIterations int, autoApprove bool, out io.Writer) int {
+	s := &stdioServer{
+		cfg:           cfg,
+		model:         model,
+		agentName:     agentName,
+		maxIterations: maxIterations,
+		autoApprove:   autoApprove,
+		out:           out,
+		approvals:     map[string]chan bool{},
+	}
+	tools.OnProgress = func(tools.Progress) {}
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+	}()
+	for {
+		var line []byte
+		var ok bool
+		select {
+		case line, ok = <-lines:
+		case <-ctx.Done():
+			s.stop()
+			return exitInterrupted
+		}
+		if !ok {
+			break
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.write(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, fmt.Sprintf("invalid JSON: %v", err)}})
+			continue
+		}
+		if msg.Method == "" {
+			s.response(msg)
+			continue
+		}
+		if msg.Method == "shutdown" {
+			s.stop()
+			s.reply(msg.ID, nil, nil)
+			return exitOK
+		}
+		s.handle(msg)
+	}
+	s.stop()
+	return exitOK
+}
+
+// handle answers a request from the client. sendMessage runs in the
+// background, so the client can answer approvals or cancel meanwhile.
+func (s *stdioServer) handle(msg rpcMessage) {
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			Model  string `json:"model"`
+			Agent  string `json:"agent"`
+			System string `json:"system"`
+		}
+		if !s.params(msg, &params) {
+			return
+		}
+		result, err := s.initialize(params.Model, params.Agent, params.System)
+		if err != nil {
+			s.reply(msg.ID, nil, &rpcError{rpcInvalidParams, err.Error()})
+			return
+		}
+		s.reply(msg.ID, result, nil)
+	case "sendMessage":
+		var params struct {
+			Content string `json:"content"`
+		}
+		if !s.params(msg, &params) {
+			return
+		}
+		if params.Content == "" {
+			s.reply(msg.ID, nil, &rpcError{rpcInvalidParams, "content is required"})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.agent == nil {
+			s.reply(msg.ID, nil, &rpcError{rpcNotInitialized, "call initialize first"})
+			return
+		}
+		if s.cancel != nil {
+			s.reply(msg.ID, nil, &rpcError{rpcServerError, "a message is already being answered; wait for it or cancel it"})
+			return
+		}
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		s.sending.Add(1)
+		go s.send(s.ctx, msg.ID, params.Content)
+	case "cancel":
+		s.mu.Lock()
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.mu.Unlock()
+		s.reply(msg.ID, nil, nil)
+	case "reset", "history":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case s.agent == nil:
+			s.reply(msg.ID, nil, &rpcError{rpcNotInitialized, "call initialize first"})
+		case s.cancel != nil:
+			s.reply(msg.ID, nil, &rpcError{rpcServerError, "a message is being answered"})
+		case msg.Method == "reset":
+			s.agent.Reset()
+			s.reply(msg.ID, nil, nil)
+		default:
+			s.reply(msg.ID, s.agent.History(), nil)
+		}
+	default:
+		s.reply(msg.ID, nil, &rpcError{rpcMethodNotFound, "unknown method " + msg.Method})
+	}
+}
+
+// params decodes the request's parameters, replying with an error if they
+// do not decode.
+func (s *stdioServer) params(msg rpcMessage, v interface{}) bool {
+	if len(msg.Params) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		s.reply(msg.ID, nil, &rpcError{rpcInvalidParams, fmt.Sprintf("invalid params: %v", err)})
+		return false
+	}
+	return true
+}
+
+// initialize starts a conversation with the given model, agent type and
+// extra instructions, each defaulting to the command line's.
+func (s *stdioServer) initialize(model, agentName, system string) (interface{}, error) {
+	if model == "" {
+		model = s.model
+	}
+	if agentName == "" {
+		agentName = s.agentName
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no model; pass model or start goclient with -model")
+	}
+	opts, err := agentOptions(s.cfg, agentName, model, system, nil)
+	if err != nil {
+		return nil, err
+	}
+	a := agent.NewAgent(append(opts,
+		agent.WithMaxIterations(s.maxIterations),
+		agent.WithApprover(func(action string) bool {
+			// The approver has no context; use the message's.
+			s.mu.Lock()
+			ctx := s.ctx
+			s.mu.Unlock()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			return s.approve(ctx, map[string]interface{}{"action": action})
+		}),
+		agent.WithHooks(approvalHook(s.approveToolCall)),
+		agent.WithEventSink(s.events()),
+	)...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return nil, fmt.Errorf("a message is being answered")
+	}
+	s.agent = a
+	var names []string
+	for _, tool := range tools.Tools() {
+		names = append(names, tool.Name())
+	}
+	return map[string]interface{}{
+		"name":            "goclient",
+		"protocolVersion": 1,
+		"model":           model,
+		"agent":           agentName,
+		"tools":           names,
+	}, nil
+}
+
+// send answers a message, replying to the sendMessage request once done.
+func (s *stdioServer) send(ctx context.Context, id json.RawMessage, content string) {
+	defer s.sending.Done()
+	s.mu.Lock()
+	a := s.agent
+	s.mu.Unlock()
+	reply, err := a.Send(ctx, content)
+	s.mu.Lock()
+	s.cancel()
+	s.ctx, s.cancel = nil, nil
+	s.mu.Unlock()
+	if err != nil {
+		s.reply(id, nil, &rpcError{rpcServerError, err.Error()})
+		return
+	}
+	s.reply(id, map[string]string{"reply": reply}, nil)
+}
+
+// approveToolCall asks the client to approve each call of a tool that does
+// more than read the workspace.
+func (s *stdioServer) approveToolCall(ctx context.Context, call tools.Call, action string) bool {
+	params := map[string]interface{}{"action": action, "tool": call.Name, "args": call.Args}
+	return traceApproval(ctx, action, func() bool { return s.approve(ctx, params) })
+}
+
+// approve sends a toolApprovalRequest and waits for the client's answer,
+// {"approved": true} or false. Cancelling the message denies it.
+func (s *stdioServer) approve(ctx context.Context, params map[string]interface{}) bool {
+	if s.autoApprove {
+		return true
+	}
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("approval-%d", s.nextID)
+	answer := make(chan bool, 1)
+	s.approvals[id] = answer
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.approvals, id)
+		s.mu.Unlock()
+	}()
+
+	rawID, _ := json.Marshal(id)
+	s.write(rpcMessage{ID: rawID, Method: "toolApprovalRequest", Params: mustJSON(params)})
+	select {
+	case approved := <-answer:
+		return approved
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// response handles the client's answer to a toolApprovalRequest.
+func (s *stdioServer) response(msg rpcMessage) {
+	var id string
+	json.Unmarshal(msg.ID, &id)
+	s.mu.Lock()
+	answer, ok := s.approvals[id]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	var result struct {
+		Approved bool `json:"approved"`
+	}
+	if msg.Error == nil {
+		json.Unmarshal(msg.Result, &result)
+	}
+	select {
+	case answer <- result.Approved:
+	default: // already answered
+	}
+}
+
+// events sends what the agent does as notifications.
+func (s *stdioServer) events() agent.EventSink {
+	return agent.Events{
+		Token: func(text string) {
+			if text != "" {
+				s.notify("token", map[string]string{"text": text})
+			}
+		},
+		ToolCallStart: func(call tools.Call) {
+			s.notify("toolCall", map[string]interface{}{"tool": call.Name, "args": call.Args})
+		},
+		ToolResult: func(call tools.Call, result string, err error) {
+			params := map[string]interface{}{"tool": call.Name, "result": result}
+			if err != nil {
+				params["error"] = err.Error()
+			}
+			s.notify("toolResult", params)
+		},
+		TurnComplete: func(reply string) { s.notify("reply", map[string]string{"text": reply}) },
+		Stats: func(stats *provider.Stats) {
+			s.notify("stats", map[string]interface{}{
+				"prompt_tokens":       stats.PromptTokens,
+				"tokens":              stats.TokenCount,
+				"time_to_first_token": stats.TimeToFirstToken().Seconds(),
+				"seconds":             stats.Elapsed().Seconds(),
+				"tokens_per_second":   stats.TokensPerSecond(),
+			})
+		},
+	}
+}
+
+// stop cancels the message being answered, if any, and waits for its
+// response to be sent.
+func (s *stdioServer) stop() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	s.sending.Wait()
+}
+
+func (s *stdioServer) notify(method string, params interface{}) {
+	s.write(rpcMessage{Method: method, Params: mustJSON(params)})
+}
+
+func (s *stdioServer) reply(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	if id == nil {
+		return // a notification: JSON-RPC 2.0 forbids answering it
+	}
+	msg := rpcMessage{ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		msg.Result = mustJSON(result)
+	}
+	s.write(msg)
+}
+
+// write sends one message as a line on the output.
+func (s *stdioServer) write(msg rpcMessage) {
+	msg.JSONRPC = "2.0"
+	data, _ := json.Marshal(msg)
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
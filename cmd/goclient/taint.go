@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// SecurityConfig configures taint tracking of untrusted tool output.
+type SecurityConfig struct {
+	Taint          bool     `yaml:"taint"`           // same as -taint
+	UntrustedTools []string `yaml:"untrusted_tools"` // tools whose output is untrusted; default: the command tools
+}
+
+// Text copied from untrusted content is recognised by runs of taintWindow
+// words, or by single words or values at least taintMinLength long, such
+// as URLs and tokens.
+const (
+	taintWindow    = 6
+	taintMinLength = 24
+)
+
+// taintTracker remembers the output of untrusted tools and holds back tool
+// calls that copy from it, so instructions planted in a web page cannot
+// make the model run commands or write files without the user noticing.
+type taintTracker struct {
+	untrusted map[string]bool
+	sources   []taintSource
+}
+
+// taintSource is the output of one untrusted tool call, normalised.
+type taintSource struct {
+	tool string
+	text string
+}
+
+// newTaintTracker tracks the tools listed in security.untrusted_tools or,
+// by default, the config's command tools: the tools that can bring in
+// content from outside the workspace, such as a page fetched with curl. It
+// fails when none of them is registered, since -taint would then silently
+// protect nothing.
+func newTaintTracker(cfg *Config) (*taintTracker, error) {
+	var names []string
+	listed := cfg.Security != nil && len(cfg.Security.UntrustedTools) > 0
+	if listed {
+		names = cfg.Security.UntrustedTools
+	} else {
+		for _, tool := range cfg.Tools {
+			names = append(names, tool.Name)
+		}
+	}
+	t := &taintTracker{untrusted: map[string]bool{}}
+	var missing []string
+	for _, name := range names {
+		if _, ok := tools.LookupTool(name); !ok {
+			missing = append(missing, name)
+			continue
+		}
+		t.untrusted[name] = true
+	}
+	switch {
+	case len(t.untrusted) == 0 && listed:
+		return nil, fmt.Errorf("none of security.untrusted_tools (%s) is a registered tool, so -taint would track nothing", strings.Join(missing, ", "))
+	case len(t.untrusted) == 0:
+		return nil, fmt.Errorf("-taint needs a tool that returns outside content: define command tools in the config or list the tools under security.untrusted_tools")
+	case len(missing) > 0:
+		slog.Warn(fmt.Sprintf("security.untrusted_tools lists tools that are not registered: %s", strings.Join(missing, ", ")))
+	}
+	return t, nil
+}
+
+// record adds the model-facing output of an untrusted tool.
+func (t *taintTracker) record(tool, output string) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(output), &decoded); err == nil {
+		output = strings.Join(stringLeaves(decoded, nil), "\n")
+	}
+	t.sources = append(t.sources, taintSource{tool: tool, text: normalizeTaint(output)})
+}
+
+// rebuild recomputes the sources from a conversation, e.g. a resumed session.
+func (t *taintTracker) rebuild(history []Message) {
+	t.sources = nil
+	for _, msg := range history {
+		if msg.Role == "tool" && msg.Untrusted {
+			t.record(msg.Tool, msg.Content)
+		}
+	}
+}
+
+// check returns the untrusted tool and the copied text when a call's
+// arguments contain text from untrusted output. Only tools with effects are
+// checked; reading and searching the workspace is always allowed.
+func (t *taintTracker) check(call tools.Call) (tool, excerpt string, tainted bool) {
+	if len(t.sources) == 0 || isReadOnly(call.Name) {
+		return "", "", false
+	}
+	for _, value := range stringLeaves(call.Args, nil) {
+		value = normalizeTaint(value)
+		words := strings.Fields(value)
+		var candidates []string
+		for i := 0; i+taintWindow <= len(words); i++ {
+			candidates = append(candidates, strings.Join(words[i:i+taintWindow], " "))
+		}
+		for _, word := range words {
+			if len(word) >= taintMinLength {
+				candidates = append(candidates, word)
+			}
+		}
+		if len(words) < taintWindow && len(value) >= taintMinLength {
+			candidates = append(candidates, value)
+		}
+		for _, candidate := range candidates {
+			for _, source := range t.sources {
+				if strings.Contains(source.text, candidate) {
+					return source.tool, candidate, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// tools returns the names of the untrusted tools.
+func (t *taintTracker) tools() []string {
+	var names []string
+	for name := range t.untrusted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hooks holds back calls that copy untrusted content unless the user
+// allows them, and records the output of the untrusted tools.
+func (t *taintTracker) hooks() agent.Hooks {
+	return agent.Hooks{
+		BeforeToolCall: func(ctx context.Context, call *tools.Call) error {
+			if source, excerpt, tainted := t.check(*call); tainted {
+				return t.allow(ctx, *call, source, excerpt)
+			}
+			return nil
+		},
+		AfterToolCall: func(ctx context.Context, call tools.Call, result string, err error) {
+			if t.untrusted[call.Name] && err == nil {
+				t.record(call.Name, result)
+			}
+		},
+	}
+}
+
+// allow asks the user, or the approver of ctx, whether a tainted call may
+// run.
+func (t *taintTracker) allow(ctx context.Context, call tools.Call, source, excerpt string) error {
+	action := fmt.Sprintf("Tool %s was called with text copied from untrusted %s output (%q). Run it anyway?", call.Name, source, excerpt)
+	if tools.Confirm(ctx, action) {
+		return nil
+	}
+	return fmt.Errorf("refused to run %s: its arguments copy text from untrusted %s output, which may contain injected instructions", call.Name, source)
+}
+
+// stringLeaves collects the strings in a decoded JSON value.
+func stringLeaves(value interface{}, leaves []string) []string {
+	switch v := value.(type) {
+	case string:
+		leaves = append(leaves, v)
+	case []interface{}:
+		for _, item := range v {
+			leaves = stringLeaves(item, leaves)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			leaves = stringLeaves(item, leaves)
+		}
+	}
+	return leaves
+}
+
+// normalizeTaint lowercases text and collapses its whitespace, so copies
+// are found however they were reformatted.
+func normalizeTaint(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
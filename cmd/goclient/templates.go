@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// promptVars holds the variables set with -var.
+var promptVars = map[string]string{}
+
+// varFlag collects repeated -var key=value flags into promptVars.
+type varFlag struct{}
+
+func (varFlag) String() string { return "" }
+
+func (varFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("want key=value, got %q", value)
+	}
+	promptVars[key] = val
+	return nil
+}
+
+// templateVars returns the variables available to prompt templates: cwd,
+// date, time, os, arch, user and git_branch, overridden by -var.
+func templateVars() map[string]string {
+	vars := map[string]string{
+		"date": time.Now().Format("2006-01-02"),
+		"time": time.Now().Format("15:04"),
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		vars["cwd"] = cwd
+	}
+	if user := os.Getenv("USER"); user != "" {
+		vars["user"] = user
+	}
+	vars["git_branch"] = ""
+	if out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output(); err == nil {
+		vars["git_branch"] = strings.TrimSpace(string(out))
+	}
+	for key, val := range promptVars {
+		vars[key] = val
+	}
+	return vars
+}
+
+// expandPrompt executes text as a text/template over templateVars. Text
+// without actions is returned unchanged; a variable that is not defined is
+// an error.
+func expandPrompt(name, text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %v", name, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, templateVars()); err != nil {
+		return "", fmt.Errorf("%v (set variables with -var key=value)", err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gherlein/goclient/pkg/tracing"
+)
+
+// startTurn starts the trace of a user turn, which lasts until the reply
+// that calls no tools, and returns the context its spans are started from.
+func (a *Agent) startTurn(ctx context.Context) context.Context {
+	a.endTurn(nil)
+	a.turnCtx, a.turnSpan = tracing.Start(ctx, "turn", "gen_ai.request.model", a.modelName)
+	if a.sessionName != "" {
+		a.turnSpan.SetAttributes("session.name", a.sessionName)
+	}
+	return a.turnCtx
+}
+
+// endTurn ends the current turn's trace, if any.
+func (a *Agent) endTurn(err error) {
+	a.turnSpan.End(err)
+	a.turnSpan = nil
+}
+
+// traceApproval records the time the user took to approve or deny action
+// as a span of ctx's trace.
+func traceApproval(ctx context.Context, action string, approve func() bool) bool {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracing.Start(ctx, "approval", "approval.action", action)
+	approved := approve()
+	span.SetAttributes("approval.approved", approved)
+	span.End(nil)
+	return approved
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// transcribeFlagFile transcribes the -transcribe file for the conversation.
+func transcribeFlagFile(ctx context.Context, path string) (string, error) {
+	text, err := tools.Transcribe(ctx, path)
+	progress.clear()
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", fmt.Errorf("%s contains no recognizable speech", path)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, colorGray+"(transcribed %s: %d words)"+colorReset+"\n", path, len(strings.Fields(text)))
+	}
+	return text, nil
+}
+
+// addTranscript starts the conversation with a transcript, as the result
+// of a transcribe_audio call, so the first message can refer to it.
+func (a *Agent) addTranscript(path, text string) {
+	a.addMessage(Message{Role: "tool", Tool: "transcribe_audio", Content: fmt.Sprintf("Transcript of %s:\n%s", path, text), Time: time.Now()})
+}
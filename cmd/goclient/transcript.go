@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// transcriptLog appends the conversation to a file as it happens, for
+// -log-transcript: user messages, replies, tool calls and tool results,
+// each with its time. Files ending in .jsonl get one JSON object per line;
+// anything else gets markdown. A nil log records nothing.
+type transcriptLog struct {
+	file  *os.File
+	jsonl bool
+}
+
+// transcriptEntry is a line of a JSONL transcript. Tool calls have the role
+// "tool_call" and their arguments in Args.
+type transcriptEntry struct {
+	Message
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// openTranscript opens path for appending and marks the start of this run.
+func openTranscript(path, model string) (*transcriptLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript: %v", err)
+	}
+	t := &transcriptLog{file: file, jsonl: filepath.Ext(path) == ".jsonl"}
+	if !t.jsonl {
+		wd, _ := os.Getwd()
+		t.write(fmt.Sprintf("\n# Session %s\n\n- Model: %s\n- Working directory: %s\n", time.Now().Format("2006-01-02 15:04:05"), model, wd))
+	}
+	return t, nil
+}
+
+// message records a message added to the conversation.
+func (t *transcriptLog) message(msg Message) {
+	if t == nil {
+		return
+	}
+	if t.jsonl {
+		t.writeJSON(transcriptEntry{Message: msg})
+		return
+	}
+	t.write(messageMarkdown(msg))
+}
+
+// toolCalls records the tool calls of a reply.
+func (t *transcriptLog) toolCalls(calls []tools.Call) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	for _, call := range calls {
+		if t.jsonl {
+			t.writeJSON(transcriptEntry{Message: Message{Role: "tool_call", Tool: call.Name, Time: now}, Args: call.Args})
+			continue
+		}
+		args, _ := json.MarshalIndent(call.Args, "", "  ")
+		t.write(fmt.Sprintf("\n### Tool call: %s (%s)\n\n```json\n%s\n```\n", call.Name, now.Format("15:04:05"), args))
+	}
+}
+
+func (t *transcriptLog) writeJSON(entry transcriptEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Warn("could not log to transcript", "err", err)
+		return
+	}
+	t.write(string(line) + "\n")
+}
+
+func (t *transcriptLog) write(text string) {
+	if _, err := t.file.WriteString(text); err != nil {
+		slog.Warn("could not write transcript", "err", err)
+	}
+}
+
+// Close closes the file.
+func (t *transcriptLog) Close() {
+	if t != nil {
+		t.file.Close()
+	}
+}
+
+// addMessage adds a message to the conversation and the transcript.
+func (a *Agent) addMessage(msg Message) {
+	a.history = append(a.history, msg)
+	a.transcript.message(msg)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// inputHeight is the number of lines of the TUI's input box.
+const inputHeight = 3
+
+// tui is the full-screen interface of -tui. The chat loop runs unchanged in
+// the background: what it prints is shown in the conversation pane, and it
+// reads messages and answers from the input box.
+type tui struct {
+	program *tea.Program
+	lines   chan string // submitted input, read by message
+	close   sync.Once
+}
+
+func newTUI() *tui {
+	return &tui{lines: make(chan string, 16)}
+}
+
+// message shows prompt in the conversation and waits for the next input,
+// a message or the answer to a question.
+func (t *tui) message(prompt string) (string, bool) {
+	fmt.Print(prompt)
+	t.program.Send(tuiIdleMsg{})
+	line, ok := <-t.lines
+	return line, ok
+}
+
+// endInput makes message return false, which ends the chat.
+func (t *tui) endInput() {
+	t.close.Do(func() { close(t.lines) })
+}
+
+// run shows the interface and runs the chat until it ends. Output of the
+// chat, including stderr, is redirected into the conversation pane.
+func (t *tui) run(ctx context.Context, a *Agent) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		t.endInput()
+	}()
+
+	t.program = tea.NewProgram(newTUIModel(t, a.modelName, cancel), tea.WithAltScreen(), tea.WithOutput(os.Stdout))
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to redirect output: %v", err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	a.out = w
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				t.program.Send(tuiOutputMsg(buf[:n]))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	tools.OnProgress = func(update tools.Progress) { t.program.Send(tuiProgressMsg(update.String())) }
+	a.onTurn = func(stats *provider.Stats) {
+		t.program.Send(tuiStatusMsg{model: a.modelName, prompt: stats.PromptTokens, output: stats.TokenCount, tps: stats.TokensPerSecond()})
+	}
+	go func() {
+		err := a.Run(ctx)
+		w.Close()
+		<-copied
+		t.program.Send(tuiDoneMsg{err})
+	}()
+
+	final, err := t.program.Run()
+	if err != nil {
+		return err
+	}
+	return final.(tuiModel).err
+}
+
+type (
+	tuiOutputMsg   string // printed by the chat
+	tuiProgressMsg string // tool progress
+	tuiIdleMsg     struct{}
+	tuiDoneMsg     struct{ err error }
+	tuiStatusMsg   struct {
+		model          string
+		prompt, output int
+		tps            float64
+	}
+)
+
+var (
+	tuiStatusStyle = lipgloss.NewStyle().Reverse(true)
+	tuiInputStyle  = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), true, false, false, false)
+)
+
+// tuiModel is the bubbletea model: the conversation pane, a status bar and
+// the input box.
+type tuiModel struct {
+	tui          *tui
+	cancel       context.CancelFunc
+	conversation viewport.Model
+	input        textarea.Model
+	transcript   *strings.Builder
+	width        int
+	status       tuiStatusMsg
+	totalPrompt  int
+	totalOutput  int
+	busy         bool
+	progress     string
+	err          error
+}
+
+func newTUIModel(t *tui, model string, cancel context.CancelFunc) tuiModel {
+	input := textarea.New()
+	input.Placeholder = "Message (Enter sends, Alt-Enter adds a line, PgUp/PgDn scroll, Ctrl-D quits)"
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	input.SetHeight(inputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	conversation := viewport.New(0, 0)
+	conversation.KeyMap = viewport.KeyMap{
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+	}
+	return tuiModel{tui: t, cancel: cancel, conversation: conversation, input: input, transcript: &strings.Builder{}, status: tuiStatusMsg{model: model}, busy: true}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.input.SetWidth(msg.Width)
+		m.conversation.Width = msg.Width
+		m.conversation.Height = max(1, msg.Height-inputHeight-2) // status bar and input border
+		m.refresh()
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "ctrl+d":
+			m.cancel()
+			m.tui.endInput()
+			return m, nil
+		case "enter":
+			text := m.input.Value()
+			m.input.Reset()
+			m.transcript.WriteString(text + "\n")
+			m.refresh()
+			m.conversation.GotoBottom()
+			m.busy = true
+			select {
+			case m.tui.lines <- text:
+			default: // the chat is busy and has not read the earlier input yet
+			}
+			return m, nil
+		case "pgup", "pgdown":
+			var cmd tea.Cmd
+			m.conversation, cmd = m.conversation.Update(msg)
+			return m, cmd
+		}
+	case tuiOutputMsg:
+		m.transcript.WriteString(strings.ReplaceAll(string(msg), "\r", ""))
+		m.refresh()
+		return m, nil
+	case tuiProgressMsg:
+		m.progress = string(msg)
+		return m, nil
+	case tuiIdleMsg:
+		m.busy = false
+		m.progress = ""
+		return m, nil
+	case tuiStatusMsg:
+		m.status = msg
+		m.totalPrompt += msg.prompt
+		m.totalOutput += msg.output
+		m.progress = ""
+		return m, nil
+	case tuiDoneMsg:
+		m.err = msg.err
+		return m, tea.Quit
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// refresh re-wraps the transcript to the window and keeps the end in view
+// unless the user has scrolled up.
+func (m *tuiModel) refresh() {
+	follow := m.conversation.AtBottom()
+	m.conversation.SetContent(lipgloss.NewStyle().Width(max(1, m.width)).Render(m.transcript.String()))
+	if follow {
+		m.conversation.GotoBottom()
+	}
+}
+
+func (m tuiModel) View() string {
+	state := "ready"
+	switch {
+	case m.progress != "":
+		state = m.progress
+	case m.busy:
+		state = "working…"
+	}
+	status := fmt.Sprintf(" %s │ last: %d prompt, %d output tokens, %.1f tokens/s │ session: %d tokens │ %s",
+		m.status.model, m.status.prompt, m.status.output, m.status.tps, m.totalPrompt+m.totalOutput, state)
+	status = tuiStatusStyle.Width(max(1, m.width)).MaxHeight(1).Render(status)
+	return m.conversation.View() + "\n" + status + "\n" + tuiInputStyle.Render(m.input.View())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// errRetry is returned by /retry to answer the last user message again.
+var errRetry = errors.New("retry")
+
+// undoableTools only read, or write files through the rollback journal;
+// the effects of any other tool survive /undo and /retry. This list is only
+// for /undo: approval goes by tools.ReadOnly, which transcribe_audio is not,
+// since it may upload the file to a hosted server.
+var undoableTools = map[string]bool{
+	"describe_tools":   true,
+	"search_docs":      true,
+	"read_file":        true,
+	"list_files":       true,
+	"edit_file":        true,
+	"recall":           true,
+	"go_outline":       true,
+	"go_doc":           true,
+	"semantic_search":  true,
+	"view_image":       true,
+	"transcribe_audio": true,
+}
+
+func init() {
+	registerCommand(command{
+		name: "undo",
+		help: "Remove the last exchange from the conversation and restore the files it edited",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			return a.undo()
+		},
+	})
+	registerCommand(command{
+		name:  "retry",
+		usage: "[temperature]",
+		help:  "Regenerate the last reply, optionally at another temperature",
+		run: func(ctx context.Context, a *Agent, arg string) error {
+			var temperature *float64
+			if arg != "" {
+				t, err := strconv.ParseFloat(arg, 64)
+				if err != nil || t < 0 {
+					return fmt.Errorf("invalid temperature %q", arg)
+				}
+				temperature = &t
+			}
+			if err := a.rewindTurn(true); err != nil {
+				return err
+			}
+			a.temperature = temperature
+			return errRetry
+		},
+	})
+}
+
+// lastUserMessage returns the index of the latest user message in the
+// history, or -1.
+func (a *Agent) lastUserMessage() int {
+	for i := len(a.history) - 1; i >= 0; i-- {
+		if a.history[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// undo implements /undo.
+func (a *Agent) undo() error {
+	if err := a.rewindTurn(false); err != nil {
+		return err
+	}
+	tools.DropCheckpoint()
+	if a.sessionName != "" {
+		if err := a.saveSession(a.sessionName); err != nil {
+			slog.Warn("could not save session", "err", err)
+		}
+	}
+	return nil
+}
+
+// rewindTurn restores the files edited since the last user message and
+// removes the replies to it from the history. The user message itself is
+// removed too unless keepMessage is set, for /retry.
+func (a *Agent) rewindTurn(keepMessage bool) error {
+	i := a.lastUserMessage()
+	if i < 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+	if keepMessage && i == len(a.history)-1 {
+		return fmt.Errorf("the last message has no reply to retry")
+	}
+
+	var edited bool
+	var kept []string
+	for _, msg := range a.history[i:] {
+		if msg.Role != "tool" {
+			continue
+		}
+		edited = edited || msg.Tool == "edit_file"
+		if !undoableTools[msg.Tool] && !containsString(kept, msg.Tool) {
+			kept = append(kept, msg.Tool)
+		}
+	}
+
+	// Every user message since the journal was last cleared has a checkpoint;
+	// older ones, e.g. from a resumed session, have none.
+	if tools.CheckpointCount() > 0 {
+		restored, err := tools.RestoreCheckpoint()
+		for _, path := range restored {
+			fmt.Printf("Restored %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+	} else if edited {
+		slog.Warn("the files edited in this exchange cannot be restored; it predates the undo history.")
+	}
+	if len(kept) > 0 {
+		slog.Warn(fmt.Sprintf("the effects of %s cannot be undone.", strings.Join(kept, ", ")))
+	}
+
+	if keepMessage {
+		i++
+		fmt.Printf("Regenerating the reply to: %s\n", strings.SplitN(a.history[i-1].Content, "\n", 2)[0])
+	} else {
+		fmt.Printf("Removed the last exchange (%d messages).\n", len(a.history)-i)
+	}
+	a.history = a.history[:i]
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// usageProvider is the key usage is recorded and budgeted under: "ollama"
+// for an Ollama server on this machine, or else the host of the configured
+// server, such as "ollama.com", so a hosted server has its own budget.
+func usageProvider() string {
+	u, err := url.Parse(provider.OllamaHost)
+	if err != nil || u.Host == "" {
+		return "ollama"
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "ollama"
+	}
+	return u.Host
+}
+
+// ProviderBudget is a monthly token budget for one provider.
+type ProviderBudget struct {
+	MonthlyTokens int     `yaml:"monthly_tokens"`
+	WarnAt        float64 `yaml:"warn_at"` // fraction of the budget, defaults to 0.8
+	Block         bool    `yaml:"block"`   // refuse requests once the budget is spent
+}
+
+// UsageLedger records token usage per provider per calendar month and is
+// persisted to ~/.local/share/goclient/usage.json. It is safe for
+// concurrent use, e.g. by the agents of goclient batch.
+type UsageLedger struct {
+	mu      sync.Mutex
+	path    string
+	budgets map[string]ProviderBudget
+	Months  map[string]map[string]int `json:"months"` // "2006-01" -> provider -> tokens
+}
+
+// loadUsageLedger reads the ledger from disk, starting empty if it does not exist.
+func loadUsageLedger(budgets map[string]ProviderBudget) (*UsageLedger, error) {
+	ledger := &UsageLedger{
+		budgets: budgets,
+		Months:  map[string]map[string]int{},
+	}
+	if dir := dataDir(); dir != "" {
+		ledger.path = filepath.Join(dir, "usage.json")
+	}
+	if ledger.path == "" {
+		return ledger, nil
+	}
+
+	data, err := os.ReadFile(ledger.path)
+	if os.IsNotExist(err) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger: %v", err)
+	}
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, fmt.Errorf("failed to parse usage ledger %s: %v", ledger.path, err)
+	}
+	if ledger.Months == nil {
+		ledger.Months = map[string]map[string]int{}
+	}
+	return ledger, nil
+}
+
+func currentMonth() string {
+	return time.Now().Format("2006-01")
+}
+
+// Used returns the tokens used by a provider in the current month.
+func (l *UsageLedger) Used(provider string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Months[currentMonth()][provider]
+}
+
+// Record adds tokens to the provider's usage, saves the ledger and returns a
+// warning if the budget threshold has been crossed.
+func (l *UsageLedger) Record(provider string, tokens int) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	month := currentMonth()
+	if l.Months[month] == nil {
+		l.Months[month] = map[string]int{}
+	}
+	l.Months[month][provider] += tokens
+
+	if err := l.save(); err != nil {
+		return "", err
+	}
+
+	budget, ok := l.budgets[provider]
+	if !ok || budget.MonthlyTokens <= 0 {
+		return "", nil
+	}
+	used := l.Months[month][provider]
+	warnAt := budget.WarnAt
+	if warnAt <= 0 {
+		warnAt = 0.8
+	}
+	switch {
+	case used >= budget.MonthlyTokens:
+		return fmt.Sprintf("%s monthly budget exhausted: %d of %d tokens used", provider, used, budget.MonthlyTokens), nil
+	case float64(used) >= warnAt*float64(budget.MonthlyTokens):
+		return fmt.Sprintf("%s has used %d of %d monthly tokens (%.0f%%)", provider, used, budget.MonthlyTokens,
+			100*float64(used)/float64(budget.MonthlyTokens)), nil
+	}
+	return "", nil
+}
+
+// CheckBudget returns an error if the provider's budget is spent and the
+// budget is configured to block further requests.
+func (l *UsageLedger) CheckBudget(provider string) error {
+	budget, ok := l.budgets[provider]
+	if !ok || !budget.Block || budget.MonthlyTokens <= 0 {
+		return nil
+	}
+	if used := l.Used(provider); used >= budget.MonthlyTokens {
+		return fmt.Errorf("%s monthly budget of %d tokens exceeded (%d used)", provider, budget.MonthlyTokens, used)
+	}
+	return nil
+}
+
+// Status describes the provider's usage and remaining budget.
+func (l *UsageLedger) Status(provider string) string {
+	used := l.Used(provider)
+	budget, ok := l.budgets[provider]
+	if !ok || budget.MonthlyTokens <= 0 {
+		return fmt.Sprintf("%s: %d tokens used this month (no budget set)", provider, used)
+	}
+	remaining := budget.MonthlyTokens - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return fmt.Sprintf("%s: %d of %d tokens used this month, %d remaining", provider, used, budget.MonthlyTokens, remaining)
+}
+
+func (l *UsageLedger) save() error {
+	if l.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %v", err)
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage ledger: %v", err)
+	}
+	if err := os.WriteFile(l.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write usage ledger: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gherlein/goclient/pkg/agent"
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/provider/providertest"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// echoInput is the input of the echo tool.
+type echoInput struct {
+	Text string `json:"text" description:"the text to return"`
+}
+
+// echoTool returns its text and counts its calls.
+func echoTool(calls *int) tools.Tool {
+	return tools.NewTool("echo", "Return the text.", func(ctx context.Context, input echoInput) (string, error) {
+		*calls++
+		return "echo: " + input.Text, nil
+	})
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		replies   []string
+		opts      []agent.Option
+		wantReply string
+		wantErr   string
+		wantCalls int
+		// wantInPrompt is text expected in the last request's prompt.
+		wantInPrompt string
+	}{
+		{
+			name:         "reply without tools",
+			replies:      []string{"Hello there."},
+			wantReply:    "Hello there.",
+			wantInPrompt: "User: hi",
+		},
+		{
+			name:         "tool result goes back to the model",
+			replies:      []string{`tool: echo({"text": "ping"})`, "It said ping."},
+			wantReply:    "It said ping.",
+			wantCalls:    1,
+			wantInPrompt: `Tool result (echo): "echo: ping"`,
+		},
+		{
+			name:         "two calls in one reply",
+			replies:      []string{"tool: echo({\"text\": \"a\"})\ntool: echo({\"text\": \"b\"})", "Done."},
+			wantReply:    "Done.",
+			wantCalls:    2,
+			wantInPrompt: `Tool result (echo): "echo: b"`,
+		},
+		{
+			name:         "unknown tool is reported to the model",
+			replies:      []string{`tool: delete_everything({})`, "Sorry."},
+			wantReply:    "Sorry.",
+			wantInPrompt: "delete_everything is not available to this agent",
+		},
+		{
+			name:         "stops after max iterations",
+			replies:      []string{`tool: echo({"text": "1"})`, `tool: echo({"text": "2"})`, `tool: echo({"text": "3"})`},
+			opts:         []agent.Option{agent.WithMaxIterations(2)},
+			wantErr:      "called tools in 2 replies in a row",
+			wantCalls:    2,
+			wantInPrompt: `"echo: 2"`,
+		},
+		{
+			name:      "stops a repeated call",
+			replies:   []string{`tool: echo({"text": "ping"})`, `tool: echo({"text": "ping"})`, `tool: echo({"text": "ping"})`},
+			wantErr:   `repeated the call echo({"text":"ping"})`,
+			wantCalls: 2,
+		},
+		{
+			name:    "examples come before the conversation",
+			replies: []string{"Hello there."},
+			opts: []agent.Option{agent.WithExamples([]agent.Message{
+				{Role: "user", Content: "hello"},
+				{Role: "assistant", Content: "Hi."},
+			})},
+			wantReply:    "Hello there.",
+			wantInPrompt: "Example conversation:\n\nUser: hello",
+		},
+		{
+			name:    "turn context goes before the message",
+			replies: []string{"Hello there."},
+			opts: []agent.Option{agent.WithTurnContext(func(ctx context.Context, message string) string {
+				return "Context for " + message + "."
+			})},
+			wantReply:    "Hello there.",
+			wantInPrompt: "Context for hi.",
+		},
+		{
+			name:         "untrusted tool output is marked",
+			replies:      []string{`tool: echo({"text": "ping"})`, "It said ping."},
+			opts:         []agent.Option{agent.WithUntrustedTools("echo")},
+			wantReply:    "It said ping.",
+			wantCalls:    1,
+			wantInPrompt: "Tool result (echo, untrusted content",
+		},
+		{
+			name:    "hook error skips the call",
+			replies: []string{`tool: echo({"text": "ping"})`, "Blocked."},
+			opts: []agent.Option{agent.WithHooks(agent.Hooks{
+				BeforeToolCall: func(ctx context.Context, call *tools.Call) error {
+					return errors.New("not allowed")
+				},
+			})},
+			wantReply:    "Blocked.",
+			wantInPrompt: `{"error": "not allowed"}`,
+		},
+		{
+			name:    "hook rewrites the arguments",
+			replies: []string{`tool: echo({"text": "ping"})`, "Done."},
+			opts: []agent.Option{agent.WithHooks(agent.Hooks{
+				BeforeToolCall: func(ctx context.Context, call *tools.Call) error {
+					call.Args["text"] = "pong"
+					return nil
+				},
+			})},
+			wantReply:    "Done.",
+			wantCalls:    1,
+			wantInPrompt: `"echo: pong"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := providertest.New(tt.replies...)
+			calls := 0
+			opts := append([]agent.Option{agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(echoTool(&calls))}, tt.opts...)
+			a := agent.NewAgent(opts...)
+
+			reply, err := a.Send(context.Background(), "hi")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Send error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if reply != tt.wantReply && tt.wantErr == "" {
+				t.Errorf("reply = %q, want %q", reply, tt.wantReply)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("echo ran %d times, want %d", calls, tt.wantCalls)
+			}
+			if fake.Remaining() != 0 {
+				t.Errorf("%d scripted replies were not used", fake.Remaining())
+			}
+			requests := fake.Requests()
+			if prompt := requests[len(requests)-1].Prompt; !strings.Contains(prompt, tt.wantInPrompt) {
+				t.Errorf("last prompt does not contain %q:\n%s", tt.wantInPrompt, prompt)
+			}
+		})
+	}
+}
+
+func TestSendKeepsHistory(t *testing.T) {
+	fake := providertest.New("First.", "Second.")
+	a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools())
+	for _, message := range []string{"one", "two"} {
+		if _, err := a.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []agent.Message{
+		{Role: "user", Content: "one"},
+		{Role: "assistant", Content: "First."},
+		{Role: "user", Content: "two"},
+		{Role: "assistant", Content: "Second."},
+	}
+	got := a.History()
+	if len(got) != len(want) {
+		t.Fatalf("history = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Role != want[i].Role || got[i].Content != want[i].Content {
+			t.Errorf("history[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if prompt := fake.Requests()[1].Prompt; !strings.Contains(prompt, "AI: First.") {
+		t.Errorf("second prompt lacks the first reply:\n%s", prompt)
+	}
+}
+
+func TestSendStopsToolLoop(t *testing.T) {
+	fake := providertest.New(`tool: echo({"text": "1"})`, `tool: echo({"text": "2"})`)
+	calls := 0
+	a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(echoTool(&calls)), agent.WithMaxIterations(1))
+	reply, err := a.Send(context.Background(), "hi")
+	if !errors.Is(err, agent.ErrToolLoop) {
+		t.Fatalf("Send error = %v, want ErrToolLoop", err)
+	}
+	if reply != `tool: echo({"text": "2"})` {
+		t.Errorf("reply = %q, want the last reply", reply)
+	}
+	history := a.History()
+	if last := history[len(history)-1]; last.Role != "note" || !strings.Contains(last.Content, "were not run") {
+		t.Errorf("last message = %+v, want a note that the calls were not run", last)
+	}
+}
+
+func TestSendTrimsContext(t *testing.T) {
+	fake := providertest.New("Fine.")
+	var notices []string
+	history := []agent.Message{
+		{Role: "user", Content: "old question " + strings.Repeat("x", 800)},
+		{Role: "assistant", Content: "old answer"},
+		{Role: "user", Content: "recent question"},
+		{Role: "assistant", Content: "recent answer"},
+	}
+	a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(),
+		agent.WithHistory(history), agent.WithContextLimit(200),
+		agent.WithEventSink(agent.Events{Notice: func(text string) { notices = append(notices, text) }}))
+	if _, err := a.Send(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	prompt := fake.Requests()[0].Prompt
+	if strings.Contains(prompt, "old question") || strings.Contains(prompt, "old answer") {
+		t.Errorf("prompt keeps the oldest turn:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "recent question") || !strings.Contains(prompt, "User: hi") {
+		t.Errorf("prompt lacks the recent turns:\n%s", prompt)
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "leaving 2 older messages out") {
+		t.Errorf("notices = %q, want one about the 2 left out", notices)
+	}
+	if len(a.History()) != len(history)+2 {
+		t.Errorf("history has %d messages, want all %d kept", len(a.History()), len(history)+2)
+	}
+}
+
+func TestSendCompacts(t *testing.T) {
+	fake := providertest.New("- the user asked old questions", "Fine.")
+	history := []agent.Message{
+		{Role: "user", Content: "old question " + strings.Repeat("x", 400)},
+		{Role: "assistant", Content: "old answer"},
+		{Role: "user", Content: "recent question"},
+		{Role: "assistant", Content: "recent answer"},
+	}
+	a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(),
+		agent.WithHistory(history), agent.WithContextLimit(1000), agent.WithCompaction(0.1, 1))
+	if _, err := a.Send(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	requests := fake.Requests()
+	if !strings.Contains(requests[0].Prompt, "old question") || !strings.Contains(requests[0].Prompt, "recent answer") {
+		t.Errorf("summary prompt lacks the older turns:\n%s", requests[0].Prompt)
+	}
+	got := a.History()
+	want := []string{"summary", "user", "assistant"}
+	if len(got) != len(want) {
+		t.Fatalf("history = %+v, want roles %v", got, want)
+	}
+	for i, role := range want {
+		if got[i].Role != role {
+			t.Errorf("history[%d].Role = %q, want %q", i, got[i].Role, role)
+		}
+	}
+	if !strings.Contains(requests[1].Prompt, "the user asked old questions") || strings.Contains(requests[1].Prompt, "old answer") {
+		t.Errorf("prompt does not replace the older turns with the summary:\n%s", requests[1].Prompt)
+	}
+}
+
+func TestSendContextOverflow(t *testing.T) {
+	fake := providertest.New("unused")
+	a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(),
+		agent.WithOptions(map[string]interface{}{"num_ctx": 4}))
+	_, err := a.Send(context.Background(), strings.Repeat("long message ", 20))
+	if !errors.Is(err, provider.ErrContextOverflow) {
+		t.Fatalf("Send error = %v, want ErrContextOverflow", err)
+	}
+	if len(fake.Requests()) != 0 {
+		t.Errorf("the request was sent to the provider")
+	}
+}
+
+func TestSendApprover(t *testing.T) {
+	tests := []struct {
+		name    string
+		approve bool
+		want    string
+	}{
+		{"approved", true, `Tool result (guarded): "done"`},
+		{"denied", false, `{"error": "refused"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked []string
+			guarded := tools.NewTool("guarded", "Ask before acting.", func(ctx context.Context, input echoInput) (string, error) {
+				if !tools.Confirm(ctx, "Do it?") {
+					return "", errors.New("refused")
+				}
+				return "done", nil
+			})
+			fake := providertest.New(`tool: guarded({"text": "x"})`, "OK.")
+			a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(guarded),
+				agent.WithApprover(func(action string) bool {
+					asked = append(asked, action)
+					return tt.approve
+				}))
+			if _, err := a.Send(context.Background(), "go"); err != nil {
+				t.Fatal(err)
+			}
+			if len(asked) != 1 || asked[0] != "Do it?" {
+				t.Errorf("approver asked %q, want [Do it?]", asked)
+			}
+			if prompt := fake.Requests()[1].Prompt; !strings.Contains(prompt, tt.want) {
+				t.Errorf("prompt does not contain %q:\n%s", tt.want, prompt)
+			}
+		})
+	}
+}
+
+func TestSendApproversAreIndependent(t *testing.T) {
+	guarded := tools.NewTool("guarded", "Ask before acting.", func(ctx context.Context, input echoInput) (string, error) {
+		if !tools.Confirm(ctx, "Do "+input.Text+"?") {
+			return "", errors.New("refused")
+		}
+		return "done", nil
+	})
+	results := make(chan string, 2)
+	for _, approve := range []bool{true, false} {
+		approve := approve
+		go func() {
+			fake := providertest.New(`tool: guarded({"text": "it"})`, "OK.")
+			a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake), agent.WithTools(guarded),
+				agent.WithApprover(func(action string) bool { return approve }))
+			if _, err := a.Send(context.Background(), "go"); err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- fmt.Sprintf("%v %s", approve, a.History()[2].Content)
+		}()
+	}
+	got := map[string]bool{<-results: true, <-results: true}
+	for _, want := range []string{`true "done"`, `false {"error": "refused"}`} {
+		if !got[want] {
+			t.Errorf("results %v lack %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// DefaultKeepTurns is the number of recent user turns Compact keeps
+// verbatim when WithCompaction does not set it.
+const DefaultKeepTurns = 2
+
+const compactSystemPrompt = `You summarize conversations between a user and a coding assistant.
+Write a compact summary that preserves: decisions made, requirements and preferences stated by the user,
+files and functions discussed or changed, important tool results, and any open tasks or unanswered questions.
+Use short bullet points. Do not add anything that was not in the conversation.`
+
+// maybeCompact compacts the conversation once it grows past the fraction
+// of the context limit set with WithCompaction.
+func (a *Agent) maybeCompact(ctx context.Context) error {
+	if a.compactAt <= 0 || a.contextLimit <= 0 {
+		return nil
+	}
+	if float64(historyTokens(a.history)+estimateTokens(a.systemPrompt())) < a.compactAt*float64(a.contextLimit) {
+		return nil
+	}
+	a.notice("conversation is getting long: compacting older turns")
+	return a.Compact(ctx)
+}
+
+// Compact replaces everything before the most recent user turns, as many
+// as WithCompaction keeps, with a summary written by the model.
+func (a *Agent) Compact(ctx context.Context) error {
+	keep := a.keepTurns
+	if keep <= 0 {
+		keep = DefaultKeepTurns
+	}
+
+	// Find the start of the oldest turn that is kept verbatim.
+	split := len(a.history)
+	for i, seen := len(a.history)-1, 0; i >= 0; i-- {
+		if a.history[i].Role == "user" {
+			seen++
+			split = i
+			if seen == keep {
+				break
+			}
+		}
+	}
+	older := a.history[:split]
+	if len(older) == 0 || (len(older) == 1 && older[0].Role == "summary") {
+		return fmt.Errorf("nothing to compact: only the last %d turns are in the history", keep)
+	}
+
+	var transcript strings.Builder
+	for _, msg := range older {
+		transcript.WriteString(msg.PromptText())
+		transcript.WriteString("\n\n")
+	}
+	request := provider.Request{
+		Model:   a.model,
+		Prompt:  "Conversation:\n\n" + transcript.String() + "Summary:",
+		System:  compactSystemPrompt,
+		Options: a.options,
+	}
+	summary, err := provider.Complete(ctx, a.provider, request)
+	if err != nil {
+		return err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return fmt.Errorf("the model returned an empty summary")
+	}
+
+	before := historyTokens(a.history)
+	compacted := Message{Role: "summary", Content: summary, Model: a.model, Time: time.Now()}
+	a.history = append([]Message{compacted}, a.history[split:]...)
+	if sink, ok := a.events.(MessageSink); ok {
+		sink.OnMessage(compacted)
+	}
+	a.notice("compacted %d messages: ~%d -> ~%d tokens", len(older), before, historyTokens(a.history))
+	return nil
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// responseReserve is the fraction of the context limit kept free for the
+// reply.
+const responseReserve = 0.25
+
+// contextWindow returns the most recent part of the history that fits in
+// the context limit alongside the system prompt, the examples and the turn
+// context. Whole turns are dropped from the front, so the current turn (the
+// last user message and any tool results after it) is always kept.
+func (a *Agent) contextWindow(system, turnContext string) []Message {
+	if a.contextLimit <= 0 {
+		return a.history
+	}
+	budget := int(float64(a.contextLimit)*(1-responseReserve)) - estimateTokens(system) - estimateTokens(turnContext)
+	for _, msg := range a.examples {
+		budget -= estimateTokens(msg.PromptText())
+	}
+
+	total := historyTokens(a.history)
+	if total <= budget {
+		return a.history
+	}
+
+	// Never drop past the start of the current turn.
+	lastUser := len(a.history)
+	for i := len(a.history) - 1; i >= 0; i-- {
+		if a.history[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+
+	start := 0
+	for total > budget && start < lastUser {
+		total -= estimateTokens(a.history[start].PromptText())
+		start++
+		// Drop the rest of the turn too so the window starts with a user message.
+		for start < lastUser && a.history[start].Role != "user" {
+			total -= estimateTokens(a.history[start].PromptText())
+			start++
+		}
+	}
+	if start > 0 {
+		a.notice("context limit %d tokens: leaving %d older messages out of the prompt", a.contextLimit, start)
+	}
+	if total > budget {
+		a.logger.Warn(fmt.Sprintf("the current turn (~%d tokens) exceeds the context budget of ~%d tokens", total, budget))
+	}
+	return a.history[start:]
+}
+
+// checkContext returns ErrContextOverflow when the request sets num_ctx and
+// its prompt is estimated not to fit, rather than let Ollama silently drop
+// the start of the conversation.
+func checkContext(request provider.Request) error {
+	var limit int
+	switch n := request.Options["num_ctx"].(type) {
+	case int:
+		limit = n
+	case float64:
+		limit = int(n)
+	}
+	if limit <= 0 {
+		return nil
+	}
+	if tokens := estimateTokens(request.System) + estimateTokens(request.Prompt); tokens > limit {
+		return fmt.Errorf("%w: ~%d tokens with num_ctx %d", provider.ErrContextOverflow, tokens, limit)
+	}
+	return nil
+}
+
+// historyTokens estimates the prompt size of a conversation.
+func historyTokens(history []Message) int {
+	total := 0
+	for _, msg := range history {
+		total += estimateTokens(msg.PromptText())
+	}
+	return total
+}
+
+// estimateTokens approximates the token count of text (about four
+// characters per token for English text and code).
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
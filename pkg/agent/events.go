@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// EventSink receives what happens during Send as it happens, so that a
+// program embedding the agent can show it: the reply as it streams, each
+// tool call and its result, and the statistics of every inference. The
+// agent itself never prints. Methods are called from the goroutine running
+// Send.
+type EventSink interface {
+	// OnToken receives each piece of a reply as it streams in.
+	OnToken(text string)
+	// OnToolCallStart is called before a tool the model called runs.
+	OnToolCallStart(call tools.Call)
+	// OnToolResult receives a tool's result, in the form sent back to the
+	// model, or the error it failed with.
+	OnToolResult(call tools.Call, result string, err error)
+	// OnTurnComplete receives each complete reply, including those that
+	// call tools.
+	OnTurnComplete(reply string)
+	// OnStats receives the token counts and timings of each inference.
+	OnStats(stats *provider.Stats)
+}
+
+// An EventSink may also implement these to hear about more of the
+// conversation.
+type (
+	// MessageSink is told about each message added to the conversation,
+	// e.g. to save it as it grows.
+	MessageSink interface{ OnMessage(msg Message) }
+	// OutputSink receives each tool's result as the tool returned it,
+	// before it is encoded for the model, e.g. to render it for the user.
+	OutputSink interface {
+		OnToolOutput(call tools.Call, result interface{})
+	}
+	// NoticeSink is told what the agent did on its own, such as leaving
+	// older messages out of the prompt or compacting the conversation.
+	NoticeSink interface{ OnNotice(text string) }
+)
+
+// Events is an EventSink made of functions; those left nil are not called.
+// It implements MessageSink, OutputSink and NoticeSink too.
+type Events struct {
+	Token         func(text string)
+	ToolCallStart func(call tools.Call)
+	ToolResult    func(call tools.Call, result string, err error)
+	TurnComplete  func(reply string)
+	Stats         func(stats *provider.Stats)
+	Message       func(msg Message)
+	ToolOutput    func(call tools.Call, result interface{})
+	Notice        func(text string)
+}
+
+func (e Events) OnToken(text string) {
+	if e.Token != nil {
+		e.Token(text)
+	}
+}
+
+func (e Events) OnToolCallStart(call tools.Call) {
+	if e.ToolCallStart != nil {
+		e.ToolCallStart(call)
+	}
+}
+
+func (e Events) OnToolResult(call tools.Call, result string, err error) {
+	if e.ToolResult != nil {
+		e.ToolResult(call, result, err)
+	}
+}
+
+func (e Events) OnTurnComplete(reply string) {
+	if e.TurnComplete != nil {
+		e.TurnComplete(reply)
+	}
+}
+
+func (e Events) OnStats(stats *provider.Stats) {
+	if e.Stats != nil {
+		e.Stats(stats)
+	}
+}
+
+func (e Events) OnMessage(msg Message) {
+	if e.Message != nil {
+		e.Message(msg)
+	}
+}
+
+func (e Events) OnToolOutput(call tools.Call, result interface{}) {
+	if e.ToolOutput != nil {
+		e.ToolOutput(call, result)
+	}
+}
+
+func (e Events) OnNotice(text string) {
+	if e.Notice != nil {
+		e.Notice(text)
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// Hooks are middleware around inference and tool calls, for concerns such
+// as logging, approval, rate limiting, metrics or rewriting prompts. Any
+// field may be nil. Hooks registered with Use or WithHooks run in the order
+// they were added.
+type Hooks struct {
+	// BeforeInference may change the request. An error cancels it and is
+	// returned by Send.
+	BeforeInference func(ctx context.Context, request *provider.Request) error
+	// AfterInference sees the reply, or the error the request failed with.
+	AfterInference func(ctx context.Context, request provider.Request, reply string, stats *provider.Stats, err error)
+	// BeforeToolCall may change the call's arguments. An error skips the
+	// call and is sent to the model as its result.
+	BeforeToolCall func(ctx context.Context, call *tools.Call) error
+	// AfterToolCall sees the result sent back to the model, or the error.
+	AfterToolCall func(ctx context.Context, call tools.Call, result string, err error)
+}
+
+// Use adds hooks to the agent.
+func (a *Agent) Use(hooks ...Hooks) {
+	a.hooks = append(a.hooks, hooks...)
+}
+
+// HookChain runs a list of hooks in order.
+type HookChain []Hooks
+
+// BeforeInference runs the BeforeInference hooks until one fails.
+func (c HookChain) BeforeInference(ctx context.Context, request *provider.Request) error {
+	for _, h := range c {
+		if h.BeforeInference != nil {
+			if err := h.BeforeInference(ctx, request); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AfterInference runs every AfterInference hook.
+func (c HookChain) AfterInference(ctx context.Context, request provider.Request, reply string, stats *provider.Stats, err error) {
+	for _, h := range c {
+		if h.AfterInference != nil {
+			h.AfterInference(ctx, request, reply, stats, err)
+		}
+	}
+}
+
+// BeforeToolCall runs the BeforeToolCall hooks until one fails.
+func (c HookChain) BeforeToolCall(ctx context.Context, call *tools.Call) error {
+	for _, h := range c {
+		if h.BeforeToolCall != nil {
+			if err := h.BeforeToolCall(ctx, call); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AfterToolCall runs every AfterToolCall hook.
+func (c HookChain) AfterToolCall(ctx context.Context, call tools.Call, result string, err error) {
+	for _, h := range c {
+		if h.AfterToolCall != nil {
+			h.AfterToolCall(ctx, call, result, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// ErrToolLoop is returned, wrapped with the reason, when Send or Continue
+// stops a model that keeps calling tools without answering.
+var ErrToolLoop = errors.New("stopped")
+
+// repeatedCallLimit is how often the model may make the identical tool call
+// while answering one message; the call after that is not run.
+const repeatedCallLimit = 2
+
+// loopGuard stops the model from calling tools indefinitely while answering
+// one message, e.g. by reading the same file over and over.
+type loopGuard struct {
+	maxIterations int // 0 for no limit
+	iterations    int
+	calls         map[string]int // times each call was made, keyed by name and arguments
+}
+
+// check records the tool calls of a reply and returns why they should not
+// be run, or "" to run them.
+func (g *loopGuard) check(calls []tools.Call) string {
+	if len(calls) == 0 {
+		return ""
+	}
+	g.iterations++
+	if g.maxIterations > 0 && g.iterations > g.maxIterations {
+		return fmt.Sprintf("the model called tools in %d replies in a row without answering", g.maxIterations)
+	}
+	if g.calls == nil {
+		g.calls = map[string]int{}
+	}
+	for _, call := range calls {
+		args, _ := json.Marshal(call.Args) // map keys are sorted, so equal arguments encode equally
+		key := call.Name + string(args)
+		g.calls[key]++
+		if g.calls[key] > repeatedCallLimit {
+			return fmt.Sprintf("the model repeated the call %s(%s) without making progress", call.Name, args)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gherlein/goclient/pkg/provider"
+	"github.com/gherlein/goclient/pkg/tools"
+)
+
+// Option configures an Agent in NewAgent.
+type Option func(*Agent)
+
+// WithModel sets the model that answers.
+func WithModel(name string) Option {
+	return func(a *Agent) { a.model = name }
+}
+
+// WithProvider sets where requests are sent; the default is Ollama at
+// provider.OllamaHost.
+func WithProvider(p provider.Provider) Option {
+	return func(a *Agent) { a.provider = p }
+}
+
+// WithHistory starts the agent with an earlier conversation, such as one
+// saved from History.
+func WithHistory(history []Message) Option {
+	return func(a *Agent) { a.history = append([]Message{}, history...) }
+}
+
+// WithTools restricts the model to the given tools. With no tools the
+// model is not offered any.
+func WithTools(available ...tools.Tool) Option {
+	return func(a *Agent) { a.tools = append([]tools.Tool{}, available...) }
+}
+
+// WithSystemPrompt sets the instructions sent as the system prompt, before
+// the descriptions of the tools.
+func WithSystemPrompt(prompt string) Option {
+	return func(a *Agent) { a.system = prompt }
+}
+
+// WithoutToolPrompt leaves the descriptions of the tools out of the system
+// prompt, for callers whose system prompt already describes them.
+func WithoutToolPrompt() Option {
+	return func(a *Agent) { a.describeTools = false }
+}
+
+// WithExamples sets an example exchange shown to the model before the
+// conversation, such as a user message, a reply calling a tool and its
+// result.
+func WithExamples(examples []Message) Option {
+	return func(a *Agent) { a.examples = append([]Message{}, examples...) }
+}
+
+// WithTurnContext sets a function whose text, such as memories or
+// documents relevant to the user's latest message, is sent just before
+// that message. It is called once per Send and is not kept in the history.
+func WithTurnContext(turnContext func(ctx context.Context, message string) string) Option {
+	return func(a *Agent) { a.turnContext = turnContext }
+}
+
+// WithContextLimit sets the size of the model's context in tokens. Older
+// turns are left out of the prompt so that it fits with room for the
+// reply; the history keeps them.
+func WithContextLimit(tokens int) Option {
+	return func(a *Agent) { a.contextLimit = tokens }
+}
+
+// WithCompaction has Send summarize all but the last keepTurns user turns
+// (DefaultKeepTurns if 0) once the conversation exceeds threshold, a
+// fraction of the context limit; see Compact. It needs WithContextLimit.
+func WithCompaction(threshold float64, keepTurns int) Option {
+	return func(a *Agent) { a.compactAt, a.keepTurns = threshold, keepTurns }
+}
+
+// WithUntrustedTools marks the results of the named tools, such as ones
+// fetching web pages, as untrusted: the model is told to treat them as
+// data and not to follow instructions in them.
+func WithUntrustedTools(names ...string) Option {
+	return func(a *Agent) {
+		a.untrusted = map[string]bool{}
+		for _, name := range names {
+			a.untrusted[name] = true
+		}
+	}
+}
+
+// WithMaxIterations sets how many consecutive replies may call tools before
+// Send stops; 0 means no limit. Send also stops a model that repeats the
+// same call more than twice.
+func WithMaxIterations(n int) Option {
+	return func(a *Agent) { a.maxIterations = n }
+}
+
+// WithApprover sets the function asked to confirm file edits, commands and
+// other actions tools consider destructive, instead of tools.Approve. It is
+// passed to the tools with tools.WithApprover, so agents running at the same
+// time each ask their own.
+func WithApprover(approve func(action string) bool) Option {
+	return func(a *Agent) { a.approve = approve }
+}
+
+// WithLogger sets the logger for the replies and tool calls, at debug
+// level; the default is slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(a *Agent) { a.logger = logger }
+}
+
+// WithGrammar sets the format the model is asked to write tool calls in.
+func WithGrammar(grammar tools.ToolGrammar) Option {
+	return func(a *Agent) { a.grammar = grammar }
+}
+
+// WithOptions sets generation options sent with every request, such as
+// temperature or num_ctx.
+func WithOptions(options map[string]interface{}) Option {
+	return func(a *Agent) { a.options = options }
+}
+
+// WithEventSink sets where the agent reports the reply as it streams, tool
+// calls, tool results and statistics.
+func WithEventSink(sink EventSink) Option {
+	return func(a *Agent) {
+		if sink == nil {
+			sink = Events{}
+		}
+		a.events = sink
+	}
+}
+
+// WithHooks adds middleware around inference and tool calls; see Hooks.
+func WithHooks(hooks ...Hooks) Option {
+	return func(a *Agent) { a.Use(hooks...) }
+}
@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ActiveCassette, when set, records every request to OllamaHost and its
+// response, or answers the requests from an earlier recording without
+// contacting the server.
+var ActiveCassette *Cassette
+
+// Cassette is a recording of the requests sent to Ollama and the responses
+// received, stored as JSON.
+type Cassette struct {
+	path      string
+	replaying bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Interaction is one request and its response. Bodies are kept as text; a
+// streamed response is its JSON lines.
+type Interaction struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Request  string `json:"request,omitempty"`
+	Status   int    `json:"status"`
+	Response string `json:"response"`
+}
+
+// cassetteFile is the JSON form of a cassette.
+type cassetteFile struct {
+	Host         string        `json:"host"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// RecordCassette starts a recording at path, replacing any file there. The
+// file is rewritten after every response, so a run that crashes still leaves
+// a usable cassette.
+func RecordCassette(path string) (*Cassette, error) {
+	// The file is written later, perhaps after the working directory changes.
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cassette path: %v", err)
+	}
+	c := &Cassette{path: path}
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ReplayCassette loads the recording at path for replay.
+func ReplayCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %v", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %v", path, err)
+	}
+	return &Cassette{path: path, replaying: true, interactions: file.Interactions, used: make([]bool, len(file.Interactions))}, nil
+}
+
+// Remaining returns the number of recorded interactions not yet replayed.
+func (c *Cassette) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, used := range c.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// replay answers req with the first unused interaction with the same method
+// and path. Requests are expected in the recorded order; one whose body
+// differs from the recording is answered anyway, with a warning, since
+// prompts may contain the date or other details that change between runs.
+func (c *Cassette) replay(req *http.Request, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, interaction := range c.interactions {
+		if c.used[i] || interaction.Method != req.Method || interaction.Path != req.URL.Path {
+			continue
+		}
+		c.used[i] = true
+		if interaction.Request != redactKey(string(body)) {
+			slog.Warn(fmt.Sprintf("cassette: %s %s differs from the recording; replaying the recorded response", req.Method, req.URL.Path))
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+			StatusCode: interaction.Status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(interaction.Response)),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: cassette %s has no recorded response for %s %s", ErrOllamaUnreachable, c.path, req.Method, req.URL.Path)
+}
+
+// record returns resp with a body that adds the interaction to the cassette
+// once it has been read.
+func (c *Cassette) record(req *http.Request, body []byte, resp *http.Response) *http.Response {
+	resp.Body = &recordingBody{body: resp.Body, done: func(response []byte) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.interactions = append(c.interactions, Interaction{
+			Method:   req.Method,
+			Path:     req.URL.Path,
+			Request:  redactKey(string(body)),
+			Status:   resp.StatusCode,
+			Response: string(response),
+		})
+		if err := c.save(); err != nil {
+			slog.Warn("could not save the cassette", "err", err)
+		}
+	}}
+	return resp
+}
+
+// save writes the cassette; the caller holds c.mu or has not shared c yet.
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(cassetteFile{Host: OllamaHost, Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %v", err)
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write cassette: %v", err)
+	}
+	return nil
+}
+
+// redactKey removes OllamaAPIKey from text that is written to a cassette.
+func redactKey(text string) string {
+	if OllamaAPIKey == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, OllamaAPIKey, "[redacted]")
+}
+
+// recordingBody passes a response body through and hands everything read
+// to done when the body is exhausted or closed.
+type recordingBody struct {
+	body     io.ReadCloser
+	buf      bytes.Buffer
+	done     func([]byte)
+	finished bool
+}
+
+func (r *recordingBody) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.buf.Write(p[:n])
+	if err == io.EOF {
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *recordingBody) Close() error {
+	r.finish()
+	return r.body.Close()
+}
+
+func (r *recordingBody) finish() {
+	if !r.finished {
+		r.finished = true
+		r.done(r.buf.Bytes())
+	}
+}
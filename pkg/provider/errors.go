@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by Generate and Models, wrapped with the details of the
+// failure; test for them with errors.Is.
+var (
+	// ErrOllamaUnreachable means the request could not be sent to OllamaHost.
+	ErrOllamaUnreachable = errors.New("cannot reach Ollama")
+	// ErrModelNotFound means the requested model is not installed.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrContextOverflow means the prompt does not fit in the model's context
+	// window.
+	ErrContextOverflow = errors.New("prompt exceeds the context window")
+	// ErrOutOfMemory means the model ran out of memory while loading or
+	// generating.
+	ErrOutOfMemory = errors.New("model ran out of memory")
+)
+
+// StatusError describes an Ollama response that was not 200 OK, using the
+// message in its {"error": ...} body when there is one.
+func StatusError(status int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	var decoded struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &decoded) == nil && decoded.Error != "" {
+		message = decoded.Error
+	}
+	if status == http.StatusNotFound && strings.Contains(strings.ToLower(message), "not found") {
+		return &serverError{message: message, kind: ErrModelNotFound}
+	}
+	if kind := errorKind(message); kind != nil {
+		return &serverError{message: message, kind: kind}
+	}
+	return fmt.Errorf("Ollama request failed with status %d: %s", status, message)
+}
+
+// StreamError describes an {"error": ...} message sent in place of a chunk
+// after a reply started streaming, e.g. when the model runs out of memory
+// or is unloaded.
+func StreamError(message string) error {
+	if kind := errorKind(message); kind != nil {
+		return &serverError{message: message, kind: kind}
+	}
+	return fmt.Errorf("Ollama stopped the reply: %s", message)
+}
+
+// errorKind returns the sentinel error matching Ollama's message, or nil.
+func errorKind(message string) error {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "context length") || strings.Contains(lower, "context window"):
+		return ErrContextOverflow
+	case strings.Contains(lower, "out of memory") || strings.Contains(lower, "insufficient memory") ||
+		strings.Contains(lower, "requires more system memory") || strings.Contains(lower, "cudamalloc failed"):
+		return ErrOutOfMemory
+	}
+	return nil
+}
+
+// serverError is an error reported by Ollama, recognised as one of the
+// sentinel errors but keeping Ollama's message.
+type serverError struct {
+	message string
+	kind    error
+}
+
+func (e *serverError) Error() string { return "Ollama: " + e.message }
+
+func (e *serverError) Unwrap() error { return e.kind }
+
+// sendError describes a request that failed before a response arrived.
+// Cancellation is reported as is rather than as an unreachable server.
+func sendError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("request to Ollama cancelled: %w", ctx.Err())
+	}
+	return fmt.Errorf("%w at %s: %w", ErrOllamaUnreachable, OllamaHost, err)
+}
@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// PullProgress is one message of Ollama's /api/pull stream: a status such
+// as "pulling manifest" or "verifying sha256 digest", and for the layers
+// being downloaded, their digest with the bytes received so far.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ModelDetails describes a model, as reported by /api/show.
+type ModelDetails struct {
+	Modelfile  string                 `json:"modelfile"`
+	Parameters string                 `json:"parameters"`
+	Template   string                 `json:"template"`
+	License    string                 `json:"license"`
+	ModifiedAt string                 `json:"modified_at"`
+	ModelInfo  map[string]interface{} `json:"model_info"`
+	// Capabilities, such as "completion", "tools", "vision" or
+	// "embedding", are reported by Ollama 0.6 and later.
+	Capabilities []string `json:"capabilities"`
+	Details      struct {
+		Format            string `json:"format"`
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// LoadedModel is a model Ollama holds in memory, as listed by /api/ps.
+type LoadedModel struct {
+	Name string `json:"name"`
+	// Size is the memory the model takes, SizeVRAM the part of it on the
+	// GPU; the rest runs on the CPU.
+	Size      int64     `json:"size"`
+	SizeVRAM  int64     `json:"size_vram"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ContextLength is the context size the model was loaded with, reported
+	// by Ollama 0.6 and later.
+	ContextLength int `json:"context_length"`
+	Details       struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// Loaded lists the models Ollama has in memory.
+func (o *Ollama) Loaded(ctx context.Context) ([]LoadedModel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", OllamaHost+"/api/ps", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for Ollama ps: %v", err)
+	}
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, sendError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, StatusError(resp.StatusCode, body)
+	}
+	var ps struct {
+		Models []LoadedModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return nil, fmt.Errorf("failed to decode Ollama ps response: %v", err)
+	}
+	return ps.Models, nil
+}
+
+// Pull downloads a model from the registry, calling onProgress, if not nil,
+// with every progress message.
+func (o *Ollama) Pull(ctx context.Context, model string, onProgress func(PullProgress)) error {
+	resp, err := o.post(ctx, "POST", "/api/pull", map[string]interface{}{"model": model, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var progress PullProgress
+		err := decoder.Decode(&progress)
+		if err == io.EOF {
+			return fmt.Errorf("the pull of %s ended before it succeeded", model)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading pull progress from Ollama: %v", err)
+		}
+		if progress.Error != "" {
+			return &serverError{message: progress.Error, kind: errorKind(progress.Error)}
+		}
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		if progress.Status == "success" {
+			return nil
+		}
+	}
+}
+
+// Warm loads a model into memory without generating anything, so that the
+// next request does not wait for it to load.
+func (o *Ollama) Warm(ctx context.Context, model string) error {
+	resp, err := o.post(ctx, "POST", "/api/generate", generateRequest{Model: model, KeepAlive: KeepAlive})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Delete removes an installed model.
+func (o *Ollama) Delete(ctx context.Context, model string) error {
+	resp, err := o.post(ctx, "DELETE", "/api/delete", map[string]string{"model": model})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Show describes an installed model.
+func (o *Ollama) Show(ctx context.Context, model string) (*ModelDetails, error) {
+	resp, err := o.post(ctx, "POST", "/api/show", map[string]string{"model": model})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var details ModelDetails
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return nil, fmt.Errorf("failed to decode Ollama model info: %v", err)
+	}
+	return &details, nil
+}
+
+// post sends payload as JSON to an Ollama endpoint and returns the response
+// if its status is 200 OK.
+func (o *Ollama) post(ctx context.Context, method, path string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Ollama request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, OllamaHost+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Ollama request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, sendError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, StatusError(resp.StatusCode, body)
+	}
+	return resp, nil
+}
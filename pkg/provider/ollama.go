@@ -0,0 +1,352 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/tracing"
+)
+
+// OllamaHost is the base URL of the Ollama server.
+var OllamaHost = "http://localhost:11434"
+
+// OllamaAPIKey, when set, is sent as a bearer token with every request to
+// OllamaHost, for hosted Ollama servers.
+var OllamaAPIKey = ""
+
+// KeepAlive, when set, tells Ollama how long to keep a model in memory
+// after each request: a duration such as "30m", a negative one such as
+// "-1s" to keep it loaded, or "0s" to unload it at once. Ollama's default
+// is five minutes.
+var KeepAlive = ""
+
+// defaultClient sends the requests of an Ollama without a Client.
+var defaultClient = &http.Client{Transport: ollamaTransport{base: http.DefaultTransport}}
+
+// NewClient returns a client for requests to OllamaHost outside an Ollama
+// provider, such as listing models, with the provider's transport.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: ollamaTransport{base: http.DefaultTransport}}
+}
+
+// ollamaTransport adds OllamaAPIKey to the requests for OllamaHost, and
+// records or replays them when ActiveCassette is set. When debug logging is enabled, it logs each
+// request to OllamaHost with its body, and each line of the response.
+type ollamaTransport struct {
+	base http.RoundTripper
+}
+
+func (t ollamaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.String(), OllamaHost+"/") {
+		return t.base.RoundTrip(req)
+	}
+	cassette := ActiveCassette
+	debug := slog.Default().Enabled(req.Context(), slog.LevelDebug)
+	var body []byte
+	if (debug || cassette != nil) && req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if cassette != nil && cassette.replaying {
+		return cassette.replay(req, body)
+	}
+	if OllamaAPIKey != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+OllamaAPIKey)
+	}
+	if !debug {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && cassette != nil {
+			resp = cassette.record(req, body, resp)
+		}
+		return resp, err
+	}
+	slog.Debug("ollama request", "method", req.Method, "url", req.URL.String(),
+		"headers", redactHeaders(req.Header), "body", debugJSON(body))
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		slog.Debug("ollama request failed", "url", req.URL.String(), "err", err)
+		return nil, err
+	}
+	slog.Debug("ollama response", "url", req.URL.String(), "status", resp.StatusCode,
+		"headers", redactHeaders(resp.Header), "elapsed", time.Since(start))
+	if cassette != nil {
+		resp = cassette.record(req, body, resp)
+	}
+	resp.Body = &debugBody{body: resp.Body, url: req.URL.String()}
+	return resp, nil
+}
+
+// redactHeaders returns the headers with credentials replaced.
+func redactHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if name == "Authorization" || name == "Cookie" || name == "Set-Cookie" {
+			value = "[redacted]"
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// debugJSON returns data for logging: as JSON if it is JSON, otherwise as a
+// string, with OllamaAPIKey removed.
+func debugJSON(data []byte) interface{} {
+	if OllamaAPIKey != "" {
+		data = bytes.ReplaceAll(data, []byte(OllamaAPIKey), []byte("[redacted]"))
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return string(data)
+}
+
+// debugBody logs each line of a response body as it is read, so streamed
+// replies are logged chunk by chunk even if the stream breaks.
+type debugBody struct {
+	body    io.ReadCloser
+	url     string
+	partial []byte
+}
+
+func (d *debugBody) Read(p []byte) (int, error) {
+	n, err := d.body.Read(p)
+	d.partial = append(d.partial, p[:n]...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(d.partial[:i]); len(line) > 0 {
+			slog.Debug("ollama response line", "url", d.url, "line", debugJSON(line))
+		}
+		d.partial = d.partial[i+1:]
+	}
+	if err != nil && err != io.EOF {
+		slog.Debug("ollama response read failed", "url", d.url, "err", err)
+	}
+	return n, err
+}
+
+func (d *debugBody) Close() error {
+	if line := bytes.TrimSpace(d.partial); len(line) > 0 {
+		slog.Debug("ollama response line", "url", d.url, "line", debugJSON(line))
+		d.partial = nil
+	}
+	return d.body.Close()
+}
+
+// OllamaStats holds the counters Ollama reports in the final (done=true)
+// message of a stream. Durations are sent in nanoseconds.
+type OllamaStats struct {
+	TotalDuration      time.Duration `json:"total_duration"`
+	LoadDuration       time.Duration `json:"load_duration"`
+	PromptEvalCount    int           `json:"prompt_eval_count"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration"`
+	EvalCount          int           `json:"eval_count"`
+	EvalDuration       time.Duration `json:"eval_duration"`
+}
+
+// Chunk is one message of Ollama's /api/generate stream. Error is set
+// instead when generation failed after the stream started.
+type Chunk struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+	OllamaStats
+}
+
+// ModelInfo describes an installed model, as listed by /api/tags.
+type ModelInfo struct {
+	Name       string `json:"name"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// Ollama talks to the Ollama server at OllamaHost.
+type Ollama struct {
+	// Client sends the requests; nil means a client without a timeout.
+	// Without a Transport of its own, it is given the one that adds
+	// OllamaAPIKey, cassettes and debug logging.
+	Client *http.Client
+	// RawLine, if set, receives every chunk of a response stream as it
+	// is decoded, for -dump-stream.
+	RawLine func(line []byte)
+}
+
+func (o *Ollama) client() *http.Client {
+	if o.Client == nil {
+		return defaultClient
+	}
+	if o.Client.Transport == nil {
+		c := *o.Client
+		c.Transport = defaultClient.Transport
+		return &c
+	}
+	return o.Client
+}
+
+// generateRequest is the body of a request to /api/generate.
+type generateRequest struct {
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	System    string                 `json:"system,omitempty"`
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Format    json.RawMessage        `json:"format,omitempty"`
+	Images    []string               `json:"images,omitempty"`
+}
+
+// Generate streams a completion from /api/generate.
+func (o *Ollama) Generate(ctx context.Context, request Request, stats *Stats, onToken func(string)) (err error) {
+	if stats == nil {
+		stats = &Stats{StartTime: time.Now()}
+	}
+	ctx, span := tracing.Start(ctx, "inference", "gen_ai.system", "ollama", "gen_ai.request.model", request.Model)
+	defer func() {
+		span.SetAttributes("gen_ai.usage.input_tokens", stats.PromptTokens, "gen_ai.usage.output_tokens", stats.TokenCount)
+		span.End(err)
+	}()
+	payload, err := json.Marshal(generateRequest{
+		Model:     request.Model,
+		Prompt:    request.Prompt,
+		System:    request.System,
+		Stream:    true,
+		Options:   request.Options,
+		KeepAlive: KeepAlive,
+		Format:    request.Format,
+		Images:    request.Images,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Ollama request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", OllamaHost+"/api/generate", bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create Ollama request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return sendError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return StatusError(resp.StatusCode, body)
+	}
+
+	// The stream span runs from the response headers to the final chunk:
+	// the time spent generating, after the prompt was evaluated.
+	_, stream := tracing.Start(ctx, "stream")
+	defer func() {
+		if !stats.FirstTokenTime.IsZero() {
+			stream.SetAttributes("time_to_first_token", stats.TimeToFirstToken())
+		}
+		stream.End(err)
+	}()
+	// Chunks are decoded as a stream of JSON values rather than split into
+	// lines, so a chunk of any length, or one split across reads, is read
+	// whole, and a final chunk without a newline still counts.
+	var body io.Reader = resp.Body
+	decoder := json.NewDecoder(body)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			// Skip the rest of the line rather than lose the reply; the
+			// debug log shows what Ollama sent.
+			rest := bufio.NewReader(io.MultiReader(decoder.Buffered(), body))
+			// The decoder stops before the bad value, so the rest may start
+			// with the end of the previous line.
+			var skipped []byte
+			for len(bytes.TrimSpace(skipped)) == 0 {
+				var readErr error
+				if skipped, readErr = rest.ReadBytes('\n'); readErr != nil {
+					break
+				}
+			}
+			slog.Warn(fmt.Sprintf("skipped malformed Ollama response line <%s>", strings.TrimSpace(string(skipped))), "err", err)
+			body = rest
+			decoder = json.NewDecoder(body)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading stream from Ollama: %v", err)
+		}
+		if o.RawLine != nil {
+			o.RawLine(raw)
+		}
+
+		var chunk Chunk
+		if err := json.Unmarshal(raw, &chunk); err != nil {
+			slog.Warn(fmt.Sprintf("could not unmarshal Ollama response chunk <%s>", raw), "err", err)
+			continue
+		}
+		if chunk.Error != "" {
+			return StreamError(chunk.Error)
+		}
+		if chunk.Response != "" {
+			if stats.FirstTokenTime.IsZero() {
+				stats.FirstTokenTime = time.Now()
+			}
+			stats.TokenCount++
+		}
+		if onToken != nil {
+			onToken(chunk.Response)
+		}
+		if chunk.Done {
+			stats.Record(chunk.OllamaStats)
+			break
+		}
+	}
+	return nil
+}
+
+// Models lists the installed models.
+func (o *Ollama) Models(ctx context.Context) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", OllamaHost+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for Ollama tags: %v", err)
+	}
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, sendError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama /api/tags request failed with status %d", resp.StatusCode)
+	}
+	var tags struct {
+		Models []ModelInfo `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode Ollama tags response: %v", err)
+	}
+	return tags.Models, nil
+}
@@ -0,0 +1,37 @@
+// Package provider sends prompts to a language model server and streams the
+// replies back. Ollama is the only implementation.
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Provider generates completions.
+type Provider interface {
+	// Generate streams the reply to request, passing each piece of text to
+	// onToken as it arrives, and fills stats with the token counts and
+	// timings of the request.
+	Generate(ctx context.Context, request Request, stats *Stats, onToken func(string)) error
+}
+
+// Request is one completion request.
+type Request struct {
+	Model   string
+	Prompt  string
+	System  string
+	Options map[string]interface{} // generation options, e.g. temperature, num_ctx, stop
+	// Format constrains the reply: "json" for any JSON value, or a JSON
+	// schema it must match (Ollama 0.5 and later).
+	Format json.RawMessage
+	// Images are base64-encoded images for vision models.
+	Images []string
+}
+
+// Complete runs a request and returns the whole reply.
+func Complete(ctx context.Context, p Provider, request Request) (string, error) {
+	var reply strings.Builder
+	err := p.Generate(ctx, request, nil, func(part string) { reply.WriteString(part) })
+	return reply.String(), err
+}
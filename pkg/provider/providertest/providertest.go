@@ -0,0 +1,209 @@
+// Package providertest replays scripted model replies, so agents, the tool
+// loop and the parsing of Ollama's stream can be exercised without a model.
+//
+// Provider implements provider.Provider in process:
+//
+//	fake := providertest.New("tool: read_file({\"path\": \"go.mod\"})", "It is a Go module.")
+//	a := agent.NewAgent(agent.WithModel("fake"), agent.WithProvider(fake))
+//
+// Server speaks Ollama's HTTP API, for code that talks to provider.OllamaHost
+// such as the goclient CLI.
+package providertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// Reply is one scripted reply. A reply with Err fails the request after
+// streaming Text.
+type Reply struct {
+	Text string
+	Err  error
+}
+
+// Script hands out replies in order and records the requests they answered.
+type Script struct {
+	mu       sync.Mutex
+	replies  []Reply
+	requests []provider.Request
+}
+
+// next returns the reply to request, or an error once the script is used up.
+func (s *Script) next(request provider.Request) (Reply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, request)
+	if len(s.requests) > len(s.replies) {
+		return Reply{}, fmt.Errorf("providertest: no scripted reply for request %d", len(s.requests))
+	}
+	return s.replies[len(s.requests)-1], nil
+}
+
+// Requests returns the requests made so far.
+func (s *Script) Requests() []provider.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]provider.Request{}, s.requests...)
+}
+
+// Remaining returns the number of replies not yet used.
+func (s *Script) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return max(len(s.replies)-len(s.requests), 0)
+}
+
+// Provider is a provider.Provider that answers each request with the next
+// scripted reply, streamed token by token.
+type Provider struct {
+	Script
+}
+
+// New returns a provider that replies with texts in order.
+func New(texts ...string) *Provider {
+	return NewWithReplies(replies(texts)...)
+}
+
+// NewWithReplies returns a provider that replies with replies in order.
+func NewWithReplies(replies ...Reply) *Provider {
+	return &Provider{Script: Script{replies: replies}}
+}
+
+func (p *Provider) Generate(ctx context.Context, request provider.Request, stats *provider.Stats, onToken func(string)) error {
+	reply, err := p.next(request)
+	if err != nil {
+		return err
+	}
+	if stats == nil {
+		stats = &provider.Stats{StartTime: time.Now()}
+	}
+	for _, token := range Tokens(reply.Text) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if stats.FirstTokenTime.IsZero() {
+			stats.FirstTokenTime = time.Now()
+		}
+		stats.TokenCount++
+		if onToken != nil {
+			onToken(token)
+		}
+	}
+	stats.PromptTokens = estimateTokens(request.System) + estimateTokens(request.Prompt)
+	return reply.Err
+}
+
+// tokenPattern splits text into words with the whitespace that follows
+// them, roughly how a model streams.
+var tokenPattern = regexp.MustCompile(`\s*\S+\s*|\s+`)
+
+// Tokens splits text into the pieces it is streamed in. Joined, they are
+// text.
+func Tokens(text string) []string {
+	return tokenPattern.FindAllString(text, -1)
+}
+
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func replies(texts []string) []Reply {
+	replies := make([]Reply, len(texts))
+	for i, text := range texts {
+		replies[i] = Reply{Text: text}
+	}
+	return replies
+}
+
+// Server is a fake Ollama server that answers /api/generate with the
+// scripted replies as a stream of JSON lines, one token per line, and
+// reports a single model through /api/tags and /api/show.
+type Server struct {
+	Script
+	*httptest.Server
+
+	// Model is the name of the model the server reports; requests for other
+	// models are answered with 404, like Ollama does.
+	Model string
+	// ContextLength is the context length /api/show reports.
+	ContextLength int
+}
+
+// NewServer starts a server for model that replies with texts in order.
+// Close it when done; point provider.OllamaHost at its URL to use it.
+func NewServer(model string, texts ...string) *Server {
+	s := &Server{Script: Script{replies: replies(texts)}, Model: model, ContextLength: 8192}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/generate", s.generate)
+	mux.HandleFunc("/api/tags", s.tags)
+	mux.HandleFunc("/api/show", s.show)
+	mux.HandleFunc("/api/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"version": "providertest"})
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) generate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model   string                 `json:"model"`
+		Prompt  string                 `json:"prompt"`
+		System  string                 `json:"system"`
+		Options map[string]interface{} `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"error": "invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if body.Model != s.Model {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]string{"error": fmt.Sprintf("model %q not found, try pulling it first", body.Model)})
+		return
+	}
+	reply, err := s.next(provider.Request{Model: body.Model, Prompt: body.Prompt, System: body.System, Options: body.Options})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeJSON(w, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	tokens := Tokens(reply.Text)
+	for _, token := range tokens {
+		writeJSON(w, provider.Chunk{Response: token})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if reply.Err != nil {
+		writeJSON(w, map[string]string{"error": reply.Err.Error()})
+		return
+	}
+	writeJSON(w, provider.Chunk{Done: true, OllamaStats: provider.OllamaStats{
+		PromptEvalCount: estimateTokens(body.System) + estimateTokens(body.Prompt),
+		EvalCount:       len(tokens),
+	}})
+}
+
+func (s *Server) tags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"models": []provider.ModelInfo{{Name: s.Model}}})
+}
+
+func (s *Server) show(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"model_info": map[string]interface{}{"providertest.context_length": s.ContextLength}})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stats describes one inference. The token counts and durations come from
+// the final message of Ollama's stream; TokenCount falls back to the number
+// of streamed chunks when Ollama does not report eval_count.
+type Stats struct {
+	StartTime      time.Time
+	TokenCount     int
+	FirstTokenTime time.Time
+
+	PromptTokens  int
+	LoadDuration  time.Duration
+	PromptEval    time.Duration
+	EvalDuration  time.Duration
+	TotalDuration time.Duration
+
+	ToolCalls []string // tools the model called in its reply
+}
+
+// Record copies the token counts and timings from a final stream message.
+func (s *Stats) Record(final OllamaStats) {
+	if final.EvalCount > 0 {
+		s.TokenCount = final.EvalCount
+	}
+	s.PromptTokens = final.PromptEvalCount
+	s.LoadDuration = final.LoadDuration
+	s.PromptEval = final.PromptEvalDuration
+	s.EvalDuration = final.EvalDuration
+	s.TotalDuration = final.TotalDuration
+}
+
+// TimeToFirstToken is the time from the request until the first streamed
+// chunk arrived.
+func (s *Stats) TimeToFirstToken() time.Duration {
+	if s.FirstTokenTime.IsZero() {
+		return 0
+	}
+	return s.FirstTokenTime.Sub(s.StartTime)
+}
+
+// TokensPerSecond is the generation rate measured by Ollama, or the rate
+// over the whole request when Ollama did not report eval_duration.
+func (s *Stats) TokensPerSecond() float64 {
+	duration := s.EvalDuration
+	if duration <= 0 {
+		duration = time.Since(s.StartTime)
+	}
+	if duration <= 0 {
+		return 0
+	}
+	return float64(s.TokenCount) / duration.Seconds()
+}
+
+// Elapsed is Ollama's total duration for the request, or the time since
+// StartTime when it was not reported.
+func (s *Stats) Elapsed() time.Duration {
+	if s.TotalDuration > 0 {
+		return s.TotalDuration
+	}
+	return time.Since(s.StartTime)
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("Prompt: %d tokens, Output: %d tokens, TTFT: %.2fs, Load: %.2fs, Time: %.2fs, TPS: %.2f",
+		s.PromptTokens, s.TokenCount, s.TimeToFirstToken().Seconds(), s.LoadDuration.Seconds(), s.Elapsed().Seconds(), s.TokensPerSecond())
+}
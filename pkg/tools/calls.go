@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Call is a tool invocation parsed from a model response.
+type Call struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// ExtractCalls returns every tool call in the model's response, in order,
+// using the given grammar.
+func ExtractCalls(response string, grammar ToolGrammar) []Call {
+	switch grammar {
+	case GrammarJSON:
+		return extractJSONToolCalls(response)
+	case GrammarStrictJSON:
+		return extractFencedToolCalls(response)
+	case GrammarStructured:
+		return extractStructuredCall(response)
+	}
+	var calls []Call
+	for _, line := range strings.Split(response, "\n") {
+		if call, ok := extractCall(line); ok {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// extractCall parses a line of the form `tool: name({...})`. The
+// arguments are read as one JSON value, so parentheses inside strings and
+// text after the closing parenthesis don't confuse the parser.
+func extractCall(line string) (Call, bool) {
+	line = strings.Trim(strings.TrimSpace(line), "`")
+	if !strings.HasPrefix(line, "tool:") {
+		return Call{}, false
+	}
+	call := strings.TrimSpace(strings.TrimPrefix(line, "tool:"))
+	start := strings.Index(call, "(")
+	if start <= 0 {
+		return Call{}, false
+	}
+	name := strings.TrimSpace(call[:start])
+	args := map[string]interface{}{}
+	rest := strings.TrimSpace(call[start+1:])
+	if !strings.HasPrefix(rest, ")") {
+		decoder := json.NewDecoder(strings.NewReader(rest))
+		if err := decoder.Decode(&args); err != nil {
+			slog.Warn("could not parse arguments for tool "+name, "err", err)
+			return Call{}, false
+		}
+		rest = strings.TrimSpace(rest[decoder.InputOffset():])
+	}
+	if !strings.HasPrefix(rest, ")") {
+		slog.Warn("could not parse arguments for tool " + name + ": expected ')' after the arguments")
+		return Call{}, false
+	}
+	return Call{Name: name, Args: args}, true
+}
+
+// toolEnvelope is the JSON form of a tool call.
+type toolEnvelope struct {
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// extractJSONToolCalls finds JSON objects of the form {"tool": ..., "args": {...}}
+// anywhere in the response, including inside fenced code blocks.
+func extractJSONToolCalls(response string) []Call {
+	var calls []Call
+	for i := 0; i < len(response); i++ {
+		if response[i] != '{' {
+			continue
+		}
+		var envelope toolEnvelope
+		decoder := json.NewDecoder(strings.NewReader(response[i:]))
+		if err := decoder.Decode(&envelope); err != nil || envelope.Tool == "" {
+			continue
+		}
+		if envelope.Args == nil {
+			envelope.Args = map[string]interface{}{}
+		}
+		calls = append(calls, Call{Name: envelope.Tool, Args: envelope.Args})
+		i += int(decoder.InputOffset()) - 1
+	}
+	return calls
+}
+
+// jsonFence matches a ```json fenced block.
+var jsonFence = regexp.MustCompile("(?s)```json[ \t]*\n(.*?)\n[ \t]*```")
+
+// extractFencedToolCalls accepts only ```json blocks that contain exactly
+// one {"tool": ..., "args": {...}} object; everything else is prose.
+func extractFencedToolCalls(response string) []Call {
+	var calls []Call
+	for _, match := range jsonFence.FindAllStringSubmatch(response, -1) {
+		var envelope toolEnvelope
+		decoder := json.NewDecoder(strings.NewReader(match[1]))
+		if err := decoder.Decode(&envelope); err != nil {
+			slog.Warn("could not parse fenced tool call", "err", err)
+			continue
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			slog.Warn("ignoring fenced tool call " + envelope.Tool + ": the block must contain a single JSON object")
+			continue
+		}
+		if envelope.Tool == "" {
+			continue
+		}
+		if envelope.Args == nil {
+			envelope.Args = map[string]interface{}{}
+		}
+		calls = append(calls, Call{Name: envelope.Tool, Args: envelope.Args})
+	}
+	return calls
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/toolcalls from the current parser")
+
+// TestExtractCallsGolden parses each reply in testdata/toolcalls/FORMAT/NAME.txt,
+// where FORMAT is a tool-call format, and compares the calls found with the
+// JSON in NAME.golden.
+func TestExtractCallsGolden(t *testing.T) {
+	replies, err := filepath.Glob(filepath.Join("testdata", "toolcalls", "*", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) == 0 {
+		t.Fatal("no replies found under testdata/toolcalls/FORMAT/")
+	}
+	for _, path := range replies {
+		format := filepath.Base(filepath.Dir(path))
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		t.Run(format+"/"+name, func(t *testing.T) {
+			grammar, err := ParseToolGrammar(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := ExtractCalls(string(reply), grammar)
+			if calls == nil {
+				calls = []Call{}
+			}
+			got, err := json.MarshalIndent(calls, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			goldenPath := strings.TrimSuffix(path, ".txt") + ".golden"
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to write it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("calls differ from %s\n--- want\n%s--- got\n%s", goldenPath, want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// CommandArg describes one argument accepted by a command tool.
+type CommandArg struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// CommandTool is a tool backed by a shell command template, e.g.
+// "kubectl get pods -n {{.namespace}}". Argument values are shell-quoted
+// before they are substituted into the template.
+type CommandTool struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description"`
+	Args        []CommandArg  `yaml:"args"`
+	Command     string        `yaml:"command"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// maxCommandOutput caps the command output returned to the model.
+const maxCommandOutput = 32 * 1024
+
+// defaultCommandTimeout applies when a command tool does not set a timeout.
+const defaultCommandTimeout = 2 * time.Minute
+
+// Definition validates the command tool and converts it into a Tool.
+func (c CommandTool) Definition() (Tool, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("command tool is missing a name")
+	}
+	if strings.TrimSpace(c.Command) == "" {
+		return nil, fmt.Errorf("command tool %s is missing a command", c.Name)
+	}
+	tmpl, err := template.New(c.Name).Option("missingkey=zero").Parse(c.Command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command template for tool %s: %v", c.Name, err)
+	}
+
+	return newTool(c.Name, c.describe(), func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return c.run(ctx, tmpl, args)
+	}, WithSummary(c.Description), WithSchema(argsSchema(c.Args)), withApproval()), nil
+}
+
+// argsSchema describes the arguments of a command or macro tool; their
+// values may be of any type.
+func argsSchema(args []CommandArg) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, arg := range args {
+		properties[arg.Name] = map[string]interface{}{"description": arg.Description}
+		if arg.Required {
+			required = append(required, arg.Name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// describe appends the argument schema to the tool description.
+func (c CommandTool) describe() string {
+	if len(c.Args) == 0 {
+		return c.Description + " Arguments: {}"
+	}
+	var parts []string
+	for _, arg := range c.Args {
+		part := fmt.Sprintf("%q: %s", arg.Name, arg.Description)
+		if !arg.Required {
+			part += " (optional)"
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("%s Arguments: {%s}", c.Description, strings.Join(parts, ", "))
+}
+
+func (c CommandTool) run(ctx context.Context, tmpl *template.Template, args map[string]interface{}) (interface{}, error) {
+	values := map[string]string{}
+	for _, arg := range c.Args {
+		raw, ok := args[arg.Name]
+		if !ok || raw == nil {
+			if arg.Required {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidToolArgs, arg.Name)
+			}
+			values[arg.Name] = "''"
+			continue
+		}
+		values[arg.Name] = shellQuote(fmt.Sprintf("%v", raw))
+	}
+
+	var command strings.Builder
+	if err := tmpl.Execute(&command, values); err != nil {
+		return nil, fmt.Errorf("failed to render command for tool %s: %v", c.Name, err)
+	}
+	if !Confirm(ctx, fmt.Sprintf("Run %s: %s?", c.Name, command.String())) {
+		return nil, fmt.Errorf("%w: %s was not run", ErrNotApproved, c.Name)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stopProgress := reportElapsed("running " + c.Name)
+	output, err := CommandExecutor.Run(ctx, command.String())
+	stopProgress()
+	result := string(output)
+	if len(result) > maxCommandOutput {
+		result = result[:maxCommandOutput] + "\n... (truncated)"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("command %q failed: %v: %s", command.String(), err, strings.TrimSpace(result))
+	}
+	return result, nil
+}
+
+// shellQuote wraps s in single quotes so it is passed to sh as one word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,456 @@
+package tools
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DocsConfig configures the search_docs tool. Dir is the directory that is
+// indexed; IndexPath is where the index is cached on disk.
+type DocsConfig struct {
+	Dir        string   `yaml:"dir"`
+	IndexPath  string   `yaml:"index"`
+	Extensions []string `yaml:"extensions"`
+	MaxResults int      `yaml:"max_results"`
+}
+
+// DocsSettings is used by search_docs. The CLI overrides it from the config file.
+var DocsSettings = DocsConfig{Dir: "."}
+
+var defaultDocExtensions = []string{".md", ".markdown", ".txt", ".go"}
+
+// skippedDirs are never indexed.
+var skippedDirs = map[string]bool{".git": true, "vendor": true, "node_modules": true}
+
+// maxIndexedFileSize skips very large files such as generated code.
+const maxIndexedFileSize = 1 << 20
+
+// DocIndex is an inverted index over chunks of documentation files.
+type DocIndex struct {
+	Root    string               `json:"root"`
+	Files   map[string]time.Time `json:"files"` // path -> modification time
+	Chunks  []DocChunk           `json:"chunks"`
+	Terms   map[string][]int     `json:"terms"` // term -> chunk indexes
+	BuiltAt time.Time            `json:"built_at"`
+}
+
+// DocChunk is a searchable section of a file, e.g. a markdown section or a
+// Go declaration with its doc comment.
+type DocChunk struct {
+	Path    string         `json:"path"`
+	Line    int            `json:"line"`
+	Heading string         `json:"heading"`
+	Text    string         `json:"text"`
+	Counts  map[string]int `json:"counts"`
+}
+
+// DocResult is one ranked search hit.
+type DocResult struct {
+	Path    string  `json:"path"`
+	Line    int     `json:"line"`
+	Heading string  `json:"heading"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// loadDocIndex returns the cached index for cfg, rebuilding it when any
+// indexed file was added, removed or modified.
+func loadDocIndex(cfg DocsConfig) (*DocIndex, error) {
+	root, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docs directory: %v", err)
+	}
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = defaultDocExtensions
+	}
+	files, err := scanDocFiles(root, extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	indexPath := cfg.IndexPath
+	if indexPath == "" {
+		indexPath = defaultIndexPath(root)
+	}
+	if indexPath != "" {
+		if cached, err := readDocIndex(indexPath); err == nil && cached.Root == root && sameFiles(cached.Files, files) {
+			return cached, nil
+		}
+	}
+
+	index, err := buildDocIndex(root, files)
+	if err != nil {
+		return nil, err
+	}
+	if indexPath != "" {
+		if err := writeDocIndex(indexPath, index); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// defaultIndexPath stores indexes under ~/.cache/goclient keyed by the root.
+func defaultIndexPath(root string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(cacheDir, "goclient", "docindex-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+func scanDocFiles(root string, extensions []string) (map[string]time.Time, error) {
+	files := map[string]time.Time{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (skippedDirs[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !hasExtension(path, extensions) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxIndexedFileSize {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan docs directory %s: %v", root, err)
+	}
+	return files, nil
+}
+
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range extensions {
+		if ext == strings.ToLower(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameFiles(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, mod := range a {
+		if other, ok := b[path]; !ok || !other.Equal(mod) {
+			return false
+		}
+	}
+	return true
+}
+
+func buildDocIndex(root string, files map[string]time.Time) (*DocIndex, error) {
+	index := &DocIndex{
+		Root:    root,
+		Files:   files,
+		Terms:   map[string][]int{},
+		BuiltAt: time.Now(),
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		OnProgress(Progress{Task: "indexing docs", Done: i, Total: len(paths), Current: path})
+		chunks, err := chunkFile(filepath.Join(root, filepath.FromSlash(path)), path)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range chunks {
+			chunk.Counts = map[string]int{}
+			for _, term := range tokenize(chunk.Heading + " " + chunk.Text) {
+				chunk.Counts[term]++
+			}
+			id := len(index.Chunks)
+			for term := range chunk.Counts {
+				index.Terms[term] = append(index.Terms[term], id)
+			}
+			index.Chunks = append(index.Chunks, chunk)
+		}
+	}
+	return index, nil
+}
+
+// chunkFile splits markdown files at headings and Go files at top-level
+// declarations (keeping their doc comments); other files become one chunk.
+func chunkFile(fullPath, relPath string) ([]DocChunk, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", relPath, err)
+	}
+	defer f.Close()
+
+	isGo := strings.HasSuffix(relPath, ".go")
+	var chunks []DocChunk
+	current := DocChunk{Path: relPath, Line: 1, Heading: relPath}
+	var text strings.Builder
+	var pendingComment []string
+	flush := func() {
+		current.Text = strings.TrimSpace(text.String())
+		if current.Text != "" {
+			chunks = append(chunks, current)
+		}
+		text.Reset()
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxIndexedFileSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		l := scanner.Text()
+		switch {
+		case !isGo && strings.HasPrefix(l, "#"):
+			flush()
+			current = DocChunk{Path: relPath, Line: line, Heading: strings.TrimSpace(strings.TrimLeft(l, "#"))}
+			continue
+		case isGo && strings.HasPrefix(l, "//"):
+			pendingComment = append(pendingComment, l)
+			continue
+		case isGo && isGoDecl(l):
+			flush()
+			current = DocChunk{Path: relPath, Line: line - len(pendingComment), Heading: strings.TrimSuffix(strings.TrimSpace(l), "{")}
+		}
+		for _, c := range pendingComment {
+			text.WriteString(c + "\n")
+		}
+		pendingComment = nil
+		text.WriteString(l + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", relPath, err)
+	}
+	for _, c := range pendingComment {
+		text.WriteString(c + "\n")
+	}
+	flush()
+	return chunks, nil
+}
+
+func isGoDecl(line string) bool {
+	for _, prefix := range []string{"func ", "type ", "package ", "var ", "const "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize lower-cases text and splits it into words of two or more letters
+// or digits, also splitting identifiers such as camelCase and snake_case.
+func tokenize(text string) []string {
+	var terms []string
+	var word []rune
+	emit := func() {
+		if len(word) >= 2 {
+			terms = append(terms, strings.ToLower(string(word)))
+		}
+		word = word[:0]
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			emit()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]) {
+			emit()
+		}
+		word = append(word, r)
+	}
+	emit()
+	return terms
+}
+
+// Search ranks chunks by TF-IDF over the query terms. Terms with no exact
+// match fall back to index terms within a small edit distance.
+func (idx *DocIndex) Search(query string, limit int) []DocResult {
+	scores := map[int]float64{}
+	total := float64(len(idx.Chunks))
+	queryTerms := tokenize(query)
+
+	for _, term := range queryTerms {
+		matches := map[string]float64{}
+		if _, ok := idx.Terms[term]; ok {
+			matches[term] = 1
+		} else {
+			for candidate := range idx.Terms {
+				if weight := fuzzyWeight(term, candidate); weight > 0 {
+					matches[candidate] = weight
+				}
+			}
+		}
+		for candidate, weight := range matches {
+			ids := idx.Terms[candidate]
+			idf := math.Log(1 + total/float64(len(ids)))
+			for _, id := range ids {
+				tf := 1 + math.Log(float64(idx.Chunks[id].Counts[candidate]))
+				scores[id] += weight * tf * idf
+			}
+		}
+	}
+
+	results := make([]DocResult, 0, len(scores))
+	for id, score := range scores {
+		chunk := idx.Chunks[id]
+		results = append(results, DocResult{
+			Path:    displayPath(filepath.Join(idx.Root, filepath.FromSlash(chunk.Path))),
+			Line:    chunk.Line,
+			Heading: chunk.Heading,
+			Score:   math.Round(score*100) / 100,
+			Snippet: snippet(chunk.Text, queryTerms),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].Line < results[j].Line
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// fuzzyWeight returns a score weight for a near-miss term, or 0 when the
+// terms are too different. Prefix matches count as close matches.
+func fuzzyWeight(term, candidate string) float64 {
+	if len(term) >= 4 && strings.HasPrefix(candidate, term) {
+		return 0.7
+	}
+	maxDistance := 0
+	switch {
+	case len(term) >= 8:
+		maxDistance = 2
+	case len(term) >= 4:
+		maxDistance = 1
+	default:
+		return 0
+	}
+	if d := levenshtein(term, candidate, maxDistance); d <= maxDistance {
+		return 0.5
+	}
+	return 0
+}
+
+// levenshtein computes the edit distance between a and b, stopping early
+// once it exceeds limit.
+func levenshtein(a, b string, limit int) int {
+	if diff := len(a) - len(b); diff > limit || -diff > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// snippet returns the lines of text around the first query term match.
+func snippet(text string, terms []string) string {
+	lines := strings.Split(text, "\n")
+	start := firstMatchingLine(lines, terms) - 1
+	if start < 0 {
+		start = 0
+	}
+	end := start + 4
+	if end > len(lines) {
+		end = len(lines)
+	}
+	s := strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+	if len(s) > 300 {
+		s = s[:300] + "..."
+	}
+	return s
+}
+
+func firstMatchingLine(lines []string, terms []string) int {
+	for i, line := range lines {
+		lower := strings.ToLower(line)
+		for _, term := range terms {
+			if strings.Contains(lower, term) {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func readDocIndex(path string) (*DocIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var index DocIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+func writeDocIndex(path string, index *DocIndex) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create index directory: %v", err)
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to encode docs index: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write docs index: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// EmbedConfig configures semantic search over the workspace. Files under Dir
+// are chunked like search_docs chunks them and embedded with Model through
+// Ollama's /api/embed. TopK chunks relevant to each user message are added
+// to the prompt; 0 leaves retrieval to the semantic_search tool. Store
+// selects where the vectors are kept.
+type EmbedConfig struct {
+	Model      string            `yaml:"model"`
+	Dir        string            `yaml:"dir"`
+	IndexPath  string            `yaml:"index"`
+	Extensions []string          `yaml:"extensions"`
+	TopK       int               `yaml:"top_k"`
+	Store      VectorStoreConfig `yaml:"store"`
+}
+
+// EmbedSettings is used by semantic_search and Retrieve. The CLI sets it
+// from the config file.
+var EmbedSettings = EmbedConfig{Model: "nomic-embed-text", Dir: "."}
+
+// embedBatchSize is the number of chunks sent per /api/embed request.
+const embedBatchSize = 32
+
+// maxEmbedChars truncates long chunks, such as large functions, to what
+// embedding models accept.
+const maxEmbedChars = 6000
+
+// embedText is the text embedded for a chunk: its location and heading
+// followed by its content.
+func embedText(chunk DocChunk) string {
+	text := chunk.Path + ": " + chunk.Heading + "\n" + chunk.Text
+	if len(text) > maxEmbedChars {
+		text = text[:maxEmbedChars]
+	}
+	return text
+}
+
+// Embed returns the embeddings of inputs from Ollama's /api/embed.
+func Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	payload, err := json.Marshal(map[string]interface{}{"model": model, "input": inputs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embed request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.OllamaHost+"/api/embed", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embed request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := provider.NewClient(0).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send embed request: %w at %s: %w", provider.ErrOllamaUnreachable, provider.OllamaHost, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("embed request failed: %w", provider.StatusError(resp.StatusCode, body))
+	}
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embed response: %v", err)
+	}
+	if len(result.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("embed response has %d embeddings for %d inputs", len(result.Embeddings), len(inputs))
+	}
+	return result.Embeddings, nil
+}
+
+// search returns the chunks closest to the query vector.
+func (idx *vectorIndex) search(ctx context.Context, query []float32, limit int) ([]DocResult, []VectorHit, error) {
+	hits, err := idx.store.Search(ctx, query, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	results := make([]DocResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, DocResult{
+			Path:    idx.displayPath(hit.Chunk),
+			Line:    hit.Chunk.Line,
+			Heading: hit.Chunk.Heading,
+			Score:   math.Round(hit.Score*1000) / 1000,
+			Snippet: snippet(hit.Chunk.Text, nil),
+		})
+	}
+	return results, hits, nil
+}
+
+// displayPath returns the workspace-relative path of a chunk.
+func (idx *vectorIndex) displayPath(chunk DocChunk) string {
+	return displayPath(filepath.Join(idx.root, filepath.FromSlash(chunk.Path)))
+}
+
+// embedQuery loads the index and embeds the query.
+func embedQuery(ctx context.Context, query string) (*vectorIndex, []float32, error) {
+	index, err := currentVectorIndex(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	vectors, err := Embed(ctx, EmbedSettings.Model, []string{query})
+	if err != nil {
+		return nil, nil, err
+	}
+	return index, vectors[0], nil
+}
+
+// Retrieve returns the TopK workspace chunks most relevant to a user
+// message, formatted for the prompt. It is empty when retrieval is disabled.
+func Retrieve(ctx context.Context, message string) (string, error) {
+	if EmbedSettings.TopK <= 0 {
+		return "", nil
+	}
+	index, query, err := embedQuery(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	_, hits, err := index.search(ctx, query, EmbedSettings.TopK)
+	if err != nil || len(hits) == 0 {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("Workspace excerpts that may be relevant:")
+	for _, hit := range hits {
+		chunk := hit.Chunk
+		body := chunk.Text
+		if len(body) > maxEmbedChars/4 {
+			body = body[:maxEmbedChars/4] + "\n..."
+		}
+		fmt.Fprintf(&b, "\n\n%s:%d (%s)\n%s", index.displayPath(chunk), chunk.Line, chunk.Heading, body)
+	}
+	return b.String(), nil
+}
+
+// semanticSearchInput is the input of semantic_search.
+type semanticSearchInput struct {
+	Query string `json:"query" description:"what you are looking for"`
+	Limit int    `json:"limit,omitempty" description:"the number of chunks to return; 5 by default"`
+}
+
+func semanticSearchTool(ctx context.Context, input semanticSearchInput) (interface{}, error) {
+	query := input.Query
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query must be a non-empty string", ErrInvalidToolArgs)
+	}
+	limit := 5
+	if input.Limit > 0 {
+		limit = input.Limit
+	}
+	index, vector, err := embedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	results, _, err := index.search(ctx, vector, limit)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// embeddingsEnabled is set once semantic search has been registered.
+var embeddingsEnabled bool
+
+// RegisterSemanticSearch adds the semantic_search tool. It is only
+// registered when embeddings are configured, since it needs an embedding
+// model to be pulled.
+func RegisterSemanticSearch() {
+	embeddingsEnabled = true
+	RegisterTool(newTool("semantic_search",
+		`Search the workspace by meaning rather than exact words, using embeddings. Returns the closest code and documentation chunks with file and line. `+
+			`Arguments: {"query": "what you are looking for", "limit": 5}`,
+		semanticSearchTool,
+		WithSummary("Search the workspace by meaning."),
+		WithExamples(`{"query": "where are HTTP retries handled"}`),
+		WithRenderer(TableRenderer),
+		WithReadOnly()))
+}
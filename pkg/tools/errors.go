@@ -0,0 +1,16 @@
+package tools
+
+import "errors"
+
+// Errors returned by ExecuteTool and the tools, wrapped with the details of
+// the failure; test for them with errors.Is.
+var (
+	// ErrToolNotFound means no registered tool has the requested name.
+	ErrToolNotFound = errors.New("unknown tool")
+	// ErrInvalidToolArgs means a tool was called with missing or malformed
+	// arguments.
+	ErrInvalidToolArgs = errors.New("invalid argument")
+	// ErrNotApproved means the user did not approve what the tool was
+	// about to do, so it did nothing.
+	ErrNotApproved = errors.New("not approved by the user")
+)
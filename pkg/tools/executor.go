@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Executor runs a shell command and returns its combined output.
+type Executor interface {
+	Run(ctx context.Context, command string) ([]byte, error)
+}
+
+// CommandExecutor runs commands for command tools. The CLI replaces it with a
+// DockerExecutor when the sandbox is enabled.
+var CommandExecutor Executor = HostExecutor{}
+
+// HostExecutor runs commands directly on the host with sh -c.
+type HostExecutor struct{}
+
+func (HostExecutor) Run(ctx context.Context, command string) ([]byte, error) {
+	return runCommand(exec.CommandContext(ctx, "sh", "-c", command))
+}
+
+// cancelWaitDelay bounds how long a cancelled command's output is waited
+// for, since processes it started may keep the output open.
+const cancelWaitDelay = 2 * time.Second
+
+// runCommand runs cmd and returns its combined output, giving up on the
+// output shortly after cmd's context is cancelled.
+func runCommand(cmd *exec.Cmd) ([]byte, error) {
+	cmd.WaitDelay = cancelWaitDelay
+	return cmd.CombinedOutput()
+}
+
+// DockerExecutor runs each command in a disposable container with the
+// workspace mounted at /workspace and networking disabled unless Network is set.
+type DockerExecutor struct {
+	Image     string `yaml:"image"`
+	Workspace string `yaml:"workspace"` // host directory to mount, defaults to the workspace root
+	Network   bool   `yaml:"network"`
+	ReadOnly  bool   `yaml:"read_only"` // mount the workspace read-only
+}
+
+// defaultSandboxImage is used when DockerExecutor.Image is empty.
+const defaultSandboxImage = "alpine:3"
+
+// dockerKillTimeout bounds the docker kill of a cancelled command's
+// container.
+const dockerKillTimeout = 10 * time.Second
+
+func (d DockerExecutor) Run(ctx context.Context, command string) ([]byte, error) {
+	name := "goclient-" + randomHex(6)
+	args, err := d.dockerArgs(name, command)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	// Killing the docker client would leave the container running, so a
+	// timeout or Ctrl-C kills the container, which ends the client too.
+	cmd.Cancel = func() error {
+		killCtx, cancel := context.WithTimeout(context.Background(), dockerKillTimeout)
+		defer cancel()
+		if err := exec.CommandContext(killCtx, "docker", "kill", name).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	return runCommand(cmd)
+}
+
+func (d DockerExecutor) dockerArgs(name, command string) ([]string, error) {
+	workspace := d.Workspace
+	if workspace == "" {
+		root, err := workspaceRoot()
+		if err != nil {
+			return nil, err
+		}
+		workspace = root
+	}
+	workspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sandbox workspace: %v", err)
+	}
+	image := d.Image
+	if image == "" {
+		image = defaultSandboxImage
+	}
+
+	// --mount, unlike -v, takes paths containing colons; it reads its
+	// value as CSV, so the source is quoted.
+	mount := "type=bind," + csvField("src="+workspace) + ",dst=/workspace"
+	if d.ReadOnly {
+		mount += ",readonly"
+	}
+	args := []string{"run", "--rm", "-i", "--name", name, "--mount", mount, "-w", "/workspace"}
+	if !d.Network {
+		args = append(args, "--network", "none")
+	}
+	return append(args, image, "sh", "-c", command), nil
+}
+
+// csvField quotes a CSV field if it contains a comma or a quote.
+func csvField(field string) string {
+	if !strings.ContainsAny(field, ",\"\n") {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
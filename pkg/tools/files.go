@@ -0,0 +1,298 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WorkspaceRoot confines the file tools. An empty value means the current
+// working directory.
+var WorkspaceRoot = ""
+
+// maxReadFileSize is the largest amount of file content returned to the model.
+const maxReadFileSize = 256 * 1024
+
+// workspaceRoot returns the absolute, symlink-resolved workspace root.
+func workspaceRoot() (string, error) {
+	root := WorkspaceRoot
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine workspace: %v", err)
+		}
+		root = wd
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid workspace root: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	return root, nil
+}
+
+// resolveWorkspacePath converts a tool path argument into an absolute path and
+// rejects paths that escape the workspace, including through symlinks, and
+// paths inside StateDir.
+func resolveWorkspacePath(path string) (string, error) {
+	root, err := workspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+
+	// Resolve symlinks on the longest existing prefix so new files can be
+	// checked too. A dangling symlink is refused: its target would be
+	// created wherever it points, inside the workspace or not.
+	resolved := path
+	for dir, rest := path, ""; ; {
+		if r, err := filepath.EvalSymlinks(dir); err == nil {
+			resolved = filepath.Join(r, rest)
+			break
+		}
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("path %s goes through a symlink whose target does not exist", path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the workspace", path)
+	}
+	if isStatePath(rel) {
+		return "", fmt.Errorf("path %s is goclient state and not available to tools", filepath.ToSlash(rel))
+	}
+	return resolved, nil
+}
+
+// DisplayPath converts a path in either absolute or relative form into the
+// workspace-relative form shown to the user and the model. Paths outside the
+// workspace are returned unchanged.
+func DisplayPath(path string) string {
+	resolved, err := resolveWorkspacePath(path)
+	if err != nil {
+		return path
+	}
+	return displayPath(resolved)
+}
+
+// displayPath returns the workspace-relative, slash-separated form of an
+// already resolved path.
+func displayPath(resolved string) string {
+	root, err := workspaceRoot()
+	if err != nil {
+		return resolved
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return resolved
+	}
+	return filepath.ToSlash(rel)
+}
+
+// WorkspacePath validates a path against the workspace and returns it in
+// the workspace-relative form used in tool results.
+func WorkspacePath(path string) (string, error) {
+	resolved, err := resolveWorkspacePath(path)
+	if err != nil {
+		return "", err
+	}
+	return displayPath(resolved), nil
+}
+
+// pathError strips the absolute path from os errors so messages only show
+// the workspace-relative path.
+func pathError(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// readFileInput is the input of read_file.
+type readFileInput struct {
+	Path string `json:"path" description:"workspace-relative or absolute path"`
+}
+
+func readFile(ctx context.Context, input readFileInput) (interface{}, error) {
+	path := input.Path
+	if path == "" {
+		return nil, fmt.Errorf("%w: path must be a non-empty string", ErrInvalidToolArgs)
+	}
+	resolved, err := resolveWorkspacePath(path)
+	if err != nil {
+		return nil, err
+	}
+	path = displayPath(resolved)
+	if content, ok := proposedContent[resolved]; ok {
+		return content, nil
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxReadFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+	if bytes.IndexByte(content, 0) >= 0 {
+		return nil, fmt.Errorf("%s appears to be a binary file", path)
+	}
+	if info.Size() > maxReadFileSize {
+		return fmt.Sprintf("%s\n... (truncated: file is %d bytes, showing the first %d)", content, info.Size(), maxReadFileSize), nil
+	}
+	return string(content), nil
+}
+
+// Edit replaces OldStr with NewStr. OldStr must occur exactly once in the
+// file; an empty OldStr creates the file with NewStr as its content.
+type Edit struct {
+	OldStr string
+	NewStr string
+}
+
+// ForModel keeps edit results compact for the model; the full before and
+// after content is only used for the terminal diff.
+func (e FileEdit) ForModel() interface{} {
+	status := "ok"
+	if e.Proposed {
+		status = "proposed to the editor; not yet applied"
+	}
+	return map[string]interface{}{
+		"path":   e.Path,
+		"status": status,
+		"lines":  strings.Count(e.New, "\n") + 1,
+	}
+}
+
+// editFileInput is the input of edit_file.
+type editFileInput struct {
+	Path   string `json:"path" description:"workspace-relative or absolute path"`
+	OldStr string `json:"old_str,omitempty" description:"text to replace, which must occur exactly once; empty to create the file"`
+	NewStr string `json:"new_str" description:"replacement text"`
+}
+
+func editFile(ctx context.Context, input editFileInput) (interface{}, error) {
+	if input.Path == "" {
+		return nil, fmt.Errorf("%w: path must be a non-empty string", ErrInvalidToolArgs)
+	}
+	if input.OldStr == input.NewStr {
+		return nil, fmt.Errorf("%w: old_str and new_str must be different", ErrInvalidToolArgs)
+	}
+	return ApplyEdits(ctx, input.Path, []Edit{{OldStr: input.OldStr, NewStr: input.NewStr}})
+}
+
+// EditFromArgs converts edit_file arguments into an Edit.
+func EditFromArgs(args map[string]interface{}) (Edit, error) {
+	oldStr, _ := args["old_str"].(string)
+	newStr, ok := args["new_str"].(string)
+	if !ok {
+		return Edit{}, fmt.Errorf("%w: new_str must be a string", ErrInvalidToolArgs)
+	}
+	if oldStr == newStr {
+		return Edit{}, fmt.Errorf("%w: old_str and new_str must be different", ErrInvalidToolArgs)
+	}
+	return Edit{OldStr: oldStr, NewStr: newStr}, nil
+}
+
+// ApplyEdits applies edits to a file as a single transaction. Each edit is
+// validated against the content produced by the edits before it, and the file
+// is only written if every edit applies cleanly and the write is confirmed
+// with Confirm.
+func ApplyEdits(ctx context.Context, path string, edits []Edit) (FileEdit, error) {
+	resolved, err := resolveWorkspacePath(path)
+	if err != nil {
+		return FileEdit{}, err
+	}
+	path = displayPath(resolved)
+
+	original := ""
+	exists := true
+	data, err := os.ReadFile(resolved)
+	if proposed, ok := proposedContent[resolved]; ok {
+		data, err = []byte(proposed), nil
+	}
+	switch {
+	case os.IsNotExist(err):
+		exists = false
+	case err != nil:
+		return FileEdit{}, fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	default:
+		original = string(data)
+	}
+
+	content := original
+	for i, edit := range edits {
+		switch {
+		case edit.OldStr == "" && !exists && i == 0:
+			content = edit.NewStr
+		case edit.OldStr == "":
+			return FileEdit{}, fmt.Errorf("edit %d of %d on %s: old_str is empty but the file already exists", i+1, len(edits), path)
+		default:
+			count := strings.Count(content, edit.OldStr)
+			if count == 0 {
+				return FileEdit{}, fmt.Errorf("edit %d of %d on %s: old_str not found (after applying the previous edits)", i+1, len(edits), path)
+			}
+			if count > 1 {
+				return FileEdit{}, fmt.Errorf("edit %d of %d on %s: old_str matches %d times; include more context", i+1, len(edits), path, count)
+			}
+			content = strings.Replace(content, edit.OldStr, edit.NewStr, 1)
+		}
+	}
+
+	if EditProposals != nil {
+		if err := proposeEdit(resolved, original, content, !exists); err != nil {
+			return FileEdit{}, err
+		}
+		return FileEdit{Path: path, Old: original, New: content, Proposed: true}, nil
+	}
+
+	if !Confirm(ctx, fmt.Sprintf("Write %s?", path)) {
+		return FileEdit{}, fmt.Errorf("%w: %s was not written", ErrNotApproved, path)
+	}
+	if err := recordWrite(resolved, []byte(original), exists); err != nil {
+		return FileEdit{}, err
+	}
+	if !exists {
+		if err := os.MkdirAll(filepath.Dir(resolved), 0o755); err != nil {
+			return FileEdit{}, fmt.Errorf("failed to create directory for %s: %v", path, pathError(err))
+		}
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(resolved); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(resolved, []byte(content), mode); err != nil {
+		return FileEdit{}, fmt.Errorf("failed to write %s: %v", path, pathError(err))
+	}
+	return FileEdit{Path: path, Old: original, New: content}, nil
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useWorkspace confines the file tools to a new temporary directory for the
+// test and returns it.
+func useWorkspace(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	saved := WorkspaceRoot
+	WorkspaceRoot = root
+	t.Cleanup(func() { WorkspaceRoot = saved })
+	return root
+}
+
+func TestApplyEdits(t *testing.T) {
+	tests := []struct {
+		name     string
+		original *string // nil when the file does not exist
+		edits    []Edit
+		deny     bool
+		want     string // the content written
+		wantErr  string
+	}{
+		{
+			name:  "creates a file",
+			edits: []Edit{{NewStr: "hello\n"}},
+			want:  "hello\n",
+		},
+		{
+			name:     "later edits apply to the content left by earlier ones",
+			original: ptr("alpha beta gamma\n"),
+			edits:    []Edit{{OldStr: "alpha", NewStr: "one"}, {OldStr: "one beta", NewStr: "two"}},
+			want:     "two gamma\n",
+		},
+		{
+			name:     "text replaced by an earlier edit is gone",
+			original: ptr("alpha\n"),
+			edits:    []Edit{{OldStr: "alpha", NewStr: "beta"}, {OldStr: "alpha", NewStr: "gamma"}},
+			wantErr:  "edit 2 of 2 on a.txt: old_str not found (after applying the previous edits)",
+		},
+		{
+			name:     "missing old_str aborts the batch",
+			original: ptr("alpha\n"),
+			edits:    []Edit{{OldStr: "alpha", NewStr: "beta"}, {OldStr: "delta", NewStr: "gamma"}},
+			wantErr:  "edit 2 of 2 on a.txt: old_str not found",
+		},
+		{
+			name:     "old_str matching more than once aborts the batch",
+			original: ptr("alpha alpha\n"),
+			edits:    []Edit{{OldStr: "alpha", NewStr: "beta"}},
+			wantErr:  "edit 1 of 1 on a.txt: old_str matches 2 times",
+		},
+		{
+			name:     "empty old_str on an existing file",
+			original: ptr("alpha\n"),
+			edits:    []Edit{{NewStr: "beta\n"}},
+			wantErr:  "old_str is empty but the file already exists",
+		},
+		{
+			name:    "empty old_str after the file was created",
+			edits:   []Edit{{NewStr: "alpha\n"}, {NewStr: "beta\n"}},
+			wantErr: "edit 2 of 2 on a.txt: old_str is empty",
+		},
+		{
+			name:     "denied write",
+			original: ptr("alpha\n"),
+			edits:    []Edit{{OldStr: "alpha", NewStr: "beta"}},
+			deny:     true,
+			wantErr:  "a.txt was not written",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(useWorkspace(t), "a.txt")
+			if tt.original != nil {
+				if err := os.WriteFile(path, []byte(*tt.original), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			asked := 0
+			ctx := WithApprover(context.Background(), func(action string) bool {
+				asked++
+				return !tt.deny
+			})
+
+			edit, err := ApplyEdits(ctx, "a.txt", tt.edits)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ApplyEdits error = %v, want %q", err, tt.wantErr)
+				}
+				if tt.deny && !errors.Is(err, ErrNotApproved) {
+					t.Errorf("ApplyEdits error = %v, want ErrNotApproved", err)
+				}
+				if !tt.deny && asked != 0 {
+					t.Errorf("the write was confirmed although an edit failed")
+				}
+				data, err := os.ReadFile(path)
+				switch {
+				case tt.original == nil && !os.IsNotExist(err):
+					t.Errorf("the file was created: %q, %v", data, err)
+				case tt.original != nil && string(data) != *tt.original:
+					t.Errorf("the file was changed to %q, want %q", data, *tt.original)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyEdits: %v", err)
+			}
+			if asked != 1 {
+				t.Errorf("the write was confirmed %d times, want once", asked)
+			}
+			if edit.New != tt.want {
+				t.Errorf("FileEdit.New = %q, want %q", edit.New, tt.want)
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != tt.want {
+				t.Errorf("file = %q, %v, want %q", data, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEditsDanglingSymlink(t *testing.T) {
+	outside := t.TempDir()
+	root := useWorkspace(t)
+	if err := os.Symlink(filepath.Join(outside, "pwned"), filepath.Join(root, "evil")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "dir"), filepath.Join(root, "evildir")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithApprover(context.Background(), func(action string) bool { return true })
+	for _, path := range []string{"evil", "evildir/pwned"} {
+		if _, err := ApplyEdits(ctx, path, []Edit{{NewStr: "pwned\n"}}); err == nil || !strings.Contains(err.Error(), "symlink whose target does not exist") {
+			t.Errorf("ApplyEdits(%s) error = %v, want a dangling symlink error", path, err)
+		}
+	}
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files were created outside the workspace: %v", entries)
+	}
+}
+
+func TestDisplayPath(t *testing.T) {
+	root := useWorkspace(t)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(root, "a.txt"), "a.txt"},
+		{filepath.Join(root, "..foo"), "..foo"},
+		{filepath.Join(root, "dir", "..bar", "b.go"), "dir/..bar/b.go"},
+		{root, "."},
+		{filepath.Dir(root), filepath.Dir(root)},
+		{filepath.Join(filepath.Dir(root), "other"), filepath.Join(filepath.Dir(root), "other")},
+	}
+	for _, tt := range tests {
+		if got := displayPath(tt.path); got != tt.want {
+			t.Errorf("displayPath(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxCheckpoints bounds the undo history; the oldest checkpoints and their
+// backups are discarded first.
+const maxCheckpoints = 50
+
+// fileBackup is the content of a file before the first write to it after a
+// checkpoint.
+type fileBackup struct {
+	path    string // resolved path of the file
+	existed bool
+	backup  string // copy of the original content under StateDir
+}
+
+// checkpoint holds the backups of the files written since it was taken.
+type checkpoint struct {
+	backups []fileBackup
+}
+
+// journal records file writes made by tools so they can be rolled back.
+var journal struct {
+	mu          sync.Mutex
+	dir         string // backup directory of this process, created on first use
+	seq         int
+	checkpoints []*checkpoint
+}
+
+// Checkpoint starts a new undo step: the first write to each file from now
+// on backs the file up, so RestoreCheckpoint can put it back.
+func Checkpoint() {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	journal.checkpoints = append(journal.checkpoints, &checkpoint{})
+	if len(journal.checkpoints) > maxCheckpoints {
+		removeBackups(journal.checkpoints[0])
+		journal.checkpoints = journal.checkpoints[1:]
+	}
+}
+
+// RestoreCheckpoint restores the files written since the latest checkpoint,
+// newest first, and returns their workspace-relative paths. The checkpoint
+// stays in place, now empty.
+func RestoreCheckpoint() ([]string, error) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if len(journal.checkpoints) == 0 {
+		return nil, nil
+	}
+	cp := journal.checkpoints[len(journal.checkpoints)-1]
+	var restored []string
+	for i := len(cp.backups) - 1; i >= 0; i-- {
+		b := cp.backups[i]
+		if err := restoreBackup(b); err != nil {
+			cp.backups = cp.backups[:i+1]
+			return restored, err
+		}
+		restored = append(restored, displayPath(b.path))
+	}
+	removeBackups(cp)
+	cp.backups = nil
+	return restored, nil
+}
+
+// CheckpointCount returns the number of checkpoints in the undo history.
+func CheckpointCount() int {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return len(journal.checkpoints)
+}
+
+// DropCheckpoint discards the latest checkpoint, leaving its files as they are.
+func DropCheckpoint() {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if n := len(journal.checkpoints); n > 0 {
+		removeBackups(journal.checkpoints[n-1])
+		journal.checkpoints = journal.checkpoints[:n-1]
+	}
+}
+
+// ClearCheckpoints discards the whole undo history, e.g. when a different
+// conversation is loaded or the chat ends.
+func ClearCheckpoints() {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	for _, cp := range journal.checkpoints {
+		removeBackups(cp)
+	}
+	journal.checkpoints = nil
+	if journal.dir != "" {
+		os.Remove(journal.dir)
+		journal.dir = ""
+	}
+}
+
+// recordWrite backs up a file before it is first written after the latest
+// checkpoint. Writes before the first checkpoint are not journaled.
+func recordWrite(resolved string, original []byte, existed bool) error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if len(journal.checkpoints) == 0 {
+		return nil
+	}
+	cp := journal.checkpoints[len(journal.checkpoints)-1]
+	for _, b := range cp.backups {
+		if b.path == resolved {
+			return nil
+		}
+	}
+	b := fileBackup{path: resolved, existed: existed}
+	if existed {
+		if journal.dir == "" {
+			state, err := EnsureStateDir()
+			if err != nil {
+				return err
+			}
+			journal.dir = filepath.Join(state, "undo", time.Now().Format("20060102-150405")+"-"+strconv.Itoa(os.Getpid()))
+			if err := os.MkdirAll(journal.dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create undo directory: %v", err)
+			}
+		}
+		journal.seq++
+		b.backup = filepath.Join(journal.dir, strconv.Itoa(journal.seq)+".bak")
+		if err := os.WriteFile(b.backup, original, 0o600); err != nil {
+			return fmt.Errorf("failed to back up %s: %v", displayPath(resolved), err)
+		}
+	}
+	cp.backups = append(cp.backups, b)
+	return nil
+}
+
+func restoreBackup(b fileBackup) error {
+	if !b.existed {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", displayPath(b.path), pathError(err))
+		}
+		return nil
+	}
+	data, err := os.ReadFile(b.backup)
+	if err != nil {
+		return fmt.Errorf("failed to read the backup of %s: %v", displayPath(b.path), err)
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(b.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(b.path, data, mode); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", displayPath(b.path), pathError(err))
+	}
+	return nil
+}
+
+func removeBackups(cp *checkpoint) {
+	for _, b := range cp.backups {
+		if b.backup != "" {
+			os.Remove(b.backup)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ListConfig caps the output of list_files so a single call cannot fill the
+// model's context window.
+type ListConfig struct {
+	MaxEntries int `yaml:"max_entries"`
+	MaxBytes   int `yaml:"max_bytes"`
+}
+
+// ListSettings is used by list_files. The CLI overrides it from the config file.
+var ListSettings = ListConfig{MaxEntries: 500, MaxBytes: 16 * 1024}
+
+// FileList is the result of list_files. Truncated is set when entries were
+// left out because of the configured limits.
+type FileList struct {
+	Files     []string        `json:"files"`
+	Truncated *ListTruncation `json:"truncated,omitempty"`
+}
+
+// ListTruncation tells the model how much was left out and how to narrow
+// the next call.
+type ListTruncation struct {
+	Omitted    int    `json:"omitted"`
+	Reason     string `json:"reason"`
+	Suggestion string `json:"suggestion"`
+}
+
+// listFilesInput is the input of list_files.
+type listFilesInput struct {
+	Path string `json:"path,omitempty" description:"directory to list; defaults to the workspace root"`
+	Glob string `json:"glob,omitempty" description:"only list files whose name matches, e.g. *.go"`
+}
+
+func listFiles(ctx context.Context, input listFilesInput) (interface{}, error) {
+	path := input.Path
+	if path == "" {
+		path = "."
+	}
+	glob := input.Glob
+	if glob != "" {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", glob, err)
+		}
+	}
+
+	resolved, err := resolveWorkspacePath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", displayPath(resolved), pathError(err))
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", displayPath(resolved))
+	}
+
+	limits := ListSettings
+	result := FileList{Files: []string{}}
+	size, omitted, reason := 0, 0, ""
+	err = filepath.WalkDir(resolved, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil // skip unreadable entries
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || (p != resolved && isStatePath(displayPath(p))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel := displayPath(p)
+		if glob != "" && !matchGlob(glob, rel) {
+			return nil
+		}
+		switch {
+		case reason != "":
+			omitted++
+		case limits.MaxEntries > 0 && len(result.Files) >= limits.MaxEntries:
+			reason = fmt.Sprintf("more than %d entries", limits.MaxEntries)
+			omitted++
+		case limits.MaxBytes > 0 && size+len(rel)+3 > limits.MaxBytes:
+			reason = fmt.Sprintf("output would exceed %d bytes", limits.MaxBytes)
+			omitted++
+		default:
+			result.Files = append(result.Files, rel)
+			size += len(rel) + 3 // quotes and separator in the JSON array
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", displayPath(resolved), pathError(err))
+	}
+	if omitted > 0 {
+		result.Truncated = &ListTruncation{
+			Omitted:    omitted,
+			Reason:     reason,
+			Suggestion: "list a subdirectory with \"path\" or filter with \"glob\", e.g. \"*.go\"",
+		}
+	}
+	return result, nil
+}
+
+// matchGlob matches a glob against the base name, or against the whole
+// relative path when the glob contains a slash.
+func matchGlob(glob, rel string) bool {
+	if strings.Contains(glob, "/") {
+		ok, _ := filepath.Match(glob, rel)
+		return ok
+	}
+	ok, _ := filepath.Match(glob, filepath.Base(rel))
+	return ok
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// EditProposals switches edit_file into proposal mode: instead of writing
+// files, each change is written to it as an LSP "workspace/applyEdit"
+// request, one JSON object per line, for an editor to apply. nil means
+// edits are written to disk.
+var EditProposals io.Writer
+
+// proposedContent holds the proposed content of files, keyed by resolved
+// path, so later reads and edits in the session see earlier proposals.
+var proposedContent = map[string]string{}
+
+// Position is a zero-based LSP position; Character counts UTF-16 code units.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is an LSP range with an exclusive end.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextEdit replaces the text in Range with NewText.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// TextDocumentIdentifier names a document; a nil Version means any version.
+type TextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
+
+// TextDocumentEdit is a list of edits to one document.
+type TextDocumentEdit struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit             `json:"edits"`
+}
+
+// CreateFile is the LSP resource operation that creates a new file.
+type CreateFile struct {
+	Kind string `json:"kind"`
+	URI  string `json:"uri"`
+}
+
+// WorkspaceEdit holds document changes in the order they must be applied.
+// Each entry is a CreateFile or a TextDocumentEdit.
+type WorkspaceEdit struct {
+	DocumentChanges []interface{} `json:"documentChanges"`
+}
+
+// ApplyWorkspaceEditRequest is the "workspace/applyEdit" message written to
+// EditProposals.
+type ApplyWorkspaceEditRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  struct {
+		Label string        `json:"label"`
+		Edit  WorkspaceEdit `json:"edit"`
+	} `json:"params"`
+}
+
+// NewWorkspaceEdit converts a change from old to new content of the file at
+// the absolute path into a WorkspaceEdit with a single minimal text edit.
+// A new file is created first when created is true.
+func NewWorkspaceEdit(path, oldContent, newContent string, created bool) WorkspaceEdit {
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	var edit WorkspaceEdit
+	if created {
+		edit.DocumentChanges = append(edit.DocumentChanges, CreateFile{Kind: "create", URI: uri})
+	}
+	edit.DocumentChanges = append(edit.DocumentChanges, TextDocumentEdit{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Edits:        []TextEdit{lineTextEdit(oldContent, newContent)},
+	})
+	return edit
+}
+
+// lineTextEdit replaces the lines between the common leading and trailing
+// lines of both versions.
+func lineTextEdit(oldContent, newContent string) TextEdit {
+	oldLines := strings.SplitAfter(oldContent, "\n")
+	newLines := strings.SplitAfter(newContent, "\n")
+
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	end := Position{Line: len(oldLines) - suffix}
+	if suffix == 0 {
+		// The change runs to the end of the file, which is the end of the
+		// last line (empty when the file ends with a newline).
+		last := oldLines[len(oldLines)-1]
+		end = Position{Line: len(oldLines) - 1, Character: len(utf16.Encode([]rune(last)))}
+	}
+	return TextEdit{
+		Range:   Range{Start: Position{Line: prefix}, End: end},
+		NewText: strings.Join(newLines[prefix:len(newLines)-suffix], ""),
+	}
+}
+
+// proposeEdit writes a change to EditProposals and remembers the proposed
+// content.
+func proposeEdit(resolved, oldContent, newContent string, created bool) error {
+	var req ApplyWorkspaceEditRequest
+	req.JSONRPC = "2.0"
+	req.Method = "workspace/applyEdit"
+	req.Params.Label = "edit " + displayPath(resolved)
+	req.Params.Edit = NewWorkspaceEdit(resolved, oldContent, newContent, created)
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode workspace edit: %v", err)
+	}
+	if _, err := EditProposals.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write workspace edit: %v", err)
+	}
+	proposedContent[resolved] = newContent
+	return nil
+}
@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// MacroStep is one tool call in a macro tool. String argument values are
+// templates rendered with the macro's arguments, the outputs of earlier
+// steps and, in a for_each step, the current item.
+type MacroStep struct {
+	Name            string                 `yaml:"name"` // key of the output in .steps
+	Tool            string                 `yaml:"tool"`
+	Args            map[string]interface{} `yaml:"args"`
+	ForEach         string                 `yaml:"for_each"`          // template rendering one item per line
+	ContinueOnError bool                   `yaml:"continue_on_error"` // record the error as the step's output
+}
+
+// MacroTool is a tool declared in the config that runs a fixed sequence of
+// other tools, so a common multi-step operation costs the model one call.
+type MacroTool struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Args        []CommandArg `yaml:"args"`
+	Steps       []MacroStep  `yaml:"steps"`
+}
+
+// maxMacroDepth stops macros that call each other from recursing forever.
+const maxMacroDepth = 4
+
+// macroDepth is the number of macros currently running; tools run one at
+// a time.
+var macroDepth int
+
+// macroFuncs are available in macro templates.
+var macroFuncs = template.FuncMap{
+	"lines": nonEmptyLines,
+	// match returns the distinct matches of a regular expression in text,
+	// or of its first group when it has one.
+	"match": func(pattern, text string) ([]string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var matches []string
+		seen := map[string]bool{}
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			s := m[0]
+			if len(m) > 1 {
+				s = m[1]
+			}
+			if !seen[s] {
+				seen[s] = true
+				matches = append(matches, s)
+			}
+		}
+		return matches, nil
+	},
+}
+
+// nonEmptyLines splits text into its non-empty, trimmed lines.
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// macroStep is a MacroStep with its templates parsed.
+type macroStep struct {
+	MacroStep
+	args    map[string]*template.Template
+	forEach *template.Template
+}
+
+// Definition validates the macro tool and converts it into a Tool.
+func (m MacroTool) Definition() (Tool, error) {
+	if m.Name == "" {
+		return nil, fmt.Errorf("macro tool is missing a name")
+	}
+	if len(m.Steps) == 0 {
+		return nil, fmt.Errorf("macro tool %s has no steps", m.Name)
+	}
+	for _, arg := range m.Args {
+		if arg.Name == "steps" || arg.Name == "prev" || arg.Name == "item" {
+			return nil, fmt.Errorf("macro tool %s: argument name %q is reserved", m.Name, arg.Name)
+		}
+	}
+	steps := make([]macroStep, len(m.Steps))
+	for i, step := range m.Steps {
+		switch step.Tool {
+		case "":
+			return nil, fmt.Errorf("step %d of macro tool %s is missing a tool", i+1, m.Name)
+		case m.Name:
+			return nil, fmt.Errorf("macro tool %s calls itself", m.Name)
+		}
+		steps[i] = macroStep{MacroStep: step, args: map[string]*template.Template{}}
+		for name, value := range step.Args {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			tmpl, err := parseMacroTemplate(m.Name, text)
+			if err != nil {
+				return nil, err
+			}
+			steps[i].args[name] = tmpl
+		}
+		if step.ForEach != "" {
+			tmpl, err := parseMacroTemplate(m.Name, step.ForEach)
+			if err != nil {
+				return nil, err
+			}
+			steps[i].forEach = tmpl
+		}
+	}
+
+	command := CommandTool{Name: m.Name, Description: m.Description, Args: m.Args}
+	return newTool(m.Name, command.describe(), func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return m.run(ctx, steps, args)
+	}, WithSummary(m.Description), WithSchema(argsSchema(m.Args))), nil
+}
+
+func parseMacroTemplate(macro, text string) (*template.Template, error) {
+	tmpl, err := template.New(macro).Option("missingkey=zero").Funcs(macroFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template in macro tool %s: %v", macro, err)
+	}
+	return tmpl, nil
+}
+
+// run executes the steps in order and returns their outputs, each under a
+// header naming the call.
+func (m MacroTool) run(ctx context.Context, steps []macroStep, args map[string]interface{}) (interface{}, error) {
+	if macroDepth >= maxMacroDepth {
+		return nil, fmt.Errorf("macro tool %s: macros nested more than %d deep", m.Name, maxMacroDepth)
+	}
+	macroDepth++
+	defer func() { macroDepth-- }()
+
+	data := map[string]interface{}{}
+	for _, arg := range m.Args {
+		value, ok := args[arg.Name]
+		if !ok || value == nil {
+			if arg.Required {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidToolArgs, arg.Name)
+			}
+			value = ""
+		}
+		data[arg.Name] = fmt.Sprintf("%v", value)
+	}
+	outputs := map[string]string{}
+	data["steps"], data["prev"], data["item"] = outputs, "", ""
+
+	var report strings.Builder
+	for i, step := range steps {
+		items := []string{""}
+		if step.forEach != nil {
+			rendered, err := render(step.forEach, data)
+			if err != nil {
+				return nil, fmt.Errorf("macro tool %s, step %d: %v", m.Name, i+1, err)
+			}
+			items = nonEmptyLines(rendered)
+		}
+
+		var stepOutput strings.Builder
+		for _, item := range items {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("macro tool %s stopped at step %d: %w", m.Name, i+1, err)
+			}
+			data["item"] = item
+			callArgs, err := step.render(data)
+			if err != nil {
+				return nil, fmt.Errorf("macro tool %s, step %d: %v", m.Name, i+1, err)
+			}
+			encoded, _ := json.Marshal(callArgs)
+			fmt.Fprintf(&report, "--- %s ---\n", FormatToolCall(GrammarText, step.Tool, string(encoded)))
+			output, err := ExecuteTool(ctx, step.Tool, callArgs)
+			if err != nil {
+				if !step.ContinueOnError {
+					return nil, fmt.Errorf("macro tool %s, step %d (%s): %v\n\nOutput so far:\n%s", m.Name, i+1, step.Tool, err, report.String())
+				}
+				output = "error: " + err.Error()
+			}
+			text := strings.TrimRight(fmt.Sprintf("%v", output), "\n")
+			fmt.Fprintf(&report, "%s\n\n", text)
+			stepOutput.WriteString(text + "\n")
+		}
+		data["prev"] = stepOutput.String()
+		if step.Name != "" {
+			outputs[step.Name] = stepOutput.String()
+		}
+	}
+	return strings.TrimRight(report.String(), "\n"), nil
+}
+
+// render returns the step's arguments with their templates rendered.
+func (s macroStep) render(data map[string]interface{}) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	for name, value := range s.Args {
+		if tmpl, ok := s.args[name]; ok {
+			rendered, err := render(tmpl, data)
+			if err != nil {
+				return nil, err
+			}
+			value = rendered
+		}
+		args[name] = value
+	}
+	return args, nil
+}
+
+func render(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
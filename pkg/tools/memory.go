@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MemoryConfig configures long-term memory. Path is a markdown file with one
+// "- " bullet per memory, so it can also be edited by hand. MaxInjected is
+// the number of memories added to the system prompt for each user message.
+type MemoryConfig struct {
+	Path        string `yaml:"path"`
+	MaxInjected int    `yaml:"max_injected"`
+}
+
+// MemorySettings is used by the remember and recall tools. The CLI sets the
+// path; an empty path disables memory.
+var MemorySettings = MemoryConfig{MaxInjected: 5}
+
+// loadMemories reads the memory file. A missing file holds no memories.
+func loadMemories(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memories: %v", err)
+	}
+	defer f.Close()
+
+	var memories []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if note, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "- "); ok && note != "" {
+			memories = append(memories, note)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read memories: %v", err)
+	}
+	return memories, nil
+}
+
+// Remember appends a note to the memory file. Notes already remembered are
+// not added again.
+func Remember(note string) error {
+	path := MemorySettings.Path
+	if path == "" {
+		return fmt.Errorf("long-term memory is not configured")
+	}
+	note = strings.Join(strings.Fields(note), " ")
+	if note == "" {
+		return fmt.Errorf("nothing to remember")
+	}
+	memories, err := loadMemories(path)
+	if err != nil {
+		return err
+	}
+	for _, m := range memories {
+		if strings.EqualFold(m, note) {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create memory directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open memory file: %v", err)
+	}
+	defer f.Close()
+	if memories == nil {
+		if info, err := f.Stat(); err == nil && info.Size() == 0 {
+			fmt.Fprint(f, "# goclient memory\n\n")
+		}
+	}
+	if _, err := fmt.Fprintf(f, "- %s\n", note); err != nil {
+		return fmt.Errorf("failed to write memory: %v", err)
+	}
+	return nil
+}
+
+// RecallMemories returns up to limit memories that share terms with the
+// query, best match first.
+func RecallMemories(query string, limit int) ([]string, error) {
+	if MemorySettings.Path == "" {
+		return nil, fmt.Errorf("long-term memory is not configured")
+	}
+	memories, err := loadMemories(MemorySettings.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	queryTerms := tokenize(query)
+	type scored struct {
+		note  string
+		score float64
+	}
+	var matches []scored
+	for _, note := range memories {
+		score := 0.0
+		for _, term := range queryTerms {
+			best := 0.0
+			for _, candidate := range tokenize(note) {
+				if candidate == term {
+					best = 1
+					break
+				}
+				if w := fuzzyWeight(term, candidate); w > best {
+					best = w
+				}
+			}
+			score += best
+		}
+		if score > 0 {
+			matches = append(matches, scored{note, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	results := []string{}
+	for i := 0; i < len(matches) && (limit <= 0 || i < limit); i++ {
+		results = append(results, matches[i].note)
+	}
+	return results, nil
+}
+
+// MemoryPrompt returns the memories to add to the system prompt for a user
+// message: all of them while there are few, otherwise the most relevant.
+// It is empty when memory is disabled or nothing applies.
+func MemoryPrompt(message string) string {
+	limit := MemorySettings.MaxInjected
+	if MemorySettings.Path == "" || limit <= 0 {
+		return ""
+	}
+	memories, err := loadMemories(MemorySettings.Path)
+	if err != nil || len(memories) == 0 {
+		return ""
+	}
+	if len(memories) > limit {
+		if memories, err = RecallMemories(message, limit); err != nil || len(memories) == 0 {
+			return ""
+		}
+	}
+	return "Things you remember from earlier sessions:\n- " + strings.Join(memories, "\n- ")
+}
+
+// rememberInput is the input of remember.
+type rememberInput struct {
+	Note string `json:"note" description:"one self-contained sentence"`
+}
+
+func rememberTool(ctx context.Context, input rememberInput) (interface{}, error) {
+	note := input.Note
+	if strings.TrimSpace(note) == "" {
+		return nil, fmt.Errorf("%w: note must be a non-empty string", ErrInvalidToolArgs)
+	}
+	if err := Remember(note); err != nil {
+		return nil, err
+	}
+	return "remembered", nil
+}
+
+func recallTool(ctx context.Context, input queryInput) (interface{}, error) {
+	if strings.TrimSpace(input.Query) == "" {
+		return nil, fmt.Errorf("%w: query must be a non-empty string", ErrInvalidToolArgs)
+	}
+	return RecallMemories(input.Query, 10)
+}
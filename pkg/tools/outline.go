@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageOutline summarizes the exported API of one Go package.
+type PackageOutline struct {
+	Dir     string   `json:"dir"` // workspace-relative directory
+	Name    string   `json:"name"`
+	Doc     string   `json:"doc,omitempty"` // package doc comment
+	DocFile string   `json:"doc_file,omitempty"`
+	Files   []string `json:"files"`
+	Symbols []string `json:"symbols"` // exported declarations, without bodies
+}
+
+// String formats the outline as a compact listing for prompts.
+func (p PackageOutline) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s (%s)\n", p.Name, p.Dir)
+	if p.Doc != "" {
+		fmt.Fprintf(&b, "  doc: %s\n", firstLine(p.Doc))
+	}
+	fmt.Fprintf(&b, "  files: %s\n", strings.Join(p.Files, ", "))
+	for _, symbol := range p.Symbols {
+		fmt.Fprintf(&b, "  %s\n", symbol)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// OutlinePackages parses the Go packages under root, skipping test files,
+// testdata, vendor and hidden directories. Packages are sorted by directory.
+func OutlinePackages(root string) ([]PackageOutline, error) {
+	var outlines []PackageOutline
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor") {
+			return filepath.SkipDir
+		}
+		outline, ok, err := outlineDir(root, path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			outlines = append(outlines, outline)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to outline %s: %v", root, err)
+	}
+	return outlines, nil
+}
+
+// outlineDir outlines the package in dir; ok is false if it has no Go files.
+func outlineDir(root, dir string) (PackageOutline, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return PackageOutline{}, false, err
+	}
+	rel, _ := filepath.Rel(root, dir)
+	outline := PackageOutline{Dir: filepath.ToSlash(rel)}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return PackageOutline{}, false, err
+		}
+		if outline.Name == "" {
+			outline.Name = file.Name.Name
+		}
+		outline.Files = append(outline.Files, name)
+		if file.Doc != nil && outline.Doc == "" {
+			outline.Doc = strings.TrimSpace(file.Doc.Text())
+			outline.DocFile = name
+		}
+		outline.Symbols = append(outline.Symbols, exportedSymbols(fset, file)...)
+	}
+	sort.Strings(outline.Symbols)
+	return outline, len(outline.Files) > 0, nil
+}
+
+// exportedSymbols returns one-line declarations of the exported functions,
+// methods, types, constants and variables in file.
+func exportedSymbols(fset *token.FileSet, file *ast.File) []string {
+	var symbols []string
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() || (decl.Recv != nil && !exportedReceiver(decl.Recv)) {
+				continue
+			}
+			symbols = append(symbols, nodeString(fset, &ast.FuncDecl{Recv: decl.Recv, Name: decl.Name, Type: decl.Type}))
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						symbols = append(symbols, "type "+spec.Name.Name+" "+typeKind(spec))
+					}
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							symbols = append(symbols, decl.Tok.String()+" "+name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+func exportedReceiver(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	expr := recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.IsExported()
+		default:
+			return false
+		}
+	}
+}
+
+// typeKind describes a type declaration without its fields or methods.
+func typeKind(spec *ast.TypeSpec) string {
+	if spec.Assign.IsValid() {
+		return "= " + exprString(spec.Type)
+	}
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	default:
+		return exprString(spec.Type)
+	}
+}
+
+func exprString(expr ast.Expr) string {
+	return nodeString(token.NewFileSet(), expr)
+}
+
+func nodeString(fset *token.FileSet, node interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// outlineInput is the input of go_outline.
+type outlineInput struct {
+	Path string `json:"path,omitempty" description:"directory to outline; defaults to the workspace root"`
+}
+
+func outlineTool(ctx context.Context, input outlineInput) (interface{}, error) {
+	path := input.Path
+	if path == "" {
+		path = "."
+	}
+	resolved, err := resolveWorkspacePath(path)
+	if err != nil {
+		return nil, err
+	}
+	outlines, err := OutlinePackages(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if len(outlines) == 0 {
+		return fmt.Sprintf("No Go packages under %s", path), nil
+	}
+	var parts []string
+	for _, outline := range outlines {
+		outline.Dir = displayPath(filepath.Join(resolved, outline.Dir))
+		parts = append(parts, outline.String())
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
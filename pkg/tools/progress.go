@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress is an update from a long-running task such as building an index
+// or running a command. Only the final tool result is sent to the model;
+// progress is for the user.
+type Progress struct {
+	Task    string // what is running, e.g. "embedding workspace"
+	Done    int    // items completed
+	Total   int    // total items, 0 when unknown
+	Current string // the item being processed, if any
+}
+
+// Percent returns the completed percentage, or -1 when the total is unknown.
+func (p Progress) Percent() int {
+	if p.Total <= 0 {
+		return -1
+	}
+	return p.Done * 100 / p.Total
+}
+
+func (p Progress) String() string {
+	s := p.Task
+	if p.Total > 0 {
+		s += fmt.Sprintf(": %d/%d (%d%%)", p.Done, p.Total, p.Percent())
+	}
+	if p.Current != "" {
+		s += " " + p.Current
+	}
+	return s
+}
+
+// OnProgress receives progress updates. The CLI replaces it to show a status
+// line; the default discards them.
+var OnProgress = func(p Progress) {}
+
+// reportElapsed reports how long a task with no measurable progress has
+// been running, once a second. The returned function stops the reports and
+// returns once no more can be sent.
+func reportElapsed(task string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		start := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				OnProgress(Progress{Task: task, Current: fmt.Sprintf("(%ds)", int(time.Since(start).Seconds()))})
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,275 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Renderer formats a tool result for display in the terminal.
+type Renderer interface {
+	Render(result interface{}) string
+}
+
+// RendererFunc adapts a plain function to the Renderer interface.
+type RendererFunc func(result interface{}) string
+
+func (f RendererFunc) Render(result interface{}) string {
+	return f(result)
+}
+
+// Built-in renderers. Tree expects a list of paths or a FileList, Table a
+// list of objects and Diff a FileEdit; each falls back to plain output for
+// other shapes.
+var (
+	PlainRenderer Renderer = RendererFunc(renderPlain)
+	TreeRenderer  Renderer = RendererFunc(renderTree)
+	TableRenderer Renderer = RendererFunc(renderTable)
+	DiffRenderer  Renderer = RendererFunc(renderDiff)
+)
+
+// Color enables ANSI colours in rendered diffs.
+var Color = true
+
+// FileEdit is the result shape understood by DiffRenderer.
+type FileEdit struct {
+	Path     string `json:"path"`
+	Old      string `json:"old"`
+	New      string `json:"new"`
+	Proposed bool   `json:"proposed,omitempty"` // sent to EditProposals instead of written
+}
+
+// RenderToolResult formats a result using the renderer declared by the tool.
+func RenderToolResult(name string, result interface{}) string {
+	tool, ok := LookupTool(name)
+	if !ok {
+		return renderPlain(result)
+	}
+	return RendererOf(tool).Render(result)
+}
+
+// ModelResult is implemented by results whose model-facing form differs from
+// what is rendered for the user.
+type ModelResult interface {
+	ForModel() interface{}
+}
+
+// EncodeToolResult returns the compact JSON form of a result that is sent
+// back to the model.
+func EncodeToolResult(result interface{}) (string, error) {
+	if mr, ok := result.(ModelResult); ok {
+		result = mr.ForModel()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tool result: %v", err)
+	}
+	return string(data), nil
+}
+
+// convertResult re-decodes a result into the shape a renderer expects, so
+// tools can return their own types as long as they marshal compatibly.
+func convertResult(result interface{}, target interface{}) bool {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, target) == nil
+}
+
+func renderPlain(result interface{}) string {
+	if s, ok := result.(string); ok {
+		return s
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(data)
+}
+
+type treeNode struct {
+	children map[string]*treeNode
+}
+
+func renderTree(result interface{}) string {
+	var paths []string
+	var truncated *ListTruncation
+	if !convertResult(result, &paths) {
+		var list FileList
+		if !convertResult(result, &list) || list.Files == nil {
+			return renderPlain(result)
+		}
+		paths, truncated = list.Files, list.Truncated
+	}
+
+	root := &treeNode{children: map[string]*treeNode{}}
+	for _, p := range paths {
+		node := root
+		for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+			if part == "" {
+				continue
+			}
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{children: map[string]*treeNode{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(".\n")
+	writeTree(&b, root, "")
+	if truncated != nil {
+		fmt.Fprintf(&b, "... %d more not shown (%s)\n", truncated.Omitted, truncated.Reason)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func writeTree(b *strings.Builder, node *treeNode, prefix string) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		branch, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+		b.WriteString(prefix + branch + name + "\n")
+		writeTree(b, node.children[name], prefix+indent)
+	}
+}
+
+// maxCellWidth keeps table columns readable in a terminal.
+const maxCellWidth = 60
+
+func renderTable(result interface{}) string {
+	var rows []map[string]interface{}
+	if !convertResult(result, &rows) || len(rows) == 0 {
+		return renderPlain(result)
+	}
+
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(columns))
+	for i, col := range columns {
+		widths[i] = len(col)
+	}
+	for r, row := range rows {
+		cells[r] = make([]string, len(columns))
+		for i, col := range columns {
+			value := ""
+			if v, ok := row[col]; ok && v != nil {
+				value = strings.Join(strings.Fields(fmt.Sprintf("%v", v)), " ")
+			}
+			if len(value) > maxCellWidth {
+				value = value[:maxCellWidth-3] + "..."
+			}
+			cells[r][i] = value
+			if len(value) > widths[i] {
+				widths[i] = len(value)
+			}
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(values []string) {
+		for i, v := range values {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(v + strings.Repeat(" ", widths[i]-len(v)))
+		}
+		b.WriteString("\n")
+	}
+	writeRow(columns)
+	separators := make([]string, len(columns))
+	for i := range columns {
+		separators[i] = strings.Repeat("-", widths[i])
+	}
+	writeRow(separators)
+	for _, row := range cells {
+		writeRow(row)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func renderDiff(result interface{}) string {
+	var edit FileEdit
+	if !convertResult(result, &edit) || edit.Path == "" {
+		return renderPlain(result)
+	}
+
+	oldLines := diffLines(edit.Old)
+	newLines := diffLines(edit.New)
+
+	// Longest common subsequence table for a simple line diff.
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", edit.Path, edit.Path)
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			b.WriteString("  " + oldLines[i] + "\n")
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			b.WriteString(colored("\u001b[31m", "- "+oldLines[i]) + "\n")
+			i++
+		default:
+			b.WriteString(colored("\u001b[32m", "+ "+newLines[j]) + "\n")
+			j++
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// colored wraps s in an ANSI colour unless Color is off.
+func colored(color, s string) string {
+	if !Color {
+		return s
+	}
+	return color + s + "\u001b[0m"
+}
+
+// diffLines splits content into lines, ignoring the empty line after a
+// trailing newline.
+func diffLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
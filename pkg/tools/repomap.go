@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RepoMapConfig controls the repository map added to the system prompt of
+// the code agent.
+type RepoMapConfig struct {
+	Disabled bool `yaml:"disabled"`
+	MaxBytes int  `yaml:"max_bytes"`
+}
+
+// RepoMapSettings is used by RepoMap. The CLI overrides it from the config file.
+var RepoMapSettings = RepoMapConfig{MaxBytes: 8 * 1024}
+
+// repoMapFile is one file of the map with its exported Go declarations.
+type repoMapFile struct {
+	path    string
+	symbols []string
+}
+
+// RepoMap returns a compact map of the repository at root: its files grouped
+// by directory, with the exported declarations of each Go file. When the map
+// exceeds RepoMapSettings.MaxBytes the declarations are dropped, and if the
+// file list alone is still too large it is cut off with a note.
+func RepoMap(root string) (string, error) {
+	var files []repoMapFile
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable entries
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		file := repoMapFile{path: filepath.ToSlash(rel)}
+		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			// Files that do not parse are still listed, just without symbols.
+			if parsed, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution); err == nil {
+				file.symbols = exportedSymbols(fset, parsed)
+			}
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to map %s: %v", root, err)
+	}
+
+	// Group files by directory, root files first.
+	sort.SliceStable(files, func(i, j int) bool {
+		return filepath.Dir(files[i].path) < filepath.Dir(files[j].path)
+	})
+
+	limit := RepoMapSettings.MaxBytes
+	repoMap := renderRepoMap(files, true, limit)
+	if limit > 0 && len(repoMap) > limit {
+		repoMap = renderRepoMap(files, false, limit)
+	}
+	return repoMap, nil
+}
+
+// renderRepoMap lists files under their directory, indenting declarations
+// below each file. Files beyond limit bytes are counted but not listed.
+func renderRepoMap(files []repoMapFile, symbols bool, limit int) string {
+	var b strings.Builder
+	dir, omitted := "", 0
+	for _, file := range files {
+		var entry strings.Builder
+		fileDir, name := ".", file.path
+		if i := strings.LastIndex(file.path, "/"); i >= 0 {
+			fileDir, name = file.path[:i], file.path[i+1:]
+		}
+		if fileDir != dir {
+			entry.WriteString(fileDir + "/\n")
+		}
+		fmt.Fprintf(&entry, "  %s\n", name)
+		if symbols {
+			for _, symbol := range file.symbols {
+				fmt.Fprintf(&entry, "    %s\n", symbol)
+			}
+		}
+		if omitted > 0 || (limit > 0 && b.Len()+entry.Len() > limit) {
+			omitted++
+			continue
+		}
+		dir = fileDir
+		b.WriteString(entry.String())
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "... %d more files not shown\n", omitted)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// permissiveSchema accepts any object. It is used when a schema cannot be
+// reflected, so the model is not told that a tool takes no arguments.
+func permissiveSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "additionalProperties": true}
+}
+
+// reflectInputSchema builds a JSON schema for a tool's input struct. Field
+// names follow the json tag and a "description" tag documents the field.
+// Types that cannot be described, and structs without exported fields, are
+// reported as errors; so are panics from reflection.
+func reflectInputSchema(input interface{}) (schema map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			schema, err = nil, fmt.Errorf("schema reflection panicked: %v", r)
+		}
+	}()
+
+	t := reflect.TypeOf(input)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("input type %v is not a struct", t)
+	}
+	schema, err = typeSchema(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	if props, _ := schema["properties"].(map[string]interface{}); len(props) == 0 {
+		return nil, fmt.Errorf("input type %v has no exported fields", t)
+	}
+	return schema, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}, nil // []byte is base64 in JSON
+		}
+		items, err := typeSchema(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key type %v is not a string", t.Key())
+		}
+		values, err := typeSchema(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t, seen)
+	default:
+		return nil, fmt.Errorf("cannot describe %v values in a schema", t)
+	}
+}
+
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	if seen[t] {
+		return nil, fmt.Errorf("recursive type %v", t)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop, err := typeSchema(field.Type, seen)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", field.Name, err)
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		properties[name] = prop
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLConfig configures the sql_query tool. Driver is "sqlite" or "postgres".
+type SQLConfig struct {
+	Driver     string `yaml:"driver"`
+	DSN        string `yaml:"dsn"`
+	AllowWrite bool   `yaml:"allow_write"` // run writes without asking for approval
+	MaxRows    int    `yaml:"max_rows"`
+}
+
+// defaultSQLMaxRows limits the rows returned when MaxRows is not set.
+const defaultSQLMaxRows = 100
+
+// NewSQLTool opens the configured database and returns the sql_query tool.
+func NewSQLTool(cfg SQLConfig) (Tool, error) {
+	switch cfg.Driver {
+	case "sqlite", "postgres":
+	default:
+		return nil, fmt.Errorf("unsupported sql driver: %q (use sqlite or postgres)", cfg.Driver)
+	}
+	if cfg.Driver == "sqlite" && isSQLiteMemory(cfg.DSN) {
+		return nil, fmt.Errorf("sql_query needs a SQLite database file: an in-memory database (%s) starts empty on every connection", cfg.DSN)
+	}
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %v", cfg.Driver, err)
+	}
+	// Queries first run where the database itself refuses writes: a
+	// read-only SQLite connection, or a read-only Postgres transaction.
+	readOnly := db
+	if cfg.Driver == "sqlite" {
+		if readOnly, err = sql.Open("sqlite", sqliteReadOnlyDSN(cfg.DSN)); err != nil {
+			return nil, fmt.Errorf("failed to open %s database: %v", cfg.Driver, err)
+		}
+	}
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = defaultSQLMaxRows
+	}
+
+	description := fmt.Sprintf(`Run a SQL query against the configured %s database and return the result as a markdown table. `+
+		`Queries that modify data require user approval. Arguments: {"query": "SELECT ..."}`, cfg.Driver)
+	return newTool("sql_query", description, func(ctx context.Context, input sqlQueryInput) (interface{}, error) {
+		return runSQLQuery(ctx, db, readOnly, cfg, input.Query)
+	},
+		WithSummary(fmt.Sprintf("Run a SQL query against the %s database.", cfg.Driver)),
+		WithExamples(`{"query": "SELECT * FROM users LIMIT 10"}`),
+		withApproval()), nil
+}
+
+// sqlQueryInput is the input of sql_query.
+type sqlQueryInput struct {
+	Query string `json:"query" description:"the SQL statement to run"`
+}
+
+// runSQLQuery runs the query read-only and, only if the database refuses
+// it as a write, asks for approval and runs it on db.
+func runSQLQuery(ctx context.Context, db, readOnly *sql.DB, cfg SQLConfig, query string) (interface{}, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query must be a non-empty string", ErrInvalidToolArgs)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	table, err := readSQLQuery(ctx, readOnly, cfg, query)
+	if err == nil {
+		return table, nil
+	}
+	if !isSQLWriteError(err) {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	if !cfg.AllowWrite && !Confirm(ctx, fmt.Sprintf("Run SQL statement that may modify data?\n%s", query)) {
+		return nil, fmt.Errorf("%w: the statement was not run", ErrNotApproved)
+	}
+	res, err := db.ExecContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	affected, _ := res.RowsAffected()
+	return fmt.Sprintf("OK, %d rows affected", affected), nil
+}
+
+// readSQLQuery runs the query in a read-only transaction. It is prepared
+// first, so Postgres takes a single statement: "COMMIT; DELETE ..." cannot
+// leave the transaction.
+func readSQLQuery(ctx context.Context, readOnly *sql.DB, cfg SQLConfig, query string) (string, error) {
+	tx, err := readOnly.BeginTx(ctx, &sql.TxOptions{ReadOnly: cfg.Driver == "postgres"})
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	return markdownTable(rows, cfg.MaxRows)
+}
+
+// sqliteReadOnlyDSN returns the DSN opened with mode=ro, so SQLite refuses
+// every write on the connection, whatever the statement.
+func sqliteReadOnlyDSN(dsn string) string {
+	path, params, _ := strings.Cut(dsn, "?")
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + strings.NewReplacer("%", "%25", "#", "%23").Replace(path)
+	}
+	if params != "" {
+		params += "&"
+	}
+	return path + "?" + params + "mode=ro"
+}
+
+// isSQLiteMemory reports whether the DSN names an in-memory database, which
+// the read-only connection could not share.
+func isSQLiteMemory(dsn string) bool {
+	path, params, _ := strings.Cut(dsn, "?")
+	path = strings.TrimPrefix(path, "file:")
+	return path == "" || path == ":memory:" || strings.Contains("&"+params+"&", "&mode=memory&")
+}
+
+// isSQLWriteError reports whether the database refused a statement because
+// it was read-only: it writes, or, for Postgres, it is several statements.
+// A SQLite database that does not exist yet can only be created by a write.
+func isSQLWriteError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_READONLY || code == sqlite3.SQLITE_CANTOPEN
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "25006" || strings.Contains(pqErr.Message, "multiple commands")
+	}
+	return false
+}
+
+func markdownTable(rows *sql.Rows, maxRows int) (string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", fmt.Errorf("failed to read columns: %v", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	count := 0
+	for rows.Next() {
+		if count == maxRows {
+			fmt.Fprintf(&b, "\n(truncated after %d rows)", maxRows)
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return "", fmt.Errorf("failed to read row: %v", err)
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				cells[i] = "NULL"
+			case []byte:
+				cells[i] = string(v)
+			default:
+				cells[i] = fmt.Sprintf("%v", v)
+			}
+			cells[i] = strings.ReplaceAll(strings.ReplaceAll(cells[i], "|", `\|`), "\n", " ")
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read rows: %v", err)
+	}
+	if count == 0 {
+		b.WriteString("\n(no rows)")
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
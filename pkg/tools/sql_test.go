@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		approve   bool
+		want      string
+		wantErr   error
+		wantAsked bool
+		wantRows  int // rows left in the table
+	}{
+		{
+			name:     "select runs without approval",
+			query:    "SELECT name FROM users ORDER BY id",
+			want:     "| name |\n| --- |\n| ada |\n| bob |",
+			wantRows: 2,
+		},
+		{
+			name:      "insert is refused without approval",
+			query:     "INSERT INTO users (name) VALUES ('eve')",
+			wantErr:   ErrNotApproved,
+			wantAsked: true,
+			wantRows:  2,
+		},
+		{
+			name:      "insert runs once approved",
+			query:     "INSERT INTO users (name) VALUES ('eve')",
+			approve:   true,
+			want:      "OK, 1 rows affected",
+			wantAsked: true,
+			wantRows:  3,
+		},
+		{
+			name:      "a write after a select still asks",
+			query:     "SELECT 1; DELETE FROM users",
+			wantErr:   ErrNotApproved,
+			wantAsked: true,
+			wantRows:  2,
+		},
+		{
+			name:      "a write in a CTE still asks",
+			query:     "WITH x AS (SELECT 1) DELETE FROM users",
+			wantErr:   ErrNotApproved,
+			wantAsked: true,
+			wantRows:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := filepath.Join(t.TempDir(), "test.db")
+			db, err := sql.Open("sqlite", dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO users (name) VALUES ('ada'), ('bob')"); err != nil {
+				t.Fatal(err)
+			}
+			tool, err := NewSQLTool(SQLConfig{Driver: "sqlite", DSN: dsn})
+			if err != nil {
+				t.Fatal(err)
+			}
+			asked := false
+			ctx := WithApprover(context.Background(), func(action string) bool {
+				asked = true
+				return tt.approve
+			})
+			input, _ := json.Marshal(sqlQueryInput{Query: tt.query})
+
+			result, err := tool.Call(ctx, input)
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("error = %v", err)
+			case tt.wantErr == nil && fmt.Sprint(result) != tt.want:
+				t.Errorf("result = %q, want %q", result, tt.want)
+			}
+			if asked != tt.wantAsked {
+				t.Errorf("approval asked = %v, want %v", asked, tt.wantAsked)
+			}
+			var rows int
+			if err := db.QueryRow("SELECT count(*) FROM users").Scan(&rows); err != nil {
+				t.Fatal(err)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("users has %d rows, want %d", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestSQLToolRejectsMemoryDatabase(t *testing.T) {
+	for _, dsn := range []string{":memory:", "file::memory:?cache=shared", "file:test.db?mode=memory"} {
+		if _, err := NewSQLTool(SQLConfig{Driver: "sqlite", DSN: dsn}); err == nil || !strings.Contains(err.Error(), "in-memory") {
+			t.Errorf("NewSQLTool(%q) error = %v, want an in-memory database error", dsn, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// StateDir is the directory in the workspace root where goclient keeps its
+// per-workspace state, such as undo backups and artifacts. The file tools
+// cannot read, list or edit it, so the model never works on its own
+// bookkeeping.
+const StateDir = ".goclient"
+
+var stateDirOnce sync.Once
+
+// isStatePath reports whether a workspace-relative path is inside StateDir.
+func isStatePath(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	return rel == StateDir || strings.HasPrefix(rel, StateDir+"/")
+}
+
+// EnsureStateDir creates StateDir in the workspace root and returns its path.
+// The first time in a git repository that does not already ignore it, the
+// user is asked to add it to .gitignore; if they decline, the directory
+// ignores itself with its own .gitignore instead.
+func EnsureStateDir() (string, error) {
+	root, err := workspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, StateDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", StateDir, err)
+	}
+	stateDirOnce.Do(func() {
+		if err := ignoreStateDir(root); err != nil {
+			Warn(err.Error())
+		}
+	})
+	return dir, nil
+}
+
+// ignoreStateDir keeps StateDir out of git.
+func ignoreStateDir(root string) error {
+	if exec.Command("git", "-C", root, "rev-parse", "--is-inside-work-tree").Run() != nil {
+		return nil // not a git repository
+	}
+	if exec.Command("git", "-C", root, "check-ignore", "-q", StateDir+"/").Run() == nil {
+		return nil // already ignored
+	}
+	if Approve(fmt.Sprintf("Add %s/ (goclient state) to .gitignore?", StateDir)) {
+		path := filepath.Join(root, ".gitignore")
+		existing, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read .gitignore: %v", err)
+		}
+		entry := StateDir + "/\n"
+		if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+			entry = "\n" + entry
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to update .gitignore: %v", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(entry); err != nil {
+			return fmt.Errorf("failed to update .gitignore: %v", err)
+		}
+		return nil
+	}
+	// A .gitignore of "*" inside the directory ignores the directory itself.
+	if err := os.WriteFile(filepath.Join(root, StateDir, ".gitignore"), []byte("*\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s/.gitignore: %v", StateDir, err)
+	}
+	return nil
+}
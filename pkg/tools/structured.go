@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// structuredEnvelope is a reply in the structured grammar: the whole reply
+// is one JSON object, either a tool call or the answer.
+type structuredEnvelope struct {
+	Action string                 `json:"action"` // "tool" or "answer"
+	Tool   string                 `json:"tool,omitempty"`
+	Args   map[string]interface{} `json:"args,omitempty"`
+	Answer string                 `json:"answer,omitempty"`
+}
+
+// StructuredFormat returns the JSON schema of a structured reply, for
+// Ollama's format parameter, which constrains the model to it. Tool names
+// are limited to the available tools.
+func StructuredFormat(available []Tool) json.RawMessage {
+	names := []string{}
+	for _, tool := range available {
+		names = append(names, tool.Name())
+	}
+	enum, _ := json.Marshal(names)
+	// Written out rather than marshalled from a map, to keep "action" first:
+	// the model decides what to do before it writes anything else.
+	return json.RawMessage(`{"type":"object","properties":{` +
+		`"action":{"type":"string","enum":["tool","answer"]},` +
+		`"tool":{"type":"string","enum":` + string(enum) + `},` +
+		`"args":{"type":"object"},` +
+		`"answer":{"type":"string"}},` +
+		`"required":["action"]}`)
+}
+
+// extractStructuredCall parses a structured reply. Replies are turned into
+// text-grammar calls as they stream (see StructuredStream), so a tool: line
+// is accepted as well.
+func extractStructuredCall(response string) []Call {
+	var envelope structuredEnvelope
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response)), &envelope); err == nil {
+		if envelope.Action != "tool" || envelope.Tool == "" {
+			return nil
+		}
+		if envelope.Args == nil {
+			envelope.Args = map[string]interface{}{}
+		}
+		return []Call{{Name: envelope.Tool, Args: envelope.Args}}
+	}
+	return ExtractCalls(response, GrammarText)
+}
+
+// answerStart matches the start of the answer string in a structured reply.
+var answerStart = regexp.MustCompile(`"answer"\s*:\s*"`)
+
+// StructuredStream turns a structured reply into what the other grammars
+// produce as it streams: the text of an answer, decoded from its JSON
+// string as it arrives, or a tool: line once a tool call is complete. That
+// way replies are shown, stored and searched for calls as usual.
+type StructuredStream struct {
+	raw     strings.Builder
+	answer  int // offset of the answer text in raw, or 0 before it is found
+	decoded int // offset in raw up to which the answer has been decoded
+	done    bool
+	emitted strings.Builder
+}
+
+// Write adds part of the reply and returns the answer text it completes.
+func (s *StructuredStream) Write(part string) string {
+	s.raw.WriteString(part)
+	raw := s.raw.String()
+	if s.answer == 0 {
+		loc := answerStart.FindStringIndex(raw)
+		if loc == nil {
+			return ""
+		}
+		s.answer, s.decoded = loc[1], loc[1]
+	}
+	if s.done {
+		return ""
+	}
+	var text strings.Builder
+	i := s.decoded
+	for i < len(raw) {
+		c := raw[i]
+		if c == '"' {
+			s.done = true
+			i++
+			break
+		}
+		if c != '\\' {
+			_, size := utf8.DecodeRuneInString(raw[i:])
+			if !utf8.FullRuneInString(raw[i:]) {
+				break
+			}
+			text.WriteString(raw[i : i+size])
+			i += size
+			continue
+		}
+		// An escape: decode it once it is complete.
+		n := 2
+		if i+1 < len(raw) && raw[i+1] == 'u' {
+			n = 6
+		}
+		if i+n > len(raw) {
+			break
+		}
+		r, err := strconv.Unquote(`"` + raw[i:i+n] + `"`)
+		if err != nil {
+			r = raw[i : i+n]
+		}
+		text.WriteString(r)
+		i += n
+	}
+	s.decoded = i
+	s.emitted.WriteString(text.String())
+	return text.String()
+}
+
+// Close returns the rest of the reply once it is complete: a tool: line
+// for a tool call, the part of the answer not yet returned by Write (a
+// surrogate pair split across escapes, say), or, when the reply is not a
+// structured reply at all, the reply as it is.
+func (s *StructuredStream) Close() string {
+	var envelope structuredEnvelope
+	if err := json.Unmarshal([]byte(strings.TrimSpace(s.raw.String())), &envelope); err != nil {
+		if s.emitted.Len() > 0 {
+			return ""
+		}
+		return s.raw.String()
+	}
+	if envelope.Action == "tool" && envelope.Tool != "" {
+		args, _ := json.Marshal(envelope.Args)
+		if envelope.Args == nil {
+			args = []byte("{}")
+		}
+		call := FormatToolCall(GrammarText, envelope.Tool, string(args))
+		if s.emitted.Len() > 0 {
+			call = "\n" + call
+		}
+		return call
+	}
+	if rest, ok := strings.CutPrefix(envelope.Answer, s.emitted.String()); ok {
+		return rest
+	}
+	return "\n" + envelope.Answer
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Tool is a tool the model can call. NewTool builds one from a function
+// taking a typed input.
+type Tool interface {
+	Name() string
+	Description() string
+	// Schema is the JSON schema of the input, or nil if the tool does not
+	// declare one.
+	Schema() map[string]interface{}
+	// Call runs the tool on its input, a JSON object. The result is sent to
+	// the model as compact JSON and shown in the terminal by the tool's
+	// Renderer.
+	Call(ctx context.Context, input json.RawMessage) (interface{}, error)
+}
+
+// A tool may also implement these to add to what the model and the user see.
+type (
+	// summarized tools give a one-line summary for the system prompt.
+	summarized interface{ Summary() string }
+	// exemplified tools give example inputs for describe_tools.
+	exemplified interface{ Examples() []string }
+	// rendered tools choose how their result is shown in the terminal.
+	rendered interface{ Renderer() Renderer }
+	// approving tools ask for approval themselves, with Confirm, before
+	// they change anything.
+	approving interface{ AsksApproval() bool }
+	// readOnly tools only read the workspace and goclient's own state, and
+	// send nothing off the machine.
+	readOnly interface{ ReadOnly() bool }
+)
+
+// Synopsis returns the tool's one-line summary, which defaults to the first
+// sentence of its description.
+func Synopsis(tool Tool) string {
+	if s, ok := tool.(summarized); ok && s.Summary() != "" {
+		return s.Summary()
+	}
+	description := tool.Description()
+	if i := strings.Index(description, ". "); i >= 0 {
+		return description[:i+1]
+	}
+	return description
+}
+
+// Examples returns the tool's example inputs.
+func Examples(tool Tool) []string {
+	if e, ok := tool.(exemplified); ok {
+		return e.Examples()
+	}
+	return nil
+}
+
+// RendererOf returns the tool's renderer, PlainRenderer by default.
+func RendererOf(tool Tool) Renderer {
+	if r, ok := tool.(rendered); ok && r.Renderer() != nil {
+		return r.Renderer()
+	}
+	return PlainRenderer
+}
+
+// AsksApproval reports whether the tool asks for approval itself before it
+// changes anything, so callers need not ask before running it.
+func AsksApproval(tool Tool) bool {
+	a, ok := tool.(approving)
+	return ok && a.AsksApproval()
+}
+
+// ReadOnly reports whether the tool only reads the workspace and sends
+// nothing off the machine, so callers may run it without approval.
+func ReadOnly(tool Tool) bool {
+	r, ok := tool.(readOnly)
+	return ok && r.ReadOnly()
+}
+
+// ToolOption sets optional details of a tool built by NewTool.
+type ToolOption func(*funcTool)
+
+// WithSummary sets the one-line summary listed in the system prompt.
+func WithSummary(summary string) ToolOption {
+	return func(t *funcTool) { t.summary = summary }
+}
+
+// WithExamples sets example inputs, as JSON objects, shown by describe_tools.
+func WithExamples(examples ...string) ToolOption {
+	return func(t *funcTool) { t.examples = examples }
+}
+
+// WithRenderer sets how the result is shown in the terminal.
+func WithRenderer(renderer Renderer) ToolOption {
+	return func(t *funcTool) { t.renderer = renderer }
+}
+
+// withApproval marks a built-in tool that asks for approval itself.
+func withApproval() ToolOption {
+	return func(t *funcTool) { t.asksApproval = true }
+}
+
+// WithReadOnly marks a tool that only reads the workspace and sends nothing
+// off the machine. Tools are assumed to have effects unless marked.
+func WithReadOnly() ToolOption {
+	return func(t *funcTool) { t.readOnly = true }
+}
+
+// WithSchema sets the input schema instead of reflecting it from the input
+// type, for tools whose arguments are only known at run time.
+func WithSchema(schema map[string]interface{}) ToolOption {
+	return func(t *funcTool) { t.schema = schema }
+}
+
+// NewTool returns a tool that decodes its input into a T and passes it to
+// fn. When T is a struct, the input schema is reflected from it: fields are
+// named by their json tag, documented by a description tag and required
+// unless tagged omitempty. Input that does not decode into a T is reported
+// as ErrInvalidToolArgs without calling fn.
+func NewTool[T any](name, description string, fn func(ctx context.Context, input T) (string, error), opts ...ToolOption) Tool {
+	return newTool(name, description, func(ctx context.Context, input T) (interface{}, error) {
+		return fn(ctx, input)
+	}, opts...)
+}
+
+// newTool is NewTool for the built-in tools, whose results may be
+// structured for their renderers.
+func newTool[T any](name, description string, fn func(ctx context.Context, input T) (interface{}, error), opts ...ToolOption) *funcTool {
+	t := &funcTool{name: name, description: description}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.schema == nil {
+		var zero T
+		if kind := reflect.TypeOf(&zero).Elem().Kind(); kind == reflect.Struct {
+			schema, err := reflectInputSchema(zero)
+			if err != nil {
+				Warn(fmt.Sprintf("tool %s: %v; accepting any arguments", name, err))
+				schema = permissiveSchema()
+			}
+			t.schema = schema
+		}
+	}
+	t.call = func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		var input T
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+			if err := json.Unmarshal(raw, &input); err != nil {
+				return nil, inputError(err)
+			}
+		}
+		return fn(ctx, input)
+	}
+	return t
+}
+
+// inputError reports input that does not decode, naming the argument
+// rather than the Go type it was decoded into.
+func inputError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("%w: %s must be of type %v, not %s", ErrInvalidToolArgs, typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidToolArgs, err)
+}
+
+// funcTool is the Tool built by NewTool.
+type funcTool struct {
+	name         string
+	description  string
+	summary      string
+	examples     []string
+	renderer     Renderer
+	schema       map[string]interface{}
+	asksApproval bool
+	readOnly     bool
+	call         func(ctx context.Context, input json.RawMessage) (interface{}, error)
+}
+
+func (t *funcTool) Name() string                   { return t.name }
+func (t *funcTool) Description() string            { return t.description }
+func (t *funcTool) Schema() map[string]interface{} { return t.schema }
+func (t *funcTool) Summary() string                { return t.summary }
+func (t *funcTool) Examples() []string             { return t.examples }
+func (t *funcTool) Renderer() Renderer             { return t.renderer }
+func (t *funcTool) AsksApproval() bool             { return t.asksApproval }
+func (t *funcTool) ReadOnly() bool                 { return t.readOnly }
+
+func (t *funcTool) Call(ctx context.Context, input json.RawMessage) (interface{}, error) {
+	return t.call(ctx, input)
+}
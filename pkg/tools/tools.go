@@ -0,0 +1,349 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// registry holds the registered tools by name.
+var registry = map[string]Tool{}
+
+// toolAliases maps legacy tool names onto their current implementation.
+var toolAliases = map[string]string{
+	"get_file_content": "read_file",
+}
+
+// Approve asks the user to confirm a potentially destructive tool action
+// when the context of the call carries no approver; see WithApprover. The
+// CLI replaces it with an interactive prompt; the default denies.
+var Approve = func(action string) bool {
+	return false
+}
+
+// approverKey is the context key of the approver set by WithApprover.
+type approverKey struct{}
+
+// WithApprover returns a context in which tools ask approve, instead of
+// Approve, to confirm their actions, so that concurrent callers can each
+// ask their own user.
+func WithApprover(ctx context.Context, approve func(action string) bool) context.Context {
+	return context.WithValue(ctx, approverKey{}, approve)
+}
+
+// Confirm asks the approver of ctx, or Approve if it has none, to confirm
+// an action.
+func Confirm(ctx context.Context, action string) bool {
+	if approve, ok := ctx.Value(approverKey{}).(func(action string) bool); ok && approve != nil {
+		return approve(action)
+	}
+	return Approve(action)
+}
+
+// Warn reports a non-fatal problem, such as a tool whose input schema could
+// not be generated. The CLI may replace it; the default logs it with slog.
+var Warn = func(message string) {
+	slog.Warn(message)
+}
+
+// RegisterTool adds a tool to the registry, replacing any tool with the same name.
+func RegisterTool(tool Tool) {
+	registry[tool.Name()] = tool
+}
+
+// LookupTool returns the registered tool with the given name.
+func LookupTool(name string) (Tool, bool) {
+	if alias, ok := toolAliases[name]; ok {
+		name = alias
+	}
+	tool, ok := registry[name]
+	return tool, ok
+}
+
+// UnregisterTool removes a tool, so that it is neither offered to the model
+// nor run.
+func UnregisterTool(name string) {
+	delete(registry, name)
+}
+
+// Tools returns all registered tools sorted by name.
+func Tools() []Tool {
+	all := make([]Tool, 0, len(registry))
+	for _, tool := range registry {
+		all = append(all, tool)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name() < all[j].Name() })
+	return all
+}
+
+// ExecuteTool runs the named tool with the given arguments. Tools stop early
+// when ctx is cancelled.
+func ExecuteTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	tool, ok := LookupTool(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+	input, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToolArgs, err)
+	}
+	return tool.Call(ctx, input)
+}
+
+// ToolGrammar selects how the model is asked to format tool calls.
+type ToolGrammar string
+
+const (
+	// GrammarText asks for a line of the form tool: name({...}).
+	GrammarText ToolGrammar = "text"
+	// GrammarJSON asks for a fenced JSON object {"tool": ..., "args": {...}}.
+	GrammarJSON ToolGrammar = "json"
+	// GrammarStrictJSON asks for the same object but only accepts it as the
+	// sole content of a ```json fenced block; JSON in prose is ignored.
+	GrammarStrictJSON ToolGrammar = "json-strict"
+	// GrammarStructured asks for every reply to be one JSON object,
+	// {"action": "tool", ...} or {"action": "answer", ...}, and has Ollama
+	// enforce it with the format parameter (see StructuredFormat). It is for
+	// models without native tool calling that drift from the text formats.
+	GrammarStructured ToolGrammar = "structured"
+)
+
+// ParseToolGrammar returns the grammar with the given name.
+func ParseToolGrammar(name string) (ToolGrammar, error) {
+	switch grammar := ToolGrammar(name); grammar {
+	case GrammarText, GrammarJSON, GrammarStrictJSON, GrammarStructured:
+		return grammar, nil
+	}
+	return "", fmt.Errorf("unknown tool-call format %q (use text, json, json-strict or structured)", name)
+}
+
+// ToolPrompt lists the registered tools using the text grammar.
+func ToolPrompt() string {
+	return ToolPromptFor(GrammarText, false)
+}
+
+// ToolPromptFor lists the registered tools with one-line summaries and
+// explains the calling convention for the grammar, optionally followed by a
+// worked example. Full argument details are available through describe_tools.
+func ToolPromptFor(grammar ToolGrammar, fewShot bool) string {
+	return ToolPromptWith(Tools(), grammar, fewShot)
+}
+
+// ToolPromptWith is ToolPromptFor restricted to the given tools.
+func ToolPromptWith(available []Tool, grammar ToolGrammar, fewShot bool) string {
+	var b strings.Builder
+	b.WriteString("You have access to the following tools:\n")
+	for _, tool := range available {
+		fmt.Fprintf(&b, "- %s: %s\n", tool.Name(), Synopsis(tool))
+	}
+	switch grammar {
+	case GrammarJSON:
+		b.WriteString("\nTo use a tool, reply with a fenced JSON block of the form:\n")
+		b.WriteString("```json\n{\"tool\": \"name\", \"args\": {\"arg\": \"value\"}}\n```\n")
+	case GrammarStrictJSON:
+		b.WriteString("\nTo use a tool, reply with a fenced JSON block of the form:\n")
+		b.WriteString("```json\n{\"tool\": \"name\", \"args\": {\"arg\": \"value\"}}\n```\n")
+		b.WriteString("Each call must be its own ```json block containing only that object. Calls written any other way are ignored.\n")
+	case GrammarStructured:
+		b.WriteString("\nReply with a single JSON object and nothing else. To use a tool:\n")
+		b.WriteString("{\"action\": \"tool\", \"tool\": \"name\", \"args\": {\"arg\": \"value\"}}\n")
+		b.WriteString("To answer the user:\n{\"action\": \"answer\", \"answer\": \"your answer\"}\n")
+		b.WriteString("Earlier tool calls appear in the conversation as tool: name({...}) lines; always reply with the JSON object.\n")
+	default:
+		b.WriteString("\nTo use a tool, reply with a single line of the form:\n")
+		b.WriteString("tool: name({\"arg\": \"value\"})\n")
+	}
+	b.WriteString("Then stop and wait for the tool result before continuing.\n")
+	b.WriteString("Call describe_tools({\"name\": \"tool_name\"}) to see a tool's arguments and examples before using it.")
+	switch grammar {
+	case GrammarJSON, GrammarStrictJSON:
+		b.WriteString(" (Using the JSON block format above.)")
+	case GrammarStructured:
+		b.WriteString(" (Using the JSON object format above.)")
+	}
+	if fewShot {
+		b.WriteString("\n\nExample:\nUser: What does go.mod contain?\nAI: ")
+		b.WriteString(FormatToolCall(grammar, "read_file", `{"path": "go.mod"}`))
+		answer := "go.mod declares the module example.com/app."
+		if grammar == GrammarStructured {
+			answer = `{"action": "answer", "answer": "go.mod declares the module example.com/app."}`
+		}
+		b.WriteString("\nTool result (read_file): \"module example.com/app\"\nAI: " + answer)
+	}
+	return b.String()
+}
+
+// FormatToolCall renders a call in the given grammar; args is a JSON object.
+func FormatToolCall(grammar ToolGrammar, name, args string) string {
+	switch grammar {
+	case GrammarJSON, GrammarStrictJSON:
+		return fmt.Sprintf("```json\n{\"tool\": %q, \"args\": %s}\n```", name, args)
+	case GrammarStructured:
+		return fmt.Sprintf("{\"action\": \"tool\", \"tool\": %q, \"args\": %s}", name, args)
+	}
+	return fmt.Sprintf("tool: %s(%s)", name, args)
+}
+
+// describeToolsInput is the input of describe_tools.
+type describeToolsInput struct {
+	Name string `json:"name,omitempty" description:"the tool to describe; omit to describe every tool"`
+}
+
+func describeTools(ctx context.Context, input describeToolsInput) (interface{}, error) {
+	described := Tools()
+	if input.Name != "" {
+		tool, found := LookupTool(input.Name)
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrToolNotFound, input.Name)
+		}
+		described = []Tool{tool}
+	}
+
+	var b strings.Builder
+	for i, tool := range described {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\n  %s\n", tool.Name(), tool.Description())
+		if tool.Schema() != nil {
+			if schema, err := json.Marshal(tool.Schema()); err == nil {
+				fmt.Fprintf(&b, "  Input schema: %s\n", schema)
+			}
+		}
+		for _, example := range Examples(tool) {
+			fmt.Fprintf(&b, "  Example: tool: %s(%s)\n", tool.Name(), example)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+func init() {
+	RegisterTool(newTool("describe_tools",
+		`Describe the available tools in full, including arguments and examples. Arguments: {"name": "tool_name"}; omit name to describe every tool.`,
+		describeTools,
+		WithExamples(`{"name": "go_doc"}`, `{}`),
+		WithReadOnly()))
+	RegisterTool(newTool("search_docs",
+		`Search the project documentation and source (markdown and Go files) by keyword, tolerating typos. Returns ranked snippets with file and line. Arguments: {"query": "search terms"}`,
+		searchDocs,
+		WithSummary("Search the project documentation and source."),
+		WithExamples(`{"query": "streaming responses"}`),
+		WithRenderer(TableRenderer),
+		WithReadOnly()))
+	RegisterTool(newTool("read_file",
+		`Read the contents of a file in the workspace. Paths may be workspace-relative or absolute; results always use workspace-relative paths. Large files are truncated. Arguments: {"path": "relative/path"}`,
+		readFile,
+		WithSummary("Read the contents of a file in the workspace."),
+		WithExamples(`{"path": "main.go"}`),
+		WithReadOnly()))
+	RegisterTool(newTool("list_files",
+		`List files under a directory in the workspace, recursively. Output is capped; when it is truncated, `+
+			`narrow the path or add a glob. Arguments: {"path": "relative/dir", "glob": "*.go"}; both are optional.`,
+		listFiles,
+		WithSummary("List files in the workspace."),
+		WithExamples(`{"path": "agent"}`, `{"glob": "*.md"}`),
+		WithRenderer(TreeRenderer),
+		WithReadOnly()))
+	RegisterTool(newTool("edit_file",
+		`Edit a file in the workspace by replacing old_str with new_str. old_str must match exactly once. `+
+			`With an empty old_str a new file is created. Several edit_file calls on the same file in one reply are applied in order as one change. `+
+			`Arguments: {"path": "relative/path", "old_str": "text to replace", "new_str": "replacement"}`,
+		editFile,
+		WithSummary("Edit or create a file in the workspace."),
+		WithExamples(`{"path": "main.go", "old_str": "fmt.Println(\"hi\")", "new_str": "fmt.Println(\"hello\")"}`),
+		WithRenderer(DiffRenderer),
+		withApproval()))
+	RegisterTool(newTool("remember",
+		`Save a short fact to long-term memory so it is available in later sessions, e.g. a project convention or a user preference. `+
+			`Arguments: {"note": "one self-contained sentence"}`,
+		rememberTool,
+		WithSummary("Save a fact to long-term memory."),
+		WithExamples(`{"note": "This project wraps errors with fmt.Errorf and %v, not %w."}`)))
+	RegisterTool(newTool("recall",
+		`Search long-term memory for facts saved in earlier sessions. Arguments: {"query": "search terms"}`,
+		recallTool,
+		WithSummary("Search long-term memory."),
+		WithExamples(`{"query": "error handling"}`),
+		WithReadOnly()))
+	RegisterTool(newTool("go_outline",
+		`Outline the Go packages under a directory: package name and doc, files, and the exported declarations without bodies. `+
+			`Arguments: {"path": "relative/dir"}; path defaults to the workspace root.`,
+		outlineTool,
+		WithSummary("Outline the exported API of the Go packages in the workspace."),
+		WithExamples(`{"path": "agent"}`, `{}`),
+		WithReadOnly()))
+	RegisterTool(newTool("go_doc",
+		`Show the documentation and signature of a Go package, type, function or method using "go doc". `+
+			`Arguments: {"symbol": "net/http.Client", "all": false}. Set "all" to true to include all package documentation.`,
+		goDoc,
+		WithSummary("Show Go documentation for a package or symbol."),
+		WithExamples(`{"symbol": "net/http.Client"}`, `{"symbol": "strings", "all": true}`),
+		WithReadOnly()))
+}
+
+// queryInput is the input of the tools that search by query.
+type queryInput struct {
+	Query string `json:"query" description:"search terms"`
+}
+
+func searchDocs(ctx context.Context, input queryInput) (interface{}, error) {
+	query := input.Query
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query must be a non-empty string", ErrInvalidToolArgs)
+	}
+	limit := DocsSettings.MaxResults
+	if limit <= 0 {
+		limit = 5
+	}
+
+	index, err := loadDocIndex(DocsSettings)
+	if err != nil {
+		return nil, err
+	}
+	results := index.Search(query, limit)
+	if len(results) == 0 {
+		return fmt.Sprintf("No documentation found for: %s", query), nil
+	}
+	return results, nil
+}
+
+// maxGoDocOutput caps the go doc output returned to the model.
+const maxGoDocOutput = 16 * 1024
+
+// goDocInput is the input of go_doc.
+type goDocInput struct {
+	Symbol string `json:"symbol" description:"package, type, function or method, e.g. net/http.Client"`
+	All    bool   `json:"all,omitempty" description:"include all package documentation"`
+}
+
+func goDoc(ctx context.Context, input goDocInput) (interface{}, error) {
+	symbol := input.Symbol
+	if strings.TrimSpace(symbol) == "" {
+		return nil, fmt.Errorf("%w: symbol must be a non-empty string", ErrInvalidToolArgs)
+	}
+
+	cmdArgs := []string{"doc"}
+	if input.All {
+		cmdArgs = append(cmdArgs, "-all")
+	}
+	// go doc accepts either "pkg.Symbol" or "pkg Symbol", so split on spaces.
+	cmdArgs = append(cmdArgs, strings.Fields(symbol)...)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "go", cmdArgs...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("go doc %s failed: %v: %s", symbol, err, strings.TrimSpace(string(output)))
+	}
+
+	doc := string(output)
+	if len(doc) > maxGoDocOutput {
+		doc = doc[:maxGoDocOutput] + "\n... (truncated)"
+	}
+	return doc, nil
+}
@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TranscribeConfig configures speech-to-text for transcribe_audio and
+// -transcribe. URL is a whisper.cpp server's /inference endpoint or an
+// OpenAI-compatible /v1/audio/transcriptions endpoint; both take the audio
+// as a multipart upload and answer {"text": ...}. Model is sent for servers
+// that serve several (whisper-1 for OpenAI), and APIKey, if set, as a
+// bearer token. Language is an ISO 639-1 code; empty lets the server detect
+// it.
+type TranscribeConfig struct {
+	URL      string        `yaml:"url"`
+	Model    string        `yaml:"model"`
+	APIKey   string        `yaml:"api_key"`
+	Language string        `yaml:"language"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// TranscribeSettings is used by Transcribe. The CLI sets it from the config
+// file; the default is a whisper.cpp server on its default port.
+var TranscribeSettings = TranscribeConfig{URL: "http://127.0.0.1:8080/inference", Timeout: 10 * time.Minute}
+
+// maxAudioSize is the largest file sent for transcription; OpenAI's limit
+// is 25 MB.
+const maxAudioSize = 100 << 20
+
+// Transcribe sends an audio file to the transcription endpoint and returns
+// its text.
+func Transcribe(ctx context.Context, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxAudioSize {
+		return "", fmt.Errorf("%s is too large to transcribe (%d bytes; the limit is %d)", path, info.Size(), maxAudioSize)
+	}
+	audio, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to build transcription request: %v", err)
+	}
+	part.Write(audio)
+	fields := map[string]string{"response_format": "json", "model": TranscribeSettings.Model, "language": TranscribeSettings.Language}
+	for name, value := range fields {
+		if value != "" {
+			form.WriteField(name, value)
+		}
+	}
+	form.Close()
+
+	timeout := TranscribeSettings.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", TranscribeSettings.URL, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create transcription request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if key := os.ExpandEnv(TranscribeSettings.APIKey); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	stop := reportElapsed("transcribing " + filepath.Base(path))
+	resp, err := http.DefaultClient.Do(req)
+	stop()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("transcription of %s timed out after %s", path, timeout)
+		}
+		return "", fmt.Errorf("failed to reach the transcription server at %s (is whisper.cpp's server running, or is transcription.url set?): %v", TranscribeSettings.URL, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read transcription response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		// Some servers answer in plain text whatever the format asked for.
+		return strings.TrimSpace(string(data)), nil
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// transcribeAudioInput is the input of transcribe_audio.
+type transcribeAudioInput struct {
+	Path string `json:"path" description:"workspace-relative or absolute path of a WAV, MP3, M4A, OGG or FLAC file"`
+}
+
+func transcribeAudio(ctx context.Context, input transcribeAudioInput) (interface{}, error) {
+	if input.Path == "" {
+		return nil, fmt.Errorf("%w: path must be a non-empty string", ErrInvalidToolArgs)
+	}
+	resolved, err := resolveWorkspacePath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	text, err := Transcribe(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return fmt.Sprintf("%s contains no recognizable speech.", displayPath(resolved)), nil
+	}
+	return text, nil
+}
+
+// RegisterTranscribeAudio adds the transcribe_audio tool. It is only
+// registered when transcription is configured, since it needs a server.
+func RegisterTranscribeAudio() {
+	RegisterTool(newTool("transcribe_audio",
+		`Transcribe speech in an audio file in the workspace, such as a voice memo or meeting recording, and return the text. `+
+			`Arguments: {"path": "file"}`,
+		transcribeAudio,
+		WithSummary("Transcribe an audio file to text."),
+		WithExamples(`{"path": "notes/standup.wav"}`)))
+}
@@ -0,0 +1,542 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// embedWorkers is the number of files chunked and embedded concurrently.
+const embedWorkers = 4
+
+// watchDebounce waits for a burst of file events to settle before updating.
+const watchDebounce = 500 * time.Millisecond
+
+// vectorManifest records what the vector store holds for each file, so only
+// files whose content changed are re-embedded and only chunks whose text
+// changed need new vectors.
+type vectorManifest struct {
+	Root    string                 `json:"root"`
+	Model   string                 `json:"model"`
+	Store   string                 `json:"store"`
+	Files   map[string]indexedFile `json:"files"`
+	BuiltAt time.Time              `json:"built_at"`
+}
+
+// indexedFile is the indexed state of one file.
+type indexedFile struct {
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+	Chunks  []string  `json:"chunks"` // chunk ids in the vector store
+}
+
+// IndexStatus describes the embeddings index for the /index command.
+type IndexStatus struct {
+	Root      string
+	Store     string
+	Files     int
+	Chunks    int
+	Pending   int // files waiting to be (re-)embedded
+	Indexing  bool
+	Watching  bool
+	Updated   time.Time
+	Embedded  int // chunks embedded by the last update
+	Reused    int // chunks whose vectors were reused by the last update
+	LastError string
+}
+
+// vectorIndex keeps a VectorStore in sync with the files of a workspace.
+type vectorIndex struct {
+	root         string
+	model        string
+	extensions   []string
+	store        VectorStore
+	manifestPath string
+
+	syncMu   sync.Mutex // serializes updates
+	mu       sync.Mutex // guards manifest and status
+	manifest *vectorManifest
+	status   IndexStatus
+}
+
+var (
+	activeIndexMu sync.Mutex
+	activeIndex   *vectorIndex
+)
+
+// currentVectorIndex returns the index for EmbedSettings. Unless the
+// workspace is being watched, it is brought up to date first.
+func currentVectorIndex(ctx context.Context) (*vectorIndex, error) {
+	idx, err := openActiveIndex()
+	if err != nil {
+		return nil, err
+	}
+	idx.mu.Lock()
+	watching := idx.status.Watching
+	idx.mu.Unlock()
+	if !watching {
+		if err := idx.sync(ctx, false, true); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// openActiveIndex opens the index for EmbedSettings once per process.
+func openActiveIndex() (*vectorIndex, error) {
+	activeIndexMu.Lock()
+	defer activeIndexMu.Unlock()
+	if !embeddingsEnabled {
+		return nil, fmt.Errorf("semantic search is not configured; add an embeddings section to the config file")
+	}
+	if activeIndex != nil {
+		return activeIndex, nil
+	}
+	idx, err := openVectorIndex(EmbedSettings)
+	if err != nil {
+		return nil, err
+	}
+	activeIndex = idx
+	return idx, nil
+}
+
+func openVectorIndex(cfg EmbedConfig) (*vectorIndex, error) {
+	root, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embeddings directory: %v", err)
+	}
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = defaultDocExtensions
+	}
+	indexPath := cfg.IndexPath
+	if indexPath == "" {
+		indexPath = defaultVectorIndexPath(root, cfg.Model)
+	}
+	if indexPath == "" {
+		return nil, fmt.Errorf("no location for the embeddings index; set embeddings.index")
+	}
+	store, err := NewVectorStore(cfg.Store, indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &vectorIndex{
+		root:         root,
+		model:        cfg.Model,
+		extensions:   extensions,
+		store:        store,
+		manifestPath: indexPath + ".manifest",
+	}
+	manifest, err := readVectorManifest(idx.manifestPath)
+	if err != nil || manifest.Root != root || manifest.Model != cfg.Model || manifest.Store != store.String() {
+		// Vectors from another model or store can't be reused.
+		manifest = &vectorManifest{Root: root, Model: cfg.Model, Store: store.String(), Files: map[string]indexedFile{}}
+		if err := store.Reset(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	idx.manifest = manifest
+	idx.status = IndexStatus{Root: root, Store: store.String(), Updated: manifest.BuiltAt}
+	idx.countLocked()
+	return idx, nil
+}
+
+// defaultVectorIndexPath stores indexes under ~/.cache/goclient keyed by the
+// root and the embedding model.
+func defaultVectorIndexPath(root, model string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(root + "\x00" + model))
+	return filepath.Join(cacheDir, "goclient", "embeddings-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// chunkID identifies a chunk by its embedded text, so a chunk that only
+// moved within its file keeps its vector.
+func chunkID(chunk DocChunk) string {
+	sum := sha256.Sum256([]byte(embedText(chunk)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// fileUpdate is the new state of a changed file, computed by a worker.
+type fileUpdate struct {
+	path     string
+	file     indexedFile
+	ids      []string
+	chunks   []DocChunk
+	vectors  [][]float32
+	embedded int
+	reused   int
+	err      error
+}
+
+// sync updates the store for files added, changed or removed since the last
+// update. With force every file is re-embedded. Progress is reported only
+// for foreground updates.
+func (idx *vectorIndex) sync(ctx context.Context, force, foreground bool) error {
+	idx.syncMu.Lock()
+	defer idx.syncMu.Unlock()
+
+	files, err := scanDocFiles(idx.root, idx.extensions)
+	if err != nil {
+		return idx.finish(err)
+	}
+
+	idx.mu.Lock()
+	var changed, removed []string
+	for path, mod := range files {
+		if old, ok := idx.manifest.Files[path]; force || !ok || !old.ModTime.Equal(mod) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range idx.manifest.Files {
+		if _, ok := files[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		idx.mu.Unlock()
+		return nil
+	}
+	sort.Strings(changed)
+	idx.status.Indexing = true
+	idx.status.Pending = len(changed)
+	previous := map[string]indexedFile{}
+	for _, path := range append(changed, removed...) {
+		previous[path] = idx.manifest.Files[path]
+	}
+	idx.mu.Unlock()
+
+	// Chunk and embed changed files with a pool of workers.
+	jobs := make(chan string)
+	updates := make(chan fileUpdate)
+	var wg sync.WaitGroup
+	for i := 0; i < embedWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				updates <- idx.embedFile(ctx, path, files[path], previous[path], force)
+			}
+		}()
+	}
+	go func() {
+		for _, path := range changed {
+			jobs <- path
+		}
+		close(jobs)
+		wg.Wait()
+		close(updates)
+	}()
+
+	var firstErr error
+	embedded, reused, done := 0, 0, 0
+	for update := range updates {
+		done++
+		if foreground {
+			OnProgress(Progress{Task: "embedding workspace", Done: done, Total: len(changed), Current: update.path})
+		}
+		if update.err == nil {
+			update.err = idx.apply(ctx, update, previous[update.path])
+		}
+		if update.err != nil {
+			if firstErr == nil {
+				firstErr = update.err
+			}
+			continue
+		}
+		embedded += update.embedded
+		reused += update.reused
+		idx.mu.Lock()
+		idx.status.Pending--
+		idx.mu.Unlock()
+	}
+
+	for _, path := range removed {
+		if err := idx.store.Delete(ctx, previous[path].Chunks); err != nil && firstErr == nil {
+			firstErr = err
+			continue
+		}
+		idx.mu.Lock()
+		delete(idx.manifest.Files, path)
+		idx.mu.Unlock()
+	}
+
+	idx.mu.Lock()
+	idx.manifest.BuiltAt = time.Now()
+	idx.status.Updated = idx.manifest.BuiltAt
+	idx.status.Embedded, idx.status.Reused = embedded, reused
+	idx.countLocked()
+	err = writeVectorManifest(idx.manifestPath, idx.manifest)
+	idx.mu.Unlock()
+	if firstErr == nil {
+		firstErr = err
+	}
+	return idx.finish(firstErr)
+}
+
+// embedFile chunks a changed file and embeds the chunks that are not already
+// in the store.
+func (idx *vectorIndex) embedFile(ctx context.Context, path string, modTime time.Time, old indexedFile, force bool) fileUpdate {
+	update := fileUpdate{path: path, file: indexedFile{ModTime: modTime}}
+	fullPath := filepath.Join(idx.root, filepath.FromSlash(path))
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		update.err = fmt.Errorf("failed to read %s: %v", path, err)
+		return update
+	}
+	sum := sha256.Sum256(data)
+	update.file.Hash = hex.EncodeToString(sum[:])
+	if !force && update.file.Hash == old.Hash {
+		// Touched but not modified: keep the chunks as they are.
+		update.file.Chunks = old.Chunks
+		update.reused = len(old.Chunks)
+		return update
+	}
+
+	chunks, err := chunkFile(fullPath, path)
+	if err != nil {
+		update.err = err
+		return update
+	}
+	seen := map[string]bool{}
+	for _, chunk := range chunks {
+		id := chunkID(chunk)
+		if seen[id] {
+			continue // identical chunks in one file share a vector
+		}
+		seen[id] = true
+		update.ids = append(update.ids, id)
+		update.chunks = append(update.chunks, chunk)
+	}
+	update.file.Chunks = update.ids
+
+	existing := map[string][]float32{}
+	if !force && len(old.Chunks) > 0 {
+		if existing, err = idx.store.Vectors(ctx, old.Chunks); err != nil {
+			update.err = err
+			return update
+		}
+	}
+	update.vectors = make([][]float32, len(update.ids))
+	var missing []int
+	for i, id := range update.ids {
+		if vector, ok := existing[id]; ok {
+			update.vectors[i] = vector
+			update.reused++
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	for start := 0; start < len(missing); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		inputs := make([]string, 0, end-start)
+		for _, i := range missing[start:end] {
+			inputs = append(inputs, embedText(update.chunks[i]))
+		}
+		vectors, err := Embed(ctx, idx.model, inputs)
+		if err != nil {
+			update.err = err
+			return update
+		}
+		for j, i := range missing[start:end] {
+			update.vectors[i] = vectors[j]
+		}
+		update.embedded += len(inputs)
+	}
+	return update
+}
+
+// apply writes a file update to the store and the manifest.
+func (idx *vectorIndex) apply(ctx context.Context, update fileUpdate, old indexedFile) error {
+	if len(update.ids) > 0 {
+		if err := idx.store.Upsert(ctx, update.ids, update.chunks, update.vectors); err != nil {
+			return err
+		}
+	}
+	if update.file.Hash != old.Hash || len(update.ids) > 0 {
+		keep := map[string]bool{}
+		for _, id := range update.file.Chunks {
+			keep[id] = true
+		}
+		var stale []string
+		for _, id := range old.Chunks {
+			if !keep[id] {
+				stale = append(stale, id)
+			}
+		}
+		if err := idx.store.Delete(ctx, stale); err != nil {
+			return err
+		}
+	}
+	idx.mu.Lock()
+	idx.manifest.Files[update.path] = update.file
+	idx.mu.Unlock()
+	return nil
+}
+
+// finish records the outcome of an update.
+func (idx *vectorIndex) finish(err error) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.status.Indexing = false
+	idx.status.LastError = ""
+	if err != nil {
+		idx.status.LastError = err.Error()
+	}
+	return err
+}
+
+// countLocked refreshes the file and chunk counts; idx.mu must be held.
+func (idx *vectorIndex) countLocked() {
+	idx.status.Files = len(idx.manifest.Files)
+	idx.status.Chunks = 0
+	for _, file := range idx.manifest.Files {
+		idx.status.Chunks += len(file.Chunks)
+	}
+}
+
+// watch re-syncs the index in the background whenever files under the root
+// change, until ctx is done.
+func (idx *vectorIndex) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch workspace: %v", err)
+	}
+	addDirs := func(dir string) {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if path != idx.root && (skippedDirs[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			watcher.Add(path)
+			return nil
+		})
+	}
+	addDirs(idx.root)
+
+	idx.mu.Lock()
+	idx.status.Watching = true
+	idx.mu.Unlock()
+
+	go func() {
+		defer watcher.Close()
+		defer func() {
+			idx.mu.Lock()
+			idx.status.Watching = false
+			idx.mu.Unlock()
+		}()
+
+		idx.sync(ctx, false, false)
+		var timer *time.Timer
+		var fire <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addDirs(event.Name)
+					}
+				}
+				if timer == nil {
+					timer = time.NewTimer(watchDebounce)
+				} else {
+					timer.Reset(watchDebounce)
+				}
+				fire = timer.C
+			case <-fire:
+				fire = nil
+				idx.sync(ctx, false, false)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				idx.finish(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// WatchWorkspace indexes the workspace for semantic search in the background
+// and keeps the index up to date as files change, until ctx is done.
+func WatchWorkspace(ctx context.Context) error {
+	idx, err := openActiveIndex()
+	if err != nil {
+		return err
+	}
+	return idx.watch(ctx)
+}
+
+// ReindexWorkspace updates the embeddings index now; with force every file
+// is re-embedded.
+func ReindexWorkspace(ctx context.Context, force bool) error {
+	idx, err := openActiveIndex()
+	if err != nil {
+		return err
+	}
+	return idx.sync(ctx, force, true)
+}
+
+// CurrentIndexStatus returns the status of the embeddings index.
+func CurrentIndexStatus() (IndexStatus, error) {
+	idx, err := openActiveIndex()
+	if err != nil {
+		return IndexStatus{}, err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.status, nil
+}
+
+func readVectorManifest(path string) (*vectorManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest vectorManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Files == nil {
+		manifest.Files = map[string]indexedFile{}
+	}
+	return &manifest, nil
+}
+
+func writeVectorManifest(path string, manifest *vectorManifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create index directory: %v", err)
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode embeddings manifest: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write embeddings manifest: %v", err)
+	}
+	return nil
+}
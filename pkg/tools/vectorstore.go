@@ -0,0 +1,411 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VectorStore keeps embedded chunks, keyed by chunk id, and finds the ones
+// closest to a query.
+type VectorStore interface {
+	// Upsert adds or replaces chunks and their vectors.
+	Upsert(ctx context.Context, ids []string, chunks []DocChunk, vectors [][]float32) error
+	// Delete removes chunks; unknown ids are ignored.
+	Delete(ctx context.Context, ids []string) error
+	// Vectors returns the stored vectors of the given chunks that exist.
+	Vectors(ctx context.Context, ids []string) (map[string][]float32, error)
+	// Search returns up to limit chunks ordered by similarity to query.
+	Search(ctx context.Context, query []float32, limit int) ([]VectorHit, error)
+	// Reset removes everything from the store.
+	Reset(ctx context.Context) error
+	// String identifies the store; the index is rebuilt when it changes.
+	String() string
+}
+
+// VectorHit is a chunk returned by a VectorStore with its cosine similarity.
+type VectorHit struct {
+	Chunk DocChunk
+	Score float64
+}
+
+// VectorStoreConfig selects a VectorStore. Backend is "file" (the default), a
+// JSON file searched in memory, or "qdrant", a Qdrant server at URL.
+type VectorStoreConfig struct {
+	Backend    string `yaml:"backend"`
+	URL        string `yaml:"url"`
+	Collection string `yaml:"collection"`
+	APIKey     string `yaml:"api_key"`
+}
+
+// NewVectorStore creates the store described by cfg. path is where the file
+// backend keeps its data.
+func NewVectorStore(cfg VectorStoreConfig, path string) (VectorStore, error) {
+	switch cfg.Backend {
+	case "", "file":
+		return &FileVectorStore{Path: path}, nil
+	case "qdrant":
+		store := &QdrantStore{URL: cfg.URL, Collection: cfg.Collection, APIKey: cfg.APIKey}
+		if store.URL == "" {
+			store.URL = "http://localhost:6333"
+		}
+		if store.Collection == "" {
+			store.Collection = "goclient"
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown vector store backend %q (use file or qdrant)", cfg.Backend)
+	}
+}
+
+// FileVectorStore keeps vectors in a JSON file and searches them by brute
+// force, which is fast enough for repositories of a few thousand chunks.
+type FileVectorStore struct {
+	Path string
+
+	mu      sync.Mutex
+	entries map[string]fileVectorEntry // nil until loaded
+}
+
+type fileVectorEntry struct {
+	Chunk  DocChunk  `json:"chunk"`
+	Vector []float32 `json:"vector"`
+}
+
+func (s *FileVectorStore) String() string { return "file:" + s.Path }
+
+// load reads the file on first use; s.mu must be held.
+func (s *FileVectorStore) load() error {
+	if s.entries != nil {
+		return nil
+	}
+	s.entries = map[string]fileVectorEntry{}
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read embeddings index: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		s.entries = map[string]fileVectorEntry{}
+		return fmt.Errorf("failed to parse embeddings index: %v", err)
+	}
+	return nil
+}
+
+// save writes the entries back to the file; s.mu must be held.
+func (s *FileVectorStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create index directory: %v", err)
+	}
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode embeddings index: %v", err)
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write embeddings index: %v", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("failed to write embeddings index: %v", err)
+	}
+	return nil
+}
+
+func (s *FileVectorStore) Upsert(ctx context.Context, ids []string, chunks []DocChunk, vectors [][]float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		s.entries[id] = fileVectorEntry{Chunk: chunks[i], Vector: vectors[i]}
+	}
+	return s.save()
+}
+
+func (s *FileVectorStore) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(s.entries, id)
+	}
+	return s.save()
+}
+
+func (s *FileVectorStore) Vectors(ctx context.Context, ids []string) (map[string][]float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	vectors := map[string][]float32{}
+	for _, id := range ids {
+		if entry, ok := s.entries[id]; ok {
+			vectors[id] = entry.Vector
+		}
+	}
+	return vectors, nil
+}
+
+func (s *FileVectorStore) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string]fileVectorEntry{}
+	return s.save()
+}
+
+func (s *FileVectorStore) Search(ctx context.Context, query []float32, limit int) ([]VectorHit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	hits := make([]VectorHit, 0, len(s.entries))
+	for _, entry := range s.entries {
+		hits = append(hits, VectorHit{Chunk: entry.Chunk, Score: cosine(query, entry.Vector)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Chunk.Path != hits[j].Chunk.Path {
+			return hits[i].Chunk.Path < hits[j].Chunk.Path
+		}
+		return hits[i].Chunk.Line < hits[j].Chunk.Line
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// QdrantStore keeps vectors in a collection on a Qdrant server, using its
+// REST API. The collection is created on the first upsert.
+type QdrantStore struct {
+	URL        string
+	Collection string
+	APIKey     string
+
+	ready bool // the collection is known to exist
+}
+
+// qdrantBatchSize is the number of points sent per upsert request.
+const qdrantBatchSize = 256
+
+func (s *QdrantStore) String() string { return "qdrant:" + s.URL + "/" + s.Collection }
+
+func (s *QdrantStore) collection() string {
+	return "/collections/" + url.PathEscape(s.Collection)
+}
+
+// pointID converts a chunk id (hex) into the UUID form Qdrant accepts.
+func pointID(id string) string {
+	id = (id + strings.Repeat("0", 32))[:32]
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:32]
+}
+
+// chunkIDFromPoint reverses pointID.
+func chunkIDFromPoint(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+// ensureCollection creates the collection for vectors of the given size
+// unless it exists.
+func (s *QdrantStore) ensureCollection(ctx context.Context, size int) error {
+	if s.ready {
+		return nil
+	}
+	err := s.do(ctx, "GET", s.collection(), nil, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		create := map[string]interface{}{"vectors": map[string]interface{}{"size": size, "distance": "Cosine"}}
+		err = s.do(ctx, "PUT", s.collection(), create, nil)
+	}
+	if err != nil {
+		return err
+	}
+	s.ready = true
+	return nil
+}
+
+func (s *QdrantStore) Upsert(ctx context.Context, ids []string, chunks []DocChunk, vectors [][]float32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := s.ensureCollection(ctx, len(vectors[0])); err != nil {
+		return err
+	}
+	for start := 0; start < len(ids); start += qdrantBatchSize {
+		end := start + qdrantBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		points := make([]map[string]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			points = append(points, map[string]interface{}{
+				"id":     pointID(ids[i]),
+				"vector": vectors[i],
+				"payload": map[string]interface{}{
+					"path":    chunks[i].Path,
+					"line":    chunks[i].Line,
+					"heading": chunks[i].Heading,
+					"text":    chunks[i].Text,
+				},
+			})
+		}
+		if err := s.do(ctx, "PUT", s.collection()+"/points?wait=true", map[string]interface{}{"points": points}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *QdrantStore) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	points := make([]string, 0, len(ids))
+	for _, id := range ids {
+		points = append(points, pointID(id))
+	}
+	err := s.do(ctx, "POST", s.collection()+"/points/delete?wait=true", map[string]interface{}{"points": points}, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *QdrantStore) Vectors(ctx context.Context, ids []string) (map[string][]float32, error) {
+	vectors := map[string][]float32{}
+	if len(ids) == 0 {
+		return vectors, nil
+	}
+	points := make([]string, 0, len(ids))
+	for _, id := range ids {
+		points = append(points, pointID(id))
+	}
+	var response struct {
+		Result []struct {
+			ID     string    `json:"id"`
+			Vector []float32 `json:"vector"`
+		} `json:"result"`
+	}
+	request := map[string]interface{}{"ids": points, "with_vector": true, "with_payload": false}
+	err := s.do(ctx, "POST", s.collection()+"/points", request, &response)
+	if errors.Is(err, errQdrantNotFound) {
+		return vectors, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range response.Result {
+		vectors[chunkIDFromPoint(r.ID)] = r.Vector
+	}
+	return vectors, nil
+}
+
+func (s *QdrantStore) Reset(ctx context.Context) error {
+	s.ready = false
+	err := s.do(ctx, "DELETE", s.collection(), nil, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *QdrantStore) Search(ctx context.Context, query []float32, limit int) ([]VectorHit, error) {
+	var response struct {
+		Result []struct {
+			Score   float64  `json:"score"`
+			Payload DocChunk `json:"payload"`
+		} `json:"result"`
+	}
+	request := map[string]interface{}{"vector": query, "limit": limit, "with_payload": true}
+	err := s.do(ctx, "POST", s.collection()+"/points/search", request, &response)
+	if errors.Is(err, errQdrantNotFound) {
+		return []VectorHit{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]VectorHit, 0, len(response.Result))
+	for _, r := range response.Result {
+		hits = append(hits, VectorHit{Chunk: r.Payload, Score: r.Score})
+	}
+	return hits, nil
+}
+
+// errQdrantNotFound is returned by do for a 404, e.g. a missing collection.
+var errQdrantNotFound = errors.New("qdrant: not found")
+
+// do sends a request to Qdrant and decodes the response into out.
+func (s *QdrantStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode qdrant request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.URL, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create qdrant request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("api-key", s.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach qdrant at %s: %v", s.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errQdrantNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("qdrant %s %s failed with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode qdrant response: %v", err)
+		}
+	}
+	return nil
+}
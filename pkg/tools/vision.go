@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gherlein/goclient/pkg/provider"
+)
+
+// VisionConfig configures view_image. Model is the vision model that
+// describes images, such as llava or llama3.2-vision; it need not be the
+// chat's model, so a text-only model can still reason about screenshots
+// and diagrams. Prompt replaces the default instructions it is given.
+type VisionConfig struct {
+	Model  string `yaml:"model"`
+	Prompt string `yaml:"prompt"`
+}
+
+// VisionSettings is used by view_image. The CLI sets it from the config
+// file.
+var VisionSettings = VisionConfig{
+	Prompt: "Describe this image in detail for someone who cannot see it. Transcribe any text, code, error messages or labels exactly.",
+}
+
+// maxImageSize is the largest image view_image sends to the model.
+const maxImageSize = 20 << 20
+
+// viewImageInput is the input of view_image.
+type viewImageInput struct {
+	Path     string `json:"path" description:"workspace-relative or absolute path of a PNG, JPEG, GIF, WebP or BMP image"`
+	Question string `json:"question,omitempty" description:"what to look for in the image; omit for a full description"`
+}
+
+func viewImage(ctx context.Context, input viewImageInput) (interface{}, error) {
+	if input.Path == "" {
+		return nil, fmt.Errorf("%w: path must be a non-empty string", ErrInvalidToolArgs)
+	}
+	resolved, err := resolveWorkspacePath(input.Path)
+	if err != nil {
+		return nil, err
+	}
+	path := displayPath(resolved)
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxImageSize {
+		return nil, fmt.Errorf("%s is too large to view (%d bytes; the limit is %d)", path, info.Size(), maxImageSize)
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, pathError(err))
+	}
+	if kind := http.DetectContentType(data); !strings.HasPrefix(kind, "image/") {
+		return nil, fmt.Errorf("%w: %s is not an image (%s)", ErrInvalidToolArgs, path, kind)
+	}
+	prompt := VisionSettings.Prompt
+	if strings.TrimSpace(input.Question) != "" {
+		prompt += "\n\nIn particular: " + input.Question
+	}
+	description, err := provider.Complete(ctx, &provider.Ollama{}, provider.Request{
+		Model:  VisionSettings.Model,
+		Prompt: prompt,
+		Images: []string{base64.StdEncoding.EncodeToString(data)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s could not describe %s: %w", VisionSettings.Model, path, err)
+	}
+	return strings.TrimSpace(description), nil
+}
+
+// RegisterViewImage adds the view_image tool. It is only registered when a
+// vision model is configured, since the chat's model may not read images.
+func RegisterViewImage() {
+	RegisterTool(newTool("view_image",
+		`Look at an image file in the workspace, such as a screenshot or diagram: a vision model describes it and the description is returned. `+
+			`Arguments: {"path": "file", "question": "what to look for"}`,
+		viewImage,
+		WithSummary("Describe an image file with a vision model."),
+		WithExamples(`{"path": "docs/architecture.png"}`, `{"path": "screenshot.png", "question": "what does the error dialog say?"}`),
+		WithReadOnly()))
+}
@@ -0,0 +1,321 @@
+// Package tracing records spans for agent turns, model requests, tool calls
+// and approvals, and exports them over OTLP/HTTP (JSON) to an OpenTelemetry
+// collector. Until Configure is called, Start returns a nil span, whose
+// methods do nothing, so instrumented code costs nothing when tracing is
+// off:
+//
+//	ctx, span := tracing.Start(ctx, "tool read_file", "tool.name", "read_file")
+//	result, err := run(ctx)
+//	span.End(err)
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter batches finished spans and posts them to an OTLP/HTTP endpoint.
+type Exporter struct {
+	Endpoint string            // e.g. http://localhost:4318/v1/traces
+	Headers  map[string]string // sent with every request, e.g. for authentication
+	Service  string            // the service.name resource attribute
+
+	client  *http.Client
+	mu      sync.Mutex
+	pending []otlpSpan
+	timer   *time.Timer
+	failed  bool // the last export failed; warn again only after a success
+}
+
+// exporter receives finished spans; nil when tracing is off.
+var exporter *Exporter
+
+// Batching: spans are sent every batchDelay, or as soon as batchSize are
+// waiting.
+const (
+	batchDelay = 5 * time.Second
+	batchSize  = 512
+)
+
+// Configure sends spans to e from now on.
+func Configure(e *Exporter) {
+	if e.Service == "" {
+		e.Service = "goclient"
+	}
+	e.client = &http.Client{Timeout: 10 * time.Second}
+	exporter = e
+}
+
+// ConfigureFromEnv turns tracing on when the standard OpenTelemetry
+// variables name an endpoint: OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or
+// OTEL_EXPORTER_OTLP_ENDPOINT with /v1/traces appended. It also reads
+// OTEL_EXPORTER_OTLP_HEADERS (key=value pairs separated by commas) and
+// OTEL_SERVICE_NAME, and leaves tracing off if OTEL_TRACES_EXPORTER is none.
+func ConfigureFromEnv() error {
+	if os.Getenv("OTEL_TRACES_EXPORTER") == "none" || os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return nil
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/json" {
+		return fmt.Errorf("OTLP protocol %s is not supported; use http/json", protocol)
+	}
+	headers := map[string]string{}
+	for _, list := range []string{os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")} {
+		for _, pair := range strings.Split(list, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			if unescaped, err := url.QueryUnescape(value); err == nil {
+				value = unescaped
+			}
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	Configure(&Exporter{Endpoint: endpoint, Headers: headers, Service: os.Getenv("OTEL_SERVICE_NAME")})
+	return nil
+}
+
+// Enabled reports whether spans are exported.
+func Enabled() bool {
+	return exporter != nil
+}
+
+// Shutdown sends the spans still waiting. Call it before the program exits.
+func Shutdown() {
+	if exporter != nil {
+		exporter.flush()
+	}
+}
+
+// Span is an operation being traced. A nil *Span is valid and records
+// nothing.
+type Span struct {
+	trace  [16]byte
+	id     [8]byte
+	parent [8]byte
+	name   string
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs []otlpAttribute
+	ended bool
+}
+
+type spanKey struct{}
+
+// Start starts a span, a child of the span in ctx if there is one, and
+// returns a context carrying it. attrs are key, value pairs.
+func Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, *Span) {
+	return StartAt(ctx, name, time.Now(), attrs...)
+}
+
+// StartAt is Start for a span that started at a time already past.
+func StartAt(ctx context.Context, name string, start time.Time, attrs ...interface{}) (context.Context, *Span) {
+	if exporter == nil {
+		return ctx, nil
+	}
+	span := &Span{name: name, start: start}
+	if parent := FromContext(ctx); parent != nil {
+		span.trace, span.parent = parent.trace, parent.id
+	} else {
+		rand.Read(span.trace[:])
+	}
+	rand.Read(span.id[:])
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SetAttributes adds key, value pairs to the span. Values are strings,
+// integers, floats or booleans; others are formatted with fmt.
+func (s *Span) SetAttributes(attrs ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(attrs); i += 2 {
+		key, _ := attrs[i].(string)
+		s.attrs = append(s.attrs, otlpAttribute{Key: key, Value: attributeValue(attrs[i+1])})
+	}
+}
+
+// End ends the span, marking it failed if err is not nil.
+func (s *Span) End(err error) {
+	s.EndAt(time.Now(), err)
+}
+
+// EndAt is End for a span that ended at a time already past. Only the first
+// call ends the span.
+func (s *Span) EndAt(end time.Time, err error) {
+	if s == nil || exporter == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	span := otlpSpan{
+		TraceID:    hex.EncodeToString(s.trace[:]),
+		SpanID:     hex.EncodeToString(s.id[:]),
+		Name:       s.name,
+		Kind:       1, // internal
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(end.UnixNano(), 10),
+		Attributes: s.attrs,
+	}
+	s.mu.Unlock()
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if err != nil {
+		span.Status = &otlpStatus{Code: 2, Message: err.Error()} // error
+	}
+	exporter.add(span)
+}
+
+func (e *Exporter) add(span otlpSpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(e.pending, span)
+	switch {
+	case len(e.pending) >= batchSize:
+		go e.flush()
+	case e.timer == nil:
+		e.timer = time.AfterFunc(batchDelay, e.flush)
+	}
+}
+
+// flush posts the waiting spans. A failed export is logged and its spans
+// are dropped.
+func (e *Exporter) flush() {
+	e.mu.Lock()
+	spans := e.pending
+	e.pending = nil
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	err := e.export(spans)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && !e.failed {
+		slog.Warn(fmt.Sprintf("could not export traces to %s: %v", e.Endpoint, err))
+	}
+	e.failed = err != nil
+}
+
+func (e *Exporter) export(spans []otlpSpan) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: attributeValue(e.Service)}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/gherlein/goclient"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// The OTLP/JSON encoding of a span.
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func attributeValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case time.Duration:
+		return map[string]interface{}{"doubleValue": v.Seconds()}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}